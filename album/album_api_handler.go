@@ -0,0 +1,233 @@
+package album
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"file-pub/image"
+	"file-pub/internal/common"
+)
+
+// apiAlbumsPath is the prefix of the versioned JSON albums API
+const apiAlbumsPath = "/api/v1/albums"
+
+// maxJSONBodySize caps JSON request bodies
+const maxJSONBodySize = 64 << 10
+
+// albumListResponse is the JSON body returned when listing albums
+type albumListResponse struct {
+	Albums []Album `json:"albums"`
+	Count  int     `json:"count"`
+}
+
+// createAlbumRequest is the JSON body accepted when creating an album
+type createAlbumRequest struct {
+	Title       string `json:"title"`
+	Description string `json:"description"`
+}
+
+// imageIDsRequest is the JSON body accepted when adding or reordering images
+type imageIDsRequest struct {
+	ImageIDs []string `json:"image_ids"`
+}
+
+// HandleAPIAlbums handles /api/v1/albums: GET lists albums, POST creates one
+func (handler *AlbumHandler) HandleAPIAlbums(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		handler.apiListAlbums(w, r)
+	case http.MethodPost:
+		handler.apiCreateAlbum(w, r)
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		common.WriteJSONError(w, http.StatusMethodNotAllowed, "method_not_allowed", "Method not allowed")
+	}
+}
+
+// HandleAPIAlbum handles /api/v1/albums/{id}: GET returns the album with its
+// images, PATCH updates it and DELETE removes it. /api/v1/albums/{id}/images
+// adds images with POST and reorders them with PUT, and
+// /api/v1/albums/{id}/images/{imageID} removes one with DELETE.
+func (handler *AlbumHandler) HandleAPIAlbum(w http.ResponseWriter, r *http.Request) {
+	id, subresource, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, apiAlbumsPath+"/"), "/")
+	if id == "" {
+		common.WriteJSONError(w, http.StatusNotFound, "not_found", "Unknown API endpoint")
+		return
+	}
+
+	switch {
+	case subresource == "":
+		switch r.Method {
+		case http.MethodGet:
+			handler.apiGetAlbum(w, r, id)
+		case http.MethodPatch:
+			handler.apiUpdateAlbum(w, r, id)
+		case http.MethodDelete:
+			handler.apiDeleteAlbum(w, r, id)
+		default:
+			w.Header().Set("Allow", "GET, PATCH, DELETE")
+			common.WriteJSONError(w, http.StatusMethodNotAllowed, "method_not_allowed", "Method not allowed")
+		}
+	case subresource == "images":
+		switch r.Method {
+		case http.MethodPost:
+			handler.apiAddImages(w, r, id)
+		case http.MethodPut:
+			handler.apiReorderImages(w, r, id)
+		default:
+			w.Header().Set("Allow", "POST, PUT")
+			common.WriteJSONError(w, http.StatusMethodNotAllowed, "method_not_allowed", "Method not allowed")
+		}
+	case strings.HasPrefix(subresource, "images/") && len(subresource) > len("images/"):
+		if r.Method != http.MethodDelete {
+			w.Header().Set("Allow", "DELETE")
+			common.WriteJSONError(w, http.StatusMethodNotAllowed, "method_not_allowed", "Method not allowed")
+			return
+		}
+		handler.apiRemoveImage(w, r, id, strings.TrimPrefix(subresource, "images/"))
+	default:
+		common.WriteJSONError(w, http.StatusNotFound, "not_found", "Unknown API endpoint")
+	}
+}
+
+// apiListAlbums returns every album as JSON
+func (handler *AlbumHandler) apiListAlbums(w http.ResponseWriter, r *http.Request) {
+	albums, err := handler.albumService.ListAlbums(r.Context())
+	if err != nil {
+		writeAPIError(w, "listing albums", err)
+		return
+	}
+
+	if albums == nil {
+		albums = []Album{}
+	}
+
+	common.WriteJSON(w, http.StatusOK, albumListResponse{
+		Albums: albums,
+		Count:  len(albums),
+	})
+}
+
+// apiCreateAlbum creates an album from a {"title": ..., "description": ...} body
+func (handler *AlbumHandler) apiCreateAlbum(w http.ResponseWriter, r *http.Request) {
+	var request createAlbumRequest
+	if err := common.ReadJSON(w, r, maxJSONBodySize, &request); err != nil {
+		common.WriteJSONError(w, http.StatusBadRequest, "invalid_request", `Expected a JSON body like {"title": "name", "description": "text"}`)
+		return
+	}
+
+	album, err := handler.albumService.CreateAlbum(r.Context(), request.Title, request.Description)
+	if err != nil {
+		writeAPIError(w, "creating album", err)
+		return
+	}
+
+	w.Header().Set("Location", apiAlbumsPath+"/"+album.ID)
+	common.WriteJSON(w, http.StatusCreated, album)
+}
+
+// apiGetAlbum returns an album with its cover and image metadata as JSON
+func (handler *AlbumHandler) apiGetAlbum(w http.ResponseWriter, r *http.Request, id string) {
+	details, err := handler.albumService.GetAlbum(r.Context(), id)
+	if err != nil {
+		writeAPIError(w, "getting album "+id, err)
+		return
+	}
+
+	common.WriteJSON(w, http.StatusOK, details)
+}
+
+// apiUpdateAlbum applies the fields present in the body and returns the updated album
+func (handler *AlbumHandler) apiUpdateAlbum(w http.ResponseWriter, r *http.Request, id string) {
+	var update AlbumUpdate
+	if err := common.ReadJSON(w, r, maxJSONBodySize, &update); err != nil {
+		common.WriteJSONError(w, http.StatusBadRequest, "invalid_request", `Expected a JSON body with "title", "description" or "cover_image_id"`)
+		return
+	}
+
+	album, err := handler.albumService.UpdateAlbum(r.Context(), id, update)
+	if err != nil {
+		writeAPIError(w, "updating album "+id, err)
+		return
+	}
+
+	common.WriteJSON(w, http.StatusOK, album)
+}
+
+// apiDeleteAlbum deletes an album and responds with 204 No Content
+func (handler *AlbumHandler) apiDeleteAlbum(w http.ResponseWriter, r *http.Request, id string) {
+	if err := handler.albumService.DeleteAlbum(r.Context(), id); err != nil {
+		writeAPIError(w, "deleting album "+id, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// apiAddImages appends the images in a {"image_ids": [...]} body and returns the updated album
+func (handler *AlbumHandler) apiAddImages(w http.ResponseWriter, r *http.Request, id string) {
+	var request imageIDsRequest
+	if err := common.ReadJSON(w, r, maxJSONBodySize, &request); err != nil {
+		common.WriteJSONError(w, http.StatusBadRequest, "invalid_request", `Expected a JSON body like {"image_ids": ["id"]}`)
+		return
+	}
+
+	album, err := handler.albumService.AddImages(r.Context(), id, request.ImageIDs)
+	if err != nil {
+		writeAPIError(w, "adding images to album "+id, err)
+		return
+	}
+
+	common.WriteJSON(w, http.StatusOK, album)
+}
+
+// apiReorderImages applies the order in a {"image_ids": [...]} body and returns the updated album
+func (handler *AlbumHandler) apiReorderImages(w http.ResponseWriter, r *http.Request, id string) {
+	var request imageIDsRequest
+	if err := common.ReadJSON(w, r, maxJSONBodySize, &request); err != nil {
+		common.WriteJSONError(w, http.StatusBadRequest, "invalid_request", `Expected a JSON body like {"image_ids": ["id"]}`)
+		return
+	}
+
+	album, err := handler.albumService.ReorderImages(r.Context(), id, request.ImageIDs)
+	if err != nil {
+		writeAPIError(w, "reordering album "+id, err)
+		return
+	}
+
+	common.WriteJSON(w, http.StatusOK, album)
+}
+
+// apiRemoveImage takes one image out of an album and returns the updated album
+func (handler *AlbumHandler) apiRemoveImage(w http.ResponseWriter, r *http.Request, id, imageID string) {
+	album, err := handler.albumService.RemoveImage(r.Context(), id, imageID)
+	if err != nil {
+		writeAPIError(w, "removing image from album "+id, err)
+		return
+	}
+
+	common.WriteJSON(w, http.StatusOK, album)
+}
+
+// writeAPIError maps service errors to a JSON error response
+func writeAPIError(w http.ResponseWriter, operation string, err error) {
+	switch {
+	case errors.Is(err, ErrAlbumNotFound):
+		common.WriteJSONError(w, http.StatusNotFound, "album_not_found", ErrAlbumNotFound.Error())
+	case errors.Is(err, image.ErrImageNotFound):
+		common.WriteJSONError(w, http.StatusNotFound, "image_not_found", err.Error())
+	case errors.Is(err, ErrImageNotInAlbum):
+		common.WriteJSONError(w, http.StatusNotFound, "image_not_in_album", ErrImageNotInAlbum.Error())
+	case errors.Is(err, ErrInvalidAlbum):
+		common.WriteJSONError(w, http.StatusBadRequest, "invalid_album", err.Error())
+	case errors.Is(err, ErrInvalidImageOrder):
+		common.WriteJSONError(w, http.StatusBadRequest, "invalid_image_order", ErrInvalidImageOrder.Error())
+	case errors.Is(err, ErrNotAlbumOwner):
+		common.WriteJSONError(w, http.StatusForbidden, "forbidden", ErrNotAlbumOwner.Error())
+	default:
+		log.Printf("API error %s: %v", operation, err)
+		common.WriteJSONError(w, http.StatusInternalServerError, "internal_error", "Internal server error")
+	}
+}
@@ -0,0 +1,17 @@
+package album
+
+import "errors"
+
+var (
+	// ErrAlbumNotFound indicates the requested album was not found
+	ErrAlbumNotFound = errors.New("album not found")
+	// ErrInvalidAlbum indicates a missing or malformed album field
+	ErrInvalidAlbum = errors.New("invalid album")
+	// ErrImageNotInAlbum indicates the image is not part of the album
+	ErrImageNotInAlbum = errors.New("image not in album")
+	// ErrInvalidImageOrder indicates a new order that does not list every album image exactly once
+	ErrInvalidImageOrder = errors.New("image order must list every image in the album exactly once")
+	// ErrNotAlbumOwner indicates a change to an album by someone other than
+	// its owner, or to an album without one while those cannot be changed
+	ErrNotAlbumOwner = errors.New("only the album's owner may change it")
+)
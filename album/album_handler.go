@@ -0,0 +1,71 @@
+package album
+
+import (
+	"errors"
+	"html/template"
+	"log"
+	"net/http"
+	"strings"
+
+	"file-pub/internal/common"
+)
+
+// AlbumHandler handles HTTP requests for album operations
+type AlbumHandler struct {
+	albumService AlbumService
+	templates    *template.Template
+}
+
+// NewAlbumHandler creates a new AlbumHandler
+func NewAlbumHandler(
+	albumService AlbumService,
+	templates *template.Template,
+) *AlbumHandler {
+	common.PanicOnInvalidDependencies("AlbumHandler", map[string]interface{}{
+		"albumService": albumService,
+		"templates":    templates,
+	})
+
+	return &AlbumHandler{
+		albumService: albumService,
+		templates:    templates,
+	}
+}
+
+// HandleAlbumPage renders the public page of an album at /album/{id}
+func (handler *AlbumHandler) HandleAlbumPage(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	id := strings.TrimPrefix(r.URL.Path, "/album/")
+	if id == "" || strings.Contains(id, "/") {
+		http.NotFound(w, r)
+		return
+	}
+
+	details, err := handler.albumService.GetAlbum(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, ErrAlbumNotFound) {
+			http.Error(w, "Album not found", http.StatusNotFound)
+			return
+		}
+		log.Printf("Error fetching album %s: %v", id, err)
+		http.Error(w, "Failed to fetch album", http.StatusInternalServerError)
+		return
+	}
+
+	data := struct {
+		Album *AlbumDetails
+		Count int
+	}{
+		Album: details,
+		Count: len(details.Images),
+	}
+
+	if err := handler.templates.ExecuteTemplate(w, "album.html", data); err != nil {
+		log.Printf("Template error: %v", err)
+		http.Error(w, "Failed to render page", http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,283 @@
+package album
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"html/template"
+	stdimage "image"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"file-pub/image"
+	"file-pub/internal/common"
+	"file-pub/storage"
+)
+
+// testHandler bundles an album handler with the services behind it
+type testHandler struct {
+	handler      *AlbumHandler
+	albumRepo    AlbumRepository
+	imageService image.ImageService
+}
+
+// newTestHandler builds an AlbumHandler over in-memory repositories and
+// blob store using the real page templates
+func newTestHandler(t *testing.T) *testHandler {
+	t.Helper()
+
+	templates, err := template.ParseGlob("../templates/*.html")
+	if err != nil {
+		t.Fatalf("parsing templates: %v", err)
+	}
+
+	config := image.DefaultConfig()
+	config.ShareLinkSecret = []byte("test share link secret")
+	imageService := image.NewImageService(image.NewMemoryImageRepository(), storage.NewMemoryBlobStore(), config)
+	// Most tests change the albums they create signed out, as with anonymous access
+	albumConfig := DefaultConfig()
+	albumConfig.ChangeUnowned = true
+	albumRepo := NewMemoryAlbumRepository()
+	albumService := NewAlbumService(albumRepo, imageService, albumConfig)
+
+	return &testHandler{
+		handler:      NewAlbumHandler(albumService, templates),
+		albumRepo:    albumRepo,
+		imageService: imageService,
+	}
+}
+
+// upload stores a small PNG through the image service and returns its ID
+func (th *testHandler) upload(t *testing.T) string {
+	t.Helper()
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, stdimage.NewGray(stdimage.Rect(0, 0, 8, 8))); err != nil {
+		t.Fatalf("encoding test PNG: %v", err)
+	}
+
+	metadata, err := th.imageService.UploadImage(context.Background(), &buf, "screenshot.png", "image/png", int64(buf.Len()), image.UploadOptions{})
+	if err != nil {
+		t.Fatalf("UploadImage: %v", err)
+	}
+	return metadata.ID
+}
+
+// api sends a JSON API request and decodes a successful response into out
+func (th *testHandler) api(t *testing.T, method, target, body string, out interface{}) int {
+	t.Helper()
+
+	handle := th.handler.HandleAPIAlbum
+	if target == apiAlbumsPath {
+		handle = th.handler.HandleAPIAlbums
+	}
+
+	w := httptest.NewRecorder()
+	handle(w, httptest.NewRequest(method, target, strings.NewReader(body)))
+	if out != nil && w.Code < 300 {
+		if err := json.Unmarshal(w.Body.Bytes(), out); err != nil {
+			t.Fatalf("decoding %s %s response: %v", method, target, err)
+		}
+	}
+	return w.Code
+}
+
+func TestAlbumAPI(t *testing.T) {
+	th := newTestHandler(t)
+	first, second, third := th.upload(t), th.upload(t), th.upload(t)
+
+	var album Album
+	if code := th.api(t, http.MethodPost, apiAlbumsPath, `{"title": " Incident 42 ", "description": "Outage"}`, &album); code != http.StatusCreated {
+		t.Fatalf("create: status = %d, want 201", code)
+	}
+	if album.Title != "Incident 42" || album.ID == "" {
+		t.Fatalf("created album = %+v", album)
+	}
+	albumPath := apiAlbumsPath + "/" + album.ID
+
+	body := `{"image_ids": ["` + first + `", "` + second + `", "` + third + `"]}`
+	if code := th.api(t, http.MethodPost, albumPath+"/images", body, &album); code != http.StatusOK {
+		t.Fatalf("add images: status = %d, want 200", code)
+	}
+
+	body = `{"image_ids": ["` + third + `", "` + first + `", "` + second + `"]}`
+	if code := th.api(t, http.MethodPut, albumPath+"/images", body, &album); code != http.StatusOK {
+		t.Fatalf("reorder: status = %d, want 200", code)
+	}
+
+	if code := th.api(t, http.MethodPatch, albumPath, `{"cover_image_id": "`+second+`"}`, &album); code != http.StatusOK {
+		t.Fatalf("set cover: status = %d, want 200", code)
+	}
+
+	if code := th.api(t, http.MethodDelete, albumPath+"/images/"+first, "", &album); code != http.StatusOK {
+		t.Fatalf("remove image: status = %d, want 200", code)
+	}
+
+	var details AlbumDetails
+	if code := th.api(t, http.MethodGet, albumPath, "", &details); code != http.StatusOK {
+		t.Fatalf("get: status = %d, want 200", code)
+	}
+	if len(details.Images) != 2 || details.Images[0].ID != third || details.Images[1].ID != second {
+		t.Errorf("images = %+v, want %s then %s", details.Images, third, second)
+	}
+	if details.Cover == nil || details.Cover.ID != second || details.Description != "Outage" {
+		t.Errorf("album = %+v, want cover %s", details, second)
+	}
+
+	var list albumListResponse
+	if code := th.api(t, http.MethodGet, apiAlbumsPath, "", &list); code != http.StatusOK || list.Count != 1 {
+		t.Errorf("list: status = %d, count = %d, want 200 and 1", code, list.Count)
+	}
+
+	tests := []struct {
+		name   string
+		method string
+		target string
+		body   string
+		want   int
+	}{
+		{"missing title", http.MethodPost, apiAlbumsPath, `{"title": " "}`, http.StatusBadRequest},
+		{"unknown field", http.MethodPost, apiAlbumsPath, `{"name": "x"}`, http.StatusBadRequest},
+		{"missing album", http.MethodGet, apiAlbumsPath + "/missing", "", http.StatusNotFound},
+		{"missing image", http.MethodPost, albumPath + "/images", `{"image_ids": ["missing"]}`, http.StatusNotFound},
+		{"no images", http.MethodPost, albumPath + "/images", `{"image_ids": []}`, http.StatusBadRequest},
+		{"incomplete order", http.MethodPut, albumPath + "/images", `{"image_ids": ["` + third + `"]}`, http.StatusBadRequest},
+		{"cover outside album", http.MethodPatch, albumPath, `{"cover_image_id": "` + first + `"}`, http.StatusNotFound},
+		{"remove absent image", http.MethodDelete, albumPath + "/images/" + first, "", http.StatusNotFound},
+		{"wrong method", http.MethodPut, albumPath, "", http.StatusMethodNotAllowed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if code := th.api(t, tt.method, tt.target, tt.body, nil); code != tt.want {
+				t.Errorf("status = %d, want %d", code, tt.want)
+			}
+		})
+	}
+
+	if code := th.api(t, http.MethodDelete, albumPath, "", nil); code != http.StatusNoContent {
+		t.Fatalf("delete: status = %d, want 204", code)
+	}
+	if _, err := th.imageService.GetImage(context.Background(), second); err != nil {
+		t.Errorf("image was deleted with its album: %v", err)
+	}
+}
+
+func TestAlbumOwnership(t *testing.T) {
+	th := newTestHandler(t)
+	imageID := th.upload(t)
+	alice := common.Identity{ID: "u-alice", Username: "alice"}
+	bob := common.Identity{ID: "u-bob", Username: "bob"}
+	send := func(identity *common.Identity, method, target, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, target, strings.NewReader(body))
+		if identity != nil {
+			r = r.WithContext(common.WithIdentity(r.Context(), *identity))
+		}
+		handle := th.handler.HandleAPIAlbum
+		if target == apiAlbumsPath {
+			handle = th.handler.HandleAPIAlbums
+		}
+		w := httptest.NewRecorder()
+		handle(w, r)
+		return w
+	}
+
+	// Albums belong to whoever created them
+	w := send(&alice, http.MethodPost, apiAlbumsPath, `{"title": "Mine"}`)
+	var album Album
+	if err := json.Unmarshal(w.Body.Bytes(), &album); err != nil || w.Code != http.StatusCreated {
+		t.Fatalf("create: status = %d: %s", w.Code, w.Body.String())
+	}
+	if album.OwnerID != alice.ID {
+		t.Fatalf("owner = %q, want %q", album.OwnerID, alice.ID)
+	}
+	albumPath := apiAlbumsPath + "/" + album.ID
+	imagesBody := `{"image_ids": ["` + imageID + `"]}`
+	if w := send(&alice, http.MethodPost, albumPath+"/images", imagesBody); w.Code != http.StatusOK {
+		t.Fatalf("add images by the owner: status = %d: %s", w.Code, w.Body.String())
+	}
+
+	// Nobody else may change it, signed in or not
+	changes := []struct {
+		method, target, body string
+	}{
+		{http.MethodPatch, albumPath, `{"title": "Bob's now"}`},
+		{http.MethodPost, albumPath + "/images", imagesBody},
+		{http.MethodPut, albumPath + "/images", imagesBody},
+		{http.MethodDelete, albumPath + "/images/" + imageID, ""},
+		{http.MethodDelete, albumPath, ""},
+	}
+	for _, identity := range []*common.Identity{&bob, nil} {
+		for _, change := range changes {
+			if w := send(identity, change.method, change.target, change.body); w.Code != http.StatusForbidden {
+				t.Errorf("%s %s by %v: status = %d, want 403", change.method, change.target, identity, w.Code)
+			}
+		}
+	}
+	if w := send(&bob, http.MethodGet, albumPath, ""); w.Code != http.StatusOK {
+		t.Errorf("GET by another user: status = %d, want 200", w.Code)
+	}
+
+	for _, change := range changes {
+		if w := send(&alice, change.method, change.target, change.body); w.Code >= 300 {
+			t.Errorf("%s %s by the owner: status = %d: %s", change.method, change.target, w.Code, w.Body.String())
+		}
+	}
+
+	// Without anonymous access nobody may change unowned albums until they are claimed
+	var unowned Album
+	if code := th.api(t, http.MethodPost, apiAlbumsPath, `{"title": "Shared"}`, &unowned); code != http.StatusCreated {
+		t.Fatalf("create unowned: status = %d", code)
+	}
+	readOnly := NewAlbumHandler(NewAlbumService(th.albumRepo, th.imageService, DefaultConfig()), th.handler.templates)
+	rename := func() int {
+		r := httptest.NewRequest(http.MethodPatch, apiAlbumsPath+"/"+unowned.ID, strings.NewReader(`{"title": "Bob's now"}`))
+		w := httptest.NewRecorder()
+		readOnly.HandleAPIAlbum(w, r.WithContext(common.WithIdentity(r.Context(), bob)))
+		return w.Code
+	}
+	if code := rename(); code != http.StatusForbidden {
+		t.Errorf("PATCH of an unowned album without anonymous access: status = %d, want 403", code)
+	}
+	if claimed, err := th.albumRepo.ClaimUnownedAlbums(context.Background(), bob.ID); err != nil || claimed != 1 {
+		t.Fatalf("ClaimUnownedAlbums = %d, %v; want 1", claimed, err)
+	}
+	if code := rename(); code != http.StatusOK {
+		t.Errorf("PATCH of a claimed album by its new owner: status = %d, want 200", code)
+	}
+}
+
+func TestHandleAlbumPage(t *testing.T) {
+	th := newTestHandler(t)
+	imageID := th.upload(t)
+
+	var album Album
+	th.api(t, http.MethodPost, apiAlbumsPath, `{"title": "Release <2.0>", "description": "Screenshots"}`, &album)
+
+	serve := func(target string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		th.handler.HandleAlbumPage(w, httptest.NewRequest(http.MethodGet, target, nil))
+		return w
+	}
+
+	w := serve("/album/" + album.ID)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "This Album Is Empty") {
+		t.Fatalf("empty album: status = %d, body missing empty state", w.Code)
+	}
+
+	th.api(t, http.MethodPost, apiAlbumsPath+"/"+album.ID+"/images", `{"image_ids": ["`+imageID+`"]}`, nil)
+	w = serve("/album/" + album.ID)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", w.Code)
+	}
+	body := w.Body.String()
+	if !strings.Contains(body, "Release &lt;2.0&gt;") || !strings.Contains(body, "/image/"+imageID+"/thumb") {
+		t.Errorf("page does not show the escaped title and the album image")
+	}
+
+	if w := serve("/album/missing"); w.Code != http.StatusNotFound {
+		t.Errorf("missing album: status = %d, want 404", w.Code)
+	}
+}
@@ -0,0 +1,496 @@
+package album
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"file-pub/internal/common"
+	"file-pub/internal/database"
+)
+
+// AlbumRepository defines the interface for album data access
+type AlbumRepository interface {
+	ListAlbums(ctx context.Context) ([]Album, error)
+	SaveAlbum(ctx context.Context, album Album) error
+	GetAlbumByID(ctx context.Context, id string) (*Album, error)
+	UpdateAlbum(ctx context.Context, album Album) error
+	ClaimUnownedAlbums(ctx context.Context, ownerID string) (int64, error)
+	DeleteAlbum(ctx context.Context, id string) error
+	AddImages(ctx context.Context, id string, imageIDs []string) error
+	RemoveImage(ctx context.Context, id, imageID string) error
+	ReorderImages(ctx context.Context, id string, imageIDs []string) error
+}
+
+// albumColumns lists the albums columns in the order scanAlbum expects
+const albumColumns = "id, title, description, cover_image_id, owner_id, created_at, updated_at"
+
+// rowScanner is implemented by *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// albumRepository implements AlbumRepository on MySQL, PostgreSQL or SQLite.
+// Queries are written with "?" placeholders and rebound for the driver.
+type albumRepository struct {
+	db     *sql.DB
+	driver string
+}
+
+// NewAlbumRepository creates a new AlbumRepository for a database opened with
+// one of the database.Driver* drivers and migrated to the current schema
+func NewAlbumRepository(db *sql.DB, driver string) AlbumRepository {
+	common.RequireNonNil(db, "db")
+	if err := database.ValidateDriver(driver); err != nil {
+		panic(err.Error())
+	}
+
+	return &albumRepository{
+		db:     db,
+		driver: driver,
+	}
+}
+
+// rebind adapts a query's placeholders to the repository's driver
+func (repo *albumRepository) rebind(query string) string {
+	return database.Rebind(repo.driver, query)
+}
+
+// ListAlbums retrieves every album, newest first, with its image IDs
+func (repo *albumRepository) ListAlbums(ctx context.Context) ([]Album, error) {
+	query := `
+		SELECT ` + albumColumns + `
+		FROM albums
+		ORDER BY created_at DESC, id DESC
+	`
+
+	rows, err := repo.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, common.WrapDatabaseError("query albums", err)
+	}
+	defer rows.Close()
+
+	var albums []Album
+	for rows.Next() {
+		album, err := scanAlbum(rows)
+		if err != nil {
+			return nil, common.WrapDatabaseError("scan album row", err)
+		}
+		albums = append(albums, *album)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, common.WrapDatabaseError("iterate album rows", err)
+	}
+
+	if err := repo.attachImageIDs(ctx, albums); err != nil {
+		return nil, err
+	}
+
+	return albums, nil
+}
+
+// SaveAlbum saves a new album and its images to the database in one transaction
+func (repo *albumRepository) SaveAlbum(ctx context.Context, album Album) error {
+	tx, err := repo.db.BeginTx(ctx, nil)
+	if err != nil {
+		return common.WrapDatabaseError("begin insert album", err)
+	}
+	defer tx.Rollback()
+
+	query := `
+		INSERT INTO albums (` + albumColumns + `)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`
+
+	_, err = tx.ExecContext(
+		ctx,
+		repo.rebind(query),
+		album.ID,
+		album.Title,
+		album.Description,
+		nullString(album.CoverImageID),
+		album.OwnerID,
+		album.CreatedAt.UTC(),
+		album.UpdatedAt.UTC(),
+	)
+	if err != nil {
+		return common.WrapDatabaseError("insert album", err)
+	}
+
+	if err := repo.insertImages(ctx, tx, album.ID, album.ImageIDs, 0); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return common.WrapDatabaseError("commit insert album", err)
+	}
+
+	return nil
+}
+
+// GetAlbumByID retrieves an album and its image IDs from the database
+func (repo *albumRepository) GetAlbumByID(ctx context.Context, id string) (*Album, error) {
+	query := `
+		SELECT ` + albumColumns + `
+		FROM albums
+		WHERE id = ?
+	`
+
+	album, err := scanAlbum(repo.db.QueryRowContext(ctx, repo.rebind(query), id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrAlbumNotFound
+		}
+		return nil, common.WrapDatabaseError(fmt.Sprintf("query album %s", id), err)
+	}
+
+	albums := []Album{*album}
+	if err := repo.attachImageIDs(ctx, albums); err != nil {
+		return nil, err
+	}
+
+	return &albums[0], nil
+}
+
+// UpdateAlbum saves an album's title, description, cover and update time
+func (repo *albumRepository) UpdateAlbum(ctx context.Context, album Album) error {
+	query := `
+		UPDATE albums
+		SET title = ?, description = ?, cover_image_id = ?, updated_at = ?
+		WHERE id = ?
+	`
+
+	result, err := repo.db.ExecContext(
+		ctx,
+		repo.rebind(query),
+		album.Title,
+		album.Description,
+		nullString(album.CoverImageID),
+		album.UpdatedAt.UTC(),
+		album.ID,
+	)
+	if err != nil {
+		return common.WrapDatabaseError(fmt.Sprintf("update album %s", album.ID), err)
+	}
+
+	// MySQL reports unchanged rows as unaffected, so confirm the album exists
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return common.WrapDatabaseError(fmt.Sprintf("update album %s", album.ID), err)
+	}
+	if affected == 0 {
+		if _, err := repo.GetAlbumByID(ctx, album.ID); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ClaimUnownedAlbums gives every album without an owner to the user with
+// ownerID and returns how many it changed
+func (repo *albumRepository) ClaimUnownedAlbums(ctx context.Context, ownerID string) (int64, error) {
+	result, err := repo.db.ExecContext(ctx, repo.rebind("UPDATE albums SET owner_id = ? WHERE owner_id = ''"), ownerID)
+	if err != nil {
+		return 0, common.WrapDatabaseError("claim unowned albums", err)
+	}
+
+	claimed, err := result.RowsAffected()
+	if err != nil {
+		return 0, common.WrapDatabaseError("claim unowned albums", err)
+	}
+	return claimed, nil
+}
+
+// DeleteAlbum removes an album and its image links; the images themselves are kept
+func (repo *albumRepository) DeleteAlbum(ctx context.Context, id string) error {
+	tx, err := repo.db.BeginTx(ctx, nil)
+	if err != nil {
+		return common.WrapDatabaseError(fmt.Sprintf("begin delete album %s", id), err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, repo.rebind("DELETE FROM album_images WHERE album_id = ?"), id); err != nil {
+		return common.WrapDatabaseError(fmt.Sprintf("delete images of album %s", id), err)
+	}
+
+	result, err := tx.ExecContext(ctx, repo.rebind("DELETE FROM albums WHERE id = ?"), id)
+	if err != nil {
+		return common.WrapDatabaseError(fmt.Sprintf("delete album %s", id), err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return common.WrapDatabaseError(fmt.Sprintf("delete album %s", id), err)
+	}
+	if affected == 0 {
+		return ErrAlbumNotFound
+	}
+
+	if err := tx.Commit(); err != nil {
+		return common.WrapDatabaseError(fmt.Sprintf("commit delete album %s", id), err)
+	}
+
+	return nil
+}
+
+// AddImages appends images to the end of an album in the given order;
+// images already in the album keep their place
+func (repo *albumRepository) AddImages(ctx context.Context, id string, imageIDs []string) error {
+	tx, err := repo.db.BeginTx(ctx, nil)
+	if err != nil {
+		return common.WrapDatabaseError(fmt.Sprintf("begin add images to album %s", id), err)
+	}
+	defer tx.Rollback()
+
+	current, err := repo.lockAlbumImages(ctx, tx, id)
+	if err != nil {
+		return err
+	}
+
+	var added []string
+	for _, imageID := range imageIDs {
+		if !containsID(current, imageID) && !containsID(added, imageID) {
+			added = append(added, imageID)
+		}
+	}
+
+	// Positions can have gaps after removals, so append after the largest
+	var next int
+	query := "SELECT COALESCE(MAX(position) + 1, 0) FROM album_images WHERE album_id = ?"
+	if err := tx.QueryRowContext(ctx, repo.rebind(query), id).Scan(&next); err != nil {
+		return common.WrapDatabaseError(fmt.Sprintf("query last position of album %s", id), err)
+	}
+	if err := repo.insertImages(ctx, tx, id, added, next); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return common.WrapDatabaseError(fmt.Sprintf("commit add images to album %s", id), err)
+	}
+
+	return nil
+}
+
+// RemoveImage takes an image out of an album, clearing the cover if it was
+// the cover image
+func (repo *albumRepository) RemoveImage(ctx context.Context, id, imageID string) error {
+	tx, err := repo.db.BeginTx(ctx, nil)
+	if err != nil {
+		return common.WrapDatabaseError(fmt.Sprintf("begin remove image from album %s", id), err)
+	}
+	defer tx.Rollback()
+
+	current, err := repo.lockAlbumImages(ctx, tx, id)
+	if err != nil {
+		return err
+	}
+	if !containsID(current, imageID) {
+		return ErrImageNotInAlbum
+	}
+
+	query := "DELETE FROM album_images WHERE album_id = ? AND image_id = ?"
+	if _, err := tx.ExecContext(ctx, repo.rebind(query), id, imageID); err != nil {
+		return common.WrapDatabaseError(fmt.Sprintf("remove image %s from album %s", imageID, id), err)
+	}
+
+	query = "UPDATE albums SET cover_image_id = NULL WHERE id = ? AND cover_image_id = ?"
+	if _, err := tx.ExecContext(ctx, repo.rebind(query), id, imageID); err != nil {
+		return common.WrapDatabaseError(fmt.Sprintf("clear cover of album %s", id), err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return common.WrapDatabaseError(fmt.Sprintf("commit remove image from album %s", id), err)
+	}
+
+	return nil
+}
+
+// ReorderImages rewrites the positions of an album's images. imageIDs must
+// list every image in the album exactly once.
+func (repo *albumRepository) ReorderImages(ctx context.Context, id string, imageIDs []string) error {
+	tx, err := repo.db.BeginTx(ctx, nil)
+	if err != nil {
+		return common.WrapDatabaseError(fmt.Sprintf("begin reorder album %s", id), err)
+	}
+	defer tx.Rollback()
+
+	current, err := repo.lockAlbumImages(ctx, tx, id)
+	if err != nil {
+		return err
+	}
+	if !isPermutation(current, imageIDs) {
+		return ErrInvalidImageOrder
+	}
+
+	query := repo.rebind("UPDATE album_images SET position = ? WHERE album_id = ? AND image_id = ?")
+	for position, imageID := range imageIDs {
+		if _, err := tx.ExecContext(ctx, query, position, id, imageID); err != nil {
+			return common.WrapDatabaseError(fmt.Sprintf("move image %s in album %s", imageID, id), err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return common.WrapDatabaseError(fmt.Sprintf("commit reorder album %s", id), err)
+	}
+
+	return nil
+}
+
+// lockAlbumImages returns an album's image IDs in order, or ErrAlbumNotFound.
+// On MySQL and PostgreSQL the album row stays locked until tx ends, so
+// concurrent changes to the same album are applied one at a time.
+func (repo *albumRepository) lockAlbumImages(ctx context.Context, tx *sql.Tx, id string) ([]string, error) {
+	query := "SELECT id FROM albums WHERE id = ?"
+	if repo.driver != database.DriverSQLite {
+		query += " FOR UPDATE"
+	}
+
+	var found string
+	err := tx.QueryRowContext(ctx, repo.rebind(query), id).Scan(&found)
+	if err == sql.ErrNoRows {
+		return nil, ErrAlbumNotFound
+	}
+	if err != nil {
+		return nil, common.WrapDatabaseError(fmt.Sprintf("query album %s", id), err)
+	}
+
+	query = "SELECT image_id FROM album_images WHERE album_id = ? ORDER BY position, image_id"
+	rows, err := tx.QueryContext(ctx, repo.rebind(query), id)
+	if err != nil {
+		return nil, common.WrapDatabaseError(fmt.Sprintf("query images of album %s", id), err)
+	}
+	defer rows.Close()
+
+	var imageIDs []string
+	for rows.Next() {
+		var imageID string
+		if err := rows.Scan(&imageID); err != nil {
+			return nil, common.WrapDatabaseError("scan album image row", err)
+		}
+		imageIDs = append(imageIDs, imageID)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, common.WrapDatabaseError("iterate album image rows", err)
+	}
+
+	return imageIDs, nil
+}
+
+// insertImages links images to an album at consecutive positions from start
+func (repo *albumRepository) insertImages(ctx context.Context, tx *sql.Tx, id string, imageIDs []string, start int) error {
+	query := repo.rebind("INSERT INTO album_images (album_id, image_id, position) VALUES (?, ?, ?)")
+	for i, imageID := range imageIDs {
+		if _, err := tx.ExecContext(ctx, query, id, imageID, start+i); err != nil {
+			return common.WrapDatabaseError(fmt.Sprintf("add image %s to album %s", imageID, id), err)
+		}
+	}
+
+	return nil
+}
+
+// attachImageIDs loads the ordered image IDs of each album in a single query
+func (repo *albumRepository) attachImageIDs(ctx context.Context, albums []Album) error {
+	if len(albums) == 0 {
+		return nil
+	}
+
+	index := make(map[string]int, len(albums))
+	args := make([]interface{}, len(albums))
+	for i, album := range albums {
+		index[album.ID] = i
+		args[i] = album.ID
+	}
+
+	query := `
+		SELECT album_id, image_id
+		FROM album_images
+		WHERE album_id IN (` + placeholders(len(albums)) + `)
+		ORDER BY position, image_id
+	`
+
+	rows, err := repo.db.QueryContext(ctx, repo.rebind(query), args...)
+	if err != nil {
+		return common.WrapDatabaseError("query album images", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var albumID, imageID string
+		if err := rows.Scan(&albumID, &imageID); err != nil {
+			return common.WrapDatabaseError("scan album image row", err)
+		}
+
+		i := index[albumID]
+		albums[i].ImageIDs = append(albums[i].ImageIDs, imageID)
+	}
+
+	if err := rows.Err(); err != nil {
+		return common.WrapDatabaseError("iterate album image rows", err)
+	}
+
+	return nil
+}
+
+// placeholders returns n comma-separated query placeholders
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
+
+// nullString stores an empty string as NULL
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
+
+// scanAlbum scans a row selected with albumColumns into an Album
+func scanAlbum(row rowScanner) (*Album, error) {
+	var album Album
+	var coverImageID sql.NullString
+	err := row.Scan(
+		&album.ID,
+		&album.Title,
+		&album.Description,
+		&coverImageID,
+		&album.OwnerID,
+		&album.CreatedAt,
+		&album.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	album.CoverImageID = coverImageID.String
+	return &album, nil
+}
+
+// containsID reports whether ids includes id
+func containsID(ids []string, id string) bool {
+	for _, candidate := range ids {
+		if candidate == id {
+			return true
+		}
+	}
+	return false
+}
+
+// isPermutation reports whether order lists exactly the IDs in current, each once
+func isPermutation(current, order []string) bool {
+	if len(current) != len(order) {
+		return false
+	}
+
+	remaining := make(map[string]bool, len(current))
+	for _, id := range current {
+		remaining[id] = true
+	}
+	for _, id := range order {
+		if !remaining[id] {
+			return false
+		}
+		delete(remaining, id)
+	}
+	return true
+}
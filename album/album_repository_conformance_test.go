@@ -0,0 +1,316 @@
+package album
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"file-pub/image"
+	"file-pub/internal/database/dbtest"
+)
+
+// testRepositoryConformance runs the behaviour every AlbumRepository
+// implementation must share. newRepos must return an empty album repository
+// and the empty image repository its albums refer to.
+func testRepositoryConformance(t *testing.T, newRepos func(t *testing.T) (AlbumRepository, image.ImageRepository)) {
+	t.Run("SaveAndGet", func(t *testing.T) {
+		repo, images := newRepos(t)
+		ctx := context.Background()
+		saveTestImages(t, images, "i1", "i2")
+
+		want := testAlbum("a", dbtest.Time(0))
+		want.CoverImageID = "i2"
+		want.OwnerID = "u1"
+		want.ImageIDs = []string{"i2", "i1"}
+		if err := repo.SaveAlbum(ctx, want); err != nil {
+			t.Fatalf("SaveAlbum: %v", err)
+		}
+
+		got, err := repo.GetAlbumByID(ctx, "a")
+		if err != nil {
+			t.Fatalf("GetAlbumByID: %v", err)
+		}
+		assertAlbum(t, *got, want)
+	})
+
+	t.Run("GetMissing", func(t *testing.T) {
+		repo, _ := newRepos(t)
+
+		_, err := repo.GetAlbumByID(context.Background(), "missing")
+		if !errors.Is(err, ErrAlbumNotFound) {
+			t.Fatalf("err = %v, want ErrAlbumNotFound", err)
+		}
+	})
+
+	t.Run("List", func(t *testing.T) {
+		repo, images := newRepos(t)
+		ctx := context.Background()
+		saveTestImages(t, images, "i1")
+
+		for i, id := range []string{"a", "b", "c"} {
+			album := testAlbum(id, dbtest.Time(i))
+			if id == "b" {
+				album.ImageIDs = []string{"i1"}
+			}
+			if err := repo.SaveAlbum(ctx, album); err != nil {
+				t.Fatalf("SaveAlbum %s: %v", id, err)
+			}
+		}
+
+		albums, err := repo.ListAlbums(ctx)
+		if err != nil {
+			t.Fatalf("ListAlbums: %v", err)
+		}
+		var ids []string
+		for _, album := range albums {
+			ids = append(ids, album.ID)
+		}
+		if fmt.Sprint(ids) != "[c b a]" {
+			t.Fatalf("albums = %v, want [c b a]", ids)
+		}
+		if fmt.Sprint(albums[1].ImageIDs) != "[i1]" {
+			t.Errorf("album b images = %v, want [i1]", albums[1].ImageIDs)
+		}
+	})
+
+	t.Run("Update", func(t *testing.T) {
+		repo, images := newRepos(t)
+		ctx := context.Background()
+		saveTestImages(t, images, "i1")
+
+		album := testAlbum("a", dbtest.Time(0))
+		album.ImageIDs = []string{"i1"}
+		if err := repo.SaveAlbum(ctx, album); err != nil {
+			t.Fatalf("SaveAlbum: %v", err)
+		}
+
+		album.Title = "Release 2.0"
+		album.Description = "Screenshots"
+		album.CoverImageID = "i1"
+		album.UpdatedAt = dbtest.Time(5)
+		if err := repo.UpdateAlbum(ctx, album); err != nil {
+			t.Fatalf("UpdateAlbum: %v", err)
+		}
+		// Saving the same values again is not a missing album
+		if err := repo.UpdateAlbum(ctx, album); err != nil {
+			t.Fatalf("UpdateAlbum unchanged: %v", err)
+		}
+
+		got, err := repo.GetAlbumByID(ctx, "a")
+		if err != nil {
+			t.Fatalf("GetAlbumByID: %v", err)
+		}
+		assertAlbum(t, *got, album)
+
+		album.ID = "missing"
+		if err := repo.UpdateAlbum(ctx, album); !errors.Is(err, ErrAlbumNotFound) {
+			t.Errorf("UpdateAlbum on missing album: err = %v, want ErrAlbumNotFound", err)
+		}
+	})
+
+	t.Run("ClaimUnownedAlbums", func(t *testing.T) {
+		repo, _ := newRepos(t)
+		ctx := context.Background()
+
+		owned := testAlbum("a", dbtest.Time(0))
+		owned.OwnerID = "u1"
+		for _, album := range []Album{owned, testAlbum("b", dbtest.Time(60)), testAlbum("c", dbtest.Time(120))} {
+			if err := repo.SaveAlbum(ctx, album); err != nil {
+				t.Fatalf("SaveAlbum %s: %v", album.ID, err)
+			}
+		}
+
+		claimed, err := repo.ClaimUnownedAlbums(ctx, "u2")
+		if err != nil || claimed != 2 {
+			t.Fatalf("ClaimUnownedAlbums = %d, %v; want 2", claimed, err)
+		}
+		for id, want := range map[string]string{"a": "u1", "b": "u2", "c": "u2"} {
+			got, err := repo.GetAlbumByID(ctx, id)
+			if err != nil {
+				t.Fatalf("GetAlbumByID %s: %v", id, err)
+			}
+			if got.OwnerID != want {
+				t.Errorf("owner of %s = %q, want %q", id, got.OwnerID, want)
+			}
+		}
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		repo, images := newRepos(t)
+		ctx := context.Background()
+		saveTestImages(t, images, "i1")
+
+		album := testAlbum("a", dbtest.Time(0))
+		album.ImageIDs = []string{"i1"}
+		if err := repo.SaveAlbum(ctx, album); err != nil {
+			t.Fatalf("SaveAlbum: %v", err)
+		}
+
+		if err := repo.DeleteAlbum(ctx, "a"); err != nil {
+			t.Fatalf("DeleteAlbum: %v", err)
+		}
+		if _, err := repo.GetAlbumByID(ctx, "a"); !errors.Is(err, ErrAlbumNotFound) {
+			t.Fatalf("GetAlbumByID after delete: err = %v, want ErrAlbumNotFound", err)
+		}
+		if err := repo.DeleteAlbum(ctx, "a"); !errors.Is(err, ErrAlbumNotFound) {
+			t.Fatalf("second DeleteAlbum: err = %v, want ErrAlbumNotFound", err)
+		}
+		if _, err := images.GetImageByID(ctx, "i1"); err != nil {
+			t.Errorf("image was deleted with its album: %v", err)
+		}
+	})
+
+	t.Run("AddImages", func(t *testing.T) {
+		repo, images := newRepos(t)
+		ctx := context.Background()
+		saveTestImages(t, images, "i1", "i2", "i3", "i4")
+
+		album := testAlbum("a", dbtest.Time(0))
+		album.ImageIDs = []string{"i2", "i1"}
+		if err := repo.SaveAlbum(ctx, album); err != nil {
+			t.Fatalf("SaveAlbum: %v", err)
+		}
+
+		// Images already in the album keep their place
+		if err := repo.AddImages(ctx, "a", []string{"i4", "i1", "i3"}); err != nil {
+			t.Fatalf("AddImages: %v", err)
+		}
+		assertImageIDs(t, repo, "a", "[i2 i1 i4 i3]")
+
+		// New images go after the last one even when removals left gaps
+		if err := repo.RemoveImage(ctx, "a", "i4"); err != nil {
+			t.Fatalf("RemoveImage: %v", err)
+		}
+		if err := repo.AddImages(ctx, "a", []string{"i4"}); err != nil {
+			t.Fatalf("AddImages again: %v", err)
+		}
+		assertImageIDs(t, repo, "a", "[i2 i1 i3 i4]")
+
+		if err := repo.AddImages(ctx, "missing", []string{"i1"}); !errors.Is(err, ErrAlbumNotFound) {
+			t.Errorf("AddImages on missing album: err = %v, want ErrAlbumNotFound", err)
+		}
+	})
+
+	t.Run("RemoveImage", func(t *testing.T) {
+		repo, images := newRepos(t)
+		ctx := context.Background()
+		saveTestImages(t, images, "i1", "i2")
+
+		album := testAlbum("a", dbtest.Time(0))
+		album.ImageIDs = []string{"i1", "i2"}
+		album.CoverImageID = "i2"
+		if err := repo.SaveAlbum(ctx, album); err != nil {
+			t.Fatalf("SaveAlbum: %v", err)
+		}
+
+		if err := repo.RemoveImage(ctx, "a", "i2"); err != nil {
+			t.Fatalf("RemoveImage: %v", err)
+		}
+		got, err := repo.GetAlbumByID(ctx, "a")
+		if err != nil {
+			t.Fatalf("GetAlbumByID: %v", err)
+		}
+		if fmt.Sprint(got.ImageIDs) != "[i1]" || got.CoverImageID != "" {
+			t.Errorf("album after removing its cover = %+v, want images [i1] and no cover", got)
+		}
+
+		if err := repo.RemoveImage(ctx, "a", "i2"); !errors.Is(err, ErrImageNotInAlbum) {
+			t.Errorf("RemoveImage twice: err = %v, want ErrImageNotInAlbum", err)
+		}
+		if err := repo.RemoveImage(ctx, "missing", "i1"); !errors.Is(err, ErrAlbumNotFound) {
+			t.Errorf("RemoveImage on missing album: err = %v, want ErrAlbumNotFound", err)
+		}
+	})
+
+	t.Run("ReorderImages", func(t *testing.T) {
+		repo, images := newRepos(t)
+		ctx := context.Background()
+		saveTestImages(t, images, "i1", "i2", "i3")
+
+		album := testAlbum("a", dbtest.Time(0))
+		album.ImageIDs = []string{"i1", "i2", "i3"}
+		if err := repo.SaveAlbum(ctx, album); err != nil {
+			t.Fatalf("SaveAlbum: %v", err)
+		}
+
+		if err := repo.ReorderImages(ctx, "a", []string{"i3", "i1", "i2"}); err != nil {
+			t.Fatalf("ReorderImages: %v", err)
+		}
+		assertImageIDs(t, repo, "a", "[i3 i1 i2]")
+
+		for _, order := range [][]string{
+			{"i3", "i1"},
+			{"i3", "i1", "i1"},
+			{"i3", "i1", "i2", "i4"},
+			{"i3", "i1", "i4"},
+		} {
+			if err := repo.ReorderImages(ctx, "a", order); !errors.Is(err, ErrInvalidImageOrder) {
+				t.Errorf("ReorderImages %v: err = %v, want ErrInvalidImageOrder", order, err)
+			}
+		}
+		assertImageIDs(t, repo, "a", "[i3 i1 i2]")
+
+		if err := repo.ReorderImages(ctx, "missing", nil); !errors.Is(err, ErrAlbumNotFound) {
+			t.Errorf("ReorderImages on missing album: err = %v, want ErrAlbumNotFound", err)
+		}
+	})
+}
+
+// testAlbum returns an empty album with the given ID
+func testAlbum(id string, createdAt time.Time) Album {
+	return Album{
+		ID:          id,
+		Title:       "Album " + id,
+		Description: "Incident " + id,
+		CreatedAt:   createdAt,
+		UpdatedAt:   createdAt,
+	}
+}
+
+// saveTestImages stores minimal image metadata for each ID
+func saveTestImages(t *testing.T, repo image.ImageRepository, ids ...string) {
+	t.Helper()
+
+	for i, id := range ids {
+		err := repo.SaveImage(context.Background(), image.ImageMetadata{
+			ID:           id,
+			Filename:     id + ".png",
+			OriginalName: "screenshot-" + id + ".png",
+			S3Key:        "uploads/" + id + ".png",
+			ContentType:  "image/png",
+			Size:         1234,
+			UploadedAt:   dbtest.Time(i),
+		})
+		if err != nil {
+			t.Fatalf("SaveImage %s: %v", id, err)
+		}
+	}
+}
+
+// assertAlbum compares every stored album field
+func assertAlbum(t *testing.T, got, want Album) {
+	t.Helper()
+
+	if got.ID != want.ID || got.Title != want.Title || got.Description != want.Description ||
+		got.CoverImageID != want.CoverImageID || got.OwnerID != want.OwnerID || fmt.Sprint(got.ImageIDs) != fmt.Sprint(want.ImageIDs) {
+		t.Errorf("album = %+v, want %+v", got, want)
+	}
+	if !got.CreatedAt.Equal(want.CreatedAt) || !got.UpdatedAt.Equal(want.UpdatedAt) {
+		t.Errorf("times = %v, %v, want %v, %v", got.CreatedAt, got.UpdatedAt, want.CreatedAt, want.UpdatedAt)
+	}
+}
+
+// assertImageIDs checks an album's image order
+func assertImageIDs(t *testing.T, repo AlbumRepository, id, want string) {
+	t.Helper()
+
+	album, err := repo.GetAlbumByID(context.Background(), id)
+	if err != nil {
+		t.Fatalf("GetAlbumByID: %v", err)
+	}
+	if got := fmt.Sprint(album.ImageIDs); got != want {
+		t.Errorf("images = %s, want %s", got, want)
+	}
+}
@@ -0,0 +1,191 @@
+package album
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// memoryAlbumRepository implements AlbumRepository in process memory
+type memoryAlbumRepository struct {
+	mu     sync.RWMutex
+	albums map[string]Album
+}
+
+// NewMemoryAlbumRepository creates a new AlbumRepository that keeps albums
+// in memory, for tests and development. Albums are lost when the process exits.
+func NewMemoryAlbumRepository() AlbumRepository {
+	return &memoryAlbumRepository{
+		albums: make(map[string]Album),
+	}
+}
+
+// ListAlbums retrieves copies of every album, newest first
+func (repo *memoryAlbumRepository) ListAlbums(ctx context.Context) ([]Album, error) {
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+
+	var albums []Album
+	for _, album := range repo.albums {
+		albums = append(albums, copyAlbum(album))
+	}
+	sort.Slice(albums, func(i, j int) bool {
+		if !albums[i].CreatedAt.Equal(albums[j].CreatedAt) {
+			return albums[i].CreatedAt.After(albums[j].CreatedAt)
+		}
+		return albums[i].ID > albums[j].ID
+	})
+
+	return albums, nil
+}
+
+// SaveAlbum saves a copy of a new album
+func (repo *memoryAlbumRepository) SaveAlbum(ctx context.Context, album Album) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	if _, exists := repo.albums[album.ID]; exists {
+		return fmt.Errorf("memory insert album %s: duplicate id", album.ID)
+	}
+	repo.albums[album.ID] = copyAlbum(album)
+
+	return nil
+}
+
+// GetAlbumByID retrieves a copy of an album
+func (repo *memoryAlbumRepository) GetAlbumByID(ctx context.Context, id string) (*Album, error) {
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+
+	album, ok := repo.albums[id]
+	if !ok {
+		return nil, ErrAlbumNotFound
+	}
+
+	album = copyAlbum(album)
+	return &album, nil
+}
+
+// UpdateAlbum saves an album's title, description, cover and update time
+func (repo *memoryAlbumRepository) UpdateAlbum(ctx context.Context, album Album) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	stored, ok := repo.albums[album.ID]
+	if !ok {
+		return ErrAlbumNotFound
+	}
+	stored.Title = album.Title
+	stored.Description = album.Description
+	stored.CoverImageID = album.CoverImageID
+	stored.UpdatedAt = album.UpdatedAt
+	repo.albums[album.ID] = stored
+
+	return nil
+}
+
+// ClaimUnownedAlbums gives every album without an owner to the user with
+// ownerID and returns how many it changed
+func (repo *memoryAlbumRepository) ClaimUnownedAlbums(ctx context.Context, ownerID string) (int64, error) {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	var claimed int64
+	for id, album := range repo.albums {
+		if album.OwnerID == "" {
+			album.OwnerID = ownerID
+			repo.albums[id] = album
+			claimed++
+		}
+	}
+
+	return claimed, nil
+}
+
+// DeleteAlbum removes an album
+func (repo *memoryAlbumRepository) DeleteAlbum(ctx context.Context, id string) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	if _, ok := repo.albums[id]; !ok {
+		return ErrAlbumNotFound
+	}
+	delete(repo.albums, id)
+
+	return nil
+}
+
+// AddImages appends images to the end of an album in the given order;
+// images already in the album keep their place
+func (repo *memoryAlbumRepository) AddImages(ctx context.Context, id string, imageIDs []string) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	album, ok := repo.albums[id]
+	if !ok {
+		return ErrAlbumNotFound
+	}
+	for _, imageID := range imageIDs {
+		if !containsID(album.ImageIDs, imageID) {
+			album.ImageIDs = append(album.ImageIDs, imageID)
+		}
+	}
+	repo.albums[id] = album
+
+	return nil
+}
+
+// RemoveImage takes an image out of an album, clearing the cover if it was
+// the cover image
+func (repo *memoryAlbumRepository) RemoveImage(ctx context.Context, id, imageID string) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	album, ok := repo.albums[id]
+	if !ok {
+		return ErrAlbumNotFound
+	}
+	if !containsID(album.ImageIDs, imageID) {
+		return ErrImageNotInAlbum
+	}
+
+	var kept []string
+	for _, candidate := range album.ImageIDs {
+		if candidate != imageID {
+			kept = append(kept, candidate)
+		}
+	}
+	album.ImageIDs = kept
+	if album.CoverImageID == imageID {
+		album.CoverImageID = ""
+	}
+	repo.albums[id] = album
+
+	return nil
+}
+
+// ReorderImages replaces the order of an album's images. imageIDs must
+// list every image in the album exactly once.
+func (repo *memoryAlbumRepository) ReorderImages(ctx context.Context, id string, imageIDs []string) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	album, ok := repo.albums[id]
+	if !ok {
+		return ErrAlbumNotFound
+	}
+	if !isPermutation(album.ImageIDs, imageIDs) {
+		return ErrInvalidImageOrder
+	}
+	album.ImageIDs = append([]string(nil), imageIDs...)
+	repo.albums[id] = album
+
+	return nil
+}
+
+// copyAlbum returns a copy of album that shares no slices with it
+func copyAlbum(album Album) Album {
+	album.ImageIDs = append([]string(nil), album.ImageIDs...)
+	return album
+}
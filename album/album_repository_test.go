@@ -0,0 +1,26 @@
+package album
+
+import (
+	"testing"
+
+	"file-pub/image"
+	"file-pub/internal/database/dbtest"
+)
+
+func TestMemoryAlbumRepository(t *testing.T) {
+	testRepositoryConformance(t, func(t *testing.T) (AlbumRepository, image.ImageRepository) {
+		return NewMemoryAlbumRepository(), image.NewMemoryImageRepository()
+	})
+}
+
+func TestSQLAlbumRepository(t *testing.T) {
+	for _, driver := range dbtest.Drivers {
+		t.Run(driver, func(t *testing.T) {
+			dbtest.SkipUnavailable(t, driver)
+			testRepositoryConformance(t, func(t *testing.T) (AlbumRepository, image.ImageRepository) {
+				db := dbtest.Open(t, driver, "album_images", "albums", "image_tags", "tags", "image_variants", "share_links", "images")
+				return NewAlbumRepository(db, driver), image.NewImageRepository(db, driver)
+			})
+		})
+	}
+}
@@ -0,0 +1,297 @@
+package album
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"file-pub/image"
+	"file-pub/internal/common"
+
+	"github.com/google/uuid"
+)
+
+// AlbumService defines the interface for album business logic
+type AlbumService interface {
+	ListAlbums(ctx context.Context) ([]Album, error)
+	CreateAlbum(ctx context.Context, title, description string) (*Album, error)
+	GetAlbum(ctx context.Context, id string) (*AlbumDetails, error)
+	UpdateAlbum(ctx context.Context, id string, update AlbumUpdate) (*Album, error)
+	DeleteAlbum(ctx context.Context, id string) error
+	AddImages(ctx context.Context, id string, imageIDs []string) (*Album, error)
+	RemoveImage(ctx context.Context, id, imageID string) (*Album, error)
+	ReorderImages(ctx context.Context, id string, imageIDs []string) (*Album, error)
+}
+
+// albumService implements AlbumService
+type albumService struct {
+	albumRepo    AlbumRepository
+	imageService image.ImageService
+	config       Config
+}
+
+// NewAlbumService creates a new AlbumService
+func NewAlbumService(
+	albumRepo AlbumRepository,
+	imageService image.ImageService,
+	config Config,
+) AlbumService {
+	common.PanicOnInvalidDependencies("AlbumService", map[string]interface{}{
+		"albumRepo":    albumRepo,
+		"imageService": imageService,
+	})
+
+	return &albumService{
+		albumRepo:    albumRepo,
+		imageService: imageService,
+		config:       config,
+	}
+}
+
+// ListAlbums retrieves every album, newest first
+func (service *albumService) ListAlbums(ctx context.Context) ([]Album, error) {
+	albums, err := service.albumRepo.ListAlbums(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("listing albums: %w", err)
+	}
+
+	return albums, nil
+}
+
+// CreateAlbum creates an empty album owned by the request's user
+func (service *albumService) CreateAlbum(ctx context.Context, title, description string) (*Album, error) {
+	title, description, err := validateAlbumText(title, description)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC().Truncate(time.Second)
+	album := Album{
+		ID:          uuid.New().String(),
+		Title:       title,
+		Description: description,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+
+	if identity, ok := common.IdentityFromContext(ctx); ok {
+		album.OwnerID = identity.ID
+	}
+
+	if err := service.albumRepo.SaveAlbum(ctx, album); err != nil {
+		return nil, fmt.Errorf("saving album: %w", err)
+	}
+
+	return &album, nil
+}
+
+// GetAlbum retrieves an album with the metadata of its images in album order.
+// Images deleted or made private since they were added are left out.
+func (service *albumService) GetAlbum(ctx context.Context, id string) (*AlbumDetails, error) {
+	album, err := service.albumRepo.GetAlbumByID(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("getting album: %w", err)
+	}
+
+	images, err := service.imageService.GetImages(ctx, album.ImageIDs)
+	if err != nil {
+		return nil, fmt.Errorf("getting album images: %w", err)
+	}
+
+	details := &AlbumDetails{
+		Album:  *album,
+		Images: make([]image.ImageMetadata, 0, len(images)),
+	}
+	for _, img := range images {
+		if !img.Private {
+			details.Images = append(details.Images, img)
+		}
+	}
+
+	// Fall back to the first image when no cover is set or it is gone
+	for i := range details.Images {
+		if details.Images[i].ID == album.CoverImageID {
+			details.Cover = &details.Images[i]
+			break
+		}
+	}
+	if details.Cover == nil && len(details.Images) > 0 {
+		details.Cover = &details.Images[0]
+	}
+
+	return details, nil
+}
+
+// UpdateAlbum changes an album's title, description or cover. The cover must
+// be one of the album's images.
+func (service *albumService) UpdateAlbum(ctx context.Context, id string, update AlbumUpdate) (*Album, error) {
+	album, err := service.getOwnedAlbum(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	title, description := album.Title, album.Description
+	if update.Title != nil {
+		title = *update.Title
+	}
+	if update.Description != nil {
+		description = *update.Description
+	}
+	album.Title, album.Description, err = validateAlbumText(title, description)
+	if err != nil {
+		return nil, err
+	}
+
+	if update.CoverImageID != nil {
+		cover := strings.TrimSpace(*update.CoverImageID)
+		if cover != "" && !containsID(album.ImageIDs, cover) {
+			return nil, fmt.Errorf("%w: cover image %s", ErrImageNotInAlbum, cover)
+		}
+		album.CoverImageID = cover
+	}
+
+	album.UpdatedAt = time.Now().UTC().Truncate(time.Second)
+	if err := service.albumRepo.UpdateAlbum(ctx, *album); err != nil {
+		return nil, fmt.Errorf("updating album: %w", err)
+	}
+
+	return album, nil
+}
+
+// DeleteAlbum deletes an album; its images are not deleted
+func (service *albumService) DeleteAlbum(ctx context.Context, id string) error {
+	if _, err := service.getOwnedAlbum(ctx, id); err != nil {
+		return err
+	}
+	if err := service.albumRepo.DeleteAlbum(ctx, id); err != nil {
+		return fmt.Errorf("deleting album: %w", err)
+	}
+
+	return nil
+}
+
+// AddImages appends existing images to the end of an album; images already
+// in the album keep their place
+func (service *albumService) AddImages(ctx context.Context, id string, imageIDs []string) (*Album, error) {
+	if len(imageIDs) == 0 {
+		return nil, fmt.Errorf("%w: no images given", ErrInvalidAlbum)
+	}
+
+	album, err := service.getOwnedAlbum(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	var added []string
+	for _, imageID := range imageIDs {
+		if !containsID(album.ImageIDs, imageID) && !containsID(added, imageID) {
+			added = append(added, imageID)
+		}
+	}
+	if len(album.ImageIDs)+len(added) > maxAlbumImages {
+		return nil, fmt.Errorf("%w: at most %d images per album", ErrInvalidAlbum, maxAlbumImages)
+	}
+
+	images, err := service.imageService.GetImages(ctx, added)
+	if err != nil {
+		return nil, fmt.Errorf("getting images: %w", err)
+	}
+	if len(images) != len(added) {
+		for _, imageID := range added {
+			if !containsImage(images, imageID) {
+				return nil, fmt.Errorf("%w: %s", image.ErrImageNotFound, imageID)
+			}
+		}
+	}
+
+	if err := service.albumRepo.AddImages(ctx, id, added); err != nil {
+		return nil, fmt.Errorf("adding images to album: %w", err)
+	}
+
+	return service.getAlbum(ctx, id)
+}
+
+// RemoveImage takes an image out of an album; the image itself is kept
+func (service *albumService) RemoveImage(ctx context.Context, id, imageID string) (*Album, error) {
+	if _, err := service.getOwnedAlbum(ctx, id); err != nil {
+		return nil, err
+	}
+	if err := service.albumRepo.RemoveImage(ctx, id, imageID); err != nil {
+		return nil, fmt.Errorf("removing image from album: %w", err)
+	}
+
+	return service.getAlbum(ctx, id)
+}
+
+// ReorderImages sets a new display order; imageIDs must list every image in
+// the album exactly once
+func (service *albumService) ReorderImages(ctx context.Context, id string, imageIDs []string) (*Album, error) {
+	if _, err := service.getOwnedAlbum(ctx, id); err != nil {
+		return nil, err
+	}
+	if err := service.albumRepo.ReorderImages(ctx, id, imageIDs); err != nil {
+		return nil, fmt.Errorf("reordering album: %w", err)
+	}
+
+	return service.getAlbum(ctx, id)
+}
+
+// getAlbum reloads an album after a change
+func (service *albumService) getAlbum(ctx context.Context, id string) (*Album, error) {
+	album, err := service.albumRepo.GetAlbumByID(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("getting album: %w", err)
+	}
+
+	return album, nil
+}
+
+// getOwnedAlbum returns an album when the request's user may change it.
+// Albums without an owner may be changed by anyone, others only by the user
+// who created them.
+func (service *albumService) getOwnedAlbum(ctx context.Context, id string) (*Album, error) {
+	album, err := service.albumRepo.GetAlbumByID(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("getting album: %w", err)
+	}
+	if album.OwnerID == "" {
+		if !service.config.ChangeUnowned {
+			return nil, ErrNotAlbumOwner
+		}
+		return album, nil
+	}
+	if identity, ok := common.IdentityFromContext(ctx); !ok || identity.ID != album.OwnerID {
+		return nil, ErrNotAlbumOwner
+	}
+	return album, nil
+}
+
+// validateAlbumText trims and checks an album's title and description
+func validateAlbumText(title, description string) (string, string, error) {
+	title = strings.TrimSpace(title)
+	description = strings.TrimSpace(description)
+
+	if title == "" {
+		return "", "", fmt.Errorf("%w: title is required", ErrInvalidAlbum)
+	}
+	if utf8.RuneCountInString(title) > maxTitleLength {
+		return "", "", fmt.Errorf("%w: title is longer than %d characters", ErrInvalidAlbum, maxTitleLength)
+	}
+	if utf8.RuneCountInString(description) > maxDescriptionLength {
+		return "", "", fmt.Errorf("%w: description is longer than %d characters", ErrInvalidAlbum, maxDescriptionLength)
+	}
+
+	return title, description, nil
+}
+
+// containsImage reports whether images includes the image with the given ID
+func containsImage(images []image.ImageMetadata, id string) bool {
+	for _, img := range images {
+		if img.ID == id {
+			return true
+		}
+	}
+	return false
+}
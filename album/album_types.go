@@ -0,0 +1,60 @@
+package album
+
+import (
+	"time"
+
+	"file-pub/image"
+)
+
+const (
+	// maxTitleLength is the longest album title, in characters
+	maxTitleLength = 255
+	// maxDescriptionLength is the longest album description, in characters
+	maxDescriptionLength = 4000
+	// maxAlbumImages caps how many images one album can hold
+	maxAlbumImages = 1000
+)
+
+// Album is a titled, ordered collection of images
+type Album struct {
+	ID          string `json:"id" db:"id"`
+	Title       string `json:"title" db:"title"`
+	Description string `json:"description" db:"description"`
+	// CoverImageID is empty when no cover was chosen; the first image is shown instead
+	CoverImageID string `json:"cover_image_id,omitempty" db:"cover_image_id"`
+	// OwnerID is the user who created the album; empty for anonymous and older albums
+	OwnerID   string    `json:"owner_id,omitempty" db:"owner_id"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
+
+	// ImageIDs lists the album's images in display order
+	ImageIDs []string `json:"image_ids,omitempty" db:"-"`
+}
+
+// AlbumDetails is an album together with the metadata of its cover and images
+type AlbumDetails struct {
+	Album
+	Cover  *image.ImageMetadata  `json:"cover,omitempty"`
+	Images []image.ImageMetadata `json:"images"`
+}
+
+// Config holds the album settings
+type Config struct {
+	// ChangeUnowned lets anyone change albums without an owner, created
+	// anonymously or before accounts existed. Otherwise nobody may until
+	// they are given an owner.
+	ChangeUnowned bool
+}
+
+// DefaultConfig returns the default album settings
+func DefaultConfig() Config {
+	return Config{}
+}
+
+// AlbumUpdate holds the album fields to change; nil fields are left as they
+// are and an empty CoverImageID clears the cover
+type AlbumUpdate struct {
+	Title        *string `json:"title"`
+	Description  *string `json:"description"`
+	CoverImageID *string `json:"cover_image_id"`
+}
@@ -0,0 +1,23 @@
+// Package db holds the database schema migrations
+package db
+
+import (
+	"embed"
+	"io/fs"
+)
+
+//go:embed migrations
+var migrationFiles embed.FS
+
+// Migrations holds the versioned schema migrations, one directory per
+// database dialect (e.g. mysql/). Files are named NNNN_description.up.sql
+// and NNNN_description.down.sql.
+var Migrations fs.FS = mustSub(migrationFiles, "migrations")
+
+func mustSub(fsys fs.FS, dir string) fs.FS {
+	sub, err := fs.Sub(fsys, dir)
+	if err != nil {
+		panic(err)
+	}
+	return sub
+}
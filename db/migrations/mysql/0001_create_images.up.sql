@@ -0,0 +1,13 @@
+-- Baseline schema as originally created by the application. IF NOT EXISTS
+-- lets databases created before migrations existed adopt this version.
+CREATE TABLE IF NOT EXISTS images (
+    id VARCHAR(36) PRIMARY KEY,
+    filename VARCHAR(255) NOT NULL,
+    original_name VARCHAR(255) NOT NULL,
+    s3_key VARCHAR(512) NOT NULL,
+    s3_url VARCHAR(1024) NOT NULL,
+    content_type VARCHAR(100) NOT NULL,
+    size BIGINT NOT NULL,
+    uploaded_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    INDEX idx_uploaded_at (uploaded_at DESC)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
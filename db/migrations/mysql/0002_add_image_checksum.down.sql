@@ -0,0 +1,2 @@
+DROP INDEX idx_uploaded_at_id ON images;
+ALTER TABLE images DROP COLUMN checksum;
@@ -0,0 +1,21 @@
+-- MySQL has no ADD COLUMN IF NOT EXISTS; databases upgraded before migrations
+-- existed may already have these, so each change is applied conditionally.
+SET @stmt = IF(
+    (SELECT COUNT(*) FROM information_schema.columns
+     WHERE table_schema = DATABASE() AND table_name = 'images' AND column_name = 'checksum') = 0,
+    'ALTER TABLE images ADD COLUMN checksum CHAR(64) NOT NULL DEFAULT '''' AFTER size',
+    'DO 0'
+);
+PREPARE stmt FROM @stmt;
+EXECUTE stmt;
+DEALLOCATE PREPARE stmt;
+
+SET @stmt = IF(
+    (SELECT COUNT(*) FROM information_schema.statistics
+     WHERE table_schema = DATABASE() AND table_name = 'images' AND index_name = 'idx_uploaded_at_id') = 0,
+    'CREATE INDEX idx_uploaded_at_id ON images (uploaded_at, id)',
+    'DO 0'
+);
+PREPARE stmt FROM @stmt;
+EXECUTE stmt;
+DEALLOCATE PREPARE stmt;
@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS image_variants (
+    image_id VARCHAR(36) NOT NULL,
+    name VARCHAR(32) NOT NULL,
+    s3_key VARCHAR(512) NOT NULL,
+    content_type VARCHAR(100) NOT NULL,
+    width INT NOT NULL,
+    height INT NOT NULL,
+    size BIGINT NOT NULL,
+    PRIMARY KEY (image_id, name),
+    CONSTRAINT fk_image_variants_image FOREIGN KEY (image_id) REFERENCES images (id) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
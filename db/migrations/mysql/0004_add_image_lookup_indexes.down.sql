@@ -0,0 +1,2 @@
+DROP INDEX idx_content_type ON images;
+DROP INDEX idx_filename ON images;
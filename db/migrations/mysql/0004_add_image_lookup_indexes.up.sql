@@ -0,0 +1,21 @@
+-- These indexes were declared in db/init.sql but never created by the
+-- application, so only some databases have them.
+SET @stmt = IF(
+    (SELECT COUNT(*) FROM information_schema.statistics
+     WHERE table_schema = DATABASE() AND table_name = 'images' AND index_name = 'idx_filename') = 0,
+    'CREATE INDEX idx_filename ON images (filename)',
+    'DO 0'
+);
+PREPARE stmt FROM @stmt;
+EXECUTE stmt;
+DEALLOCATE PREPARE stmt;
+
+SET @stmt = IF(
+    (SELECT COUNT(*) FROM information_schema.statistics
+     WHERE table_schema = DATABASE() AND table_name = 'images' AND index_name = 'idx_content_type') = 0,
+    'CREATE INDEX idx_content_type ON images (content_type)',
+    'DO 0'
+);
+PREPARE stmt FROM @stmt;
+EXECUTE stmt;
+DEALLOCATE PREPARE stmt;
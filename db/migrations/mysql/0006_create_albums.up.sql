@@ -0,0 +1,20 @@
+CREATE TABLE IF NOT EXISTS albums (
+    id VARCHAR(36) PRIMARY KEY,
+    title VARCHAR(255) NOT NULL,
+    description TEXT NOT NULL,
+    cover_image_id VARCHAR(36) NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    INDEX idx_albums_created_at (created_at, id),
+    CONSTRAINT fk_albums_cover_image FOREIGN KEY (cover_image_id) REFERENCES images (id) ON DELETE SET NULL
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+CREATE TABLE IF NOT EXISTS album_images (
+    album_id VARCHAR(36) NOT NULL,
+    image_id VARCHAR(36) NOT NULL,
+    position INT NOT NULL,
+    PRIMARY KEY (album_id, image_id),
+    INDEX idx_album_images_image (image_id),
+    CONSTRAINT fk_album_images_album FOREIGN KEY (album_id) REFERENCES albums (id) ON DELETE CASCADE,
+    CONSTRAINT fk_album_images_image FOREIGN KEY (image_id) REFERENCES images (id) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
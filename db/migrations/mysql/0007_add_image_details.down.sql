@@ -0,0 +1,4 @@
+ALTER TABLE images
+    DROP COLUMN alt_text,
+    DROP COLUMN description,
+    DROP COLUMN title;
@@ -0,0 +1,6 @@
+-- TEXT columns cannot have a literal default before MySQL 8.0.13; existing
+-- rows get the implicit default, an empty string
+ALTER TABLE images
+    ADD COLUMN title VARCHAR(255) NOT NULL DEFAULT '' AFTER original_name,
+    ADD COLUMN description TEXT NOT NULL AFTER title,
+    ADD COLUMN alt_text VARCHAR(1000) NOT NULL DEFAULT '' AFTER description;
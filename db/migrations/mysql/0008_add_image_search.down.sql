@@ -0,0 +1 @@
+DROP INDEX ft_images_search ON images;
@@ -0,0 +1,3 @@
+-- InnoDB ignores words shorter than innodb_ft_min_token_size (3 by default)
+-- and its stopword list; tags are matched separately and are not affected
+CREATE FULLTEXT INDEX ft_images_search ON images (original_name, title, description);
@@ -0,0 +1,9 @@
+ALTER TABLE images
+    DROP COLUMN gps_longitude,
+    DROP COLUMN gps_latitude,
+    DROP COLUMN taken_at,
+    DROP COLUMN camera_model,
+    DROP COLUMN camera_make,
+    DROP COLUMN orientation,
+    DROP COLUMN height,
+    DROP COLUMN width;
@@ -0,0 +1,11 @@
+-- Dimensions and EXIF fields extracted at upload. Zero dimensions mean the
+-- image was uploaded before they were recorded.
+ALTER TABLE images
+    ADD COLUMN width INT NOT NULL DEFAULT 0 AFTER uploaded_at,
+    ADD COLUMN height INT NOT NULL DEFAULT 0 AFTER width,
+    ADD COLUMN orientation SMALLINT NOT NULL DEFAULT 0 AFTER height,
+    ADD COLUMN camera_make VARCHAR(255) NOT NULL DEFAULT '' AFTER orientation,
+    ADD COLUMN camera_model VARCHAR(255) NOT NULL DEFAULT '' AFTER camera_make,
+    ADD COLUMN taken_at DATETIME NULL AFTER camera_model,
+    ADD COLUMN gps_latitude DOUBLE NULL AFTER taken_at,
+    ADD COLUMN gps_longitude DOUBLE NULL AFTER gps_latitude;
@@ -0,0 +1,2 @@
+-- Blob key of the unmodified upload, kept privately when metadata is stripped
+ALTER TABLE images ADD COLUMN original_key VARCHAR(512) NOT NULL DEFAULT '' AFTER s3_url;
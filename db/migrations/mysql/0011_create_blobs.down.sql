@@ -0,0 +1,2 @@
+DROP INDEX idx_images_checksum ON images;
+DROP TABLE IF EXISTS blobs;
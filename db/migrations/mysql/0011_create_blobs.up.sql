@@ -0,0 +1,11 @@
+-- Reference counts for content-addressed blobs. Existing images keep their
+-- own keys, so each starts with the images already using it.
+CREATE TABLE IF NOT EXISTS blobs (
+    s3_key VARCHAR(512) NOT NULL PRIMARY KEY,
+    ref_count INT NOT NULL DEFAULT 0
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+INSERT INTO blobs (s3_key, ref_count)
+SELECT s3_key, COUNT(*) FROM images GROUP BY s3_key;
+INSERT INTO blobs (s3_key, ref_count)
+SELECT original_key, COUNT(*) FROM images WHERE original_key <> '' GROUP BY original_key;
+CREATE INDEX idx_images_checksum ON images (checksum);
@@ -0,0 +1,2 @@
+-- 64-bit difference hash as 16 hex digits, compared by Hamming distance
+ALTER TABLE images ADD COLUMN perceptual_hash VARCHAR(16) NOT NULL DEFAULT '' AFTER checksum;
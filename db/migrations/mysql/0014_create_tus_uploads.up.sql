@@ -0,0 +1,26 @@
+-- Resumable tus uploads. Bytes short of a full part wait in the tail object;
+-- full parts are uploaded to the multipart upload and listed in
+-- tus_upload_parts. Completed uploads are kept until they expire so clients
+-- can still ask for their offset.
+CREATE TABLE IF NOT EXISTS tus_uploads (
+    id VARCHAR(36) PRIMARY KEY,
+    s3_key VARCHAR(512) NOT NULL,
+    multipart_id VARCHAR(1024) NOT NULL DEFAULT '',
+    upload_length BIGINT NOT NULL,
+    upload_offset BIGINT NOT NULL DEFAULT 0,
+    metadata TEXT NOT NULL,
+    tail_key VARCHAR(512) NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    expires_at TIMESTAMP NOT NULL,
+    completed_at TIMESTAMP NULL,
+    INDEX idx_tus_uploads_expires_at (expires_at)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+CREATE TABLE IF NOT EXISTS tus_upload_parts (
+    upload_id VARCHAR(36) NOT NULL,
+    part_number INT NOT NULL,
+    etag VARCHAR(255) NOT NULL,
+    size BIGINT NOT NULL,
+    PRIMARY KEY (upload_id, part_number),
+    CONSTRAINT fk_tus_upload_parts_upload FOREIGN KEY (upload_id) REFERENCES tus_uploads (id) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
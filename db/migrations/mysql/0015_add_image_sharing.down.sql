@@ -0,0 +1,2 @@
+ALTER TABLE images DROP COLUMN private;
+DROP TABLE IF EXISTS share_links;
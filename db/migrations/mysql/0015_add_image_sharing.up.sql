@@ -0,0 +1,16 @@
+-- Signed links that open private images. Each link can expire, be revoked,
+-- run out of downloads or ask for a password (a bcrypt hash, or empty).
+CREATE TABLE IF NOT EXISTS share_links (
+    id VARCHAR(36) PRIMARY KEY,
+    image_id VARCHAR(36) NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    max_downloads INT NOT NULL DEFAULT 0,
+    download_count INT NOT NULL DEFAULT 0,
+    password_hash VARCHAR(255) NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    INDEX idx_share_links_image_id (image_id),
+    CONSTRAINT fk_share_links_image FOREIGN KEY (image_id) REFERENCES images (id) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+-- Private images are only served through share links
+ALTER TABLE images ADD COLUMN private BOOLEAN NOT NULL DEFAULT FALSE AFTER alt_text;
@@ -0,0 +1,30 @@
+-- Accounts that sign in with a username and a bcrypt password hash
+CREATE TABLE IF NOT EXISTS users (
+    id VARCHAR(36) PRIMARY KEY,
+    username VARCHAR(32) NOT NULL,
+    password_hash VARCHAR(255) NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE KEY idx_users_username (username)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+-- Login sessions, keyed by the SHA-256 of the token kept in the cookie
+CREATE TABLE IF NOT EXISTS sessions (
+    id VARCHAR(64) PRIMARY KEY,
+    user_id VARCHAR(36) NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    expires_at TIMESTAMP NOT NULL,
+    INDEX idx_sessions_user_id (user_id),
+    INDEX idx_sessions_expires_at (expires_at),
+    CONSTRAINT fk_sessions_user FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+-- The user who uploaded an image; empty for anonymous and older uploads
+ALTER TABLE images ADD COLUMN owner_id VARCHAR(36) NOT NULL DEFAULT '' AFTER private;
+CREATE INDEX idx_images_owner_id ON images (owner_id);
+
+-- The user who started a direct or resumable upload, who will own the image
+ALTER TABLE upload_reservations ADD COLUMN owner_id VARCHAR(36) NOT NULL DEFAULT '' AFTER size;
+ALTER TABLE tus_uploads ADD COLUMN owner_id VARCHAR(36) NOT NULL DEFAULT '' AFTER tail_key;
+
+-- The user who created an album; empty for anonymous and older albums
+ALTER TABLE albums ADD COLUMN owner_id VARCHAR(36) NOT NULL DEFAULT '' AFTER cover_image_id;
@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS images (
+    id VARCHAR(36) PRIMARY KEY,
+    filename VARCHAR(255) NOT NULL,
+    original_name VARCHAR(255) NOT NULL,
+    s3_key VARCHAR(512) NOT NULL,
+    s3_url VARCHAR(1024) NOT NULL,
+    content_type VARCHAR(100) NOT NULL,
+    size BIGINT NOT NULL,
+    uploaded_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS idx_uploaded_at ON images (uploaded_at DESC);
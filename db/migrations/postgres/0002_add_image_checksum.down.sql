@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_uploaded_at_id;
+ALTER TABLE images DROP COLUMN IF EXISTS checksum;
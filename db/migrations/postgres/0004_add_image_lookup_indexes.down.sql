@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_content_type;
+DROP INDEX IF EXISTS idx_filename;
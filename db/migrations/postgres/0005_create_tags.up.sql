@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS tags (
+    id BIGSERIAL PRIMARY KEY,
+    name VARCHAR(64) NOT NULL UNIQUE
+);
+
+CREATE TABLE IF NOT EXISTS image_tags (
+    image_id VARCHAR(36) NOT NULL REFERENCES images (id) ON DELETE CASCADE,
+    tag_id BIGINT NOT NULL REFERENCES tags (id) ON DELETE CASCADE,
+    PRIMARY KEY (image_id, tag_id)
+);
+CREATE INDEX IF NOT EXISTS idx_image_tags_tag ON image_tags (tag_id);
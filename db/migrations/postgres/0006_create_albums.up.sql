@@ -0,0 +1,17 @@
+CREATE TABLE IF NOT EXISTS albums (
+    id VARCHAR(36) PRIMARY KEY,
+    title VARCHAR(255) NOT NULL,
+    description TEXT NOT NULL,
+    cover_image_id VARCHAR(36) NULL REFERENCES images (id) ON DELETE SET NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS idx_albums_created_at ON albums (created_at, id);
+
+CREATE TABLE IF NOT EXISTS album_images (
+    album_id VARCHAR(36) NOT NULL REFERENCES albums (id) ON DELETE CASCADE,
+    image_id VARCHAR(36) NOT NULL REFERENCES images (id) ON DELETE CASCADE,
+    position INTEGER NOT NULL,
+    PRIMARY KEY (album_id, image_id)
+);
+CREATE INDEX IF NOT EXISTS idx_album_images_image ON album_images (image_id);
@@ -0,0 +1,3 @@
+ALTER TABLE images DROP COLUMN IF EXISTS alt_text;
+ALTER TABLE images DROP COLUMN IF EXISTS description;
+ALTER TABLE images DROP COLUMN IF EXISTS title;
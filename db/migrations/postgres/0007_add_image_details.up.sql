@@ -0,0 +1,3 @@
+ALTER TABLE images ADD COLUMN IF NOT EXISTS title VARCHAR(255) NOT NULL DEFAULT '';
+ALTER TABLE images ADD COLUMN IF NOT EXISTS description TEXT NOT NULL DEFAULT '';
+ALTER TABLE images ADD COLUMN IF NOT EXISTS alt_text VARCHAR(1000) NOT NULL DEFAULT '';
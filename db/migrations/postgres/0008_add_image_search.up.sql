@@ -0,0 +1,3 @@
+-- The indexed expression must match the one the repository queries with
+CREATE INDEX IF NOT EXISTS idx_images_search ON images
+    USING GIN (to_tsvector('simple', original_name || ' ' || title || ' ' || description));
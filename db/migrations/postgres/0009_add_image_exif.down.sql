@@ -0,0 +1,8 @@
+ALTER TABLE images DROP COLUMN IF EXISTS gps_longitude;
+ALTER TABLE images DROP COLUMN IF EXISTS gps_latitude;
+ALTER TABLE images DROP COLUMN IF EXISTS taken_at;
+ALTER TABLE images DROP COLUMN IF EXISTS camera_model;
+ALTER TABLE images DROP COLUMN IF EXISTS camera_make;
+ALTER TABLE images DROP COLUMN IF EXISTS orientation;
+ALTER TABLE images DROP COLUMN IF EXISTS height;
+ALTER TABLE images DROP COLUMN IF EXISTS width;
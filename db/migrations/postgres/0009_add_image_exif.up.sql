@@ -0,0 +1,8 @@
+ALTER TABLE images ADD COLUMN IF NOT EXISTS width INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE images ADD COLUMN IF NOT EXISTS height INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE images ADD COLUMN IF NOT EXISTS orientation SMALLINT NOT NULL DEFAULT 0;
+ALTER TABLE images ADD COLUMN IF NOT EXISTS camera_make VARCHAR(255) NOT NULL DEFAULT '';
+ALTER TABLE images ADD COLUMN IF NOT EXISTS camera_model VARCHAR(255) NOT NULL DEFAULT '';
+ALTER TABLE images ADD COLUMN IF NOT EXISTS taken_at TIMESTAMPTZ NULL;
+ALTER TABLE images ADD COLUMN IF NOT EXISTS gps_latitude DOUBLE PRECISION NULL;
+ALTER TABLE images ADD COLUMN IF NOT EXISTS gps_longitude DOUBLE PRECISION NULL;
@@ -0,0 +1 @@
+ALTER TABLE images ADD COLUMN IF NOT EXISTS original_key VARCHAR(512) NOT NULL DEFAULT '';
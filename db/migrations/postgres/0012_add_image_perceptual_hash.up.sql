@@ -0,0 +1 @@
+ALTER TABLE images ADD COLUMN IF NOT EXISTS perceptual_hash VARCHAR(16) NOT NULL DEFAULT '';
@@ -0,0 +1,12 @@
+-- Image IDs and object keys handed out for uploads sent straight to the
+-- blob store, until the upload is completed or expires
+CREATE TABLE IF NOT EXISTS upload_reservations (
+    id VARCHAR(36) PRIMARY KEY,
+    s3_key VARCHAR(512) NOT NULL,
+    original_name VARCHAR(255) NOT NULL,
+    content_type VARCHAR(100) NOT NULL,
+    size BIGINT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    expires_at TIMESTAMPTZ NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_upload_reservations_expires_at ON upload_reservations (expires_at);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS tus_upload_parts;
+DROP TABLE IF EXISTS tus_uploads;
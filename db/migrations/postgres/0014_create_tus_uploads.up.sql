@@ -0,0 +1,25 @@
+-- Resumable tus uploads. Bytes short of a full part wait in the tail object;
+-- full parts are uploaded to the multipart upload and listed in
+-- tus_upload_parts. Completed uploads are kept until they expire so clients
+-- can still ask for their offset.
+CREATE TABLE IF NOT EXISTS tus_uploads (
+    id VARCHAR(36) PRIMARY KEY,
+    s3_key VARCHAR(512) NOT NULL,
+    multipart_id VARCHAR(1024) NOT NULL DEFAULT '',
+    upload_length BIGINT NOT NULL,
+    upload_offset BIGINT NOT NULL DEFAULT 0,
+    metadata TEXT NOT NULL,
+    tail_key VARCHAR(512) NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    expires_at TIMESTAMPTZ NOT NULL,
+    completed_at TIMESTAMPTZ NULL
+);
+CREATE INDEX IF NOT EXISTS idx_tus_uploads_expires_at ON tus_uploads (expires_at);
+
+CREATE TABLE IF NOT EXISTS tus_upload_parts (
+    upload_id VARCHAR(36) NOT NULL REFERENCES tus_uploads (id) ON DELETE CASCADE,
+    part_number INTEGER NOT NULL,
+    etag VARCHAR(255) NOT NULL,
+    size BIGINT NOT NULL,
+    PRIMARY KEY (upload_id, part_number)
+);
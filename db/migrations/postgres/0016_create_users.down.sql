@@ -0,0 +1,7 @@
+ALTER TABLE albums DROP COLUMN IF EXISTS owner_id;
+ALTER TABLE tus_uploads DROP COLUMN IF EXISTS owner_id;
+ALTER TABLE upload_reservations DROP COLUMN IF EXISTS owner_id;
+DROP INDEX IF EXISTS idx_images_owner_id;
+ALTER TABLE images DROP COLUMN IF EXISTS owner_id;
+DROP TABLE IF EXISTS sessions;
+DROP TABLE IF EXISTS users;
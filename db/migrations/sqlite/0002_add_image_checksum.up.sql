@@ -0,0 +1,2 @@
+ALTER TABLE images ADD COLUMN checksum TEXT NOT NULL DEFAULT '';
+CREATE INDEX IF NOT EXISTS idx_uploaded_at_id ON images (uploaded_at, id);
@@ -0,0 +1,2 @@
+CREATE INDEX IF NOT EXISTS idx_filename ON images (filename);
+CREATE INDEX IF NOT EXISTS idx_content_type ON images (content_type);
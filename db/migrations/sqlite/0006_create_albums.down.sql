@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS album_images;
+DROP TABLE IF EXISTS albums;
@@ -0,0 +1,17 @@
+CREATE TABLE IF NOT EXISTS albums (
+    id TEXT PRIMARY KEY,
+    title TEXT NOT NULL,
+    description TEXT NOT NULL,
+    cover_image_id TEXT NULL REFERENCES images (id) ON DELETE SET NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS idx_albums_created_at ON albums (created_at, id);
+
+CREATE TABLE IF NOT EXISTS album_images (
+    album_id TEXT NOT NULL REFERENCES albums (id) ON DELETE CASCADE,
+    image_id TEXT NOT NULL REFERENCES images (id) ON DELETE CASCADE,
+    position INTEGER NOT NULL,
+    PRIMARY KEY (album_id, image_id)
+);
+CREATE INDEX IF NOT EXISTS idx_album_images_image ON album_images (image_id);
@@ -0,0 +1,3 @@
+ALTER TABLE images DROP COLUMN alt_text;
+ALTER TABLE images DROP COLUMN description;
+ALTER TABLE images DROP COLUMN title;
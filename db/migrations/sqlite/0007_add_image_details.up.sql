@@ -0,0 +1,3 @@
+ALTER TABLE images ADD COLUMN title TEXT NOT NULL DEFAULT '';
+ALTER TABLE images ADD COLUMN description TEXT NOT NULL DEFAULT '';
+ALTER TABLE images ADD COLUMN alt_text TEXT NOT NULL DEFAULT '';
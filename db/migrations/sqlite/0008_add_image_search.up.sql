@@ -0,0 +1,30 @@
+-- SQLite has no full-text index on ordinary tables, so an FTS5 table mirrors
+-- the searchable columns and triggers keep it in step with images
+CREATE VIRTUAL TABLE IF NOT EXISTS images_fts USING fts5(
+    id UNINDEXED,
+    original_name,
+    title,
+    description,
+    tokenize = 'unicode61 remove_diacritics 2'
+);
+
+INSERT INTO images_fts (id, original_name, title, description)
+SELECT id, original_name, title, description FROM images;
+
+CREATE TRIGGER IF NOT EXISTS images_fts_insert AFTER INSERT ON images
+BEGIN
+    INSERT INTO images_fts (id, original_name, title, description)
+    VALUES (new.id, new.original_name, new.title, new.description);
+END;
+
+CREATE TRIGGER IF NOT EXISTS images_fts_update AFTER UPDATE OF original_name, title, description ON images
+BEGIN
+    DELETE FROM images_fts WHERE id = old.id;
+    INSERT INTO images_fts (id, original_name, title, description)
+    VALUES (new.id, new.original_name, new.title, new.description);
+END;
+
+CREATE TRIGGER IF NOT EXISTS images_fts_delete AFTER DELETE ON images
+BEGIN
+    DELETE FROM images_fts WHERE id = old.id;
+END;
@@ -0,0 +1,8 @@
+ALTER TABLE images DROP COLUMN gps_longitude;
+ALTER TABLE images DROP COLUMN gps_latitude;
+ALTER TABLE images DROP COLUMN taken_at;
+ALTER TABLE images DROP COLUMN camera_model;
+ALTER TABLE images DROP COLUMN camera_make;
+ALTER TABLE images DROP COLUMN orientation;
+ALTER TABLE images DROP COLUMN height;
+ALTER TABLE images DROP COLUMN width;
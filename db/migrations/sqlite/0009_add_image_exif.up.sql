@@ -0,0 +1,8 @@
+ALTER TABLE images ADD COLUMN width INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE images ADD COLUMN height INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE images ADD COLUMN orientation INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE images ADD COLUMN camera_make TEXT NOT NULL DEFAULT '';
+ALTER TABLE images ADD COLUMN camera_model TEXT NOT NULL DEFAULT '';
+ALTER TABLE images ADD COLUMN taken_at TIMESTAMP NULL;
+ALTER TABLE images ADD COLUMN gps_latitude REAL NULL;
+ALTER TABLE images ADD COLUMN gps_longitude REAL NULL;
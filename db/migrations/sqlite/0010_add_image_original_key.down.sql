@@ -0,0 +1 @@
+ALTER TABLE images DROP COLUMN original_key;
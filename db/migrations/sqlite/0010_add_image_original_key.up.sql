@@ -0,0 +1 @@
+ALTER TABLE images ADD COLUMN original_key TEXT NOT NULL DEFAULT '';
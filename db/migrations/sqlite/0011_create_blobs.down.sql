@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_images_checksum;
+DROP TABLE IF EXISTS blobs;
@@ -0,0 +1 @@
+ALTER TABLE images ADD COLUMN perceptual_hash TEXT NOT NULL DEFAULT '';
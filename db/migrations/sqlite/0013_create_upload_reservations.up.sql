@@ -0,0 +1,12 @@
+-- Image IDs and object keys handed out for uploads sent straight to the
+-- blob store, until the upload is completed or expires
+CREATE TABLE IF NOT EXISTS upload_reservations (
+    id TEXT PRIMARY KEY,
+    s3_key TEXT NOT NULL,
+    original_name TEXT NOT NULL,
+    content_type TEXT NOT NULL,
+    size INTEGER NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    expires_at TIMESTAMP NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_upload_reservations_expires_at ON upload_reservations (expires_at);
@@ -0,0 +1,25 @@
+-- Resumable tus uploads. Bytes short of a full part wait in the tail object;
+-- full parts are uploaded to the multipart upload and listed in
+-- tus_upload_parts. Completed uploads are kept until they expire so clients
+-- can still ask for their offset.
+CREATE TABLE IF NOT EXISTS tus_uploads (
+    id TEXT PRIMARY KEY,
+    s3_key TEXT NOT NULL,
+    multipart_id TEXT NOT NULL DEFAULT '',
+    upload_length INTEGER NOT NULL,
+    upload_offset INTEGER NOT NULL DEFAULT 0,
+    metadata TEXT NOT NULL,
+    tail_key TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    expires_at TIMESTAMP NOT NULL,
+    completed_at TIMESTAMP NULL
+);
+CREATE INDEX IF NOT EXISTS idx_tus_uploads_expires_at ON tus_uploads (expires_at);
+
+CREATE TABLE IF NOT EXISTS tus_upload_parts (
+    upload_id TEXT NOT NULL REFERENCES tus_uploads (id) ON DELETE CASCADE,
+    part_number INTEGER NOT NULL,
+    etag TEXT NOT NULL,
+    size INTEGER NOT NULL,
+    PRIMARY KEY (upload_id, part_number)
+);
@@ -0,0 +1,15 @@
+-- Signed links that open private images. Each link can expire, be revoked,
+-- run out of downloads or ask for a password (a bcrypt hash, or empty).
+CREATE TABLE IF NOT EXISTS share_links (
+    id TEXT PRIMARY KEY,
+    image_id TEXT NOT NULL REFERENCES images (id) ON DELETE CASCADE,
+    expires_at TIMESTAMP NOT NULL,
+    max_downloads INTEGER NOT NULL DEFAULT 0,
+    download_count INTEGER NOT NULL DEFAULT 0,
+    password_hash TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS idx_share_links_image_id ON share_links (image_id);
+
+-- Private images are only served through share links
+ALTER TABLE images ADD COLUMN private BOOLEAN NOT NULL DEFAULT 0;
@@ -0,0 +1,7 @@
+ALTER TABLE albums DROP COLUMN owner_id;
+ALTER TABLE tus_uploads DROP COLUMN owner_id;
+ALTER TABLE upload_reservations DROP COLUMN owner_id;
+DROP INDEX IF EXISTS idx_images_owner_id;
+ALTER TABLE images DROP COLUMN owner_id;
+DROP TABLE IF EXISTS sessions;
+DROP TABLE IF EXISTS users;
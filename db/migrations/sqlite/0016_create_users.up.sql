@@ -0,0 +1,28 @@
+-- Accounts that sign in with a username and a bcrypt password hash
+CREATE TABLE IF NOT EXISTS users (
+    id TEXT PRIMARY KEY,
+    username TEXT NOT NULL UNIQUE,
+    password_hash TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Login sessions, keyed by the SHA-256 of the token kept in the cookie
+CREATE TABLE IF NOT EXISTS sessions (
+    id TEXT PRIMARY KEY,
+    user_id TEXT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    expires_at TIMESTAMP NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_sessions_user_id ON sessions (user_id);
+CREATE INDEX IF NOT EXISTS idx_sessions_expires_at ON sessions (expires_at);
+
+-- The user who uploaded an image; empty for anonymous and older uploads
+ALTER TABLE images ADD COLUMN owner_id TEXT NOT NULL DEFAULT '';
+CREATE INDEX IF NOT EXISTS idx_images_owner_id ON images (owner_id);
+
+-- The user who started a direct or resumable upload, who will own the image
+ALTER TABLE upload_reservations ADD COLUMN owner_id TEXT NOT NULL DEFAULT '';
+ALTER TABLE tus_uploads ADD COLUMN owner_id TEXT NOT NULL DEFAULT '';
+
+-- The user who created an album; empty for anonymous and older albums
+ALTER TABLE albums ADD COLUMN owner_id TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,412 @@
+package image
+
+import (
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+
+	"file-pub/internal/common"
+	"file-pub/storage"
+)
+
+// apiImagesPath is the prefix of the versioned JSON images API
+const apiImagesPath = "/api/v1/images"
+
+// apiUploadsPath is the prefix of the direct upload API
+const apiUploadsPath = "/api/v1/uploads"
+
+// maxJSONBodySize caps JSON request bodies
+const maxJSONBodySize = 64 << 10
+
+// imageListResponse is the JSON body returned when listing images
+type imageListResponse struct {
+	Images     []ImageMetadata `json:"images"`
+	Count      int             `json:"count"`
+	Total      int64           `json:"total"`
+	NextCursor string          `json:"next_cursor,omitempty"`
+	PrevCursor string          `json:"prev_cursor,omitempty"`
+}
+
+// similarImagesResponse is the JSON body returned when listing similar images
+type similarImagesResponse struct {
+	Images []SimilarImage `json:"images"`
+	Count  int            `json:"count"`
+}
+
+// HandleAPIImages handles /api/v1/images: GET lists images, POST uploads one
+func (handler *ImageHandler) HandleAPIImages(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		handler.apiListImages(w, r)
+	case http.MethodPost:
+		handler.apiUploadImage(w, r)
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		common.WriteJSONError(w, http.StatusMethodNotAllowed, "method_not_allowed", "Method not allowed")
+	}
+}
+
+// HandleAPIImage handles /api/v1/images/{id}: GET returns metadata, PATCH
+// edits the title, description and alt text, and DELETE removes the image.
+// /api/v1/images/{id}/tags adds tags with POST and /api/v1/images/{id}/tags/{tag}
+// removes one with DELETE. GET /api/v1/images/{id}/similar lists images that
+// look alike. /api/v1/images/{id}/links lists share links with GET and creates
+// one with POST, and DELETE /api/v1/images/{id}/links/{linkID} revokes one.
+func (handler *ImageHandler) HandleAPIImage(w http.ResponseWriter, r *http.Request) {
+	id, subresource, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, apiImagesPath+"/"), "/")
+	if id == "" {
+		common.WriteJSONError(w, http.StatusNotFound, "not_found", "Unknown API endpoint")
+		return
+	}
+
+	switch {
+	case subresource == "":
+		switch r.Method {
+		case http.MethodGet:
+			handler.apiGetImage(w, r, id)
+		case http.MethodPatch:
+			handler.apiUpdateImage(w, r, id)
+		case http.MethodDelete:
+			handler.apiDeleteImage(w, r, id)
+		default:
+			w.Header().Set("Allow", "GET, PATCH, DELETE")
+			common.WriteJSONError(w, http.StatusMethodNotAllowed, "method_not_allowed", "Method not allowed")
+		}
+	case subresource == "tags":
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", "POST")
+			common.WriteJSONError(w, http.StatusMethodNotAllowed, "method_not_allowed", "Method not allowed")
+			return
+		}
+		handler.apiAddTags(w, r, id)
+	case strings.HasPrefix(subresource, "tags/") && len(subresource) > len("tags/"):
+		if r.Method != http.MethodDelete {
+			w.Header().Set("Allow", "DELETE")
+			common.WriteJSONError(w, http.StatusMethodNotAllowed, "method_not_allowed", "Method not allowed")
+			return
+		}
+		handler.apiRemoveTag(w, r, id, strings.TrimPrefix(subresource, "tags/"))
+	case subresource == "similar":
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", "GET")
+			common.WriteJSONError(w, http.StatusMethodNotAllowed, "method_not_allowed", "Method not allowed")
+			return
+		}
+		handler.apiSimilarImages(w, r, id)
+	case subresource == "links":
+		switch r.Method {
+		case http.MethodGet:
+			handler.apiListShareLinks(w, r, id)
+		case http.MethodPost:
+			handler.apiCreateShareLink(w, r, id)
+		default:
+			w.Header().Set("Allow", "GET, POST")
+			common.WriteJSONError(w, http.StatusMethodNotAllowed, "method_not_allowed", "Method not allowed")
+		}
+	case strings.HasPrefix(subresource, "links/") && len(subresource) > len("links/"):
+		if r.Method != http.MethodDelete {
+			w.Header().Set("Allow", "DELETE")
+			common.WriteJSONError(w, http.StatusMethodNotAllowed, "method_not_allowed", "Method not allowed")
+			return
+		}
+		handler.apiRevokeShareLink(w, r, id, strings.TrimPrefix(subresource, "links/"))
+	default:
+		common.WriteJSONError(w, http.StatusNotFound, "not_found", "Unknown API endpoint")
+	}
+}
+
+// apiListImages returns one page of images as JSON
+func (handler *ImageHandler) apiListImages(w http.ResponseWriter, r *http.Request) {
+	query, err := imageQueryFromRequest(r)
+	if err != nil {
+		if errors.Is(err, ErrInvalidSearch) {
+			writeAPIError(w, "parsing image query", err)
+			return
+		}
+		common.WriteJSONError(w, http.StatusBadRequest, "invalid_request", err.Error())
+		return
+	}
+
+	page, err := handler.imageService.GetAllImages(r.Context(), query)
+	if err != nil {
+		writeAPIError(w, "listing images", err)
+		return
+	}
+
+	images := page.Images
+	if images == nil {
+		images = []ImageMetadata{}
+	}
+
+	common.WriteJSON(w, http.StatusOK, imageListResponse{
+		Images:     images,
+		Count:      len(images),
+		Total:      page.Total,
+		NextCursor: page.NextCursor,
+		PrevCursor: page.PrevCursor,
+	})
+}
+
+// apiGetImage returns the metadata of a single image as JSON
+func (handler *ImageHandler) apiGetImage(w http.ResponseWriter, r *http.Request, id string) {
+	metadata, err := handler.imageService.GetImage(r.Context(), id)
+	if err != nil {
+		writeAPIError(w, "getting image "+id, err)
+		return
+	}
+
+	common.WriteJSON(w, http.StatusOK, metadata)
+}
+
+// apiSimilarImages returns the images similar to one, closest first, as JSON
+func (handler *ImageHandler) apiSimilarImages(w http.ResponseWriter, r *http.Request, id string) {
+	limit, err := limitFromRequest(r)
+	if err != nil {
+		common.WriteJSONError(w, http.StatusBadRequest, "invalid_request", err.Error())
+		return
+	}
+
+	similar, err := handler.imageService.FindSimilarImages(r.Context(), id, limit)
+	if err != nil {
+		writeAPIError(w, "finding images similar to "+id, err)
+		return
+	}
+
+	common.WriteJSON(w, http.StatusOK, similarImagesResponse{
+		Images: similar,
+		Count:  len(similar),
+	})
+}
+
+// apiUploadImage uploads a multipart "image" file and returns the created metadata
+func (handler *ImageHandler) apiUploadImage(w http.ResponseWriter, r *http.Request) {
+	if err := handler.parseUploadForm(w, r); err != nil {
+		log.Printf("Error parsing form: %v", err)
+		if errors.Is(err, ErrFileTooLarge) {
+			writeAPIError(w, "parsing upload form", err)
+			return
+		}
+		common.WriteJSONError(w, http.StatusBadRequest, "invalid_request", "Expected a multipart/form-data body")
+		return
+	}
+
+	file, header, err := r.FormFile("image")
+	if err != nil {
+		log.Printf("Error reading file: %v", err)
+		common.WriteJSONError(w, http.StatusBadRequest, "invalid_request", `Missing "image" file field`)
+		return
+	}
+	defer file.Close()
+
+	opts, err := uploadOptionsFromForm(r)
+	if err != nil {
+		common.WriteJSONError(w, http.StatusBadRequest, "invalid_request", err.Error())
+		return
+	}
+
+	metadata, err := handler.imageService.UploadImage(
+		r.Context(),
+		file,
+		header.Filename,
+		header.Header.Get("Content-Type"),
+		header.Size,
+		opts,
+	)
+	if err != nil {
+		writeAPIError(w, "uploading image", err)
+		return
+	}
+
+	w.Header().Set("Location", apiImagesPath+"/"+metadata.ID)
+	common.WriteJSON(w, http.StatusCreated, metadata)
+}
+
+// apiUpdateImage applies the fields present in the body and returns the updated metadata
+func (handler *ImageHandler) apiUpdateImage(w http.ResponseWriter, r *http.Request, id string) {
+	var update ImageUpdate
+	if err := common.ReadJSON(w, r, maxJSONBodySize, &update); err != nil {
+		common.WriteJSONError(w, http.StatusBadRequest, "invalid_request", `Expected a JSON body with "title", "description", "alt_text" or "private"`)
+		return
+	}
+
+	metadata, err := handler.imageService.UpdateImage(r.Context(), id, update)
+	if err != nil {
+		writeAPIError(w, "updating image "+id, err)
+		return
+	}
+
+	common.WriteJSON(w, http.StatusOK, metadata)
+}
+
+// apiDeleteImage deletes an image and responds with 204 No Content
+func (handler *ImageHandler) apiDeleteImage(w http.ResponseWriter, r *http.Request, id string) {
+	if err := handler.imageService.DeleteImage(r.Context(), id); err != nil {
+		writeAPIError(w, "deleting image "+id, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// tagsRequest is the JSON body accepted when tagging an image
+type tagsRequest struct {
+	Tags []string `json:"tags"`
+}
+
+// apiAddTags attaches the tags in a {"tags": [...]} body and returns the updated metadata
+func (handler *ImageHandler) apiAddTags(w http.ResponseWriter, r *http.Request, id string) {
+	var request tagsRequest
+	if err := common.ReadJSON(w, r, maxJSONBodySize, &request); err != nil {
+		common.WriteJSONError(w, http.StatusBadRequest, "invalid_request", `Expected a JSON body like {"tags": ["name"]}`)
+		return
+	}
+
+	metadata, err := handler.imageService.AddTags(r.Context(), id, request.Tags)
+	if err != nil {
+		writeAPIError(w, "tagging image "+id, err)
+		return
+	}
+
+	common.WriteJSON(w, http.StatusOK, metadata)
+}
+
+// apiRemoveTag detaches one tag and returns the updated metadata
+func (handler *ImageHandler) apiRemoveTag(w http.ResponseWriter, r *http.Request, id, tag string) {
+	metadata, err := handler.imageService.RemoveTags(r.Context(), id, []string{tag})
+	if err != nil {
+		writeAPIError(w, "untagging image "+id, err)
+		return
+	}
+
+	common.WriteJSON(w, http.StatusOK, metadata)
+}
+
+// directUploadRequest is the JSON body that reserves a direct upload
+type directUploadRequest struct {
+	Filename    string `json:"filename"`
+	ContentType string `json:"content_type"`
+	Size        int64  `json:"size"`
+}
+
+// completeUploadRequest is the optional JSON body that completes a direct
+// upload, with the same options as a form upload
+type completeUploadRequest struct {
+	Tags          []string `json:"tags"`
+	Title         string   `json:"title"`
+	Description   string   `json:"description"`
+	AltText       string   `json:"alt_text"`
+	StripMetadata *bool    `json:"strip_metadata"`
+}
+
+// HandleAPIUploads handles /api/v1/uploads: POST reserves an image ID and
+// returns a presigned request that uploads the file straight to the blob store
+func (handler *ImageHandler) HandleAPIUploads(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		common.WriteJSONError(w, http.StatusMethodNotAllowed, "method_not_allowed", "Method not allowed")
+		return
+	}
+
+	var request directUploadRequest
+	if err := common.ReadJSON(w, r, maxJSONBodySize, &request); err != nil {
+		common.WriteJSONError(w, http.StatusBadRequest, "invalid_request", `Expected a JSON body with "filename", "content_type" and "size"`)
+		return
+	}
+
+	upload, err := handler.imageService.CreateDirectUpload(r.Context(), request.Filename, request.ContentType, request.Size)
+	if err != nil {
+		writeAPIError(w, "creating direct upload", err)
+		return
+	}
+
+	common.WriteJSON(w, http.StatusCreated, upload)
+}
+
+// HandleAPIUpload handles POST /api/v1/uploads/{id}/complete, which verifies
+// the uploaded object and creates the image. The object is read once through
+// the application for its checksum and thumbnails, then copied within the
+// store rather than uploaded again.
+func (handler *ImageHandler) HandleAPIUpload(w http.ResponseWriter, r *http.Request) {
+	id, action, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, apiUploadsPath+"/"), "/")
+	if id == "" || action != "complete" {
+		common.WriteJSONError(w, http.StatusNotFound, "not_found", "Unknown API endpoint")
+		return
+	}
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		common.WriteJSONError(w, http.StatusMethodNotAllowed, "method_not_allowed", "Method not allowed")
+		return
+	}
+
+	// The body is optional
+	var request completeUploadRequest
+	if err := common.ReadJSON(w, r, maxJSONBodySize, &request); err != nil && !errors.Is(err, io.EOF) {
+		common.WriteJSONError(w, http.StatusBadRequest, "invalid_request", `Expected an empty body or a JSON body with upload options`)
+		return
+	}
+
+	metadata, err := handler.imageService.CompleteDirectUpload(r.Context(), id, UploadOptions{
+		Tags:          request.Tags,
+		Title:         request.Title,
+		Description:   request.Description,
+		AltText:       request.AltText,
+		StripMetadata: request.StripMetadata,
+	})
+	if err != nil {
+		writeAPIError(w, "completing direct upload "+id, err)
+		return
+	}
+
+	w.Header().Set("Location", apiImagesPath+"/"+metadata.ID)
+	common.WriteJSON(w, http.StatusCreated, metadata)
+}
+
+// writeAPIError maps service errors to a JSON error response
+func writeAPIError(w http.ResponseWriter, operation string, err error) {
+	switch {
+	case errors.Is(err, ErrUploadNotFound):
+		common.WriteJSONError(w, http.StatusNotFound, "upload_not_found", ErrUploadNotFound.Error())
+	case errors.Is(err, ErrUploadExpired):
+		common.WriteJSONError(w, http.StatusGone, "upload_expired", ErrUploadExpired.Error())
+	case errors.Is(err, ErrUploadIncomplete):
+		common.WriteJSONError(w, http.StatusConflict, "upload_incomplete", ErrUploadIncomplete.Error())
+	case errors.Is(err, ErrUploadConflict):
+		common.WriteJSONError(w, http.StatusConflict, "upload_conflict", err.Error())
+	case errors.Is(err, ErrDirectUploadUnsupported):
+		common.WriteJSONError(w, http.StatusNotImplemented, "direct_upload_unsupported", ErrDirectUploadUnsupported.Error())
+	case errors.Is(err, ErrInvalidUpload):
+		common.WriteJSONError(w, http.StatusBadRequest, "invalid_request", err.Error())
+	case errors.Is(err, ErrImageNotFound), errors.Is(err, storage.ErrObjectNotFound):
+		common.WriteJSONError(w, http.StatusNotFound, "image_not_found", ErrImageNotFound.Error())
+	case errors.Is(err, ErrInvalidImageType):
+		common.WriteJSONError(w, http.StatusUnsupportedMediaType, "invalid_image_type", ErrInvalidImageType.Error())
+	case errors.Is(err, ErrContentTypeMismatch):
+		common.WriteJSONError(w, http.StatusUnsupportedMediaType, "content_type_mismatch", err.Error())
+	case errors.Is(err, ErrInvalidCursor):
+		common.WriteJSONError(w, http.StatusBadRequest, "invalid_cursor", ErrInvalidCursor.Error())
+	case errors.Is(err, ErrInvalidSearch):
+		common.WriteJSONError(w, http.StatusBadRequest, "invalid_search", err.Error())
+	case errors.Is(err, ErrInvalidDetails):
+		common.WriteJSONError(w, http.StatusBadRequest, "invalid_details", err.Error())
+	case errors.Is(err, ErrInvalidTag):
+		common.WriteJSONError(w, http.StatusBadRequest, "invalid_tag", err.Error())
+	case errors.Is(err, ErrNotImageOwner):
+		common.WriteJSONError(w, http.StatusForbidden, "forbidden", ErrNotImageOwner.Error())
+	case errors.Is(err, ErrNotUploadOwner):
+		common.WriteJSONError(w, http.StatusForbidden, "forbidden", ErrNotUploadOwner.Error())
+	case errors.Is(err, ErrInvalidShareLink):
+		common.WriteJSONError(w, http.StatusBadRequest, "invalid_share_link", err.Error())
+	case errors.Is(err, ErrShareLinkNotFound):
+		common.WriteJSONError(w, http.StatusNotFound, "share_link_not_found", ErrShareLinkNotFound.Error())
+	case errors.Is(err, ErrFileTooLarge):
+		common.WriteJSONError(w, http.StatusRequestEntityTooLarge, "file_too_large", err.Error())
+	case errors.Is(err, ErrImageDeleteIncomplete):
+		log.Printf("API error %s: %v", operation, err)
+		common.WriteJSONError(w, http.StatusInternalServerError, "delete_incomplete", ErrImageDeleteIncomplete.Error())
+	default:
+		log.Printf("API error %s: %v", operation, err)
+		common.WriteJSONError(w, http.StatusInternalServerError, "internal_error", "Internal server error")
+	}
+}
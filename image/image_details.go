@@ -0,0 +1,41 @@
+package image
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	// maxTitleLength is the longest image title, in characters
+	maxTitleLength = 255
+	// maxDescriptionLength is the longest image description, in characters
+	maxDescriptionLength = 4000
+	// maxAltTextLength is the longest alt text, in characters
+	maxAltTextLength = 1000
+)
+
+// setDetails trims and validates an image's title, description and alt text
+// and stores them in metadata; all three may be empty
+func setDetails(metadata *ImageMetadata, title, description, altText string) error {
+	fields := []struct {
+		name  string
+		value *string
+		max   int
+	}{
+		{"title", &title, maxTitleLength},
+		{"description", &description, maxDescriptionLength},
+		{"alt text", &altText, maxAltTextLength},
+	}
+	for _, field := range fields {
+		*field.value = strings.TrimSpace(*field.value)
+		if utf8.RuneCountInString(*field.value) > field.max {
+			return fmt.Errorf("%w: %s is longer than %d characters", ErrInvalidDetails, field.name, field.max)
+		}
+	}
+
+	metadata.Title = title
+	metadata.Description = description
+	metadata.AltText = altText
+	return nil
+}
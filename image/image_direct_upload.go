@@ -0,0 +1,201 @@
+package image
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+	"unicode/utf8"
+
+	"file-pub/storage"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// completionGracePeriod is how long after its presigned request expires
+	// an upload that started in time can still be completed
+	completionGracePeriod = 10 * time.Minute
+	// maxFilenameLength matches the images.original_name column
+	maxFilenameLength = 255
+)
+
+// CreateDirectUpload reserves an image ID and returns a presigned request
+// that uploads the image straight to the blob store. The upload becomes an
+// image once CompleteDirectUpload has verified it.
+func (service *imageService) CreateDirectUpload(ctx context.Context, filename, contentType string, size int64) (*DirectUpload, error) {
+	presigner, ok := service.blobStore.(storage.Presigner)
+	if !ok {
+		return nil, ErrDirectUploadUnsupported
+	}
+
+	contentType = normalizeContentType(contentType)
+	if err := service.ValidateImageType(contentType); err != nil {
+		return nil, err
+	}
+	if size <= 0 {
+		return nil, fmt.Errorf("%w: size must be positive", ErrInvalidUpload)
+	}
+	if limit := service.config.sizeLimit(contentType); size > limit {
+		return nil, fmt.Errorf("%w: %s upload of %d bytes exceeds %d bytes", ErrFileTooLarge, contentType, size, limit)
+	}
+	if filename == "" || utf8.RuneCountInString(filename) > maxFilenameLength {
+		return nil, fmt.Errorf("%w: filename must be 1 to %d characters", ErrInvalidUpload, maxFilenameLength)
+	}
+
+	// Reservations nobody completed would otherwise pile up, with their objects
+	service.deleteExpiredUploads(ctx)
+
+	id := uuid.New().String()
+	key := "pending/" + id + imageExtensions[contentType]
+	request, err := presigner.PresignPut(ctx, key, contentType, service.config.DirectUploadExpiry)
+	if err != nil {
+		return nil, fmt.Errorf("presigning direct upload: %w", err)
+	}
+
+	reservation := UploadReservation{
+		ID:          id,
+		S3Key:       key,
+		Filename:    filename,
+		ContentType: contentType,
+		Size:        size,
+		OwnerID:     viewerID(ctx),
+		CreatedAt:   time.Now(),
+		ExpiresAt:   request.ExpiresAt.Add(completionGracePeriod),
+	}
+	if err := service.imageRepo.SaveReservation(ctx, reservation); err != nil {
+		return nil, fmt.Errorf("saving upload reservation: %w", err)
+	}
+
+	return &DirectUpload{UploadReservation: reservation, Upload: request}, nil
+}
+
+// CompleteDirectUpload verifies the object uploaded for a reservation and
+// saves it as an image with the reserved ID, owned by the user who reserved
+// it. Only that user may complete it. Uploads that can never succeed,
+// because they expired or are not the reserved image, are discarded; after
+// other failures the upload can be completed again.
+func (service *imageService) CompleteDirectUpload(ctx context.Context, id string, opts UploadOptions) (*ImageMetadata, error) {
+	reservation, err := service.imageRepo.GetReservation(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkUploadOwner(ctx, reservation.OwnerID); err != nil {
+		return nil, err
+	}
+
+	// Claim the reservation so concurrent completions cannot both save it
+	if err := service.imageRepo.DeleteReservation(ctx, id); err != nil {
+		return nil, err
+	}
+	restore := func() {
+		if err := service.imageRepo.SaveReservation(ctx, *reservation); err != nil {
+			log.Printf("Failed to restore upload reservation %s: %v", id, err)
+		}
+	}
+	discard := func() {
+		service.deleteObjects(ctx, []string{reservation.S3Key})
+	}
+
+	if time.Now().After(reservation.ExpiresAt) {
+		discard()
+		return nil, ErrUploadExpired
+	}
+
+	info, err := service.blobStore.Head(ctx, reservation.S3Key)
+	if err != nil {
+		restore()
+		if errors.Is(err, storage.ErrObjectNotFound) {
+			return nil, ErrUploadIncomplete
+		}
+		return nil, fmt.Errorf("checking uploaded object: %w", err)
+	}
+
+	// The presigned request fixes the content type but not the length
+	if info.Size != reservation.Size {
+		discard()
+		return nil, fmt.Errorf("%w: received %d bytes, reserved %d", ErrInvalidUpload, info.Size, reservation.Size)
+	}
+	if normalizeContentType(info.ContentType) != reservation.ContentType {
+		discard()
+		return nil, fmt.Errorf("%w: uploaded as %s, reserved %s", ErrContentTypeMismatch, info.ContentType, reservation.ContentType)
+	}
+
+	// A ranged read of the first bytes turns away other kinds of files before
+	// the whole object is read; createImage checks the content fully
+	sniffed, err := service.sniffObject(ctx, reservation.S3Key, info.Size)
+	if err != nil {
+		restore()
+		return nil, fmt.Errorf("reading uploaded object: %w", err)
+	}
+	if err := service.ValidateImageType(sniffed); err != nil {
+		discard()
+		return nil, fmt.Errorf("%w: content looks like %s", err, sniffed)
+	}
+	if err := checkDeclaredType(reservation.ContentType, sniffed); err != nil {
+		discard()
+		return nil, err
+	}
+
+	// The content is still read once for its checksum, metadata and variants,
+	// but the object itself is copied within the store when it can be
+	body, _, err := service.blobStore.Get(ctx, reservation.S3Key)
+	if err != nil {
+		restore()
+		return nil, fmt.Errorf("reading uploaded object: %w", err)
+	}
+	defer body.Close()
+
+	metadata, err := service.createImage(ctx, id, reservation.OwnerID, body, reservation.S3Key, reservation.Filename, reservation.ContentType, reservation.Size, opts)
+	if err != nil {
+		if isRejectedUpload(err) {
+			discard()
+		} else {
+			restore()
+		}
+		return nil, err
+	}
+
+	// The image now has its own copy under its content-addressed key
+	discard()
+	return metadata, nil
+}
+
+// sniffObject returns the content type suggested by the first bytes of a
+// stored object of the given size, fetched with a ranged read
+func (service *imageService) sniffObject(ctx context.Context, key string, size int64) (string, error) {
+	body, err := service.blobStore.GetRange(ctx, key, 0, min(size, sniffLength))
+	if err != nil {
+		return "", err
+	}
+	defer body.Close()
+
+	head, err := io.ReadAll(body)
+	if err != nil {
+		return "", err
+	}
+	return http.DetectContentType(head), nil
+}
+
+// isRejectedUpload reports whether createImage failed because of the upload
+// itself, so trying again with the same bytes cannot succeed
+func isRejectedUpload(err error) bool {
+	return errors.Is(err, ErrInvalidImageType) || errors.Is(err, ErrContentTypeMismatch) || errors.Is(err, ErrFileTooLarge)
+}
+
+// deleteExpiredUploads removes expired reservations and whatever was
+// uploaded for them. Failures are only logged; an object left behind is
+// never served.
+func (service *imageService) deleteExpiredUploads(ctx context.Context) {
+	expired, err := service.imageRepo.DeleteExpiredReservations(ctx, time.Now())
+	if err != nil {
+		log.Printf("Failed to delete expired upload reservations: %v", err)
+		return
+	}
+	for _, reservation := range expired {
+		service.deleteObjects(ctx, []string{reservation.S3Key})
+	}
+}
@@ -5,8 +5,49 @@ import "errors"
 var (
 	// ErrInvalidImageType indicates an invalid image file type was provided
 	ErrInvalidImageType = errors.New("invalid image type, only JPEG, PNG, GIF, and WebP are allowed")
+	// ErrContentTypeMismatch indicates the declared content type does not match the file contents
+	ErrContentTypeMismatch = errors.New("declared content type does not match file contents")
 	// ErrImageNotFound indicates the requested image was not found
 	ErrImageNotFound = errors.New("image not found")
 	// ErrFileTooLarge indicates the uploaded file is too large
 	ErrFileTooLarge = errors.New("file too large")
+	// ErrInvalidUpload indicates a malformed upload request
+	ErrInvalidUpload = errors.New("invalid upload request")
+	// ErrInvalidCursor indicates a malformed pagination cursor
+	ErrInvalidCursor = errors.New("invalid pagination cursor")
+	// ErrInvalidTransform indicates disallowed or malformed image transformation parameters
+	ErrInvalidTransform = errors.New("invalid image transformation")
+	// ErrInvalidTag indicates a malformed tag or too many tags on one image
+	ErrInvalidTag = errors.New("invalid tag")
+	// ErrInvalidSearch indicates a malformed search or filter
+	ErrInvalidSearch = errors.New("invalid search")
+	// ErrInvalidDetails indicates a title, description or alt text that is too long
+	ErrInvalidDetails = errors.New("invalid image details")
+	// ErrUploadNotFound indicates no direct or resumable upload exists under the ID
+	ErrUploadNotFound = errors.New("upload not found")
+	// ErrUploadExpired indicates an upload was continued or completed after it expired
+	ErrUploadExpired = errors.New("upload expired")
+	// ErrUploadIncomplete indicates a direct upload was completed before its object was uploaded
+	ErrUploadIncomplete = errors.New("upload not received, send the presigned request first")
+	// ErrUploadConflict indicates a resumable upload chunk does not start at the upload's current offset
+	ErrUploadConflict = errors.New("upload offset does not match")
+	// ErrDirectUploadUnsupported indicates the blob store cannot presign direct uploads
+	ErrDirectUploadUnsupported = errors.New("direct uploads are not supported by the storage backend")
+	// ErrNotImageOwner indicates a change to an image by someone other than
+	// its owner, or to an image without one while those cannot be changed
+	ErrNotImageOwner = errors.New("only the image's owner may change it")
+	// ErrNotUploadOwner indicates a direct or resumable upload was continued by another user
+	ErrNotUploadOwner = errors.New("upload belongs to another user")
+	// ErrInvalidShareLink indicates share link options out of range
+	ErrInvalidShareLink = errors.New("invalid share link")
+	// ErrShareLinkNotFound indicates a share link that does not exist, was revoked or is not signed correctly
+	ErrShareLinkNotFound = errors.New("share link not found")
+	// ErrShareLinkExpired indicates a share link used after it expired
+	ErrShareLinkExpired = errors.New("share link expired")
+	// ErrShareLinkExhausted indicates a share link used after its last allowed download
+	ErrShareLinkExhausted = errors.New("share link download limit reached")
+	// ErrSharePasswordRequired indicates a protected share link used without its password, or with a wrong one
+	ErrSharePasswordRequired = errors.New("share link password required")
+	// ErrImageDeleteIncomplete indicates the stored object was removed but the metadata row was not
+	ErrImageDeleteIncomplete = errors.New("image object deleted but metadata removal failed, retry the delete")
 )
@@ -0,0 +1,414 @@
+package image
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	stdimage "image"
+	"io"
+	"math"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// maxExifSize caps how much EXIF data is read from a single upload; JPEG
+// APP1 segments cannot exceed 64 KiB and other containers rarely do
+const maxExifSize = 1 << 20
+
+// maxCameraFieldLength matches the camera_make and camera_model columns
+const maxCameraFieldLength = 255
+
+// exifHeader prefixes the TIFF structure in JPEG APP1 segments, and
+// sometimes in WebP EXIF chunks
+var exifHeader = []byte("Exif\x00\x00")
+
+// errNoExif is returned by the container readers when there is no EXIF data
+var errNoExif = errors.New("no exif data")
+
+// TIFF tags read from IFD0, the Exif IFD and the GPS IFD
+const (
+	tagMake               = 0x010f
+	tagModel              = 0x0110
+	tagOrientation        = 0x0112
+	tagDateTime           = 0x0132
+	tagExifIFD            = 0x8769
+	tagGPSIFD             = 0x8825
+	tagDateTimeOriginal   = 0x9003
+	tagOffsetTimeOriginal = 0x9011
+	tagGPSLatitudeRef     = 0x0001
+	tagGPSLatitude        = 0x0002
+	tagGPSLongitudeRef    = 0x0003
+	tagGPSLongitude       = 0x0004
+)
+
+// TIFF field types and their sizes in bytes
+const (
+	typeByte      = 1
+	typeASCII     = 2
+	typeShort     = 3
+	typeLong      = 4
+	typeRational  = 5
+	typeUndefined = 7
+	typeSLong     = 9
+	typeSRational = 10
+)
+
+var tiffTypeSizes = map[uint16]uint32{
+	typeByte:      1,
+	typeASCII:     1,
+	typeShort:     2,
+	typeLong:      4,
+	typeRational:  8,
+	typeUndefined: 1,
+	typeSLong:     4,
+	typeSRational: 8,
+}
+
+// extractMetadata fills in the dimensions of the image read from r and, when
+// it carries EXIF data, its orientation, camera, capture time and GPS
+// position. An error means only the dimensions could be read; r is left at
+// an unspecified offset.
+func extractMetadata(r io.ReadSeeker, contentType string, metadata *ImageMetadata) error {
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("rewinding image: %w", err)
+	}
+	config, _, err := stdimage.DecodeConfig(r)
+	if err != nil {
+		return fmt.Errorf("decoding image header: %w", err)
+	}
+	metadata.Width = config.Width
+	metadata.Height = config.Height
+
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("rewinding image: %w", err)
+	}
+	var data []byte
+	switch contentType {
+	case "image/jpeg":
+		data, err = jpegExif(r)
+	case "image/png":
+		data, err = pngExif(r)
+	case "image/webp":
+		data, err = webpExif(r)
+	default:
+		// GIF has no standard place for EXIF data
+		return nil
+	}
+	if errors.Is(err, errNoExif) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("reading exif data: %w", err)
+	}
+
+	return parseExif(bytes.TrimPrefix(data, exifHeader), metadata)
+}
+
+// jpegExif returns the Exif APP1 segment of a JPEG stream
+func jpegExif(r io.Reader) ([]byte, error) {
+	var marker [2]byte
+	if _, err := io.ReadFull(r, marker[:]); err != nil {
+		return nil, err
+	}
+	if marker != [2]byte{0xff, 0xd8} {
+		return nil, errors.New("missing JPEG start of image")
+	}
+
+	for {
+		if _, err := io.ReadFull(r, marker[:]); err != nil {
+			return nil, err
+		}
+		if marker[0] != 0xff {
+			return nil, errors.New("malformed JPEG marker")
+		}
+		// Padding bytes, and markers without a length
+		if marker[1] == 0xff {
+			continue
+		}
+		if marker[1] == 0x01 || (marker[1] >= 0xd0 && marker[1] <= 0xd7) {
+			continue
+		}
+		// Metadata segments come before the scan data
+		if marker[1] == 0xda || marker[1] == 0xd9 {
+			return nil, errNoExif
+		}
+
+		var length uint16
+		if err := binary.Read(r, binary.BigEndian, &length); err != nil {
+			return nil, err
+		}
+		if length < 2 {
+			return nil, errors.New("malformed JPEG segment length")
+		}
+		segment := make([]byte, length-2)
+		if _, err := io.ReadFull(r, segment); err != nil {
+			return nil, err
+		}
+		if marker[1] == 0xe1 && bytes.HasPrefix(segment, exifHeader) {
+			return segment, nil
+		}
+	}
+}
+
+// pngExif returns the contents of the eXIf chunk of a PNG stream
+func pngExif(r io.ReadSeeker) ([]byte, error) {
+	if _, err := r.Seek(8, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	for {
+		var header struct {
+			Length uint32
+			Type   [4]byte
+		}
+		if err := binary.Read(r, binary.BigEndian, &header); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil, errNoExif
+			}
+			return nil, err
+		}
+
+		switch string(header.Type[:]) {
+		case "eXIf":
+			return readChunk(r, header.Length)
+		case "IEND":
+			return nil, errNoExif
+		}
+		// Skip the chunk data and its CRC
+		if _, err := r.Seek(int64(header.Length)+4, io.SeekCurrent); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// webpExif returns the contents of the EXIF chunk of a WebP stream
+func webpExif(r io.ReadSeeker) ([]byte, error) {
+	if _, err := r.Seek(12, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	for {
+		var header struct {
+			Type   [4]byte
+			Length uint32
+		}
+		if err := binary.Read(r, binary.LittleEndian, &header); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil, errNoExif
+			}
+			return nil, err
+		}
+
+		if string(header.Type[:]) == "EXIF" {
+			return readChunk(r, header.Length)
+		}
+		// Chunks are padded to an even length
+		if _, err := r.Seek(int64(header.Length)+int64(header.Length&1), io.SeekCurrent); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// readChunk reads length bytes of chunk data, refusing oversized chunks
+func readChunk(r io.Reader, length uint32) ([]byte, error) {
+	if length > maxExifSize {
+		return nil, fmt.Errorf("exif chunk of %d bytes is too large", length)
+	}
+	data := make([]byte, length)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// tiffEntry is one field of a TIFF image file directory
+type tiffEntry struct {
+	typ   uint16
+	count uint32
+	value []byte
+}
+
+// tiffReader reads image file directories from a TIFF structure
+type tiffReader struct {
+	data  []byte
+	order binary.ByteOrder
+}
+
+// parseExif reads the fields this service keeps from a TIFF structure.
+// Fields that are missing or malformed are left unset.
+func parseExif(data []byte, metadata *ImageMetadata) error {
+	if len(data) < 8 {
+		return errors.New("exif data is too short")
+	}
+	tiff := tiffReader{data: data}
+	switch string(data[:2]) {
+	case "II":
+		tiff.order = binary.LittleEndian
+	case "MM":
+		tiff.order = binary.BigEndian
+	default:
+		return errors.New("exif data has no TIFF byte order mark")
+	}
+	if tiff.order.Uint16(data[2:]) != 42 {
+		return errors.New("exif data has no TIFF magic number")
+	}
+
+	ifd0, err := tiff.readIFD(tiff.order.Uint32(data[4:]))
+	if err != nil {
+		return err
+	}
+
+	metadata.CameraMake = tiff.string(ifd0[tagMake])
+	metadata.CameraModel = tiff.string(ifd0[tagModel])
+	if orientation, ok := tiff.uint(ifd0[tagOrientation]); ok && orientation >= 1 && orientation <= 8 {
+		metadata.Orientation = int(orientation)
+	}
+
+	taken, offset := tiff.string(ifd0[tagDateTime]), ""
+	if pointer, ok := tiff.uint(ifd0[tagExifIFD]); ok {
+		if exif, err := tiff.readIFD(pointer); err == nil {
+			if original := tiff.string(exif[tagDateTimeOriginal]); original != "" {
+				taken = original
+				offset = tiff.string(exif[tagOffsetTimeOriginal])
+			}
+		}
+	}
+	if takenAt, ok := parseExifTime(taken, offset); ok {
+		metadata.TakenAt = &takenAt
+	}
+
+	if pointer, ok := tiff.uint(ifd0[tagGPSIFD]); ok {
+		if gps, err := tiff.readIFD(pointer); err == nil {
+			latitude, latOK := tiff.coordinate(gps[tagGPSLatitude], tiff.string(gps[tagGPSLatitudeRef]), "S", 90)
+			longitude, lonOK := tiff.coordinate(gps[tagGPSLongitude], tiff.string(gps[tagGPSLongitudeRef]), "W", 180)
+			if latOK && lonOK {
+				metadata.Latitude = &latitude
+				metadata.Longitude = &longitude
+			}
+		}
+	}
+
+	return nil
+}
+
+// readIFD reads the directory at offset, keyed by tag
+func (tiff tiffReader) readIFD(offset uint32) (map[uint16]tiffEntry, error) {
+	if uint64(offset)+2 > uint64(len(tiff.data)) {
+		return nil, errors.New("exif directory offset out of range")
+	}
+	count := uint64(tiff.order.Uint16(tiff.data[offset:]))
+	start := uint64(offset) + 2
+	if start+count*12 > uint64(len(tiff.data)) {
+		return nil, errors.New("exif directory runs past the end of the data")
+	}
+
+	entries := make(map[uint16]tiffEntry, count)
+	for i := uint64(0); i < count; i++ {
+		field := tiff.data[start+i*12 : start+(i+1)*12]
+		entry := tiffEntry{
+			typ:   tiff.order.Uint16(field[2:]),
+			count: tiff.order.Uint32(field[4:]),
+		}
+		size, ok := tiffTypeSizes[entry.typ]
+		if !ok {
+			continue
+		}
+		length := uint64(size) * uint64(entry.count)
+		if length <= 4 {
+			entry.value = field[8 : 8+length]
+		} else {
+			valueOffset := uint64(tiff.order.Uint32(field[8:]))
+			if valueOffset+length > uint64(len(tiff.data)) {
+				continue
+			}
+			entry.value = tiff.data[valueOffset : valueOffset+length]
+		}
+		entries[tiff.order.Uint16(field)] = entry
+	}
+	return entries, nil
+}
+
+// string returns an ASCII field as printable UTF-8 of at most
+// maxCameraFieldLength bytes
+func (tiff tiffReader) string(entry tiffEntry) string {
+	if entry.typ != typeASCII {
+		return ""
+	}
+	value, _, _ := strings.Cut(string(entry.value), "\x00")
+	value = strings.Map(func(r rune) rune {
+		if r == utf8.RuneError || !unicode.IsPrint(r) {
+			return -1
+		}
+		return r
+	}, value)
+	value = strings.TrimSpace(value)
+
+	for len(value) > maxCameraFieldLength {
+		_, size := utf8.DecodeLastRuneInString(value)
+		value = value[:len(value)-size]
+	}
+	return value
+}
+
+// uint returns the first value of a SHORT or LONG field
+func (tiff tiffReader) uint(entry tiffEntry) (uint32, bool) {
+	switch {
+	case entry.typ == typeShort && len(entry.value) >= 2:
+		return uint32(tiff.order.Uint16(entry.value)), true
+	case entry.typ == typeLong && len(entry.value) >= 4:
+		return tiff.order.Uint32(entry.value), true
+	}
+	return 0, false
+}
+
+// coordinate converts a degrees, minutes, seconds RATIONAL field to signed
+// decimal degrees, negative when ref is negativeRef
+func (tiff tiffReader) coordinate(entry tiffEntry, ref, negativeRef string, limit float64) (float64, bool) {
+	if entry.typ != typeRational || entry.count != 3 {
+		return 0, false
+	}
+
+	var parts [3]float64
+	for i := range parts {
+		numerator := tiff.order.Uint32(entry.value[i*8:])
+		denominator := tiff.order.Uint32(entry.value[i*8+4:])
+		if denominator == 0 {
+			return 0, false
+		}
+		parts[i] = float64(numerator) / float64(denominator)
+	}
+
+	degrees := parts[0] + parts[1]/60 + parts[2]/3600
+	if math.IsNaN(degrees) || degrees > limit {
+		return 0, false
+	}
+	if strings.EqualFold(ref, negativeRef) {
+		degrees = -degrees
+	}
+	return degrees, true
+}
+
+// parseExifTime parses an EXIF date and time. EXIF times are local to the
+// camera; without an offset they are stored as if they were UTC.
+func parseExifTime(value, offset string) (time.Time, bool) {
+	if value == "" {
+		return time.Time{}, false
+	}
+	location := time.UTC
+	if offset != "" {
+		parsed, err := time.Parse("-07:00", offset)
+		if err == nil {
+			_, seconds := parsed.Zone()
+			location = time.FixedZone(offset, seconds)
+		}
+	}
+
+	taken, err := time.ParseInLocation("2006:01:02 15:04:05", value, location)
+	if err != nil || taken.Year() < 1800 {
+		return time.Time{}, false
+	}
+	return taken.UTC(), true
+}
@@ -0,0 +1,277 @@
+package image
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	stdimage "image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"math"
+	"math/rand"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"file-pub/storage"
+)
+
+// faultyBlobStore wraps a BlobStore and fails selected operations, so tests
+// can exercise the error paths that real backends only hit under outages
+type faultyBlobStore struct {
+	storage.BlobStore
+
+	mu       sync.Mutex
+	failures map[string]error
+	calls    map[string]int
+}
+
+// newFaultyBlobStore wraps an empty in-memory blob store
+func newFaultyBlobStore() *faultyBlobStore {
+	return &faultyBlobStore{
+		BlobStore: storage.NewMemoryBlobStore(),
+		failures:  make(map[string]error),
+		calls:     make(map[string]int),
+	}
+}
+
+// failOn makes every later call to op ("Put", "Copy", "Get", "GetRange",
+// "Delete", "Head" or "List") return err; a nil err restores normal behaviour
+func (store *faultyBlobStore) failOn(op string, err error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	if err == nil {
+		delete(store.failures, op)
+		return
+	}
+	store.failures[op] = err
+}
+
+// callCount returns how many times op has been called
+func (store *faultyBlobStore) callCount(op string) int {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	return store.calls[op]
+}
+
+// record counts a call to op and returns its injected failure, if any
+func (store *faultyBlobStore) record(op string) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	store.calls[op]++
+	return store.failures[op]
+}
+
+func (store *faultyBlobStore) Put(ctx context.Context, key string, body io.Reader, contentType string) (*storage.ObjectInfo, error) {
+	if err := store.record("Put"); err != nil {
+		return nil, err
+	}
+	return store.BlobStore.Put(ctx, key, body, contentType)
+}
+
+func (store *faultyBlobStore) Copy(ctx context.Context, srcKey, dstKey, contentType string) (*storage.ObjectInfo, error) {
+	if err := store.record("Copy"); err != nil {
+		return nil, err
+	}
+	return store.BlobStore.(storage.Copier).Copy(ctx, srcKey, dstKey, contentType)
+}
+
+func (store *faultyBlobStore) Get(ctx context.Context, key string) (io.ReadCloser, *storage.ObjectInfo, error) {
+	if err := store.record("Get"); err != nil {
+		return nil, nil, err
+	}
+	return store.BlobStore.Get(ctx, key)
+}
+
+func (store *faultyBlobStore) GetRange(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error) {
+	if err := store.record("GetRange"); err != nil {
+		return nil, err
+	}
+	return store.BlobStore.GetRange(ctx, key, offset, length)
+}
+
+func (store *faultyBlobStore) Delete(ctx context.Context, key string) error {
+	if err := store.record("Delete"); err != nil {
+		return err
+	}
+	return store.BlobStore.Delete(ctx, key)
+}
+
+func (store *faultyBlobStore) Head(ctx context.Context, key string) (*storage.ObjectInfo, error) {
+	if err := store.record("Head"); err != nil {
+		return nil, err
+	}
+	return store.BlobStore.Head(ctx, key)
+}
+
+func (store *faultyBlobStore) List(ctx context.Context, prefix string) ([]storage.ObjectInfo, error) {
+	if err := store.record("List"); err != nil {
+		return nil, err
+	}
+	return store.BlobStore.List(ctx, prefix)
+}
+
+// presigningBlobStore is a faultyBlobStore that presigns direct uploads.
+// Tests play the client by putting the object into the store themselves.
+type presigningBlobStore struct {
+	*faultyBlobStore
+}
+
+func (store *presigningBlobStore) PresignPut(ctx context.Context, key, contentType string, expires time.Duration) (*storage.PresignedRequest, error) {
+	return &storage.PresignedRequest{
+		Method:    http.MethodPut,
+		URL:       "https://blobs.example.com/" + key,
+		Headers:   map[string]string{"Content-Type": contentType},
+		ExpiresAt: time.Now().Add(expires),
+	}, nil
+}
+
+// testPatternPNG returns a width x height grey PNG of diagonal stripes,
+// mirrored left to right when mirror is set. Copies at different sizes look
+// the same to the perceptual hash.
+func testPatternPNG(t *testing.T, width, height int, mirror bool) []byte {
+	t.Helper()
+
+	img := stdimage.NewGray(stdimage.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			u, v := float64(x)/float64(width), float64(y)/float64(height)
+			if mirror {
+				u = 1 - u
+			}
+			img.SetGray(x, y, color.Gray{Y: uint8(128 + 100*math.Sin(9*u+4*v*v))})
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatalf("encoding test PNG: %v", err)
+	}
+	return buf.Bytes()
+}
+
+// testPNG returns an opaque width x height PNG
+func testPNG(t *testing.T, width, height int) []byte {
+	t.Helper()
+
+	img := stdimage.NewNRGBA(stdimage.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, color.NRGBA{R: uint8(x), G: uint8(y), B: 128, A: 255})
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatalf("encoding test PNG: %v", err)
+	}
+	return buf.Bytes()
+}
+
+// testNoisePNG returns a width x height PNG of seeded random pixels, which
+// barely compresses, for tests that need an upload of a certain size
+func testNoisePNG(t *testing.T, width, height int) []byte {
+	t.Helper()
+
+	img := stdimage.NewNRGBA(stdimage.Rect(0, 0, width, height))
+	random := rand.New(rand.NewSource(1))
+	random.Read(img.Pix)
+	for i := 3; i < len(img.Pix); i += 4 {
+		img.Pix[i] = 255
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatalf("encoding test PNG: %v", err)
+	}
+	return buf.Bytes()
+}
+
+// testExifJPEG returns a width x height JPEG, red on the left half and blue
+// on the right, whose Exif segment records the camera, orientation 6,
+// capture time and GPS position
+func testExifJPEG(t *testing.T, width, height int) []byte {
+	t.Helper()
+
+	img := stdimage.NewRGBA(stdimage.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, color.RGBA{R: 255, A: 255})
+			if x >= width/2 {
+				img.Set(x, y, color.RGBA{B: 255, A: 255})
+			}
+		}
+	}
+	var encoded bytes.Buffer
+	if err := jpeg.Encode(&encoded, img, nil); err != nil {
+		t.Fatalf("encoding test JPEG: %v", err)
+	}
+
+	// A big-endian TIFF structure: IFD0 at offset 8 followed by the Exif
+	// and GPS IFDs, with values that do not fit inline stored after them
+	const ifd0, exifIFD, gpsIFD, values = 8, 80, 112, 174
+	tiff := make([]byte, values, 256)
+	copy(tiff, "MM\x00\x2a")
+	binary.BigEndian.PutUint32(tiff[4:], ifd0)
+
+	appendValue := func(value []byte) uint32 {
+		offset := uint32(len(tiff))
+		tiff = append(tiff, value...)
+		return offset
+	}
+	writeIFD := func(at int, entries [][4]uint32) {
+		binary.BigEndian.PutUint16(tiff[at:], uint16(len(entries)))
+		for i, entry := range entries {
+			field := tiff[at+2+i*12:]
+			binary.BigEndian.PutUint16(field, uint16(entry[0]))
+			binary.BigEndian.PutUint16(field[2:], uint16(entry[1]))
+			binary.BigEndian.PutUint32(field[4:], entry[2])
+			binary.BigEndian.PutUint32(field[8:], entry[3])
+		}
+	}
+	rational := func(parts ...uint32) []byte {
+		value := make([]byte, 0, len(parts)*4)
+		for _, part := range parts {
+			value = binary.BigEndian.AppendUint32(value, part)
+		}
+		return value
+	}
+
+	cameraMake := appendValue([]byte("Canon\x00"))
+	model := appendValue([]byte("EOS R5\x00"))
+	taken := appendValue([]byte("2023:07:14 11:30:15\x00"))
+	latitude := appendValue(rational(52, 1, 31, 1, 1230, 100))
+	longitude := appendValue(rational(13, 1, 24, 1, 1782, 100))
+
+	writeIFD(ifd0, [][4]uint32{
+		{tagMake, typeASCII, 6, cameraMake},
+		{tagModel, typeASCII, 7, model},
+		{tagOrientation, typeShort, 1, 6 << 16},
+		{tagExifIFD, typeLong, 1, exifIFD},
+		{tagGPSIFD, typeLong, 1, gpsIFD},
+	})
+	writeIFD(exifIFD, [][4]uint32{
+		{tagDateTimeOriginal, typeASCII, 20, taken},
+		{tagOffsetTimeOriginal, typeASCII, 7, appendValue([]byte("+02:00\x00"))},
+	})
+	writeIFD(gpsIFD, [][4]uint32{
+		{tagGPSLatitudeRef, typeASCII, 2, 'N' << 24},
+		{tagGPSLatitude, typeRational, 3, latitude},
+		{tagGPSLongitudeRef, typeASCII, 2, 'W' << 24},
+		{tagGPSLongitude, typeRational, 3, longitude},
+	})
+
+	segment := append(append([]byte(nil), exifHeader...), tiff...)
+	var out bytes.Buffer
+	out.Write(encoded.Bytes()[:2])
+	out.Write([]byte{0xff, 0xe1, byte((len(segment) + 2) >> 8), byte(len(segment) + 2)})
+	out.Write(segment)
+	out.Write(encoded.Bytes()[2:])
+	return out.Bytes()
+}
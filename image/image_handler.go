@@ -1,12 +1,28 @@
 package image
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
 	"html/template"
 	"log"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
 
 	"file-pub/internal/common"
+	"file-pub/storage"
+)
+
+const (
+	// multipartOverhead allows for boundaries and part headers around the uploaded file
+	multipartOverhead = 1 << 20
+	// multipartMemory is how much of a multipart form is held in memory before spilling to disk
+	multipartMemory = 8 << 20
+	// maxFormBodySize caps URL-encoded form bodies such as the edit form
+	maxFormBodySize = 64 << 10
 )
 
 // ImageHandler handles HTTP requests for image operations
@@ -38,20 +54,49 @@ func (handler *ImageHandler) HandleHome(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	// Fetch all images from database
-	images, err := handler.imageService.GetAllImages(r.Context())
+	query, err := imageQueryFromRequest(r)
 	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Fetch one page of images from database
+	page, err := handler.imageService.GetAllImages(r.Context(), query)
+	if err != nil {
+		if errors.Is(err, ErrInvalidCursor) || errors.Is(err, ErrInvalidTag) || errors.Is(err, ErrInvalidSearch) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 		log.Printf("Error fetching images: %v", err)
 		http.Error(w, "Failed to fetch images", http.StatusInternalServerError)
 		return
 	}
 
+	params := r.URL.Query()
 	data := struct {
-		Images []ImageMetadata
-		Count  int
+		Images   []ImageMetadata
+		Count    int
+		Total    int64
+		Tags     []string
+		Filters  url.Values
+		Filtered bool
+		Mine     bool
+		User     *common.Identity
+		NextURL  string
+		PrevURL  string
 	}{
-		Images: images,
-		Count:  len(images),
+		Images:   page.Images,
+		Count:    len(page.Images),
+		Total:    page.Total,
+		Tags:     query.Tags,
+		Filters:  params,
+		Filtered: isFiltered(query),
+		Mine:     query.OwnerID != "",
+		NextURL:  pageURL(r, "after", page.NextCursor),
+		PrevURL:  pageURL(r, "before", page.PrevCursor),
+	}
+	if identity, ok := common.IdentityFromContext(r.Context()); ok {
+		data.User = &identity
 	}
 
 	if err := handler.templates.ExecuteTemplate(w, "index.html", data); err != nil {
@@ -67,10 +112,14 @@ func (handler *ImageHandler) HandleUpload(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	// Parse multipart form (max 32MB)
-	if err := r.ParseMultipartForm(32 << 20); err != nil {
+	// Parse multipart form, rejecting bodies over the configured size limit
+	if err := handler.parseUploadForm(w, r); err != nil {
 		log.Printf("Error parsing form: %v", err)
-		http.Error(w, "File too large", http.StatusBadRequest)
+		if errors.Is(err, ErrFileTooLarge) {
+			http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, "Invalid upload form", http.StatusBadRequest)
 		return
 	}
 
@@ -82,62 +131,534 @@ func (handler *ImageHandler) HandleUpload(w http.ResponseWriter, r *http.Request
 	}
 	defer file.Close()
 
-	// Get content type
-	contentType := header.Header.Get("Content-Type")
-
-	// Validate file type
-	if err := handler.imageService.ValidateImageType(contentType); err != nil {
+	opts, err := uploadOptionsFromForm(r)
+	if err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	// Upload image
-	_, err = handler.imageService.UploadImage(
+	// Upload image; the service verifies the declared type against the content
+	metadata, err := handler.imageService.UploadImage(
 		r.Context(),
 		file,
 		header.Filename,
-		contentType,
+		header.Header.Get("Content-Type"),
 		header.Size,
+		opts,
 	)
 	if err != nil {
 		log.Printf("Upload error: %v", err)
+		if errors.Is(err, ErrFileTooLarge) {
+			http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+			return
+		}
+		if errors.Is(err, ErrInvalidImageType) || errors.Is(err, ErrContentTypeMismatch) ||
+			errors.Is(err, ErrInvalidTag) || errors.Is(err, ErrInvalidDetails) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 		http.Error(w, fmt.Sprintf("Failed to upload file: %v", err), http.StatusInternalServerError)
 		return
 	}
 
-	// Redirect back to home
+	// Show the look-alikes of a near-duplicate, otherwise go back home
+	if len(metadata.NearDuplicates) > 0 {
+		http.Redirect(w, r, "/image/"+url.PathEscape(metadata.ID)+"/similar", http.StatusSeeOther)
+		return
+	}
 	http.Redirect(w, r, "/", http.StatusSeeOther)
 }
 
-// HandleImageProxy serves images from S3 through the application
-func (handler *ImageHandler) HandleImageProxy(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
+// IsImageView reports whether r only views an image file, the original or a
+// thumbnail, or unlocks a share link. These stay reachable without signing in
+// so that albums and share links work for visitors.
+func IsImageView(r *http.Request) bool {
+	if !strings.HasPrefix(r.URL.Path, "/image/") {
+		return false
 	}
+	_, subresource, _ := strings.Cut(r.URL.Path[len("/image/"):], "/")
+	if subresource != "" && subresource != "thumb" {
+		return false
+	}
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		return true
+	case http.MethodPost:
+		// Unlocking a password-protected share link
+		return subresource == "" && r.URL.Query().Get("share") != ""
+	default:
+		return false
+	}
+}
 
+// HandleImageProxy serves images from the blob store through the application.
+// /image/{id} serves the original (DELETE removes the image instead),
+// /image/{id}/thumb serves a resized variant, optionally chosen with ?size=N,
+// /image/{id}/edit shows and saves the form for the image's details,
+// /image/{id}/links creates and revokes share links and
+// /image/{id}/similar lists images that look alike.
+// Adding w, h, fit, format or q to /image/{id} renders a transformed copy.
+// Private images are only served to their owner or through a share link.
+func (handler *ImageHandler) HandleImageProxy(w http.ResponseWriter, r *http.Request) {
 	// Extract image ID from URL path
-	// Expected format: /image/{id}
-	id := r.URL.Path[len("/image/"):]
+	// Expected format: /image/{id} or /image/{id}/{thumb,edit,links,similar}
+	id, subresource, _ := strings.Cut(r.URL.Path[len("/image/"):], "/")
 	if id == "" {
 		http.Error(w, "Image ID required", http.StatusBadRequest)
 		return
 	}
 
-	// Fetch image data from S3
-	imageData, contentType, err := handler.imageService.GetImageData(r.Context(), id)
+	if subresource == "edit" {
+		handler.handleEdit(w, r, id)
+		return
+	}
+	if subresource == "similar" {
+		handler.handleSimilar(w, r, id)
+		return
+	}
+	if subresource == "links" || strings.HasPrefix(subresource, "links/") {
+		handler.handleShareLinks(w, r, id, strings.TrimPrefix(strings.TrimPrefix(subresource, "links"), "/"))
+		return
+	}
+	if subresource == "" && r.Method == http.MethodPost && r.URL.Query().Get("share") != "" {
+		handler.handleUnlockShareLink(w, r, id)
+		return
+	}
+
+	if r.Method != http.MethodGet && r.Method != http.MethodHead && r.Method != http.MethodDelete {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if r.Method == http.MethodDelete {
+		if subresource != "" {
+			http.NotFound(w, r)
+			return
+		}
+		handler.handleDelete(w, r, id)
+		return
+	}
+
+	link, ok := handler.authorizeImage(w, r, id)
+	if !ok {
+		return
+	}
+	// Downloads of the original or a transformed copy count against a link's
+	// limit once they are sent; thumbnails and HEAD requests do not
+	if link != nil && subresource == "" && r.Method == http.MethodGet {
+		w = &shareDownloadWriter{ResponseWriter: w, handler: handler, r: r, id: id, link: link}
+	}
+
+	switch {
+	case subresource == "" && hasTransformParams(r.URL.Query()):
+		opts, err := parseTransformOptions(r.URL.Query())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		object, err := handler.imageService.GetTransformedImage(r.Context(), id, opts)
+		handler.serveImageObject(w, r, id, object, err)
+	case subresource == "":
+		// Open image stream from the blob store
+		object, err := handler.imageService.GetImageData(r.Context(), id)
+		handler.serveImageObject(w, r, id, object, err)
+	case subresource == "thumb":
+		size := 0
+		if param := r.URL.Query().Get("size"); param != "" {
+			parsed, err := strconv.Atoi(param)
+			if err != nil || parsed <= 0 {
+				http.Error(w, "Invalid size", http.StatusBadRequest)
+				return
+			}
+			size = parsed
+		}
+
+		object, err := handler.imageService.GetThumbnail(r.Context(), id, size)
+		handler.serveImageObject(w, r, id, object, err)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// serveImageObject streams an opened image with the given caching policy, or
+// reports the error from opening it
+func (handler *ImageHandler) serveImageObject(w http.ResponseWriter, r *http.Request, id string, object *ImageObject, err error) {
+	if err != nil {
+		log.Printf("Error fetching image %s: %v", id, err)
+		if errors.Is(err, ErrImageNotFound) || errors.Is(err, storage.ErrObjectNotFound) {
+			http.Error(w, "Image not found", http.StatusNotFound)
+			return
+		}
+		if errors.Is(err, ErrInvalidTransform) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		http.Error(w, "Failed to fetch image", http.StatusInternalServerError)
+		return
+	}
+	defer object.Body.Close()
+
+	// Set headers; ServeContent adds Last-Modified, Content-Length and
+	// Content-Range and answers Range, If-Range, If-None-Match and
+	// If-Modified-Since requests with 206, 304 or 416 as appropriate
+	w.Header().Set("Content-Type", object.ContentType)
+	if object.Metadata.Private {
+		// Served to the owner or through a share link, never to shared caches
+		w.Header().Set("Cache-Control", "private, no-store")
+	} else {
+		w.Header().Set("Cache-Control", "public, max-age=86400") // Cache for 24 hours
+	}
+	if object.ETag != "" {
+		w.Header().Set("ETag", object.ETag)
+	}
+
+	// Stream image data without buffering the whole object
+	http.ServeContent(w, r, "", object.LastModified, object.Body)
+}
+
+// handleEdit renders the details form on GET and saves it on POST, then
+// redirects back to the gallery
+func (handler *ImageHandler) handleEdit(w http.ResponseWriter, r *http.Request, id string) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead && r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	metadata, err := handler.imageService.GetImage(r.Context(), id)
 	if err != nil {
+		if errors.Is(err, ErrImageNotFound) {
+			http.Error(w, "Image not found", http.StatusNotFound)
+			return
+		}
 		log.Printf("Error fetching image %s: %v", id, err)
-		http.Error(w, "Image not found", http.StatusNotFound)
+		http.Error(w, "Failed to fetch image", http.StatusInternalServerError)
 		return
 	}
 
-	// Set headers
-	w.Header().Set("Content-Type", contentType)
-	w.Header().Set("Cache-Control", "public, max-age=86400") // Cache for 24 hours
+	if r.Method != http.MethodPost {
+		handler.renderEditForm(w, r, http.StatusOK, metadata, "")
+		return
+	}
 
-	// Write image data
-	if _, err := w.Write(imageData); err != nil {
-		log.Printf("Error writing image response: %v", err)
+	r.Body = http.MaxBytesReader(w, r.Body, maxFormBodySize)
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Invalid form", http.StatusBadRequest)
+		return
 	}
+
+	title, description, altText := r.PostFormValue("title"), r.PostFormValue("description"), r.PostFormValue("alt_text")
+	private := r.PostFormValue("private") != ""
+	_, err = handler.imageService.UpdateImage(r.Context(), id, ImageUpdate{
+		Title:       &title,
+		Description: &description,
+		AltText:     &altText,
+		Private:     &private,
+	})
+	if err != nil {
+		if errors.Is(err, ErrInvalidDetails) {
+			// Show the rejected values again so nothing typed is lost
+			metadata.Title, metadata.Description, metadata.AltText, metadata.Private = title, description, altText, private
+			handler.renderEditForm(w, r, http.StatusBadRequest, metadata, err.Error())
+			return
+		}
+		if errors.Is(err, ErrImageNotFound) {
+			http.Error(w, "Image not found", http.StatusNotFound)
+			return
+		}
+		if errors.Is(err, ErrNotImageOwner) {
+			http.Error(w, ErrNotImageOwner.Error(), http.StatusForbidden)
+			return
+		}
+		log.Printf("Error updating image %s: %v", id, err)
+		http.Error(w, "Failed to update image", http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+// renderEditForm renders the details form and share links for an image with
+// an optional error message
+func (handler *ImageHandler) renderEditForm(w http.ResponseWriter, r *http.Request, status int, metadata *ImageMetadata, message string) {
+	links, err := handler.imageService.ListShareLinks(r.Context(), metadata.ID)
+	if err != nil {
+		if errors.Is(err, ErrNotImageOwner) {
+			http.Error(w, ErrNotImageOwner.Error(), http.StatusForbidden)
+			return
+		}
+		log.Printf("Error listing share links of image %s: %v", metadata.ID, err)
+		http.Error(w, "Failed to fetch share links", http.StatusInternalServerError)
+		return
+	}
+
+	data := struct {
+		Image         *ImageMetadata
+		Error         string
+		Links         []ShareLink
+		ExpiryChoices []shareExpiryChoice
+		Now           time.Time
+	}{
+		Image:         metadata,
+		Error:         message,
+		Links:         links,
+		ExpiryChoices: shareExpiryChoices,
+		Now:           time.Now(),
+	}
+
+	var page bytes.Buffer
+	if err := handler.templates.ExecuteTemplate(&page, "edit.html", data); err != nil {
+		log.Printf("Template error: %v", err)
+		http.Error(w, "Failed to render page", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	page.WriteTo(w)
+}
+
+// handleSimilar renders the page of images similar to one, closest first
+func (handler *ImageHandler) handleSimilar(w http.ResponseWriter, r *http.Request, id string) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	metadata, err := handler.imageService.GetImage(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, ErrImageNotFound) {
+			http.Error(w, "Image not found", http.StatusNotFound)
+			return
+		}
+		log.Printf("Error fetching image %s: %v", id, err)
+		http.Error(w, "Failed to fetch image", http.StatusInternalServerError)
+		return
+	}
+
+	similar, err := handler.imageService.FindSimilarImages(r.Context(), id, 0)
+	if err != nil {
+		if errors.Is(err, ErrImageNotFound) {
+			http.Error(w, "Image not found", http.StatusNotFound)
+			return
+		}
+		log.Printf("Error finding images similar to %s: %v", id, err)
+		http.Error(w, "Failed to fetch similar images", http.StatusInternalServerError)
+		return
+	}
+
+	data := struct {
+		Image   *ImageMetadata
+		Similar []SimilarImage
+	}{
+		Image:   metadata,
+		Similar: similar,
+	}
+
+	var page bytes.Buffer
+	if err := handler.templates.ExecuteTemplate(&page, "similar.html", data); err != nil {
+		log.Printf("Template error: %v", err)
+		http.Error(w, "Failed to render page", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	page.WriteTo(w)
+}
+
+// handleDelete deletes an image and responds with 204 No Content
+func (handler *ImageHandler) handleDelete(w http.ResponseWriter, r *http.Request, id string) {
+	err := handler.imageService.DeleteImage(r.Context(), id)
+	if err != nil {
+		log.Printf("Error deleting image %s: %v", id, err)
+		switch {
+		case errors.Is(err, ErrImageNotFound):
+			http.Error(w, "Image not found", http.StatusNotFound)
+		case errors.Is(err, ErrNotImageOwner):
+			http.Error(w, ErrNotImageOwner.Error(), http.StatusForbidden)
+		case errors.Is(err, ErrImageDeleteIncomplete):
+			http.Error(w, ErrImageDeleteIncomplete.Error(), http.StatusInternalServerError)
+		default:
+			http.Error(w, "Failed to delete image", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// parseUploadForm caps the request body at the service's upload limit and
+// parses the multipart form, returning ErrFileTooLarge for oversized bodies
+func (handler *ImageHandler) parseUploadForm(w http.ResponseWriter, r *http.Request) error {
+	r.Body = http.MaxBytesReader(w, r.Body, handler.imageService.MaxUploadSize()+multipartOverhead)
+
+	if err := r.ParseMultipartForm(multipartMemory); err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			return fmt.Errorf("%w: request body exceeds %d bytes", ErrFileTooLarge, maxBytesErr.Limit)
+		}
+		return fmt.Errorf("%w: %v", ErrInvalidUpload, err)
+	}
+
+	return nil
+}
+
+// uploadOptionsFromForm reads the optional upload fields from a parsed form.
+// Tags are given as a comma-separated "tags" field; an empty strip_metadata
+// leaves the choice to the server configuration.
+func uploadOptionsFromForm(r *http.Request) (UploadOptions, error) {
+	opts := UploadOptions{
+		Tags:        parseTagList(r.FormValue("tags")),
+		Title:       r.FormValue("title"),
+		Description: r.FormValue("description"),
+		AltText:     r.FormValue("alt_text"),
+	}
+
+	strip, err := parseStripMetadata(r.FormValue("strip_metadata"))
+	if err != nil {
+		return opts, err
+	}
+	opts.StripMetadata = strip
+	return opts, nil
+}
+
+// parseStripMetadata reads a strip_metadata option: a boolean, "on" from a
+// checkbox, or empty to leave the choice to the server configuration
+func parseStripMetadata(value string) (*bool, error) {
+	switch value = strings.ToLower(value); value {
+	case "":
+		return nil, nil
+	case "on":
+		strip := true
+		return &strip, nil
+	default:
+		strip, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, fmt.Errorf("%w: strip_metadata must be true or false", ErrInvalidUpload)
+		}
+		return &strip, nil
+	}
+}
+
+// imageQueryFromRequest reads the pagination parameters (limit, after,
+// before), the search q and the filters tag, type, min_size, max_size, from,
+// to and mine. tag and type may be repeated; from and to are dates
+// (YYYY-MM-DD, both inclusive) or RFC 3339 times; mine=true keeps the
+// signed-in user's uploads.
+func imageQueryFromRequest(r *http.Request) (ImageQuery, error) {
+	params := r.URL.Query()
+	query := ImageQuery{
+		After:        params.Get("after"),
+		Before:       params.Get("before"),
+		Tags:         params["tag"],
+		Search:       params.Get("q"),
+		ContentTypes: nonEmpty(params["type"]),
+	}
+
+	limit, err := limitFromRequest(r)
+	if err != nil {
+		return ImageQuery{}, err
+	}
+	query.Limit = limit
+
+	for param, size := range map[string]*int64{"min_size": &query.MinSize, "max_size": &query.MaxSize} {
+		if value := params.Get(param); value != "" {
+			parsed, err := strconv.ParseInt(value, 10, 64)
+			if err != nil || parsed < 0 {
+				return ImageQuery{}, fmt.Errorf("%w: invalid %s %q", ErrInvalidSearch, param, value)
+			}
+			*size = parsed
+		}
+	}
+
+	if query.UploadedFrom, err = parseDateParam(params.Get("from"), false); err != nil {
+		return ImageQuery{}, err
+	}
+	if query.UploadedTo, err = parseDateParam(params.Get("to"), true); err != nil {
+		return ImageQuery{}, err
+	}
+
+	if value := params.Get("mine"); value != "" {
+		mine, err := strconv.ParseBool(value)
+		if err != nil {
+			return ImageQuery{}, fmt.Errorf("%w: invalid mine %q", ErrInvalidSearch, value)
+		}
+		if mine {
+			identity, ok := common.IdentityFromContext(r.Context())
+			if !ok {
+				return ImageQuery{}, fmt.Errorf("%w: sign in to list your uploads", ErrInvalidSearch)
+			}
+			query.OwnerID = identity.ID
+		}
+	}
+
+	return query, nil
+}
+
+// limitFromRequest parses the optional limit query parameter, returning 0
+// when it is absent
+func limitFromRequest(r *http.Request) (int, error) {
+	limit := r.URL.Query().Get("limit")
+	if limit == "" {
+		return 0, nil
+	}
+	parsed, err := strconv.Atoi(limit)
+	if err != nil || parsed <= 0 {
+		return 0, fmt.Errorf("invalid limit %q", limit)
+	}
+	return parsed, nil
+}
+
+// isFiltered reports whether a query searches or filters, rather than
+// listing every image
+func isFiltered(query ImageQuery) bool {
+	return len(query.Tags) > 0 || strings.TrimSpace(query.Search) != "" || len(query.ContentTypes) > 0 ||
+		query.MinSize > 0 || query.MaxSize > 0 || !query.UploadedFrom.IsZero() || !query.UploadedTo.IsZero() ||
+		query.OwnerID != ""
+}
+
+// parseDateParam parses a date (YYYY-MM-DD, as UTC) or an RFC 3339 time. A
+// date used as an end bound covers the whole day, so the next midnight is
+// returned for it.
+func parseDateParam(value string, end bool) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+
+	if date, err := time.Parse(time.DateOnly, value); err == nil {
+		if end {
+			date = date.AddDate(0, 0, 1)
+		}
+		return date, nil
+	}
+	parsed, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%w: invalid date %q, expected YYYY-MM-DD or RFC 3339", ErrInvalidSearch, value)
+	}
+	return parsed, nil
+}
+
+// nonEmpty drops empty strings, such as those sent by an unselected form field
+func nonEmpty(values []string) []string {
+	var kept []string
+	for _, value := range values {
+		if strings.TrimSpace(value) != "" {
+			kept = append(kept, value)
+		}
+	}
+	return kept
+}
+
+// pageURL returns the current URL with the pagination cursor replaced,
+// or an empty string when there is no cursor in that direction
+func pageURL(r *http.Request, param, cursor string) string {
+	if cursor == "" {
+		return ""
+	}
+
+	params := r.URL.Query()
+	params.Del("after")
+	params.Del("before")
+	params.Set(param, cursor)
+
+	return r.URL.Path + "?" + params.Encode()
 }
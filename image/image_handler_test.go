@@ -0,0 +1,1736 @@
+package image
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	stdimage "image"
+	"image/jpeg"
+	"io"
+	"math"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"testing/iotest"
+	"time"
+
+	"file-pub/internal/common"
+	"file-pub/storage"
+)
+
+// testHandler bundles a handler with the fakes behind it
+type testHandler struct {
+	handler *ImageHandler
+	service ImageService
+	repo    ImageRepository
+	store   *faultyBlobStore
+}
+
+// newTestHandler builds an ImageHandler over an in-memory repository and
+// blob store using the real page templates
+func newTestHandler(t *testing.T, config Config) *testHandler {
+	t.Helper()
+
+	templates, err := template.ParseGlob("../templates/*.html")
+	if err != nil {
+		t.Fatalf("parsing templates: %v", err)
+	}
+
+	// Most tests change the images they upload signed out, as with anonymous access
+	config.ShareLinkSecret = []byte("test share link secret")
+	config.ChangeUnowned = true
+	repo := NewMemoryImageRepository()
+	store := newFaultyBlobStore()
+	service := NewImageService(repo, store, config)
+
+	return &testHandler{
+		handler: NewImageHandler(service, templates),
+		service: service,
+		repo:    repo,
+		store:   store,
+	}
+}
+
+// upload stores a test image with the given tags through the service
+func (th *testHandler) upload(t *testing.T, data []byte, tags ...string) *ImageMetadata {
+	t.Helper()
+
+	opts := UploadOptions{Tags: tags}
+	metadata, err := th.service.UploadImage(context.Background(), bytes.NewReader(data), "photo.png", "image/png", int64(len(data)), opts)
+	if err != nil {
+		t.Fatalf("UploadImage: %v", err)
+	}
+	return metadata
+}
+
+// serve sends a request to handle and returns the recorded response
+func serve(handle http.HandlerFunc, r *http.Request) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	handle(w, r)
+	return w
+}
+
+// multipartUpload builds an upload form request with the file in the "image" field
+func multipartUpload(t *testing.T, filename, contentType string, data []byte) *http.Request {
+	t.Helper()
+	return multipartUploadFields(t, filename, contentType, data, nil)
+}
+
+// multipartUploadFields is multipartUpload with extra form fields before the file
+func multipartUploadFields(t *testing.T, filename, contentType string, data []byte, fields url.Values) *http.Request {
+	t.Helper()
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	for name, values := range fields {
+		for _, value := range values {
+			form.WriteField(name, value)
+		}
+	}
+
+	header := make(textproto.MIMEHeader)
+	header.Set("Content-Disposition", `form-data; name="image"; filename="`+filename+`"`)
+	header.Set("Content-Type", contentType)
+	part, err := form.CreatePart(header)
+	if err != nil {
+		t.Fatalf("creating form part: %v", err)
+	}
+	part.Write(data)
+	form.Close()
+
+	r := httptest.NewRequest(http.MethodPost, "/upload", &body)
+	r.Header.Set("Content-Type", form.FormDataContentType())
+	return r
+}
+
+func TestHandleHome(t *testing.T) {
+	th := newTestHandler(t, DefaultConfig())
+
+	w := serve(th.handler.HandleHome, httptest.NewRequest(http.MethodGet, "/", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("empty gallery: status = %d, want 200", w.Code)
+	}
+
+	for i := 0; i < 3; i++ {
+		th.upload(t, testPNG(t, 16, 16))
+	}
+
+	w = serve(th.handler.HandleHome, httptest.NewRequest(http.MethodGet, "/?limit=2", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", w.Code)
+	}
+	body := w.Body.String()
+	if got := strings.Count(body, `class="delete-button"`); got != 2 {
+		t.Errorf("rendered %d images, want 2", got)
+	}
+	if !strings.Contains(body, "after=") {
+		t.Error("first page has no link to older images")
+	}
+
+	tests := []struct {
+		name   string
+		method string
+		target string
+		want   int
+	}{
+		{"invalid cursor", http.MethodGet, "/?after=bogus", http.StatusBadRequest},
+		{"invalid limit", http.MethodGet, "/?limit=0", http.StatusBadRequest},
+		{"wrong method", http.MethodPost, "/", http.StatusMethodNotAllowed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(th.handler.HandleHome, httptest.NewRequest(tt.method, tt.target, nil))
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d", w.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestHandleUpload(t *testing.T) {
+	config := DefaultConfig()
+	config.MaxUploadSize = 64 << 10
+	pngData := testPNG(t, 300, 200)
+
+	tests := []struct {
+		name        string
+		filename    string
+		contentType string
+		data        []byte
+		want        int
+		stored      bool
+	}{
+		{"png", "photo.png", "image/png", pngData, http.StatusSeeOther, true},
+		{"generic declared type", "photo.png", "application/octet-stream", pngData, http.StatusSeeOther, true},
+		{"mismatched declared type", "photo.jpg", "image/jpeg", pngData, http.StatusBadRequest, false},
+		{"not an image", "notes.txt", "text/plain", []byte("hello, world"), http.StatusBadRequest, false},
+		{"too large", "big.png", "image/png", bytes.Repeat([]byte{0}, 2<<20), http.StatusRequestEntityTooLarge, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			th := newTestHandler(t, config)
+
+			w := serve(th.handler.HandleUpload, multipartUpload(t, tt.filename, tt.contentType, tt.data))
+			if w.Code != tt.want {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.want, w.Body.String())
+			}
+
+			page, err := th.repo.GetAllImages(context.Background(), ImageQuery{Limit: 10})
+			if err != nil {
+				t.Fatalf("GetAllImages: %v", err)
+			}
+			if stored := page.Total == 1; stored != tt.stored {
+				t.Fatalf("stored = %v, want %v", stored, tt.stored)
+			}
+			if !tt.stored {
+				return
+			}
+
+			img := page.Images[0]
+			if img.ContentType != "image/png" || img.OriginalName != tt.filename || img.Size != int64(len(tt.data)) {
+				t.Errorf("metadata = %+v", img)
+			}
+			if len(img.Variants) != 1 || img.Variants[0].Name != "256" {
+				t.Errorf("variants = %+v, want one 256 variant", img.Variants)
+			}
+		})
+	}
+
+	t.Run("storage failure", func(t *testing.T) {
+		th := newTestHandler(t, config)
+		th.store.failOn("Put", errors.New("bucket unavailable"))
+
+		w := serve(th.handler.HandleUpload, multipartUpload(t, "photo.png", "image/png", pngData))
+		if w.Code != http.StatusInternalServerError {
+			t.Errorf("status = %d, want 500", w.Code)
+		}
+	})
+
+	t.Run("wrong method", func(t *testing.T) {
+		th := newTestHandler(t, config)
+
+		w := serve(th.handler.HandleUpload, httptest.NewRequest(http.MethodGet, "/upload", nil))
+		if w.Code != http.StatusMethodNotAllowed {
+			t.Errorf("status = %d, want 405", w.Code)
+		}
+	})
+}
+
+func TestHandleImageProxy(t *testing.T) {
+	th := newTestHandler(t, DefaultConfig())
+	data := testPNG(t, 300, 200)
+	img := th.upload(t, data)
+	etag := `"` + img.Checksum + `"`
+
+	t.Run("original", func(t *testing.T) {
+		w := serve(th.handler.HandleImageProxy, httptest.NewRequest(http.MethodGet, "/image/"+img.ID, nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("status = %d, want 200", w.Code)
+		}
+		if !bytes.Equal(w.Body.Bytes(), data) {
+			t.Error("body differs from the uploaded image")
+		}
+		if got := w.Header().Get("Content-Type"); got != "image/png" {
+			t.Errorf("Content-Type = %q", got)
+		}
+		if got := w.Header().Get("ETag"); got != etag {
+			t.Errorf("ETag = %q, want %q", got, etag)
+		}
+	})
+
+	t.Run("range", func(t *testing.T) {
+		r := httptest.NewRequest(http.MethodGet, "/image/"+img.ID, nil)
+		r.Header.Set("Range", "bytes=0-9")
+		w := serve(th.handler.HandleImageProxy, r)
+		if w.Code != http.StatusPartialContent {
+			t.Fatalf("status = %d, want 206", w.Code)
+		}
+		if !bytes.Equal(w.Body.Bytes(), data[:10]) {
+			t.Errorf("body = %x, want %x", w.Body.Bytes(), data[:10])
+		}
+	})
+
+	t.Run("not modified", func(t *testing.T) {
+		r := httptest.NewRequest(http.MethodGet, "/image/"+img.ID, nil)
+		r.Header.Set("If-None-Match", etag)
+		w := serve(th.handler.HandleImageProxy, r)
+		if w.Code != http.StatusNotModified {
+			t.Errorf("status = %d, want 304", w.Code)
+		}
+	})
+
+	t.Run("thumbnail", func(t *testing.T) {
+		w := serve(th.handler.HandleImageProxy, httptest.NewRequest(http.MethodGet, "/image/"+img.ID+"/thumb?size=256", nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("status = %d, want 200", w.Code)
+		}
+		config, _, err := stdimage.DecodeConfig(w.Body)
+		if err != nil {
+			t.Fatalf("decoding thumbnail: %v", err)
+		}
+		if config.Width != 256 {
+			t.Errorf("thumbnail width = %d, want 256", config.Width)
+		}
+	})
+
+	t.Run("thumbnail falls back to original", func(t *testing.T) {
+		w := serve(th.handler.HandleImageProxy, httptest.NewRequest(http.MethodGet, "/image/"+img.ID+"/thumb?size=1024", nil))
+		if w.Code != http.StatusOK || !bytes.Equal(w.Body.Bytes(), data) {
+			t.Errorf("status = %d, want 200 with the original", w.Code)
+		}
+	})
+
+	t.Run("transform", func(t *testing.T) {
+		w := serve(th.handler.HandleImageProxy, httptest.NewRequest(http.MethodGet, "/image/"+img.ID+"?w=64&h=64&fit=cover", nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("status = %d, want 303: %s", w.Code, w.Body.String())
+		}
+		config, format, err := stdimage.DecodeConfig(w.Body)
+		if err != nil {
+			t.Fatalf("decoding transform: %v", err)
+		}
+		if format != "png" || config.Width != 64 || config.Height != 64 {
+			t.Errorf("transform = %s %dx%d, want png 64x64", format, config.Width, config.Height)
+		}
+	})
+
+	t.Run("webp transform", func(t *testing.T) {
+		w := serve(th.handler.HandleImageProxy, httptest.NewRequest(http.MethodGet, "/image/"+img.ID+"?w=64&format=webp&q=80", nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("status = %d, want 200: %s", w.Code, w.Body.String())
+		}
+		if got := w.Header().Get("Content-Type"); got != "image/webp" {
+			t.Errorf("Content-Type = %q, want image/webp", got)
+		}
+		config, format, err := stdimage.DecodeConfig(w.Body)
+		if err != nil {
+			t.Fatalf("decoding transform: %v", err)
+		}
+		if format != "webp" || config.Width != 64 {
+			t.Errorf("transform = %s %dx%d, want webp 64 wide", format, config.Width, config.Height)
+		}
+	})
+
+	t.Run("quality ignored for lossless output", func(t *testing.T) {
+		prefix := derivedPrefix(img.ID)
+		before, err := th.store.List(context.Background(), prefix)
+		if err != nil {
+			t.Fatalf("List: %v", err)
+		}
+		for _, q := range []string{"50", "90", "81"} {
+			w := serve(th.handler.HandleImageProxy, httptest.NewRequest(http.MethodGet, "/image/"+img.ID+"?w=128&format=png&q="+q, nil))
+			if w.Code != http.StatusOK {
+				t.Fatalf("q=%s: status = %d, want 200: %s", q, w.Code, w.Body.String())
+			}
+		}
+		after, err := th.store.List(context.Background(), prefix)
+		if err != nil {
+			t.Fatalf("List: %v", err)
+		}
+		if len(after) != len(before)+1 {
+			t.Errorf("derived objects = %d, want %d: one rendition for every q", len(after), len(before)+1)
+		}
+	})
+
+	tests := []struct {
+		name   string
+		method string
+		target string
+		want   int
+	}{
+		{"head", http.MethodHead, "/image/" + img.ID, http.StatusOK},
+		{"missing image", http.MethodGet, "/image/missing", http.StatusNotFound},
+		{"missing id", http.MethodGet, "/image/", http.StatusBadRequest},
+		{"unknown subresource", http.MethodGet, "/image/" + img.ID + "/other", http.StatusNotFound},
+		{"invalid thumbnail size", http.MethodGet, "/image/" + img.ID + "/thumb?size=big", http.StatusBadRequest},
+		{"disallowed transform size", http.MethodGet, "/image/" + img.ID + "?w=65", http.StatusBadRequest},
+		{"disallowed jpeg quality", http.MethodGet, "/image/" + img.ID + "?w=64&format=jpeg&q=81", http.StatusBadRequest},
+		{"wrong method", http.MethodPut, "/image/" + img.ID, http.StatusMethodNotAllowed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(th.handler.HandleImageProxy, httptest.NewRequest(tt.method, tt.target, nil))
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d", w.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestHandleImageProxyDelete(t *testing.T) {
+	th := newTestHandler(t, DefaultConfig())
+	img := th.upload(t, testPNG(t, 300, 200))
+
+	// Render a transform so there is a derived object to clean up
+	serve(th.handler.HandleImageProxy, httptest.NewRequest(http.MethodGet, "/image/"+img.ID+"?w=64", nil))
+
+	w := serve(th.handler.HandleImageProxy, httptest.NewRequest(http.MethodDelete, "/image/"+img.ID, nil))
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("status = %d, want 204", w.Code)
+	}
+
+	objects, err := th.store.List(context.Background(), "")
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if len(objects) != 0 {
+		t.Errorf("%d objects left in the store after delete", len(objects))
+	}
+
+	w = serve(th.handler.HandleImageProxy, httptest.NewRequest(http.MethodGet, "/image/"+img.ID, nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("GET after delete: status = %d, want 404", w.Code)
+	}
+	w = serve(th.handler.HandleImageProxy, httptest.NewRequest(http.MethodDelete, "/image/"+img.ID, nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("second DELETE: status = %d, want 404", w.Code)
+	}
+}
+
+func TestHandleImageProxyStorageErrors(t *testing.T) {
+	th := newTestHandler(t, DefaultConfig())
+	img := th.upload(t, testPNG(t, 16, 16))
+
+	// The original vanished from the store but its metadata remains
+	if err := th.store.BlobStore.Delete(context.Background(), img.S3Key); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	w := serve(th.handler.HandleImageProxy, httptest.NewRequest(http.MethodGet, "/image/"+img.ID, nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("missing object: status = %d, want 404", w.Code)
+	}
+
+	// A store outage keeps the image and its metadata intact. The content
+	// differs from the first image so the delete has to release its blob.
+	other := th.upload(t, testPNG(t, 16, 17))
+	th.store.failOn("Delete", errors.New("bucket unavailable"))
+	w = serve(th.handler.HandleImageProxy, httptest.NewRequest(http.MethodDelete, "/image/"+other.ID, nil))
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("store outage: status = %d, want 500", w.Code)
+	}
+	if _, err := th.repo.GetImageByID(context.Background(), other.ID); err != nil {
+		t.Errorf("metadata removed despite failed object delete: %v", err)
+	}
+	if th.store.callCount("Delete") == 0 {
+		t.Error("blob store Delete was never called")
+	}
+}
+
+func TestHandleHomeTagFilter(t *testing.T) {
+	th := newTestHandler(t, DefaultConfig())
+	th.upload(t, testPNG(t, 16, 16), "beach", "sunset")
+	th.upload(t, testPNG(t, 16, 16), "beach")
+	th.upload(t, testPNG(t, 16, 16))
+
+	tests := []struct {
+		target string
+		want   int
+	}{
+		{"/", 3},
+		{"/?tag=Beach", 2},
+		{"/?tag=beach&tag=sunset", 1},
+		{"/?tag=night", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.target, func(t *testing.T) {
+			w := serve(th.handler.HandleHome, httptest.NewRequest(http.MethodGet, tt.target, nil))
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, want 200", w.Code)
+			}
+			if got := strings.Count(w.Body.String(), `class="delete-button"`); got != tt.want {
+				t.Errorf("rendered %d images, want %d", got, tt.want)
+			}
+		})
+	}
+
+	w := serve(th.handler.HandleHome, httptest.NewRequest(http.MethodGet, "/?tag=%21%21", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("invalid tag: status = %d, want 400", w.Code)
+	}
+}
+
+func TestHandleUploadTags(t *testing.T) {
+	th := newTestHandler(t, DefaultConfig())
+
+	upload := func(tags string) *httptest.ResponseRecorder {
+		r := multipartUploadFields(t, "photo.png", "image/png", testPNG(t, 16, 16), url.Values{"tags": {tags}})
+		return serve(th.handler.HandleUpload, r)
+	}
+
+	if w := upload("Beach, sunset ,beach"); w.Code != http.StatusSeeOther {
+		t.Fatalf("status = %d, want 303: %s", w.Code, w.Body.String())
+	}
+	page, err := th.repo.GetAllImages(context.Background(), ImageQuery{Limit: 10})
+	if err != nil {
+		t.Fatalf("GetAllImages: %v", err)
+	}
+	if len(page.Images) != 1 || strings.Join(page.Images[0].Tags, ",") != "beach,sunset" {
+		t.Fatalf("stored images = %+v, want one tagged beach,sunset", page.Images)
+	}
+
+	if w := upload("no/slashes"); w.Code != http.StatusBadRequest {
+		t.Errorf("invalid tag: status = %d, want 400", w.Code)
+	}
+}
+
+func TestHandleAPIImageTags(t *testing.T) {
+	th := newTestHandler(t, DefaultConfig())
+	img := th.upload(t, testPNG(t, 16, 16), "beach")
+
+	request := func(method, target, body string) (*httptest.ResponseRecorder, ImageMetadata) {
+		t.Helper()
+		w := serve(th.handler.HandleAPIImage, httptest.NewRequest(method, target, strings.NewReader(body)))
+		var metadata ImageMetadata
+		if w.Code == http.StatusOK {
+			if err := json.Unmarshal(w.Body.Bytes(), &metadata); err != nil {
+				t.Fatalf("decoding response: %v", err)
+			}
+		}
+		return w, metadata
+	}
+
+	tagsPath := "/api/v1/images/" + img.ID + "/tags"
+	w, metadata := request(http.MethodPost, tagsPath, `{"tags": ["Night", "beach"]}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("add tags: status = %d, want 200: %s", w.Code, w.Body.String())
+	}
+	if got := strings.Join(metadata.Tags, ","); got != "beach,night" {
+		t.Errorf("tags after add = %s, want beach,night", got)
+	}
+
+	w, metadata = request(http.MethodDelete, tagsPath+"/beach", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("remove tag: status = %d, want 200: %s", w.Code, w.Body.String())
+	}
+	if got := strings.Join(metadata.Tags, ","); got != "night" {
+		t.Errorf("tags after remove = %s, want night", got)
+	}
+
+	tests := []struct {
+		name   string
+		method string
+		target string
+		body   string
+		want   int
+	}{
+		{"invalid tag", http.MethodPost, tagsPath, `{"tags": ["a/b"]}`, http.StatusBadRequest},
+		{"unknown field", http.MethodPost, tagsPath, `{"labels": ["a"]}`, http.StatusBadRequest},
+		{"missing image", http.MethodPost, "/api/v1/images/missing/tags", `{"tags": ["a"]}`, http.StatusNotFound},
+		{"wrong method", http.MethodGet, tagsPath, "", http.StatusMethodNotAllowed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if w, _ := request(tt.method, tt.target, tt.body); w.Code != tt.want {
+				t.Errorf("status = %d, want %d", w.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestHandleImageEdit(t *testing.T) {
+	th := newTestHandler(t, DefaultConfig())
+	img := th.upload(t, testPNG(t, 16, 16))
+	editPath := "/image/" + img.ID + "/edit"
+
+	w := serve(th.handler.HandleImageProxy, httptest.NewRequest(http.MethodGet, editPath, nil))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `name="alt_text"`) {
+		t.Fatalf("edit form: status = %d, want 200 with the alt text field", w.Code)
+	}
+
+	post := func(form url.Values) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, editPath, strings.NewReader(form.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		return serve(th.handler.HandleImageProxy, r)
+	}
+
+	w = post(url.Values{"title": {" Login page "}, "description": {"Second attempt"}, "alt_text": {"Login form <error>"}})
+	if w.Code != http.StatusSeeOther {
+		t.Fatalf("save: status = %d, want 303: %s", w.Code, w.Body.String())
+	}
+	got, err := th.repo.GetImageByID(context.Background(), img.ID)
+	if err != nil {
+		t.Fatalf("GetImageByID: %v", err)
+	}
+	if got.Title != "Login page" || got.Description != "Second attempt" || got.AltText != "Login form <error>" {
+		t.Errorf("details = %q, %q, %q", got.Title, got.Description, got.AltText)
+	}
+
+	// The gallery uses the title as the caption and the alt text for the img tag
+	body := serve(th.handler.HandleHome, httptest.NewRequest(http.MethodGet, "/", nil)).Body.String()
+	if !strings.Contains(body, `alt="Login form &lt;error&gt;"`) || !strings.Contains(body, "Login page") {
+		t.Errorf("gallery does not render the title and alt text")
+	}
+
+	w = post(url.Values{"title": {strings.Repeat("x", maxTitleLength+1)}})
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "title is longer") {
+		t.Errorf("too long title: status = %d, want 400 with the form and error", w.Code)
+	}
+
+	tests := []struct {
+		method string
+		target string
+		want   int
+	}{
+		{http.MethodGet, "/image/missing/edit", http.StatusNotFound},
+		{http.MethodDelete, editPath, http.StatusMethodNotAllowed},
+		{http.MethodPost, "/image/" + img.ID, http.StatusMethodNotAllowed},
+	}
+	for _, tt := range tests {
+		w := serve(th.handler.HandleImageProxy, httptest.NewRequest(tt.method, tt.target, nil))
+		if w.Code != tt.want {
+			t.Errorf("%s %s: status = %d, want %d", tt.method, tt.target, w.Code, tt.want)
+		}
+	}
+}
+
+func TestHandleAPIImageUpdate(t *testing.T) {
+	th := newTestHandler(t, DefaultConfig())
+	img := th.upload(t, testPNG(t, 16, 16))
+	imagePath := "/api/v1/images/" + img.ID
+
+	patch := func(target, body string) *httptest.ResponseRecorder {
+		return serve(th.handler.HandleAPIImage, httptest.NewRequest(http.MethodPatch, target, strings.NewReader(body)))
+	}
+
+	w := patch(imagePath, `{"title": "Dashboard", "alt_text": "Latency graph"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200: %s", w.Code, w.Body.String())
+	}
+
+	// Fields left out of the body keep their values
+	w = patch(imagePath, `{"description": "Spike at 14:02"}`)
+	var metadata ImageMetadata
+	if err := json.Unmarshal(w.Body.Bytes(), &metadata); err != nil {
+		t.Fatalf("decoding response: %v", err)
+	}
+	if metadata.Title != "Dashboard" || metadata.AltText != "Latency graph" || metadata.Description != "Spike at 14:02" {
+		t.Errorf("metadata = %+v", metadata)
+	}
+
+	tests := []struct {
+		name   string
+		target string
+		body   string
+		want   int
+	}{
+		{"too long", imagePath, `{"alt_text": "` + strings.Repeat("x", maxAltTextLength+1) + `"}`, http.StatusBadRequest},
+		{"unknown field", imagePath, `{"caption": "x"}`, http.StatusBadRequest},
+		{"missing image", "/api/v1/images/missing", `{"title": "x"}`, http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if w := patch(tt.target, tt.body); w.Code != tt.want {
+				t.Errorf("status = %d, want %d", w.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestHandleHomeSearch(t *testing.T) {
+	th := newTestHandler(t, DefaultConfig())
+	login := th.upload(t, testPNG(t, 16, 16), "login")
+	other := th.upload(t, testPNG(t, 16, 16))
+	title := "Deployment dashboard"
+	if _, err := th.service.UpdateImage(context.Background(), other.ID, ImageUpdate{Title: &title}); err != nil {
+		t.Fatalf("UpdateImage: %v", err)
+	}
+
+	tests := []struct {
+		target string
+		want   int
+		status int
+	}{
+		{"/?q=Login", 1, http.StatusOK},
+		{"/?q=deploy+dash", 1, http.StatusOK},
+		{"/?q=&type=", 2, http.StatusOK},
+		{"/?type=png&min_size=1", 2, http.StatusOK},
+		{"/?type=gif", 0, http.StatusOK},
+		{"/?from=2000-01-01&to=2000-12-31", 0, http.StatusOK},
+		{"/?type=bmp", 0, http.StatusBadRequest},
+		{"/?min_size=-1", 0, http.StatusBadRequest},
+		{"/?min_size=10&max_size=5", 0, http.StatusBadRequest},
+		{"/?from=yesterday", 0, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.target, func(t *testing.T) {
+			w := serve(th.handler.HandleHome, httptest.NewRequest(http.MethodGet, tt.target, nil))
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d", w.Code, tt.status)
+			}
+			if tt.status != http.StatusOK {
+				return
+			}
+			if got := strings.Count(w.Body.String(), `class="delete-button"`); got != tt.want {
+				t.Errorf("rendered %d images, want %d", got, tt.want)
+			}
+		})
+	}
+
+	// The search box keeps the query and the API accepts the same parameters
+	w := serve(th.handler.HandleHome, httptest.NewRequest(http.MethodGet, "/?q=login", nil))
+	if !strings.Contains(w.Body.String(), `value="login"`) {
+		t.Error("search box does not show the current query")
+	}
+
+	w = serve(th.handler.HandleAPIImages, httptest.NewRequest(http.MethodGet, "/api/v1/images?q=login", nil))
+	var page imageListResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &page); err != nil {
+		t.Fatalf("decoding response: %v", err)
+	}
+	if len(page.Images) != 1 || page.Images[0].ID != login.ID {
+		t.Errorf("API search = %+v, want only %s", page.Images, login.ID)
+	}
+
+	w = serve(th.handler.HandleAPIImages, httptest.NewRequest(http.MethodGet, "/api/v1/images?to=soon", nil))
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "invalid_search") {
+		t.Errorf("invalid date: status = %d, body = %s", w.Code, w.Body.String())
+	}
+}
+
+func TestHandleUploadExifMetadata(t *testing.T) {
+	th := newTestHandler(t, DefaultConfig())
+
+	w := serve(th.handler.HandleAPIImages, multipartUpload(t, "photo.jpg", "image/jpeg", testExifJPEG(t, 40, 30)))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("status = %d, body = %s", w.Code, w.Body.String())
+	}
+	var created ImageMetadata
+	if err := json.Unmarshal(w.Body.Bytes(), &created); err != nil {
+		t.Fatalf("decoding response: %v", err)
+	}
+
+	stored, err := th.service.GetImage(context.Background(), created.ID)
+	if err != nil {
+		t.Fatalf("GetImage: %v", err)
+	}
+	for _, img := range []*ImageMetadata{&created, stored} {
+		if img.Width != 40 || img.Height != 30 || img.Orientation != 6 ||
+			img.CameraMake != "Canon" || img.CameraModel != "EOS R5" {
+			t.Errorf("metadata = %+v", img)
+		}
+		wantTaken := time.Date(2023, 7, 14, 9, 30, 15, 0, time.UTC)
+		if img.TakenAt == nil || !img.TakenAt.Equal(wantTaken) {
+			t.Errorf("TakenAt = %v, want %v", img.TakenAt, wantTaken)
+		}
+		if img.Latitude == nil || img.Longitude == nil ||
+			math.Abs(*img.Latitude-52.5201) > 1e-4 || math.Abs(*img.Longitude+13.4050) > 1e-4 {
+			t.Errorf("position = %v, %v", img.Latitude, img.Longitude)
+		}
+	}
+
+	// Images without EXIF data still record their dimensions
+	plain := th.upload(t, testPNG(t, 16, 8))
+	if plain.Width != 16 || plain.Height != 8 || plain.Orientation != 0 || plain.TakenAt != nil || plain.Latitude != nil {
+		t.Errorf("metadata = %+v", plain)
+	}
+}
+
+func TestHandleUploadStripMetadata(t *testing.T) {
+	config := DefaultConfig()
+	config.KeepOriginals = true
+	th := newTestHandler(t, config)
+	ctx := context.Background()
+	data := testExifJPEG(t, 40, 30)
+
+	upload := func(t *testing.T, strip string) (*httptest.ResponseRecorder, ImageMetadata) {
+		t.Helper()
+		w := serve(th.handler.HandleAPIImages, multipartUploadFields(t, "photo.jpg", "image/jpeg", data, url.Values{"strip_metadata": {strip}}))
+		var created ImageMetadata
+		if w.Code == http.StatusCreated {
+			if err := json.Unmarshal(w.Body.Bytes(), &created); err != nil {
+				t.Fatalf("decoding response: %v", err)
+			}
+		}
+		return w, created
+	}
+	stored := func(t *testing.T, key string) []byte {
+		t.Helper()
+		body, _, err := th.store.Get(ctx, key)
+		if err != nil {
+			t.Fatalf("Get %s: %v", key, err)
+		}
+		defer body.Close()
+		content, err := io.ReadAll(body)
+		if err != nil {
+			t.Fatalf("reading %s: %v", key, err)
+		}
+		return content
+	}
+
+	t.Run("stripped", func(t *testing.T) {
+		w, created := upload(t, "true")
+		if w.Code != http.StatusCreated {
+			t.Fatalf("status = %d, body = %s", w.Code, w.Body.String())
+		}
+		if created.Width != 30 || created.Height != 40 || created.Orientation != 0 ||
+			created.Latitude != nil || created.Longitude != nil || created.CameraMake != "Canon" {
+			t.Errorf("metadata = %+v", created)
+		}
+		if strings.Contains(w.Body.String(), "original_key") {
+			t.Error("response exposes the original key")
+		}
+
+		served := stored(t, created.S3Key)
+		if bytes.Contains(served, []byte("Exif")) || bytes.Contains(served, []byte("Canon")) {
+			t.Error("served image still carries EXIF data")
+		}
+		if int64(len(served)) != created.Size {
+			t.Errorf("size = %d, want %d", created.Size, len(served))
+		}
+
+		// Orientation 6 turns the red left half into the top half
+		img, err := jpeg.Decode(bytes.NewReader(served))
+		if err != nil {
+			t.Fatalf("decoding served image: %v", err)
+		}
+		if bounds := img.Bounds(); bounds.Dx() != 30 || bounds.Dy() != 40 {
+			t.Fatalf("served image is %dx%d, want 30x40", bounds.Dx(), bounds.Dy())
+		}
+		if r, _, b, _ := img.At(15, 5).RGBA(); r < b {
+			t.Error("top of the served image is not red")
+		}
+		if r, _, b, _ := img.At(15, 35).RGBA(); b < r {
+			t.Error("bottom of the served image is not blue")
+		}
+
+		original, err := th.repo.GetImageByID(ctx, created.ID)
+		if err != nil {
+			t.Fatalf("GetImageByID: %v", err)
+		}
+		if original.OriginalKey == "" || !bytes.Equal(stored(t, original.OriginalKey), data) {
+			t.Fatalf("unmodified original not kept under %q", original.OriginalKey)
+		}
+
+		if err := th.service.DeleteImage(ctx, created.ID); err != nil {
+			t.Fatalf("DeleteImage: %v", err)
+		}
+		if _, _, err := th.store.Get(ctx, original.OriginalKey); !errors.Is(err, storage.ErrObjectNotFound) {
+			t.Errorf("original after delete: err = %v, want ErrObjectNotFound", err)
+		}
+	})
+
+	t.Run("kept", func(t *testing.T) {
+		w, created := upload(t, "false")
+		if w.Code != http.StatusCreated {
+			t.Fatalf("status = %d, body = %s", w.Code, w.Body.String())
+		}
+		if created.Orientation != 6 || created.Latitude == nil {
+			t.Errorf("metadata = %+v", created)
+		}
+		if !bytes.Equal(stored(t, created.S3Key), data) {
+			t.Error("served image differs from the upload")
+		}
+	})
+
+	t.Run("invalid option", func(t *testing.T) {
+		w, _ := upload(t, "maybe")
+		if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "invalid_request") {
+			t.Errorf("status = %d, body = %s", w.Code, w.Body.String())
+		}
+	})
+}
+
+func TestUploadDeduplication(t *testing.T) {
+	th := newTestHandler(t, DefaultConfig())
+	ctx := context.Background()
+	data := testPNG(t, 300, 200)
+
+	first := th.upload(t, data)
+	second := th.upload(t, data, "copy")
+	if first.ID == second.ID {
+		t.Fatal("duplicate uploads share an ID")
+	}
+	if first.S3Key != second.S3Key || first.S3Key != "uploads/"+first.Checksum+".png" {
+		t.Errorf("keys = %s and %s, want both uploads/%s.png", first.S3Key, second.S3Key, first.Checksum)
+	}
+	if len(second.Variants) == 0 || fmt.Sprint(second.Variants) != fmt.Sprint(first.Variants) {
+		t.Errorf("variants = %+v, want the first image's %+v", second.Variants, first.Variants)
+	}
+
+	countObjects := func() int {
+		t.Helper()
+		objects, err := th.store.List(ctx, "")
+		if err != nil {
+			t.Fatalf("List: %v", err)
+		}
+		return len(objects)
+	}
+	stored := countObjects()
+	if want := 1 + len(first.Variants); stored != want {
+		t.Errorf("%d objects stored, want %d", stored, want)
+	}
+
+	// Deleting one copy leaves the shared objects for the other
+	if err := th.service.DeleteImage(ctx, first.ID); err != nil {
+		t.Fatalf("DeleteImage: %v", err)
+	}
+	if got := countObjects(); got != stored {
+		t.Errorf("%d objects left after deleting one copy, want %d", got, stored)
+	}
+	w := serve(th.handler.HandleImageProxy, httptest.NewRequest(http.MethodGet, "/image/"+second.ID, nil))
+	if w.Code != http.StatusOK || !bytes.Equal(w.Body.Bytes(), data) {
+		t.Errorf("remaining copy: status = %d", w.Code)
+	}
+
+	if err := th.service.DeleteImage(ctx, second.ID); err != nil {
+		t.Fatalf("DeleteImage: %v", err)
+	}
+	if got := countObjects(); got != 0 {
+		t.Errorf("%d objects left after deleting every copy", got)
+	}
+}
+
+func TestHandleSimilarImages(t *testing.T) {
+	config := DefaultConfig()
+	config.WarnNearDuplicates = true
+	th := newTestHandler(t, config)
+
+	original := th.upload(t, testPatternPNG(t, 320, 240, false))
+	if original.PerceptualHash == "" || len(original.NearDuplicates) != 0 {
+		t.Fatalf("original: hash = %q, near duplicates = %+v", original.PerceptualHash, original.NearDuplicates)
+	}
+	mirrored := th.upload(t, testPatternPNG(t, 320, 240, true))
+	if len(mirrored.NearDuplicates) != 0 {
+		t.Errorf("mirrored: near duplicates = %+v", mirrored.NearDuplicates)
+	}
+
+	// A resized copy is reported on upload, by the API and on the page
+	w := serve(th.handler.HandleAPIImages, multipartUpload(t, "small.png", "image/png", testPatternPNG(t, 96, 72, false)))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("upload status = %d, body = %s", w.Code, w.Body.String())
+	}
+	var resized ImageMetadata
+	if err := json.Unmarshal(w.Body.Bytes(), &resized); err != nil {
+		t.Fatalf("decoding response: %v", err)
+	}
+	if len(resized.NearDuplicates) != 1 || resized.NearDuplicates[0].ID != original.ID {
+		t.Errorf("near duplicates = %+v, want only %s", resized.NearDuplicates, original.ID)
+	}
+
+	w = serve(th.handler.HandleAPIImage, httptest.NewRequest(http.MethodGet, "/api/v1/images/"+original.ID+"/similar", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("similar status = %d, body = %s", w.Code, w.Body.String())
+	}
+	var similar similarImagesResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &similar); err != nil {
+		t.Fatalf("decoding response: %v", err)
+	}
+	if similar.Count != 1 || similar.Images[0].ID != resized.ID || similar.Images[0].Distance != resized.NearDuplicates[0].Distance {
+		t.Errorf("similar = %+v, want only %s", similar, resized.ID)
+	}
+
+	w = serve(th.handler.HandleImageProxy, httptest.NewRequest(http.MethodGet, "/image/"+original.ID+"/similar", nil))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "/image/"+resized.ID) ||
+		strings.Contains(w.Body.String(), "/image/"+mirrored.ID) {
+		t.Errorf("similar page: status = %d", w.Code)
+	}
+
+	// The upload form sends near-duplicates to the similar images page
+	w = serve(th.handler.HandleUpload, multipartUpload(t, "large.png", "image/png", testPatternPNG(t, 640, 480, false)))
+	if location := w.Header().Get("Location"); w.Code != http.StatusSeeOther || !strings.HasSuffix(location, "/similar") {
+		t.Errorf("upload: status = %d, location = %q", w.Code, location)
+	}
+
+	for _, path := range []string{"/image/missing/similar", "/api/v1/images/missing/similar"} {
+		handle := th.handler.HandleImageProxy
+		if strings.HasPrefix(path, "/api/") {
+			handle = th.handler.HandleAPIImage
+		}
+		if w := serve(handle, httptest.NewRequest(http.MethodGet, path, nil)); w.Code != http.StatusNotFound {
+			t.Errorf("%s: status = %d, want 404", path, w.Code)
+		}
+	}
+}
+
+func TestHandleAPIDirectUpload(t *testing.T) {
+	th := newTestHandler(t, DefaultConfig())
+	ctx := context.Background()
+	data := testPNG(t, 48, 32)
+
+	reserve := func(t *testing.T, body string) (*httptest.ResponseRecorder, DirectUpload, string) {
+		t.Helper()
+		w := serve(th.handler.HandleAPIUploads, httptest.NewRequest(http.MethodPost, "/api/v1/uploads", strings.NewReader(body)))
+		var upload DirectUpload
+		var key string
+		if w.Code == http.StatusCreated {
+			if err := json.Unmarshal(w.Body.Bytes(), &upload); err != nil {
+				t.Fatalf("decoding response: %v", err)
+			}
+			key = strings.TrimPrefix(upload.Upload.URL, "https://blobs.example.com/")
+		}
+		return w, upload, key
+	}
+	complete := func(id, body string) *httptest.ResponseRecorder {
+		return serve(th.handler.HandleAPIUpload, httptest.NewRequest(http.MethodPost, "/api/v1/uploads/"+id+"/complete", strings.NewReader(body)))
+	}
+	pngRequest := fmt.Sprintf(`{"filename": "direct.png", "content_type": "image/png", "size": %d}`, len(data))
+
+	if w, _, _ := reserve(t, pngRequest); w.Code != http.StatusNotImplemented {
+		t.Errorf("without presigning: status = %d, want 501", w.Code)
+	}
+
+	config := DefaultConfig()
+	config.ShareLinkSecret = []byte("test share link secret")
+	th.service = NewImageService(th.repo, &presigningBlobStore{th.store}, config)
+	th.handler = NewImageHandler(th.service, th.handler.templates)
+
+	t.Run("completed", func(t *testing.T) {
+		w, upload, key := reserve(t, pngRequest)
+		if w.Code != http.StatusCreated {
+			t.Fatalf("reserve: status = %d, body = %s", w.Code, w.Body.String())
+		}
+		if upload.Upload.Method != http.MethodPut || upload.Upload.Headers["Content-Type"] != "image/png" || !strings.HasPrefix(key, "pending/") {
+			t.Errorf("upload = %+v", upload.Upload)
+		}
+
+		// Completing before the object arrives keeps the reservation
+		if w := complete(upload.ID, ""); w.Code != http.StatusConflict {
+			t.Errorf("early completion: status = %d, want 409", w.Code)
+		}
+
+		if _, err := th.store.Put(ctx, key, bytes.NewReader(data), "image/png"); err != nil {
+			t.Fatalf("Put: %v", err)
+		}
+		puts, copies := th.store.callCount("Put"), th.store.callCount("Copy")
+		w = complete(upload.ID, `{"tags": ["direct"], "title": "Straight to the bucket"}`)
+		if w.Code != http.StatusCreated {
+			t.Fatalf("complete: status = %d, body = %s", w.Code, w.Body.String())
+		}
+		var created ImageMetadata
+		if err := json.Unmarshal(w.Body.Bytes(), &created); err != nil {
+			t.Fatalf("decoding response: %v", err)
+		}
+		if created.ID != upload.ID || created.OriginalName != "direct.png" || created.Title != "Straight to the bucket" ||
+			strings.Join(created.Tags, ",") != "direct" || created.Width != 48 || created.PerceptualHash == "" {
+			t.Errorf("image = %+v", created)
+		}
+
+		// The uploaded object is copied within the store; only variants are put
+		if got := th.store.callCount("Copy") - copies; got != 1 {
+			t.Errorf("%d objects copied, want 1", got)
+		}
+		if got, want := th.store.callCount("Put")-puts, len(created.Variants); got != want {
+			t.Errorf("%d objects put, want %d for the variants", got, want)
+		}
+		if _, err := th.store.Head(ctx, key); !errors.Is(err, storage.ErrObjectNotFound) {
+			t.Errorf("pending object after completion: err = %v", err)
+		}
+
+		w = serve(th.handler.HandleImageProxy, httptest.NewRequest(http.MethodGet, "/image/"+created.ID, nil))
+		if w.Code != http.StatusOK || !bytes.Equal(w.Body.Bytes(), data) {
+			t.Errorf("serving the image: status = %d", w.Code)
+		}
+		if w := complete(upload.ID, ""); w.Code != http.StatusNotFound {
+			t.Errorf("second completion: status = %d, want 404", w.Code)
+		}
+	})
+
+	t.Run("wrong size", func(t *testing.T) {
+		_, upload, key := reserve(t, `{"filename": "direct.png", "content_type": "image/png", "size": 10}`)
+		if _, err := th.store.Put(ctx, key, bytes.NewReader(data), "image/png"); err != nil {
+			t.Fatalf("Put: %v", err)
+		}
+		if w := complete(upload.ID, ""); w.Code != http.StatusBadRequest {
+			t.Errorf("status = %d, want 400", w.Code)
+		}
+		if _, err := th.store.Head(ctx, key); !errors.Is(err, storage.ErrObjectNotFound) {
+			t.Errorf("rejected object was kept: err = %v", err)
+		}
+	})
+
+	t.Run("not an image", func(t *testing.T) {
+		text := []byte("definitely not a png file")
+		_, upload, key := reserve(t, fmt.Sprintf(`{"filename": "notes.png", "content_type": "image/png", "size": %d}`, len(text)))
+		if _, err := th.store.Put(ctx, key, bytes.NewReader(text), "image/png"); err != nil {
+			t.Fatalf("Put: %v", err)
+		}
+		gets := th.store.callCount("Get")
+		if w := complete(upload.ID, ""); w.Code != http.StatusUnsupportedMediaType {
+			t.Errorf("status = %d, want 415", w.Code)
+		}
+		if got := th.store.callCount("Get") - gets; got != 0 {
+			t.Errorf("object read %d times, want only a ranged read of its first bytes", got)
+		}
+	})
+
+	t.Run("owned by the user who reserved it", func(t *testing.T) {
+		alice := common.Identity{ID: "u-alice", Username: "alice"}
+		as := func(identity common.Identity, r *http.Request) *http.Request {
+			return r.WithContext(common.WithIdentity(r.Context(), identity))
+		}
+		w := serve(th.handler.HandleAPIUploads, as(alice, httptest.NewRequest(http.MethodPost, "/api/v1/uploads", strings.NewReader(pngRequest))))
+		var upload DirectUpload
+		if err := json.Unmarshal(w.Body.Bytes(), &upload); err != nil || w.Code != http.StatusCreated {
+			t.Fatalf("reserve: status = %d, body = %s", w.Code, w.Body.String())
+		}
+		if _, err := th.store.Put(ctx, strings.TrimPrefix(upload.Upload.URL, "https://blobs.example.com/"), bytes.NewReader(data), "image/png"); err != nil {
+			t.Fatalf("Put: %v", err)
+		}
+
+		completePath := "/api/v1/uploads/" + upload.ID + "/complete"
+		if w := serve(th.handler.HandleAPIUpload, as(common.Identity{ID: "u-bob", Username: "bob"}, httptest.NewRequest(http.MethodPost, completePath, nil))); w.Code != http.StatusForbidden {
+			t.Errorf("completed by another user: status = %d, want 403", w.Code)
+		}
+		if w := complete(upload.ID, ""); w.Code != http.StatusForbidden {
+			t.Errorf("completed signed out: status = %d, want 403", w.Code)
+		}
+		w = serve(th.handler.HandleAPIUpload, as(alice, httptest.NewRequest(http.MethodPost, completePath, nil)))
+		var created ImageMetadata
+		if err := json.Unmarshal(w.Body.Bytes(), &created); err != nil || w.Code != http.StatusCreated {
+			t.Fatalf("complete: status = %d, body = %s", w.Code, w.Body.String())
+		}
+		if created.OwnerID != alice.ID {
+			t.Errorf("owner = %q, want %q", created.OwnerID, alice.ID)
+		}
+	})
+
+	t.Run("expired", func(t *testing.T) {
+		_, upload, key := reserve(t, pngRequest)
+		_, other, otherKey := reserve(t, pngRequest)
+		for _, key := range []string{key, otherKey} {
+			if _, err := th.store.Put(ctx, key, bytes.NewReader(data), "image/png"); err != nil {
+				t.Fatalf("Put: %v", err)
+			}
+		}
+		for _, id := range []string{upload.ID, other.ID} {
+			reservation, err := th.repo.GetReservation(ctx, id)
+			if err != nil {
+				t.Fatalf("GetReservation: %v", err)
+			}
+			reservation.ExpiresAt = time.Now().Add(-time.Minute)
+			th.repo.DeleteReservation(ctx, id)
+			th.repo.SaveReservation(ctx, *reservation)
+		}
+
+		if w := complete(upload.ID, ""); w.Code != http.StatusGone {
+			t.Errorf("status = %d, want 410", w.Code)
+		}
+
+		// The next reservation sweeps away the other expired one
+		reserve(t, pngRequest)
+		if _, err := th.repo.GetReservation(ctx, other.ID); !errors.Is(err, ErrUploadNotFound) {
+			t.Errorf("expired reservation: err = %v, want ErrUploadNotFound", err)
+		}
+		for _, key := range []string{key, otherKey} {
+			if _, err := th.store.Head(ctx, key); !errors.Is(err, storage.ErrObjectNotFound) {
+				t.Errorf("expired object %s was kept: err = %v", key, err)
+			}
+		}
+	})
+
+	tests := []struct {
+		name string
+		body string
+		want int
+	}{
+		{"too large", `{"filename": "big.png", "content_type": "image/png", "size": 1073741824}`, http.StatusRequestEntityTooLarge},
+		{"wrong type", `{"filename": "notes.txt", "content_type": "text/plain", "size": 10}`, http.StatusUnsupportedMediaType},
+		{"no size", `{"filename": "direct.png", "content_type": "image/png"}`, http.StatusBadRequest},
+		{"no filename", `{"content_type": "image/png", "size": 10}`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if w, _, _ := reserve(t, tt.body); w.Code != tt.want {
+				t.Errorf("status = %d, want %d", w.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestHandleTusUpload(t *testing.T) {
+	th := newTestHandler(t, DefaultConfig())
+	ctx := context.Background()
+
+	tusRequest := func(method, target string, body io.Reader, headers ...string) *http.Request {
+		r := httptest.NewRequest(method, target, body)
+		r.Header.Set("Tus-Resumable", "1.0.0")
+		for i := 0; i+1 < len(headers); i += 2 {
+			r.Header.Set(headers[i], headers[i+1])
+		}
+		return r
+	}
+	create := func(t *testing.T, length int, metadata string) string {
+		t.Helper()
+		w := serve(th.handler.HandleTusUploads, tusRequest(http.MethodPost, "/api/v1/tus", nil,
+			"Upload-Length", fmt.Sprint(length), "Upload-Metadata", metadata))
+		if w.Code != http.StatusCreated || w.Header().Get("Upload-Expires") == "" {
+			t.Fatalf("create: status = %d, body = %s", w.Code, w.Body.String())
+		}
+		return w.Header().Get("Location")
+	}
+	patch := func(location string, offset int, body io.Reader) *httptest.ResponseRecorder {
+		return serve(th.handler.HandleTusUpload, tusRequest(http.MethodPatch, location, body,
+			"Content-Type", "application/offset+octet-stream", "Upload-Offset", fmt.Sprint(offset)))
+	}
+	offsetOf := func(t *testing.T, location string) int {
+		t.Helper()
+		w := serve(th.handler.HandleTusUpload, tusRequest(http.MethodHead, location, nil))
+		if w.Code != http.StatusOK || w.Header().Get("Cache-Control") != "no-store" {
+			t.Fatalf("HEAD: status = %d", w.Code)
+		}
+		offset, _ := strconv.Atoi(w.Header().Get("Upload-Offset"))
+		return offset
+	}
+	metadata := func(pairs ...string) string {
+		var encoded []string
+		for i := 0; i+1 < len(pairs); i += 2 {
+			encoded = append(encoded, pairs[i]+" "+base64.StdEncoding.EncodeToString([]byte(pairs[i+1])))
+		}
+		return strings.Join(encoded, ",")
+	}
+
+	w := serve(th.handler.HandleTusUploads, httptest.NewRequest(http.MethodOptions, "/api/v1/tus", nil))
+	if w.Code != http.StatusNoContent || w.Header().Get("Tus-Version") != "1.0.0" || w.Header().Get("Tus-Max-Size") == "" {
+		t.Errorf("OPTIONS: status = %d, headers = %v", w.Code, w.Header())
+	}
+	r := httptest.NewRequest(http.MethodPost, "/api/v1/tus", nil)
+	r.Header.Set("Upload-Length", "10")
+	if w := serve(th.handler.HandleTusUploads, r); w.Code != http.StatusPreconditionFailed {
+		t.Errorf("without Tus-Resumable: status = %d, want 412", w.Code)
+	}
+
+	t.Run("resumed across parts", func(t *testing.T) {
+		// Large enough for one full part plus the last one
+		data := testNoisePNG(t, 1400, 1300)
+		if len(data) <= storage.MinPartSize {
+			t.Fatalf("test image is %d bytes, want more than one part", len(data))
+		}
+		location := create(t, len(data), metadata("filename", "big.png", "filetype", "image/png", "tags", "tus,mobile"))
+		id := strings.TrimPrefix(location, "/api/v1/tus/")
+
+		const chunk = 2 << 20
+		if w := patch(location, 0, bytes.NewReader(data[:chunk])); w.Code != http.StatusNoContent || w.Header().Get("Upload-Offset") != fmt.Sprint(chunk) {
+			t.Fatalf("first chunk: status = %d, offset = %s", w.Code, w.Header().Get("Upload-Offset"))
+		}
+		if w := patch(location, 0, bytes.NewReader(data[:chunk])); w.Code != http.StatusConflict {
+			t.Errorf("repeated chunk: status = %d, want 409", w.Code)
+		}
+		r := tusRequest(http.MethodPatch, location, bytes.NewReader(data[chunk:]), "Upload-Offset", fmt.Sprint(chunk))
+		if w := serve(th.handler.HandleTusUpload, r); w.Code != http.StatusUnsupportedMediaType {
+			t.Errorf("without the chunk content type: status = %d, want 415", w.Code)
+		}
+
+		// A dropped connection keeps what arrived, here past the first part
+		received := len(data) - 100_000
+		dropped := io.MultiReader(bytes.NewReader(data[chunk:received]), iotest.ErrReader(errors.New("connection reset")))
+		if w := patch(location, chunk, dropped); w.Code != http.StatusInternalServerError {
+			t.Errorf("dropped chunk: status = %d, want 500", w.Code)
+		}
+		offset := offsetOf(t, location)
+		if offset != received {
+			t.Fatalf("offset after dropped chunk = %d, want %d", offset, received)
+		}
+
+		if w := patch(location, offset, bytes.NewReader(data[offset:])); w.Code != http.StatusNoContent || w.Header().Get("Upload-Offset") != fmt.Sprint(len(data)) {
+			t.Fatalf("last chunk: status = %d, body = %s", w.Code, w.Body.String())
+		}
+
+		created, err := th.repo.GetImageByID(ctx, id)
+		if err != nil {
+			t.Fatalf("GetImageByID: %v", err)
+		}
+		if created.OriginalName != "big.png" || strings.Join(created.Tags, ",") != "mobile,tus" || created.Size != int64(len(data)) {
+			t.Errorf("image = %+v", created)
+		}
+		w := serve(th.handler.HandleImageProxy, httptest.NewRequest(http.MethodGet, "/image/"+id, nil))
+		if w.Code != http.StatusOK || !bytes.Equal(w.Body.Bytes(), data) {
+			t.Errorf("serving the image: status = %d, %d bytes", w.Code, w.Body.Len())
+		}
+		for _, prefix := range []string{"tus/", "multipart/"} {
+			if objects, _ := th.store.List(ctx, prefix); len(objects) != 0 {
+				t.Errorf("objects left under %s: %+v", prefix, objects)
+			}
+		}
+
+		// The finished upload still reports its offset
+		if offset := offsetOf(t, location); offset != len(data) {
+			t.Errorf("offset after completion = %d, want %d", offset, len(data))
+		}
+		if w := patch(location, len(data), http.NoBody); w.Code != http.StatusNoContent {
+			t.Errorf("empty chunk after completion: status = %d", w.Code)
+		}
+	})
+
+	t.Run("chunk past the length", func(t *testing.T) {
+		data := testPNG(t, 16, 16)
+		location := create(t, len(data)-1, metadata("filename", "short.png"))
+		if w := patch(location, 0, bytes.NewReader(data)); w.Code != http.StatusRequestEntityTooLarge {
+			t.Errorf("status = %d, want 413", w.Code)
+		}
+		if offset := offsetOf(t, location); offset != 0 {
+			t.Errorf("offset = %d, want 0", offset)
+		}
+	})
+
+	t.Run("not an image", func(t *testing.T) {
+		text := []byte("definitely not a png file")
+		location := create(t, len(text), metadata("filename", "notes.png"))
+		if w := patch(location, 0, bytes.NewReader(text)); w.Code != http.StatusUnsupportedMediaType {
+			t.Errorf("status = %d, want 415", w.Code)
+		}
+		if w := serve(th.handler.HandleTusUpload, tusRequest(http.MethodHead, location, nil)); w.Code != http.StatusNotFound {
+			t.Errorf("rejected upload: HEAD status = %d, want 404", w.Code)
+		}
+	})
+
+	t.Run("terminated", func(t *testing.T) {
+		data := testPNG(t, 16, 16)
+		location := create(t, len(data), "")
+		if w := patch(location, 0, bytes.NewReader(data[:10])); w.Code != http.StatusNoContent {
+			t.Fatalf("chunk: status = %d", w.Code)
+		}
+		if w := serve(th.handler.HandleTusUpload, tusRequest(http.MethodDelete, location, nil)); w.Code != http.StatusNoContent {
+			t.Fatalf("DELETE: status = %d", w.Code)
+		}
+		if w := patch(location, 10, bytes.NewReader(data[10:])); w.Code != http.StatusNotFound {
+			t.Errorf("chunk after termination: status = %d, want 404", w.Code)
+		}
+		if objects, _ := th.store.List(ctx, "tus/"); len(objects) != 0 {
+			t.Errorf("objects left after termination: %+v", objects)
+		}
+	})
+
+	t.Run("owned by the user who started it", func(t *testing.T) {
+		alice := common.Identity{ID: "u-alice", Username: "alice"}
+		bob := common.Identity{ID: "u-bob", Username: "bob"}
+		as := func(identity common.Identity, r *http.Request) *http.Request {
+			return r.WithContext(common.WithIdentity(r.Context(), identity))
+		}
+		data := testPNG(t, 16, 16)
+		w := serve(th.handler.HandleTusUploads, as(alice, tusRequest(http.MethodPost, "/api/v1/tus", nil, "Upload-Length", fmt.Sprint(len(data)))))
+		if w.Code != http.StatusCreated {
+			t.Fatalf("create: status = %d, body = %s", w.Code, w.Body.String())
+		}
+		location := w.Header().Get("Location")
+		chunk := func(identity common.Identity) *http.Request {
+			return as(identity, tusRequest(http.MethodPatch, location, bytes.NewReader(data),
+				"Content-Type", "application/offset+octet-stream", "Upload-Offset", "0"))
+		}
+
+		for _, r := range []*http.Request{
+			as(bob, tusRequest(http.MethodHead, location, nil)),
+			chunk(bob),
+			as(bob, tusRequest(http.MethodDelete, location, nil)),
+			tusRequest(http.MethodHead, location, nil),
+		} {
+			if w := serve(th.handler.HandleTusUpload, r); w.Code != http.StatusForbidden {
+				t.Errorf("%s by another user: status = %d, want 403", r.Method, w.Code)
+			}
+		}
+		if w := serve(th.handler.HandleTusUpload, chunk(alice)); w.Code != http.StatusNoContent {
+			t.Fatalf("chunk by the owner: status = %d, body = %s", w.Code, w.Body.String())
+		}
+		created, err := th.repo.GetImageByID(ctx, strings.TrimPrefix(location, "/api/v1/tus/"))
+		if err != nil || created.OwnerID != alice.ID {
+			t.Errorf("image = %+v, %v; want owned by %s", created, err, alice.ID)
+		}
+
+		// Anonymous uploads may be finished by anyone and stay unowned
+		location = create(t, len(data), "")
+		if w := serve(th.handler.HandleTusUpload, chunk(bob)); w.Code != http.StatusNoContent {
+			t.Fatalf("finishing an anonymous upload: status = %d", w.Code)
+		}
+		created, err = th.repo.GetImageByID(ctx, strings.TrimPrefix(location, "/api/v1/tus/"))
+		if err != nil || created.OwnerID != "" {
+			t.Errorf("image = %+v, %v; want no owner", created, err)
+		}
+	})
+
+	t.Run("invalid metadata", func(t *testing.T) {
+		w := serve(th.handler.HandleTusUploads, tusRequest(http.MethodPost, "/api/v1/tus", nil,
+			"Upload-Length", "100", "Upload-Metadata", "filename not-base64!"))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("status = %d, want 400", w.Code)
+		}
+		w = serve(th.handler.HandleTusUploads, tusRequest(http.MethodPost, "/api/v1/tus", nil,
+			"Upload-Length", fmt.Sprint(64<<20), "Upload-Metadata", metadata("filetype", "image/png")))
+		if w.Code != http.StatusRequestEntityTooLarge {
+			t.Errorf("oversized: status = %d, want 413", w.Code)
+		}
+	})
+}
+
+func TestHandleImageSharing(t *testing.T) {
+	th := newTestHandler(t, DefaultConfig())
+	owner := common.WithIdentity(context.Background(), common.Identity{ID: "u-owner", Username: "owner"})
+	asOwner := func(r *http.Request) *http.Request {
+		return r.WithContext(owner)
+	}
+	data := testPNG(t, 16, 16)
+	img, err := th.service.UploadImage(owner, bytes.NewReader(data), "photo.png", "image/png", int64(len(data)), UploadOptions{})
+	if err != nil {
+		t.Fatalf("UploadImage: %v", err)
+	}
+	imagePath, apiLinksPath := "/image/"+img.ID, "/api/v1/images/"+img.ID+"/links"
+
+	get := func(target string, cookies ...*http.Cookie) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, target, nil)
+		for _, cookie := range cookies {
+			r.AddCookie(cookie)
+		}
+		return serve(th.handler.HandleImageProxy, r)
+	}
+	newForm := func(target string, form url.Values) *http.Request {
+		r := httptest.NewRequest(http.MethodPost, target, strings.NewReader(form.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		return r
+	}
+	postForm := func(target string, form url.Values) *httptest.ResponseRecorder {
+		return serve(th.handler.HandleImageProxy, newForm(target, form))
+	}
+	createLink := func(body string) (*httptest.ResponseRecorder, ShareLink) {
+		w := serve(th.handler.HandleAPIImage, asOwner(httptest.NewRequest(http.MethodPost, apiLinksPath, strings.NewReader(body))))
+		var link ShareLink
+		json.Unmarshal(w.Body.Bytes(), &link)
+		return w, link
+	}
+
+	w := serve(th.handler.HandleAPIImage, asOwner(httptest.NewRequest(http.MethodPatch, "/api/v1/images/"+img.ID, strings.NewReader(`{"private": true}`))))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"private":true`) {
+		t.Fatalf("making private: status = %d: %s", w.Code, w.Body.String())
+	}
+
+	// Without a link a private image does not exist, and the gallery hides it
+	for _, target := range []string{imagePath, imagePath + "/thumb"} {
+		if w := get(target); w.Code != http.StatusNotFound {
+			t.Errorf("GET %s: status = %d, want 404", target, w.Code)
+		}
+	}
+	if body := serve(th.handler.HandleHome, httptest.NewRequest(http.MethodGet, "/", nil)).Body.String(); strings.Contains(body, imagePath+"/thumb") {
+		t.Error("gallery shows the thumbnail of a private image")
+	}
+
+	expiresAt := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+	w, limited := createLink(`{"expires_at": "` + expiresAt + `", "max_downloads": 4}`)
+	if w.Code != http.StatusCreated || limited.URL == "" || limited.MaxDownloads != 4 || limited.Protected {
+		t.Fatalf("creating link: status = %d: %s", w.Code, w.Body.String())
+	}
+	downloads := func() int {
+		t.Helper()
+		links, err := th.service.ListShareLinks(owner, img.ID)
+		if err != nil || len(links) != 1 {
+			t.Fatalf("links = %+v, %v; want one link", links, err)
+		}
+		return links[0].Downloads
+	}
+
+	// Thumbnails and HEAD requests do not use up downloads
+	_, query, _ := strings.Cut(limited.URL, "?")
+	if w := get(imagePath + "/thumb?" + query); w.Code != http.StatusOK {
+		t.Errorf("thumbnail through link: status = %d, want 200", w.Code)
+	}
+	head := serve(th.handler.HandleImageProxy, httptest.NewRequest(http.MethodHead, limited.URL, nil))
+	if head.Code != http.StatusOK {
+		t.Errorf("HEAD through link: status = %d, want 200", head.Code)
+	}
+	// Only responses starting at the first byte count, so ranged and resumed
+	// downloads use up one download
+	ranged := func(spec string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, limited.URL, nil)
+		r.Header.Set("Range", spec)
+		return serve(th.handler.HandleImageProxy, r)
+	}
+	if w := ranged("bytes=0-9"); w.Code != http.StatusPartialContent {
+		t.Fatalf("first range: status = %d, want 206", w.Code)
+	}
+	for _, spec := range []string{"bytes=10-", "bytes=-5", "bytes=10-19"} {
+		if w := ranged(spec); w.Code != http.StatusPartialContent {
+			t.Errorf("range %s: status = %d, want 206", spec, w.Code)
+		}
+	}
+	if got := downloads(); got != 1 {
+		t.Fatalf("%d downloads counted after ranged requests, want 1", got)
+	}
+
+	// Nothing is counted when the image is not sent
+	conditional := httptest.NewRequest(http.MethodGet, limited.URL, nil)
+	conditional.Header.Set("If-None-Match", head.Header().Get("ETag"))
+	if w := serve(th.handler.HandleImageProxy, conditional); w.Code != http.StatusNotModified {
+		t.Errorf("conditional download: status = %d, want 304", w.Code)
+	}
+	if w := get(limited.URL + "&w=7"); w.Code != http.StatusBadRequest {
+		t.Errorf("bad transform: status = %d, want 400", w.Code)
+	}
+	if got := downloads(); got != 1 {
+		t.Errorf("%d downloads counted after unsent responses, want 1", got)
+	}
+
+	// A suffix range covering the whole image and a multipart response
+	// including the first byte are downloads too
+	if w := ranged("bytes=-999999999"); w.Code != http.StatusPartialContent {
+		t.Errorf("whole suffix range: status = %d, want 206", w.Code)
+	}
+	if w := ranged("bytes=1-,0-0"); w.Code != http.StatusPartialContent || !strings.HasPrefix(w.Header().Get("Content-Type"), "multipart/byteranges") {
+		t.Errorf("multiple ranges: status = %d, Content-Type = %q", w.Code, w.Header().Get("Content-Type"))
+	}
+	if got := downloads(); got != 3 {
+		t.Errorf("%d downloads counted after whole-image ranges, want 3", got)
+	}
+
+	if w := get(limited.URL); w.Code != http.StatusOK || w.Header().Get("Cache-Control") != "private, no-store" {
+		t.Fatalf("last download: status = %d, Cache-Control = %q", w.Code, w.Header().Get("Cache-Control"))
+	}
+	if w := get(limited.URL); w.Code != http.StatusGone {
+		t.Errorf("download past the limit: status = %d, want 410", w.Code)
+	}
+
+	// A link used up between authorizing and sending is refused without the image
+	object, err := th.service.GetImageData(owner, img.ID)
+	if err != nil {
+		t.Fatalf("GetImageData: %v", err)
+	}
+	w = httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, limited.URL, nil)
+	th.handler.serveImageObject(&shareDownloadWriter{ResponseWriter: w, handler: th.handler, r: r, id: img.ID, link: &limited}, r, img.ID, object, nil)
+	if w.Code != http.StatusGone || w.Header().Get("Content-Range") != "" || strings.Contains(w.Body.String(), "PNG") {
+		t.Errorf("link used up while sending: status = %d, body = %q", w.Code, w.Body.String())
+	}
+
+	tampered := strings.Replace(limited.URL, "share="+limited.ID, "share=other", 1)
+	if w := get(tampered); w.Code != http.StatusNotFound {
+		t.Errorf("tampered link: status = %d, want 404", w.Code)
+	}
+	if w, _ := createLink(`{"expires_at": "` + time.Now().Add(365*24*time.Hour).UTC().Format(time.RFC3339) + `"}`); w.Code != http.StatusBadRequest ||
+		!strings.Contains(w.Body.String(), "invalid_share_link") {
+		t.Errorf("expiry past the maximum: status = %d: %s", w.Code, w.Body.String())
+	}
+
+	// A password protected link made on the edit page asks for the password
+	// once, then remembers it in a cookie
+	if w := serve(th.handler.HandleImageProxy, asOwner(newForm(imagePath+"/links", url.Values{"expires_in": {"24h"}, "password": {"hunter2"}}))); w.Code != http.StatusSeeOther {
+		t.Fatalf("creating protected link: status = %d: %s", w.Code, w.Body.String())
+	}
+	links, err := th.service.ListShareLinks(owner, img.ID)
+	if err != nil || len(links) != 2 || !links[1].Protected {
+		t.Fatalf("links = %+v, %v, want the limited and a protected link", links, err)
+	}
+	protected := links[1]
+	if w := serve(th.handler.HandleImageProxy, asOwner(httptest.NewRequest(http.MethodGet, imagePath+"/edit", nil))); !strings.Contains(w.Body.String(), "password protected") {
+		t.Error("edit page does not list the protected link")
+	}
+
+	if w := get(protected.URL); w.Code != http.StatusUnauthorized || !strings.Contains(w.Body.String(), `name="password"`) {
+		t.Fatalf("protected link: status = %d, want 401 with the password form", w.Code)
+	}
+	if w := postForm(protected.URL, url.Values{"password": {"wrong"}}); w.Code != http.StatusUnauthorized || !strings.Contains(w.Body.String(), "Wrong password") {
+		t.Errorf("wrong password: status = %d, want 401", w.Code)
+	}
+	w = postForm(protected.URL, url.Values{"password": {"hunter2"}})
+	cookies := w.Result().Cookies()
+	if w.Code != http.StatusSeeOther || w.Header().Get("Location") != protected.URL || len(cookies) != 1 {
+		t.Fatalf("right password: status = %d, Location = %q, cookies = %v", w.Code, w.Header().Get("Location"), cookies)
+	}
+	if w := get(protected.URL, cookies...); w.Code != http.StatusOK {
+		t.Errorf("protected link with cookie: status = %d, want 200", w.Code)
+	}
+
+	if w := serve(th.handler.HandleImageProxy, asOwner(newForm(imagePath+"/links/"+protected.ID+"/revoke", nil))); w.Code != http.StatusSeeOther {
+		t.Fatalf("revoking: status = %d", w.Code)
+	}
+	if w := get(protected.URL, cookies...); w.Code != http.StatusNotFound {
+		t.Errorf("revoked link: status = %d, want 404", w.Code)
+	}
+	for i, want := range []int{http.StatusNoContent, http.StatusNotFound} {
+		w := serve(th.handler.HandleAPIImage, asOwner(httptest.NewRequest(http.MethodDelete, apiLinksPath+"/"+limited.ID, nil)))
+		if w.Code != want {
+			t.Errorf("API revoke %d: status = %d, want %d", i+1, w.Code, want)
+		}
+	}
+
+	// Public again, the image is served to anyone
+	th.service.UpdateImage(owner, img.ID, ImageUpdate{Private: new(bool)})
+	if w := get(imagePath); w.Code != http.StatusOK || w.Header().Get("Cache-Control") != "public, max-age=86400" {
+		t.Errorf("public image: status = %d, Cache-Control = %q", w.Code, w.Header().Get("Cache-Control"))
+	}
+}
+
+func TestNearDuplicatesHidePrivateImages(t *testing.T) {
+	config := DefaultConfig()
+	config.WarnNearDuplicates = true
+	th := newTestHandler(t, config)
+	alice := common.WithIdentity(context.Background(), common.Identity{ID: "u-alice", Username: "alice"})
+	bob := common.Identity{ID: "u-bob", Username: "bob"}
+
+	data := testPatternPNG(t, 320, 240, false)
+	original, err := th.service.UploadImage(alice, bytes.NewReader(data), "photo.png", "image/png", int64(len(data)), UploadOptions{})
+	if err != nil {
+		t.Fatalf("UploadImage: %v", err)
+	}
+	private := true
+	if _, err := th.service.UpdateImage(alice, original.ID, ImageUpdate{Private: &private}); err != nil {
+		t.Fatalf("UpdateImage: %v", err)
+	}
+
+	// Another user's near-copy must not learn of the private image
+	r := multipartUpload(t, "copy.png", "image/png", testPatternPNG(t, 96, 72, false))
+	w := serve(th.handler.HandleAPIImages, r.WithContext(common.WithIdentity(r.Context(), bob)))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("upload status = %d, body = %s", w.Code, w.Body.String())
+	}
+	if strings.Contains(w.Body.String(), "near_duplicates") || strings.Contains(w.Body.String(), original.ID) {
+		t.Errorf("another user's upload reported the private image: %s", w.Body.String())
+	}
+
+	// The owner is still warned about copies of their own private image
+	resized := testPatternPNG(t, 160, 120, false)
+	mine, err := th.service.UploadImage(alice, bytes.NewReader(resized), "mine.png", "image/png", int64(len(resized)), UploadOptions{})
+	if err != nil {
+		t.Fatalf("UploadImage: %v", err)
+	}
+	found := false
+	for _, match := range mine.NearDuplicates {
+		found = found || match.ID == original.ID
+	}
+	if !found {
+		t.Errorf("owner's near duplicates = %+v, want %s", mine.NearDuplicates, original.ID)
+	}
+}
+
+func TestImageOwnership(t *testing.T) {
+	th := newTestHandler(t, DefaultConfig())
+	alice := common.Identity{ID: "u-alice", Username: "alice"}
+	bob := common.Identity{ID: "u-bob", Username: "bob"}
+	as := func(identity common.Identity, r *http.Request) *http.Request {
+		return r.WithContext(common.WithIdentity(r.Context(), identity))
+	}
+
+	// Uploads belong to whoever is signed in; older images have no owner
+	if w := serve(th.handler.HandleUpload, as(alice, multipartUpload(t, "mine.png", "image/png", testPNG(t, 20, 10)))); w.Code != http.StatusSeeOther {
+		t.Fatalf("upload: status = %d: %s", w.Code, w.Body.String())
+	}
+	unowned := th.upload(t, testPNG(t, 10, 20))
+
+	page, err := th.repo.GetAllImages(context.Background(), ImageQuery{Limit: 10})
+	if err != nil || len(page.Images) != 2 {
+		t.Fatalf("GetAllImages = %+v, %v; want 2 images", page, err)
+	}
+	var owned ImageMetadata
+	for _, img := range page.Images {
+		if img.ID != unowned.ID {
+			owned = img
+		}
+	}
+	if owned.OwnerID != alice.ID {
+		t.Fatalf("owner = %q, want %q", owned.OwnerID, alice.ID)
+	}
+
+	var list imageListResponse
+	w := serve(th.handler.HandleAPIImages, as(alice, httptest.NewRequest(http.MethodGet, "/api/v1/images?mine=true", nil)))
+	if err := json.Unmarshal(w.Body.Bytes(), &list); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("mine: status = %d: %s", w.Code, w.Body.String())
+	}
+	if len(list.Images) != 1 || list.Images[0].ID != owned.ID {
+		t.Errorf("mine = %+v, want only %s", list.Images, owned.ID)
+	}
+	if w := serve(th.handler.HandleAPIImages, httptest.NewRequest(http.MethodGet, "/api/v1/images?mine=true", nil)); w.Code != http.StatusBadRequest {
+		t.Errorf("mine while signed out: status = %d, want 400", w.Code)
+	}
+
+	// Only the owner may change an owned image; with anonymous access anyone
+	// may change unowned ones
+	apiPath := "/api/v1/images/" + owned.ID
+	if w := serve(th.handler.HandleAPIImage, as(bob, httptest.NewRequest(http.MethodPatch, apiPath, strings.NewReader(`{"title": "bob's now"}`)))); w.Code != http.StatusForbidden {
+		t.Errorf("PATCH by another user: status = %d, want 403", w.Code)
+	}
+	if w := serve(th.handler.HandleImageProxy, as(bob, httptest.NewRequest(http.MethodDelete, "/image/"+owned.ID, nil))); w.Code != http.StatusForbidden {
+		t.Errorf("DELETE by another user: status = %d, want 403", w.Code)
+	}
+	if w := serve(th.handler.HandleAPIImage, as(alice, httptest.NewRequest(http.MethodPatch, apiPath, strings.NewReader(`{"title": "still mine"}`)))); w.Code != http.StatusOK {
+		t.Errorf("PATCH by the owner: status = %d, want 200", w.Code)
+	}
+	if w := serve(th.handler.HandleAPIImage, as(bob, httptest.NewRequest(http.MethodPatch, "/api/v1/images/"+unowned.ID, strings.NewReader(`{"title": "shared"}`)))); w.Code != http.StatusOK {
+		t.Errorf("PATCH of an unowned image: status = %d, want 200", w.Code)
+	}
+
+	// Without anonymous access nobody may change unowned images until they are claimed
+	config := DefaultConfig()
+	config.ShareLinkSecret = []byte("test share link secret")
+	readOnly := NewImageHandler(NewImageService(th.repo, th.store, config), th.handler.templates)
+	if w := serve(readOnly.HandleAPIImage, as(bob, httptest.NewRequest(http.MethodPatch, "/api/v1/images/"+unowned.ID, strings.NewReader(`{"title": "mine now"}`)))); w.Code != http.StatusForbidden {
+		t.Errorf("PATCH of an unowned image without anonymous access: status = %d, want 403", w.Code)
+	}
+	if w := serve(readOnly.HandleImageProxy, as(bob, httptest.NewRequest(http.MethodDelete, "/image/"+unowned.ID, nil))); w.Code != http.StatusForbidden {
+		t.Errorf("DELETE of an unowned image without anonymous access: status = %d, want 403", w.Code)
+	}
+	if claimed, err := th.repo.ClaimUnownedImages(context.Background(), bob.ID); err != nil || claimed != 1 {
+		t.Fatalf("ClaimUnownedImages = %d, %v; want 1", claimed, err)
+	}
+	if w := serve(readOnly.HandleAPIImage, as(bob, httptest.NewRequest(http.MethodPatch, "/api/v1/images/"+unowned.ID, strings.NewReader(`{"title": "mine now"}`)))); w.Code != http.StatusOK {
+		t.Errorf("PATCH of a claimed image by its new owner: status = %d, want 200", w.Code)
+	}
+
+	// Viewing stays open to everyone
+	if w := serve(th.handler.HandleImageProxy, as(bob, httptest.NewRequest(http.MethodGet, "/image/"+owned.ID, nil))); w.Code != http.StatusOK {
+		t.Errorf("GET by another user: status = %d, want 200", w.Code)
+	}
+
+	// Unless the image is private: then only its owner sees it without a link
+	if w := serve(th.handler.HandleAPIImage, as(alice, httptest.NewRequest(http.MethodPatch, apiPath, strings.NewReader(`{"private": true}`)))); w.Code != http.StatusOK {
+		t.Fatalf("making private: status = %d: %s", w.Code, w.Body.String())
+	}
+	for _, target := range []string{"/image/" + owned.ID, "/image/" + owned.ID + "/thumb"} {
+		if w := serve(th.handler.HandleImageProxy, as(alice, httptest.NewRequest(http.MethodGet, target, nil))); w.Code != http.StatusOK ||
+			w.Header().Get("Cache-Control") != "private, no-store" {
+			t.Errorf("GET %s by the owner: status = %d, Cache-Control = %q", target, w.Code, w.Header().Get("Cache-Control"))
+		}
+		if w := serve(th.handler.HandleImageProxy, as(bob, httptest.NewRequest(http.MethodGet, target, nil))); w.Code != http.StatusNotFound {
+			t.Errorf("GET %s by another user: status = %d, want 404", target, w.Code)
+		}
+	}
+
+	// Listings, search and the API leave it out for everyone else
+	for _, tc := range []struct {
+		identity common.Identity
+		want     bool
+	}{{alice, true}, {bob, false}} {
+		for _, target := range []string{"/", "/?q=mine"} {
+			body := serve(th.handler.HandleHome, as(tc.identity, httptest.NewRequest(http.MethodGet, target, nil))).Body.String()
+			if got := strings.Contains(body, "/image/"+owned.ID+"/edit"); got != tc.want {
+				t.Errorf("%s as %s: lists the private image = %v, want %v", target, tc.identity.Username, got, tc.want)
+			}
+		}
+		w := serve(th.handler.HandleAPIImages, as(tc.identity, httptest.NewRequest(http.MethodGet, "/api/v1/images", nil)))
+		if got := strings.Contains(w.Body.String(), owned.ID); got != tc.want {
+			t.Errorf("API list as %s: includes the private image = %v, want %v", tc.identity.Username, got, tc.want)
+		}
+		wantStatus := http.StatusNotFound
+		if tc.want {
+			wantStatus = http.StatusOK
+		}
+		if w := serve(th.handler.HandleAPIImage, as(tc.identity, httptest.NewRequest(http.MethodGet, apiPath, nil))); w.Code != wantStatus {
+			t.Errorf("API GET as %s: status = %d, want %d", tc.identity.Username, w.Code, wantStatus)
+		}
+	}
+}
+
+func TestIsImageView(t *testing.T) {
+	tests := []struct {
+		method string
+		target string
+		want   bool
+	}{
+		{http.MethodGet, "/image/abc", true},
+		{http.MethodHead, "/image/abc/thumb?size=300", true},
+		{http.MethodGet, "/image/abc?w=100&format=webp", true},
+		{http.MethodPost, "/image/abc?share=token", true},
+		{http.MethodGet, "/image/abc/edit", false},
+		{http.MethodGet, "/image/abc/links", false},
+		{http.MethodPost, "/image/abc/edit?share=token", false},
+		{http.MethodDelete, "/image/abc?share=token", false},
+		{http.MethodGet, "/upload", false},
+	}
+	for _, tt := range tests {
+		if got := IsImageView(httptest.NewRequest(tt.method, tt.target, nil)); got != tt.want {
+			t.Errorf("IsImageView(%s %s) = %v, want %v", tt.method, tt.target, got, tt.want)
+		}
+	}
+}
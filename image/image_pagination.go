@@ -0,0 +1,78 @@
+package image
+
+import (
+	"encoding/base64"
+	"strings"
+	"time"
+)
+
+// pageCursor is a keyset position in the (uploaded_at, id) ordering
+type pageCursor struct {
+	UploadedAt time.Time
+	ID         string
+}
+
+// encodeCursor returns the opaque cursor string for an image's position
+func encodeCursor(img ImageMetadata) string {
+	raw := img.UploadedAt.UTC().Format(time.RFC3339Nano) + "|" + img.ID
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// decodeCursor parses an opaque cursor string
+func decodeCursor(cursor string) (*pageCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	uploadedAt, id, ok := strings.Cut(string(raw), "|")
+	if !ok || id == "" {
+		return nil, ErrInvalidCursor
+	}
+
+	parsed, err := time.Parse(time.RFC3339Nano, uploadedAt)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	return &pageCursor{UploadedAt: parsed, ID: id}, nil
+}
+
+// buildPage trims a result fetched with one extra row into an ImagePage.
+// Rows must be in the order they were fetched: newest first when paging
+// forward, oldest first when paging backward with query.Before.
+func buildPage(rows []ImageMetadata, query ImageQuery) *ImagePage {
+	hasMore := len(rows) > query.Limit
+	if hasMore {
+		rows = rows[:query.Limit]
+	}
+
+	backward := query.Before != ""
+	if backward {
+		for i, j := 0, len(rows)-1; i < j; i, j = i+1, j-1 {
+			rows[i], rows[j] = rows[j], rows[i]
+		}
+	}
+
+	page := &ImagePage{Images: rows}
+	if len(rows) == 0 {
+		return page
+	}
+
+	first, last := rows[0], rows[len(rows)-1]
+	if backward {
+		page.NextCursor = encodeCursor(last)
+		if hasMore {
+			page.PrevCursor = encodeCursor(first)
+		}
+	} else {
+		if hasMore {
+			page.NextCursor = encodeCursor(last)
+		}
+		if query.After != "" {
+			page.PrevCursor = encodeCursor(first)
+		}
+	}
+
+	return page
+}
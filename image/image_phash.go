@@ -0,0 +1,73 @@
+package image
+
+import (
+	"fmt"
+	stdimage "image"
+	"math/bits"
+	"sort"
+	"strconv"
+
+	"golang.org/x/image/draw"
+)
+
+// maxHashDistance is the largest possible Hamming distance between two hashes
+const maxHashDistance = 64
+
+// maxNearDuplicateWarnings caps the near-duplicates reported for one upload
+const maxNearDuplicateWarnings = 10
+
+// perceptualHash computes the 64-bit difference hash (dHash) of img as 16
+// hex digits. The image is reduced to 9x8 grey pixels and each bit records
+// whether a pixel is darker than its right neighbour, so resized and
+// recompressed copies hash alike.
+func perceptualHash(img stdimage.Image) string {
+	small := stdimage.NewGray(stdimage.Rect(0, 0, 9, 8))
+	draw.BiLinear.Scale(small, small.Bounds(), img, img.Bounds(), draw.Src, nil)
+
+	var hash uint64
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			hash <<= 1
+			if small.GrayAt(x, y).Y < small.GrayAt(x+1, y).Y {
+				hash |= 1
+			}
+		}
+	}
+	return fmt.Sprintf("%016x", hash)
+}
+
+// hashDistance returns the Hamming distance between two perceptual hashes;
+// ok is false when either is missing or malformed
+func hashDistance(a, b string) (distance int, ok bool) {
+	x, errA := strconv.ParseUint(a, 16, 64)
+	y, errB := strconv.ParseUint(b, 16, 64)
+	if errA != nil || errB != nil {
+		return 0, false
+	}
+	return bits.OnesCount64(x ^ y), true
+}
+
+// nearestHashes returns the images in hashes within threshold of hash,
+// closest first and then by ID, leaving out excludeID
+func nearestHashes(hashes map[string]string, hash string, excludeID string, threshold, limit int) []NearDuplicate {
+	var matches []NearDuplicate
+	for id, other := range hashes {
+		if id == excludeID {
+			continue
+		}
+		if distance, ok := hashDistance(hash, other); ok && distance <= threshold {
+			matches = append(matches, NearDuplicate{ID: id, Distance: distance})
+		}
+	}
+
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].Distance != matches[j].Distance {
+			return matches[i].Distance < matches[j].Distance
+		}
+		return matches[i].ID < matches[j].ID
+	})
+	if len(matches) > limit {
+		matches = matches[:limit]
+	}
+	return matches
+}
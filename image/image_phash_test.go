@@ -0,0 +1,41 @@
+package image
+
+import (
+	"bytes"
+	stdimage "image"
+	"testing"
+)
+
+func TestPerceptualHash(t *testing.T) {
+	hash := func(data []byte) string {
+		t.Helper()
+		img, _, err := stdimage.Decode(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("decoding: %v", err)
+		}
+		return perceptualHash(img)
+	}
+
+	original := hash(testPatternPNG(t, 320, 240, false))
+	if len(original) != 16 {
+		t.Fatalf("hash = %q, want 16 hex digits", original)
+	}
+
+	for name, tc := range map[string]struct {
+		data    []byte
+		maxDist int
+		minDist int
+	}{
+		"resized":  {data: testPatternPNG(t, 96, 72, false), maxDist: 4},
+		"mirrored": {data: testPatternPNG(t, 320, 240, true), minDist: 16, maxDist: 64},
+	} {
+		distance, ok := hashDistance(original, hash(tc.data))
+		if !ok || distance < tc.minDist || distance > tc.maxDist {
+			t.Errorf("%s: distance = %d, %v, want %d to %d", name, distance, ok, tc.minDist, tc.maxDist)
+		}
+	}
+
+	if _, ok := hashDistance(original, ""); ok {
+		t.Error("distance to a missing hash is valid")
+	}
+}
@@ -4,40 +4,143 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+	"strings"
+	"time"
 
 	"file-pub/internal/common"
+	"file-pub/internal/database"
+	"file-pub/storage"
 )
 
 // ImageRepository defines the interface for image data access
 type ImageRepository interface {
-	GetAllImages(ctx context.Context) ([]ImageMetadata, error)
+	GetAllImages(ctx context.Context, query ImageQuery) (*ImagePage, error)
 	SaveImage(ctx context.Context, metadata ImageMetadata) error
 	GetImageByID(ctx context.Context, id string) (*ImageMetadata, error)
+	GetImagesByIDs(ctx context.Context, ids []string) ([]ImageMetadata, error)
+	FindImageByChecksum(ctx context.Context, checksum string) (*ImageMetadata, error)
+	ListPerceptualHashes(ctx context.Context) (map[string]string, error)
+	UpdateImage(ctx context.Context, metadata ImageMetadata) error
+	ClaimUnownedImages(ctx context.Context, ownerID string) (int64, error)
+	DeleteImage(ctx context.Context, id string, release ReleaseFunc) error
+	AddTags(ctx context.Context, id string, tags []string) error
+	RemoveTags(ctx context.Context, id string, tags []string) error
+	SaveReservation(ctx context.Context, reservation UploadReservation) error
+	GetReservation(ctx context.Context, id string) (*UploadReservation, error)
+	DeleteReservation(ctx context.Context, id string) error
+	DeleteExpiredReservations(ctx context.Context, now time.Time) ([]UploadReservation, error)
+	SaveTusUpload(ctx context.Context, upload TusUpload) error
+	GetTusUpload(ctx context.Context, id string) (*TusUpload, error)
+	UpdateTusUpload(ctx context.Context, upload TusUpload, previousOffset int64) error
+	DeleteTusUpload(ctx context.Context, id string) error
+	DeleteExpiredTusUploads(ctx context.Context, now time.Time) ([]TusUpload, error)
+	SaveShareLink(ctx context.Context, link ShareLink) error
+	GetShareLink(ctx context.Context, id string) (*ShareLink, error)
+	ListShareLinks(ctx context.Context, imageID string) ([]ShareLink, error)
+	DeleteShareLink(ctx context.Context, imageID, id string) error
+	RecordShareDownload(ctx context.Context, id string, now time.Time) error
 }
 
-// imageRepository implements ImageRepository
+// ReleaseFunc is called by DeleteImage for each blob key the deleted image
+// held the last reference to, before the deletion is committed. An error
+// aborts the deletion, so the blob stays referenced.
+type ReleaseFunc func(key string) error
+
+// imageColumns lists the images columns in the order scanImage expects
+const imageColumns = "id, filename, original_name, title, description, alt_text, s3_key, s3_url, content_type, size, checksum, uploaded_at, " +
+	"width, height, orientation, camera_make, camera_model, taken_at, gps_latitude, gps_longitude, original_key, perceptual_hash, private, owner_id"
+
+// searchDocument is the text PostgreSQL indexes for full-text search; it must
+// match the expression of the idx_images_search index exactly
+const searchDocument = "original_name || ' ' || title || ' ' || description"
+
+// reservationColumns lists the upload_reservations columns in the order
+// scanReservation expects
+const reservationColumns = "id, s3_key, original_name, content_type, size, owner_id, created_at, expires_at"
+
+// tusUploadColumns lists the tus_uploads columns in the order scanTusUpload
+// expects
+const tusUploadColumns = "id, s3_key, multipart_id, upload_length, upload_offset, metadata, tail_key, owner_id, created_at, expires_at, completed_at"
+
+// shareLinkColumns lists the share_links columns in the order scanShareLink
+// expects
+const shareLinkColumns = "id, image_id, expires_at, max_downloads, download_count, password_hash, created_at"
+
+// variantColumns lists the image_variants columns in scan order
+const variantColumns = "image_id, name, s3_key, content_type, width, height, size"
+
+// rowScanner is implemented by *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// imageRepository implements ImageRepository on MySQL, PostgreSQL or SQLite.
+// Queries are written with "?" placeholders and rebound for the driver.
 type imageRepository struct {
-	db *sql.DB
+	db     *sql.DB
+	driver string
 }
 
-// NewImageRepository creates a new ImageRepository
-func NewImageRepository(db *sql.DB) ImageRepository {
+// NewImageRepository creates a new ImageRepository for a database opened with
+// one of the database.Driver* drivers and migrated to the current schema
+func NewImageRepository(db *sql.DB, driver string) ImageRepository {
 	common.RequireNonNil(db, "db")
+	if err := database.ValidateDriver(driver); err != nil {
+		panic(err.Error())
+	}
 
 	return &imageRepository{
-		db: db,
+		db:     db,
+		driver: driver,
 	}
 }
 
-// GetAllImages retrieves all images from the database
-func (repo *imageRepository) GetAllImages(ctx context.Context) ([]ImageMetadata, error) {
-	query := `
-		SELECT id, filename, original_name, s3_key, s3_url, content_type, size, uploaded_at
+// rebind adapts a query's placeholders to the repository's driver
+func (repo *imageRepository) rebind(query string) string {
+	return database.Rebind(repo.driver, query)
+}
+
+// GetAllImages retrieves one page of images using keyset pagination over (uploaded_at, id)
+func (repo *imageRepository) GetAllImages(ctx context.Context, query ImageQuery) (*ImagePage, error) {
+	// Filters narrow the result set and apply to the total as well
+	filters, filterArgs := repo.queryFilters(query)
+
+	conditions := append([]string(nil), filters...)
+	args := append([]interface{}(nil), filterArgs...)
+	order := "DESC"
+
+	switch {
+	case query.Before != "":
+		cursor, err := decodeCursor(query.Before)
+		if err != nil {
+			return nil, err
+		}
+		conditions = append(conditions, "(uploaded_at > ? OR (uploaded_at = ? AND id > ?))")
+		args = append(args, cursor.UploadedAt.UTC(), cursor.UploadedAt.UTC(), cursor.ID)
+		order = "ASC"
+	case query.After != "":
+		cursor, err := decodeCursor(query.After)
+		if err != nil {
+			return nil, err
+		}
+		conditions = append(conditions, "(uploaded_at < ? OR (uploaded_at = ? AND id < ?))")
+		args = append(args, cursor.UploadedAt.UTC(), cursor.UploadedAt.UTC(), cursor.ID)
+	}
+
+	where := ""
+	if len(conditions) > 0 {
+		where = "WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	sqlQuery := `
+		SELECT ` + imageColumns + `
 		FROM images
-		ORDER BY uploaded_at DESC
+		` + where + `
+		ORDER BY uploaded_at ` + order + `, id ` + order + `
+		LIMIT ?
 	`
 
-	rows, err := repo.db.QueryContext(ctx, query)
+	rows, err := repo.db.QueryContext(ctx, repo.rebind(sqlQuery), append(args, query.Limit+1)...)
 	if err != nil {
 		return nil, common.WrapDatabaseError("query images", err)
 	}
@@ -45,77 +148,200 @@ func (repo *imageRepository) GetAllImages(ctx context.Context) ([]ImageMetadata,
 
 	var images []ImageMetadata
 	for rows.Next() {
-		var img ImageMetadata
-		err := rows.Scan(
-			&img.ID,
-			&img.Filename,
-			&img.OriginalName,
-			&img.S3Key,
-			&img.S3URL,
-			&img.ContentType,
-			&img.Size,
-			&img.UploadedAt,
-		)
+		img, err := scanImage(rows)
 		if err != nil {
 			return nil, common.WrapDatabaseError("scan image row", err)
 		}
-		images = append(images, img)
+		images = append(images, *img)
 	}
 
 	if err := rows.Err(); err != nil {
 		return nil, common.WrapDatabaseError("iterate image rows", err)
 	}
 
-	return images, nil
+	if err := repo.attachVariants(ctx, images); err != nil {
+		return nil, err
+	}
+	if err := repo.attachTags(ctx, images); err != nil {
+		return nil, err
+	}
+
+	countQuery := "SELECT COUNT(*) FROM images"
+	if len(filters) > 0 {
+		countQuery += " WHERE " + strings.Join(filters, " AND ")
+	}
+
+	page := buildPage(images, query)
+	if err := repo.db.QueryRowContext(ctx, repo.rebind(countQuery), filterArgs...).Scan(&page.Total); err != nil {
+		return nil, common.WrapDatabaseError("count images", err)
+	}
+
+	return page, nil
+}
+
+// queryFilters builds the WHERE conditions for a query's search and filters
+func (repo *imageRepository) queryFilters(query ImageQuery) ([]string, []interface{}) {
+	var filters []string
+	var args []interface{}
+
+	if len(query.Tags) > 0 {
+		filters = append(filters, `id IN (
+			SELECT it.image_id FROM image_tags it JOIN tags t ON t.id = it.tag_id
+			WHERE t.name IN (`+placeholders(len(query.Tags))+`)
+			GROUP BY it.image_id
+			HAVING COUNT(*) = ?
+		)`)
+		for _, tag := range query.Tags {
+			args = append(args, tag)
+		}
+		args = append(args, len(query.Tags))
+	}
+
+	// Each word must prefix a word of the indexed text or a tag
+	for _, term := range strings.Fields(query.Search) {
+		match, matchArg := repo.fullTextMatch(term)
+		filters = append(filters, `(`+match+` OR id IN (
+			SELECT it.image_id FROM image_tags it JOIN tags t ON t.id = it.tag_id
+			WHERE t.name LIKE ?
+		))`)
+		args = append(args, matchArg, term+"%")
+	}
+
+	if len(query.ContentTypes) > 0 {
+		filters = append(filters, "content_type IN ("+placeholders(len(query.ContentTypes))+")")
+		for _, contentType := range query.ContentTypes {
+			args = append(args, contentType)
+		}
+	}
+	if query.MinSize > 0 {
+		filters = append(filters, "size >= ?")
+		args = append(args, query.MinSize)
+	}
+	if query.MaxSize > 0 {
+		filters = append(filters, "size <= ?")
+		args = append(args, query.MaxSize)
+	}
+	if !query.UploadedFrom.IsZero() {
+		filters = append(filters, "uploaded_at >= ?")
+		args = append(args, query.UploadedFrom.UTC())
+	}
+	if !query.UploadedTo.IsZero() {
+		filters = append(filters, "uploaded_at < ?")
+		args = append(args, query.UploadedTo.UTC())
+	}
+	if query.OwnerID != "" {
+		filters = append(filters, "owner_id = ?")
+		args = append(args, query.OwnerID)
+	}
+	filters = append(filters, "(private = ? OR (owner_id <> '' AND owner_id = ?))")
+	args = append(args, false, query.ViewerID)
+
+	return filters, args
+}
+
+// fullTextMatch returns a condition matching images whose original name,
+// title or description has a word starting with term, using the driver's
+// full-text index. term holds only letters and digits.
+func (repo *imageRepository) fullTextMatch(term string) (string, interface{}) {
+	switch repo.driver {
+	case database.DriverMySQL:
+		return "MATCH (original_name, title, description) AGAINST (? IN BOOLEAN MODE)", term + "*"
+	case database.DriverPostgres:
+		return "to_tsvector('simple', " + searchDocument + ") @@ to_tsquery('simple', ?)", term + ":*"
+	default:
+		return "id IN (SELECT id FROM images_fts WHERE images_fts MATCH ?)", `"` + term + `"*`
+	}
 }
 
-// SaveImage saves image metadata to the database
+// SaveImage saves image metadata and its variants to the database in one transaction
 func (repo *imageRepository) SaveImage(ctx context.Context, metadata ImageMetadata) error {
+	tx, err := repo.db.BeginTx(ctx, nil)
+	if err != nil {
+		return common.WrapDatabaseError("begin insert image", err)
+	}
+	defer tx.Rollback()
+
 	query := `
-		INSERT INTO images (id, filename, original_name, s3_key, s3_url, content_type, size, uploaded_at)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		INSERT INTO images (` + imageColumns + `)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`
 
-	_, err := repo.db.ExecContext(
+	_, err = tx.ExecContext(
 		ctx,
-		query,
+		repo.rebind(query),
 		metadata.ID,
 		metadata.Filename,
 		metadata.OriginalName,
+		metadata.Title,
+		metadata.Description,
+		metadata.AltText,
 		metadata.S3Key,
 		metadata.S3URL,
 		metadata.ContentType,
 		metadata.Size,
-		metadata.UploadedAt,
+		metadata.Checksum,
+		metadata.UploadedAt.UTC(),
+		metadata.Width,
+		metadata.Height,
+		metadata.Orientation,
+		metadata.CameraMake,
+		metadata.CameraModel,
+		nullTime(metadata.TakenAt),
+		nullFloat(metadata.Latitude),
+		nullFloat(metadata.Longitude),
+		metadata.OriginalKey,
+		metadata.PerceptualHash,
+		metadata.Private,
+		metadata.OwnerID,
 	)
-
 	if err != nil {
 		return common.WrapDatabaseError("insert image", err)
 	}
 
+	for _, variant := range metadata.Variants {
+		_, err := tx.ExecContext(ctx, repo.rebind(`
+			INSERT INTO image_variants (`+variantColumns+`)
+			VALUES (?, ?, ?, ?, ?, ?, ?)
+		`),
+			metadata.ID,
+			variant.Name,
+			variant.S3Key,
+			variant.ContentType,
+			variant.Width,
+			variant.Height,
+			variant.Size,
+		)
+		if err != nil {
+			return common.WrapDatabaseError(fmt.Sprintf("insert image variant %s", variant.Name), err)
+		}
+	}
+
+	for _, key := range blobKeys(metadata) {
+		if err := repo.retainBlob(ctx, tx, key); err != nil {
+			return err
+		}
+	}
+
+	if err := repo.insertTags(ctx, tx, metadata.ID, metadata.Tags); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return common.WrapDatabaseError("commit insert image", err)
+	}
+
 	return nil
 }
 
 // GetImageByID retrieves an image by ID from the database
 func (repo *imageRepository) GetImageByID(ctx context.Context, id string) (*ImageMetadata, error) {
 	query := `
-		SELECT id, filename, original_name, s3_key, s3_url, content_type, size, uploaded_at
+		SELECT ` + imageColumns + `
 		FROM images
 		WHERE id = ?
 	`
 
-	var img ImageMetadata
-	err := repo.db.QueryRowContext(ctx, query, id).Scan(
-		&img.ID,
-		&img.Filename,
-		&img.OriginalName,
-		&img.S3Key,
-		&img.S3URL,
-		&img.ContentType,
-		&img.Size,
-		&img.UploadedAt,
-	)
-
+	img, err := scanImage(repo.db.QueryRowContext(ctx, repo.rebind(query), id))
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, ErrImageNotFound
@@ -123,5 +349,1022 @@ func (repo *imageRepository) GetImageByID(ctx context.Context, id string) (*Imag
 		return nil, common.WrapDatabaseError(fmt.Sprintf("query image %s", id), err)
 	}
 
-	return &img, nil
+	images := []ImageMetadata{*img}
+	if err := repo.attachVariants(ctx, images); err != nil {
+		return nil, err
+	}
+	if err := repo.attachTags(ctx, images); err != nil {
+		return nil, err
+	}
+
+	return &images[0], nil
+}
+
+// GetImagesByIDs retrieves the images with the given IDs in the order the IDs
+// are listed; IDs with no image are skipped
+func (repo *imageRepository) GetImagesByIDs(ctx context.Context, ids []string) ([]ImageMetadata, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	args := make([]interface{}, len(ids))
+	for i, id := range ids {
+		args[i] = id
+	}
+
+	query := `
+		SELECT ` + imageColumns + `
+		FROM images
+		WHERE id IN (` + placeholders(len(ids)) + `)
+	`
+
+	rows, err := repo.db.QueryContext(ctx, repo.rebind(query), args...)
+	if err != nil {
+		return nil, common.WrapDatabaseError("query images by id", err)
+	}
+	defer rows.Close()
+
+	found := make(map[string]ImageMetadata, len(ids))
+	for rows.Next() {
+		img, err := scanImage(rows)
+		if err != nil {
+			return nil, common.WrapDatabaseError("scan image row", err)
+		}
+		found[img.ID] = *img
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, common.WrapDatabaseError("iterate image rows", err)
+	}
+
+	images := make([]ImageMetadata, 0, len(found))
+	for _, id := range ids {
+		if img, ok := found[id]; ok {
+			images = append(images, img)
+			delete(found, id)
+		}
+	}
+
+	if err := repo.attachVariants(ctx, images); err != nil {
+		return nil, err
+	}
+	if err := repo.attachTags(ctx, images); err != nil {
+		return nil, err
+	}
+
+	return images, nil
+}
+
+// FindImageByChecksum retrieves the earliest image with the given content
+// checksum, or ErrImageNotFound when there is none
+func (repo *imageRepository) FindImageByChecksum(ctx context.Context, checksum string) (*ImageMetadata, error) {
+	query := `
+		SELECT ` + imageColumns + `
+		FROM images
+		WHERE checksum = ?
+		ORDER BY uploaded_at, id
+		LIMIT 1
+	`
+
+	img, err := scanImage(repo.db.QueryRowContext(ctx, repo.rebind(query), checksum))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrImageNotFound
+		}
+		return nil, common.WrapDatabaseError(fmt.Sprintf("query image by checksum %s", checksum), err)
+	}
+
+	images := []ImageMetadata{*img}
+	if err := repo.attachVariants(ctx, images); err != nil {
+		return nil, err
+	}
+	if err := repo.attachTags(ctx, images); err != nil {
+		return nil, err
+	}
+
+	return &images[0], nil
+}
+
+// ListPerceptualHashes returns the perceptual hash of every image that has
+// one, keyed by image ID
+func (repo *imageRepository) ListPerceptualHashes(ctx context.Context) (map[string]string, error) {
+	rows, err := repo.db.QueryContext(ctx, "SELECT id, perceptual_hash FROM images WHERE perceptual_hash <> ''")
+	if err != nil {
+		return nil, common.WrapDatabaseError("query perceptual hashes", err)
+	}
+	defer rows.Close()
+
+	hashes := make(map[string]string)
+	for rows.Next() {
+		var id, hash string
+		if err := rows.Scan(&id, &hash); err != nil {
+			return nil, common.WrapDatabaseError("scan perceptual hash", err)
+		}
+		hashes[id] = hash
+	}
+	if err := rows.Err(); err != nil {
+		return nil, common.WrapDatabaseError("iterate perceptual hashes", err)
+	}
+
+	return hashes, nil
+}
+
+// UpdateImage saves an image's title, description, alt text and privacy
+func (repo *imageRepository) UpdateImage(ctx context.Context, metadata ImageMetadata) error {
+	query := `
+		UPDATE images
+		SET title = ?, description = ?, alt_text = ?, private = ?
+		WHERE id = ?
+	`
+
+	result, err := repo.db.ExecContext(
+		ctx,
+		repo.rebind(query),
+		metadata.Title,
+		metadata.Description,
+		metadata.AltText,
+		metadata.Private,
+		metadata.ID,
+	)
+	if err != nil {
+		return common.WrapDatabaseError(fmt.Sprintf("update image %s", metadata.ID), err)
+	}
+
+	// MySQL reports unchanged rows as unaffected, so confirm the image exists
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return common.WrapDatabaseError(fmt.Sprintf("update image %s", metadata.ID), err)
+	}
+	if affected == 0 {
+		if _, err := repo.GetImageByID(ctx, metadata.ID); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ClaimUnownedImages gives every image without an owner to the user with
+// ownerID and returns how many it changed
+func (repo *imageRepository) ClaimUnownedImages(ctx context.Context, ownerID string) (int64, error) {
+	result, err := repo.db.ExecContext(ctx, repo.rebind("UPDATE images SET owner_id = ? WHERE owner_id = ''"), ownerID)
+	if err != nil {
+		return 0, common.WrapDatabaseError("claim unowned images", err)
+	}
+
+	claimed, err := result.RowsAffected()
+	if err != nil {
+		return 0, common.WrapDatabaseError("claim unowned images", err)
+	}
+	return claimed, nil
+}
+
+// DeleteImage removes an image with its variants and tags and drops its
+// references to blobs, calling release for each blob left unreferenced
+func (repo *imageRepository) DeleteImage(ctx context.Context, id string, release ReleaseFunc) error {
+	tx, err := repo.db.BeginTx(ctx, nil)
+	if err != nil {
+		return common.WrapDatabaseError(fmt.Sprintf("begin delete image %s", id), err)
+	}
+	defer tx.Rollback()
+
+	var img ImageMetadata
+	err = tx.QueryRowContext(ctx, repo.rebind("SELECT s3_key, original_key FROM images WHERE id = ?"), id).Scan(&img.S3Key, &img.OriginalKey)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return ErrImageNotFound
+		}
+		return common.WrapDatabaseError(fmt.Sprintf("query image %s", id), err)
+	}
+
+	if _, err := tx.ExecContext(ctx, repo.rebind("DELETE FROM image_variants WHERE image_id = ?"), id); err != nil {
+		return common.WrapDatabaseError(fmt.Sprintf("delete variants of image %s", id), err)
+	}
+
+	if _, err := tx.ExecContext(ctx, repo.rebind("DELETE FROM image_tags WHERE image_id = ?"), id); err != nil {
+		return common.WrapDatabaseError(fmt.Sprintf("delete tags of image %s", id), err)
+	}
+
+	if _, err := tx.ExecContext(ctx, repo.rebind("DELETE FROM share_links WHERE image_id = ?"), id); err != nil {
+		return common.WrapDatabaseError(fmt.Sprintf("delete share links of image %s", id), err)
+	}
+
+	result, err := tx.ExecContext(ctx, repo.rebind("DELETE FROM images WHERE id = ?"), id)
+	if err != nil {
+		return common.WrapDatabaseError(fmt.Sprintf("delete image %s", id), err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return common.WrapDatabaseError(fmt.Sprintf("delete image %s", id), err)
+	}
+	if affected == 0 {
+		return ErrImageNotFound
+	}
+
+	for _, key := range blobKeys(img) {
+		if err := repo.releaseBlob(ctx, tx, key, release); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return common.WrapDatabaseError(fmt.Sprintf("commit delete image %s", id), err)
+	}
+
+	return nil
+}
+
+// retainBlob adds a reference to a blob, creating its row on first use
+func (repo *imageRepository) retainBlob(ctx context.Context, tx *sql.Tx, key string) error {
+	query := "INSERT INTO blobs (s3_key, ref_count) VALUES (?, 1) ON CONFLICT (s3_key) DO UPDATE SET ref_count = blobs.ref_count + 1"
+	if repo.driver == database.DriverMySQL {
+		query = "INSERT INTO blobs (s3_key, ref_count) VALUES (?, 1) ON DUPLICATE KEY UPDATE ref_count = ref_count + 1"
+	}
+
+	if _, err := tx.ExecContext(ctx, repo.rebind(query), key); err != nil {
+		return common.WrapDatabaseError(fmt.Sprintf("retain blob %s", key), err)
+	}
+	return nil
+}
+
+// releaseBlob drops a reference to a blob. The update locks the blob row, so
+// a concurrent upload of the same content waits until release has run and
+// the row is gone, and then starts a fresh count. Blobs stored before
+// reference counting have no row and are released by their only image.
+func (repo *imageRepository) releaseBlob(ctx context.Context, tx *sql.Tx, key string, release ReleaseFunc) error {
+	if _, err := tx.ExecContext(ctx, repo.rebind("UPDATE blobs SET ref_count = ref_count - 1 WHERE s3_key = ?"), key); err != nil {
+		return common.WrapDatabaseError(fmt.Sprintf("release blob %s", key), err)
+	}
+
+	var refs int
+	err := tx.QueryRowContext(ctx, repo.rebind("SELECT ref_count FROM blobs WHERE s3_key = ?"), key).Scan(&refs)
+	if err != nil && err != sql.ErrNoRows {
+		return common.WrapDatabaseError(fmt.Sprintf("query blob %s", key), err)
+	}
+	if refs > 0 {
+		return nil
+	}
+
+	if release != nil {
+		if err := release(key); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.ExecContext(ctx, repo.rebind("DELETE FROM blobs WHERE s3_key = ?"), key); err != nil {
+		return common.WrapDatabaseError(fmt.Sprintf("delete blob %s", key), err)
+	}
+	return nil
+}
+
+// AddTags attaches tags to an image; tags it already has are ignored
+func (repo *imageRepository) AddTags(ctx context.Context, id string, tags []string) error {
+	tx, err := repo.db.BeginTx(ctx, nil)
+	if err != nil {
+		return common.WrapDatabaseError(fmt.Sprintf("begin tag image %s", id), err)
+	}
+	defer tx.Rollback()
+
+	if err := repo.requireImage(ctx, tx, id); err != nil {
+		return err
+	}
+	if err := repo.insertTags(ctx, tx, id, tags); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return common.WrapDatabaseError(fmt.Sprintf("commit tag image %s", id), err)
+	}
+
+	return nil
+}
+
+// RemoveTags detaches tags from an image; tags it does not have are ignored.
+// Rows in the tags table are kept for reuse.
+func (repo *imageRepository) RemoveTags(ctx context.Context, id string, tags []string) error {
+	tx, err := repo.db.BeginTx(ctx, nil)
+	if err != nil {
+		return common.WrapDatabaseError(fmt.Sprintf("begin untag image %s", id), err)
+	}
+	defer tx.Rollback()
+
+	if err := repo.requireImage(ctx, tx, id); err != nil {
+		return err
+	}
+
+	if len(tags) > 0 {
+		args := []interface{}{id}
+		for _, tag := range tags {
+			args = append(args, tag)
+		}
+
+		query := `
+			DELETE FROM image_tags
+			WHERE image_id = ? AND tag_id IN (SELECT id FROM tags WHERE name IN (` + placeholders(len(tags)) + `))
+		`
+		if _, err := tx.ExecContext(ctx, repo.rebind(query), args...); err != nil {
+			return common.WrapDatabaseError(fmt.Sprintf("untag image %s", id), err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return common.WrapDatabaseError(fmt.Sprintf("commit untag image %s", id), err)
+	}
+
+	return nil
+}
+
+// SaveReservation records a direct upload reservation
+func (repo *imageRepository) SaveReservation(ctx context.Context, reservation UploadReservation) error {
+	query := `
+		INSERT INTO upload_reservations (` + reservationColumns + `)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`
+
+	_, err := repo.db.ExecContext(
+		ctx,
+		repo.rebind(query),
+		reservation.ID,
+		reservation.S3Key,
+		reservation.Filename,
+		reservation.ContentType,
+		reservation.Size,
+		reservation.OwnerID,
+		reservation.CreatedAt.UTC(),
+		reservation.ExpiresAt.UTC(),
+	)
+	if err != nil {
+		return common.WrapDatabaseError("insert upload reservation", err)
+	}
+
+	return nil
+}
+
+// GetReservation retrieves a direct upload reservation by image ID
+func (repo *imageRepository) GetReservation(ctx context.Context, id string) (*UploadReservation, error) {
+	query := "SELECT " + reservationColumns + " FROM upload_reservations WHERE id = ?"
+
+	reservation, err := scanReservation(repo.db.QueryRowContext(ctx, repo.rebind(query), id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrUploadNotFound
+		}
+		return nil, common.WrapDatabaseError(fmt.Sprintf("query upload reservation %s", id), err)
+	}
+
+	return reservation, nil
+}
+
+// DeleteReservation removes a direct upload reservation
+func (repo *imageRepository) DeleteReservation(ctx context.Context, id string) error {
+	result, err := repo.db.ExecContext(ctx, repo.rebind("DELETE FROM upload_reservations WHERE id = ?"), id)
+	if err != nil {
+		return common.WrapDatabaseError(fmt.Sprintf("delete upload reservation %s", id), err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return common.WrapDatabaseError(fmt.Sprintf("delete upload reservation %s", id), err)
+	}
+	if affected == 0 {
+		return ErrUploadNotFound
+	}
+
+	return nil
+}
+
+// DeleteExpiredReservations removes the reservations that expired at or
+// before now and returns them, so their objects can be cleaned up
+func (repo *imageRepository) DeleteExpiredReservations(ctx context.Context, now time.Time) ([]UploadReservation, error) {
+	tx, err := repo.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, common.WrapDatabaseError("begin delete expired reservations", err)
+	}
+	defer tx.Rollback()
+
+	query := "SELECT " + reservationColumns + " FROM upload_reservations WHERE expires_at <= ?"
+	rows, err := tx.QueryContext(ctx, repo.rebind(query), now.UTC())
+	if err != nil {
+		return nil, common.WrapDatabaseError("query expired reservations", err)
+	}
+	defer rows.Close()
+
+	var expired []UploadReservation
+	for rows.Next() {
+		reservation, err := scanReservation(rows)
+		if err != nil {
+			return nil, common.WrapDatabaseError("scan expired reservation", err)
+		}
+		expired = append(expired, *reservation)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, common.WrapDatabaseError("iterate expired reservations", err)
+	}
+	rows.Close()
+
+	if _, err := tx.ExecContext(ctx, repo.rebind("DELETE FROM upload_reservations WHERE expires_at <= ?"), now.UTC()); err != nil {
+		return nil, common.WrapDatabaseError("delete expired reservations", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, common.WrapDatabaseError("commit delete expired reservations", err)
+	}
+
+	return expired, nil
+}
+
+// SaveTusUpload records a new resumable upload
+func (repo *imageRepository) SaveTusUpload(ctx context.Context, upload TusUpload) error {
+	query := `
+		INSERT INTO tus_uploads (` + tusUploadColumns + `)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`
+
+	_, err := repo.db.ExecContext(
+		ctx,
+		repo.rebind(query),
+		upload.ID,
+		upload.S3Key,
+		upload.MultipartID,
+		upload.Length,
+		upload.Offset,
+		upload.Metadata,
+		upload.TailKey,
+		upload.OwnerID,
+		upload.CreatedAt.UTC(),
+		upload.ExpiresAt.UTC(),
+		nullTime(upload.CompletedAt),
+	)
+	if err != nil {
+		return common.WrapDatabaseError("insert tus upload", err)
+	}
+
+	return nil
+}
+
+// GetTusUpload retrieves a resumable upload with its parts in order
+func (repo *imageRepository) GetTusUpload(ctx context.Context, id string) (*TusUpload, error) {
+	query := "SELECT " + tusUploadColumns + " FROM tus_uploads WHERE id = ?"
+
+	upload, err := scanTusUpload(repo.db.QueryRowContext(ctx, repo.rebind(query), id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrUploadNotFound
+		}
+		return nil, common.WrapDatabaseError(fmt.Sprintf("query tus upload %s", id), err)
+	}
+
+	query = "SELECT part_number, etag, size FROM tus_upload_parts WHERE upload_id = ? ORDER BY part_number"
+	rows, err := repo.db.QueryContext(ctx, repo.rebind(query), id)
+	if err != nil {
+		return nil, common.WrapDatabaseError(fmt.Sprintf("query parts of tus upload %s", id), err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var part storage.CompletedPart
+		if err := rows.Scan(&part.PartNumber, &part.ETag, &part.Size); err != nil {
+			return nil, common.WrapDatabaseError(fmt.Sprintf("scan part of tus upload %s", id), err)
+		}
+		upload.Parts = append(upload.Parts, part)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, common.WrapDatabaseError(fmt.Sprintf("iterate parts of tus upload %s", id), err)
+	}
+
+	return upload, nil
+}
+
+// UpdateTusUpload saves the progress of a resumable upload, adding the parts
+// not stored yet. It returns ErrUploadConflict unless the stored upload is
+// still at previousOffset, so concurrent chunks cannot both be applied.
+func (repo *imageRepository) UpdateTusUpload(ctx context.Context, upload TusUpload, previousOffset int64) error {
+	tx, err := repo.db.BeginTx(ctx, nil)
+	if err != nil {
+		return common.WrapDatabaseError(fmt.Sprintf("begin update tus upload %s", upload.ID), err)
+	}
+	defer tx.Rollback()
+
+	query := `
+		UPDATE tus_uploads
+		SET multipart_id = ?, upload_offset = ?, tail_key = ?, expires_at = ?, completed_at = ?
+		WHERE id = ? AND upload_offset = ?
+	`
+	result, err := tx.ExecContext(
+		ctx,
+		repo.rebind(query),
+		upload.MultipartID,
+		upload.Offset,
+		upload.TailKey,
+		upload.ExpiresAt.UTC(),
+		nullTime(upload.CompletedAt),
+		upload.ID,
+		previousOffset,
+	)
+	if err != nil {
+		return common.WrapDatabaseError(fmt.Sprintf("update tus upload %s", upload.ID), err)
+	}
+
+	// MySQL reports unchanged rows as unaffected, so check why nothing matched
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return common.WrapDatabaseError(fmt.Sprintf("update tus upload %s", upload.ID), err)
+	}
+	if affected == 0 {
+		var offset int64
+		err := tx.QueryRowContext(ctx, repo.rebind("SELECT upload_offset FROM tus_uploads WHERE id = ?"), upload.ID).Scan(&offset)
+		if err == sql.ErrNoRows {
+			return ErrUploadNotFound
+		}
+		if err != nil {
+			return common.WrapDatabaseError(fmt.Sprintf("query tus upload %s", upload.ID), err)
+		}
+		if offset != previousOffset {
+			return ErrUploadConflict
+		}
+	}
+
+	var stored int
+	err = tx.QueryRowContext(ctx, repo.rebind("SELECT COUNT(*) FROM tus_upload_parts WHERE upload_id = ?"), upload.ID).Scan(&stored)
+	if err != nil {
+		return common.WrapDatabaseError(fmt.Sprintf("count parts of tus upload %s", upload.ID), err)
+	}
+
+	insertPart := repo.rebind("INSERT INTO tus_upload_parts (upload_id, part_number, etag, size) VALUES (?, ?, ?, ?)")
+	for _, part := range upload.Parts[min(stored, len(upload.Parts)):] {
+		if _, err := tx.ExecContext(ctx, insertPart, upload.ID, part.PartNumber, part.ETag, part.Size); err != nil {
+			return common.WrapDatabaseError(fmt.Sprintf("insert part %d of tus upload %s", part.PartNumber, upload.ID), err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return common.WrapDatabaseError(fmt.Sprintf("commit update tus upload %s", upload.ID), err)
+	}
+
+	return nil
+}
+
+// DeleteTusUpload removes a resumable upload and its parts
+func (repo *imageRepository) DeleteTusUpload(ctx context.Context, id string) error {
+	tx, err := repo.db.BeginTx(ctx, nil)
+	if err != nil {
+		return common.WrapDatabaseError(fmt.Sprintf("begin delete tus upload %s", id), err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, repo.rebind("DELETE FROM tus_upload_parts WHERE upload_id = ?"), id); err != nil {
+		return common.WrapDatabaseError(fmt.Sprintf("delete parts of tus upload %s", id), err)
+	}
+
+	result, err := tx.ExecContext(ctx, repo.rebind("DELETE FROM tus_uploads WHERE id = ?"), id)
+	if err != nil {
+		return common.WrapDatabaseError(fmt.Sprintf("delete tus upload %s", id), err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return common.WrapDatabaseError(fmt.Sprintf("delete tus upload %s", id), err)
+	}
+	if affected == 0 {
+		return ErrUploadNotFound
+	}
+
+	if err := tx.Commit(); err != nil {
+		return common.WrapDatabaseError(fmt.Sprintf("commit delete tus upload %s", id), err)
+	}
+
+	return nil
+}
+
+// DeleteExpiredTusUploads removes the resumable uploads that expired at or
+// before now and returns them without their parts, so their objects can be
+// cleaned up
+func (repo *imageRepository) DeleteExpiredTusUploads(ctx context.Context, now time.Time) ([]TusUpload, error) {
+	tx, err := repo.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, common.WrapDatabaseError("begin delete expired tus uploads", err)
+	}
+	defer tx.Rollback()
+
+	query := "SELECT " + tusUploadColumns + " FROM tus_uploads WHERE expires_at <= ?"
+	rows, err := tx.QueryContext(ctx, repo.rebind(query), now.UTC())
+	if err != nil {
+		return nil, common.WrapDatabaseError("query expired tus uploads", err)
+	}
+	defer rows.Close()
+
+	var expired []TusUpload
+	for rows.Next() {
+		upload, err := scanTusUpload(rows)
+		if err != nil {
+			return nil, common.WrapDatabaseError("scan expired tus upload", err)
+		}
+		expired = append(expired, *upload)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, common.WrapDatabaseError("iterate expired tus uploads", err)
+	}
+	rows.Close()
+
+	for _, upload := range expired {
+		if _, err := tx.ExecContext(ctx, repo.rebind("DELETE FROM tus_upload_parts WHERE upload_id = ?"), upload.ID); err != nil {
+			return nil, common.WrapDatabaseError(fmt.Sprintf("delete parts of tus upload %s", upload.ID), err)
+		}
+		if _, err := tx.ExecContext(ctx, repo.rebind("DELETE FROM tus_uploads WHERE id = ?"), upload.ID); err != nil {
+			return nil, common.WrapDatabaseError(fmt.Sprintf("delete tus upload %s", upload.ID), err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, common.WrapDatabaseError("commit delete expired tus uploads", err)
+	}
+
+	return expired, nil
+}
+
+// SaveShareLink records a new share link
+func (repo *imageRepository) SaveShareLink(ctx context.Context, link ShareLink) error {
+	query := `
+		INSERT INTO share_links (` + shareLinkColumns + `)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`
+
+	_, err := repo.db.ExecContext(
+		ctx,
+		repo.rebind(query),
+		link.ID,
+		link.ImageID,
+		link.ExpiresAt.UTC(),
+		link.MaxDownloads,
+		link.Downloads,
+		link.PasswordHash,
+		link.CreatedAt.UTC(),
+	)
+	if err != nil {
+		return common.WrapDatabaseError("insert share link", err)
+	}
+
+	return nil
+}
+
+// GetShareLink retrieves a share link by ID
+func (repo *imageRepository) GetShareLink(ctx context.Context, id string) (*ShareLink, error) {
+	query := "SELECT " + shareLinkColumns + " FROM share_links WHERE id = ?"
+
+	link, err := scanShareLink(repo.db.QueryRowContext(ctx, repo.rebind(query), id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrShareLinkNotFound
+		}
+		return nil, common.WrapDatabaseError(fmt.Sprintf("query share link %s", id), err)
+	}
+
+	return link, nil
+}
+
+// ListShareLinks returns an image's share links, oldest first
+func (repo *imageRepository) ListShareLinks(ctx context.Context, imageID string) ([]ShareLink, error) {
+	query := "SELECT " + shareLinkColumns + " FROM share_links WHERE image_id = ? ORDER BY created_at, id"
+
+	rows, err := repo.db.QueryContext(ctx, repo.rebind(query), imageID)
+	if err != nil {
+		return nil, common.WrapDatabaseError(fmt.Sprintf("query share links of image %s", imageID), err)
+	}
+	defer rows.Close()
+
+	var links []ShareLink
+	for rows.Next() {
+		link, err := scanShareLink(rows)
+		if err != nil {
+			return nil, common.WrapDatabaseError("scan share link", err)
+		}
+		links = append(links, *link)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, common.WrapDatabaseError("iterate share links", err)
+	}
+
+	return links, nil
+}
+
+// DeleteShareLink revokes one of an image's share links
+func (repo *imageRepository) DeleteShareLink(ctx context.Context, imageID, id string) error {
+	result, err := repo.db.ExecContext(ctx, repo.rebind("DELETE FROM share_links WHERE id = ? AND image_id = ?"), id, imageID)
+	if err != nil {
+		return common.WrapDatabaseError(fmt.Sprintf("delete share link %s", id), err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return common.WrapDatabaseError(fmt.Sprintf("delete share link %s", id), err)
+	}
+	if affected == 0 {
+		return ErrShareLinkNotFound
+	}
+
+	return nil
+}
+
+// RecordShareDownload counts a download through a share link, atomically
+// checking that the link is still valid at now and has downloads left
+func (repo *imageRepository) RecordShareDownload(ctx context.Context, id string, now time.Time) error {
+	query := `
+		UPDATE share_links
+		SET download_count = download_count + 1
+		WHERE id = ? AND expires_at > ? AND (max_downloads = 0 OR download_count < max_downloads)
+	`
+	result, err := repo.db.ExecContext(ctx, repo.rebind(query), id, now.UTC())
+	if err != nil {
+		return common.WrapDatabaseError(fmt.Sprintf("count download of share link %s", id), err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return common.WrapDatabaseError(fmt.Sprintf("count download of share link %s", id), err)
+	}
+	if affected == 0 {
+		link, err := repo.GetShareLink(ctx, id)
+		if err != nil {
+			return err
+		}
+		if !link.ExpiresAt.After(now) {
+			return ErrShareLinkExpired
+		}
+		return ErrShareLinkExhausted
+	}
+
+	return nil
+}
+
+// requireImage returns ErrImageNotFound unless the image exists
+func (repo *imageRepository) requireImage(ctx context.Context, tx *sql.Tx, id string) error {
+	var exists int
+	err := tx.QueryRowContext(ctx, repo.rebind("SELECT 1 FROM images WHERE id = ?"), id).Scan(&exists)
+	if err == sql.ErrNoRows {
+		return ErrImageNotFound
+	}
+	if err != nil {
+		return common.WrapDatabaseError(fmt.Sprintf("query image %s", id), err)
+	}
+	return nil
+}
+
+// insertTags creates any missing tags and links them to an image
+func (repo *imageRepository) insertTags(ctx context.Context, tx *sql.Tx, id string, tags []string) error {
+	insertTag := repo.rebind(database.InsertIgnore(repo.driver, "INSERT INTO tags (name) VALUES (?)"))
+	linkTag := repo.rebind(database.InsertIgnore(repo.driver, `
+		INSERT INTO image_tags (image_id, tag_id)
+		SELECT ?, id FROM tags WHERE name = ?
+	`))
+
+	for _, tag := range tags {
+		if _, err := tx.ExecContext(ctx, insertTag, tag); err != nil {
+			return common.WrapDatabaseError(fmt.Sprintf("insert tag %s", tag), err)
+		}
+		if _, err := tx.ExecContext(ctx, linkTag, id, tag); err != nil {
+			return common.WrapDatabaseError(fmt.Sprintf("tag image %s with %s", id, tag), err)
+		}
+	}
+
+	return nil
+}
+
+// attachTags loads the tag names of each image in a single query
+func (repo *imageRepository) attachTags(ctx context.Context, images []ImageMetadata) error {
+	if len(images) == 0 {
+		return nil
+	}
+
+	index := make(map[string]int, len(images))
+	args := make([]interface{}, len(images))
+	for i, img := range images {
+		index[img.ID] = i
+		args[i] = img.ID
+	}
+
+	query := `
+		SELECT it.image_id, t.name
+		FROM image_tags it JOIN tags t ON t.id = it.tag_id
+		WHERE it.image_id IN (` + placeholders(len(images)) + `)
+		ORDER BY t.name
+	`
+
+	rows, err := repo.db.QueryContext(ctx, repo.rebind(query), args...)
+	if err != nil {
+		return common.WrapDatabaseError("query image tags", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var imageID, name string
+		if err := rows.Scan(&imageID, &name); err != nil {
+			return common.WrapDatabaseError("scan image tag row", err)
+		}
+
+		i := index[imageID]
+		images[i].Tags = append(images[i].Tags, name)
+	}
+
+	if err := rows.Err(); err != nil {
+		return common.WrapDatabaseError("iterate image tag rows", err)
+	}
+
+	return nil
+}
+
+// attachVariants loads the variants of each image in a single query
+func (repo *imageRepository) attachVariants(ctx context.Context, images []ImageMetadata) error {
+	if len(images) == 0 {
+		return nil
+	}
+
+	index := make(map[string]int, len(images))
+	args := make([]interface{}, len(images))
+	for i, img := range images {
+		index[img.ID] = i
+		args[i] = img.ID
+	}
+
+	query := `
+		SELECT ` + variantColumns + `
+		FROM image_variants
+		WHERE image_id IN (` + placeholders(len(images)) + `)
+		ORDER BY width
+	`
+
+	rows, err := repo.db.QueryContext(ctx, repo.rebind(query), args...)
+	if err != nil {
+		return common.WrapDatabaseError("query image variants", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var variant ImageVariant
+		err := rows.Scan(
+			&variant.ImageID,
+			&variant.Name,
+			&variant.S3Key,
+			&variant.ContentType,
+			&variant.Width,
+			&variant.Height,
+			&variant.Size,
+		)
+		if err != nil {
+			return common.WrapDatabaseError("scan image variant row", err)
+		}
+
+		i := index[variant.ImageID]
+		images[i].Variants = append(images[i].Variants, variant)
+	}
+
+	if err := rows.Err(); err != nil {
+		return common.WrapDatabaseError("iterate image variant rows", err)
+	}
+
+	return nil
+}
+
+// placeholders returns n comma-separated query placeholders
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
+
+// scanImage scans a row selected with imageColumns into ImageMetadata
+func scanImage(row rowScanner) (*ImageMetadata, error) {
+	var img ImageMetadata
+	var takenAt sql.NullTime
+	var latitude, longitude sql.NullFloat64
+	err := row.Scan(
+		&img.ID,
+		&img.Filename,
+		&img.OriginalName,
+		&img.Title,
+		&img.Description,
+		&img.AltText,
+		&img.S3Key,
+		&img.S3URL,
+		&img.ContentType,
+		&img.Size,
+		&img.Checksum,
+		&img.UploadedAt,
+		&img.Width,
+		&img.Height,
+		&img.Orientation,
+		&img.CameraMake,
+		&img.CameraModel,
+		&takenAt,
+		&latitude,
+		&longitude,
+		&img.OriginalKey,
+		&img.PerceptualHash,
+		&img.Private,
+		&img.OwnerID,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if takenAt.Valid {
+		taken := takenAt.Time.UTC()
+		img.TakenAt = &taken
+	}
+	if latitude.Valid && longitude.Valid {
+		img.Latitude = &latitude.Float64
+		img.Longitude = &longitude.Float64
+	}
+
+	return &img, nil
+}
+
+// scanReservation scans a row selected with reservationColumns
+func scanReservation(row rowScanner) (*UploadReservation, error) {
+	var reservation UploadReservation
+	err := row.Scan(
+		&reservation.ID,
+		&reservation.S3Key,
+		&reservation.Filename,
+		&reservation.ContentType,
+		&reservation.Size,
+		&reservation.OwnerID,
+		&reservation.CreatedAt,
+		&reservation.ExpiresAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &reservation, nil
+}
+
+// scanTusUpload reads a tus_uploads row selected with tusUploadColumns
+func scanTusUpload(row rowScanner) (*TusUpload, error) {
+	var upload TusUpload
+	var completedAt sql.NullTime
+	err := row.Scan(
+		&upload.ID,
+		&upload.S3Key,
+		&upload.MultipartID,
+		&upload.Length,
+		&upload.Offset,
+		&upload.Metadata,
+		&upload.TailKey,
+		&upload.OwnerID,
+		&upload.CreatedAt,
+		&upload.ExpiresAt,
+		&completedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if completedAt.Valid {
+		completed := completedAt.Time
+		upload.CompletedAt = &completed
+	}
+
+	return &upload, nil
+}
+
+// scanShareLink scans a row selected with shareLinkColumns
+func scanShareLink(row rowScanner) (*ShareLink, error) {
+	var link ShareLink
+	err := row.Scan(
+		&link.ID,
+		&link.ImageID,
+		&link.ExpiresAt,
+		&link.MaxDownloads,
+		&link.Downloads,
+		&link.PasswordHash,
+		&link.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	link.Protected = link.PasswordHash != ""
+
+	return &link, nil
+}
+
+// nullTime converts an optional time to a nullable UTC column value
+func nullTime(t *time.Time) sql.NullTime {
+	if t == nil {
+		return sql.NullTime{}
+	}
+	return sql.NullTime{Time: t.UTC(), Valid: true}
+}
+
+// nullFloat converts an optional number to a nullable column value
+func nullFloat(f *float64) sql.NullFloat64 {
+	if f == nil {
+		return sql.NullFloat64{}
+	}
+	return sql.NullFloat64{Float64: *f, Valid: true}
+}
+
+// blobKeys lists the blob store keys an image holds references to
+func blobKeys(img ImageMetadata) []string {
+	keys := []string{img.S3Key}
+	if img.OriginalKey != "" {
+		keys = append(keys, img.OriginalKey)
+	}
+	return keys
 }
@@ -0,0 +1,850 @@
+package image
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"file-pub/internal/database/dbtest"
+	"file-pub/storage"
+)
+
+// testRepositoryConformance runs the behaviour every ImageRepository
+// implementation must share. newRepo must return an empty repository.
+func testRepositoryConformance(t *testing.T, newRepo func(t *testing.T) ImageRepository) {
+	t.Run("SaveAndGet", func(t *testing.T) {
+		repo := newRepo(t)
+		ctx := context.Background()
+
+		want := testImage("a", dbtest.Time(0))
+		want.Variants = []ImageVariant{
+			{Name: "1024", S3Key: "variants/a/1024.jpg", ContentType: "image/jpeg", Width: 1024, Height: 768, Size: 2048},
+			{Name: "256", S3Key: "variants/a/256.jpg", ContentType: "image/jpeg", Width: 256, Height: 192, Size: 512},
+		}
+		if err := repo.SaveImage(ctx, want); err != nil {
+			t.Fatalf("SaveImage: %v", err)
+		}
+
+		got, err := repo.GetImageByID(ctx, "a")
+		if err != nil {
+			t.Fatalf("GetImageByID: %v", err)
+		}
+		assertImage(t, *got, want)
+
+		if len(got.Variants) != 2 || got.Variants[0].Name != "256" || got.Variants[1].Name != "1024" {
+			t.Fatalf("variants = %+v, want 256 then 1024", got.Variants)
+		}
+		variant := got.Variants[1]
+		if variant.ImageID != "a" || variant.S3Key != "variants/a/1024.jpg" || variant.ContentType != "image/jpeg" ||
+			variant.Width != 1024 || variant.Height != 768 || variant.Size != 2048 {
+			t.Errorf("variant = %+v", variant)
+		}
+	})
+
+	t.Run("ExifMetadata", func(t *testing.T) {
+		repo := newRepo(t)
+		ctx := context.Background()
+
+		takenAt := time.Date(2023, 7, 14, 9, 30, 15, 0, time.UTC)
+		latitude, longitude := 52.520008, -13.404954
+		want := testImage("a", dbtest.Time(0))
+		want.Orientation = 6
+		want.CameraMake = "Canon"
+		want.CameraModel = "EOS R5"
+		want.TakenAt = &takenAt
+		want.Latitude = &latitude
+		want.Longitude = &longitude
+		if err := repo.SaveImage(ctx, want); err != nil {
+			t.Fatalf("SaveImage: %v", err)
+		}
+		if err := repo.SaveImage(ctx, testImage("b", dbtest.Time(1))); err != nil {
+			t.Fatalf("SaveImage: %v", err)
+		}
+
+		got, err := repo.GetImageByID(ctx, "a")
+		if err != nil {
+			t.Fatalf("GetImageByID: %v", err)
+		}
+		assertImage(t, *got, want)
+
+		page, err := repo.GetAllImages(ctx, ImageQuery{Limit: 10})
+		if err != nil {
+			t.Fatalf("GetAllImages: %v", err)
+		}
+		if len(page.Images) != 2 {
+			t.Fatalf("got %d images, want 2", len(page.Images))
+		}
+		assertImage(t, page.Images[0], testImage("b", dbtest.Time(1)))
+		assertImage(t, page.Images[1], want)
+	})
+
+	t.Run("BlobReferences", func(t *testing.T) {
+		repo := newRepo(t)
+		ctx := context.Background()
+
+		// a and b share content; b and c share an unmodified original
+		a, b, c := testImage("a", dbtest.Time(0)), testImage("b", dbtest.Time(1)), testImage("c", dbtest.Time(2))
+		a.S3Key, b.S3Key = "uploads/same.jpg", "uploads/same.jpg"
+		b.OriginalKey, c.OriginalKey = "originals/raw.jpg", "originals/raw.jpg"
+		for _, img := range []ImageMetadata{a, b, c} {
+			if err := repo.SaveImage(ctx, img); err != nil {
+				t.Fatalf("SaveImage %s: %v", img.ID, err)
+			}
+		}
+
+		var released []string
+		release := func(key string) error {
+			released = append(released, key)
+			return nil
+		}
+		steps := []struct {
+			id   string
+			want []string
+		}{
+			{"a", nil},
+			{"c", []string{"uploads/c.jpg"}},
+			{"b", []string{"uploads/same.jpg", "originals/raw.jpg"}},
+		}
+		for _, step := range steps {
+			released = nil
+			if err := repo.DeleteImage(ctx, step.id, release); err != nil {
+				t.Fatalf("DeleteImage %s: %v", step.id, err)
+			}
+			if fmt.Sprint(released) != fmt.Sprint(step.want) {
+				t.Errorf("deleting %s released %v, want %v", step.id, released, step.want)
+			}
+		}
+
+		// A failed release keeps the image and its reference
+		if err := repo.SaveImage(ctx, a); err != nil {
+			t.Fatalf("SaveImage: %v", err)
+		}
+		failure := errors.New("store unavailable")
+		if err := repo.DeleteImage(ctx, "a", func(string) error { return failure }); !errors.Is(err, failure) {
+			t.Fatalf("DeleteImage with failing release: err = %v, want %v", err, failure)
+		}
+		if _, err := repo.GetImageByID(ctx, "a"); err != nil {
+			t.Fatalf("GetImageByID after failed delete: %v", err)
+		}
+		released = nil
+		if err := repo.DeleteImage(ctx, "a", release); err != nil {
+			t.Fatalf("DeleteImage: %v", err)
+		}
+		if fmt.Sprint(released) != "[uploads/same.jpg]" {
+			t.Errorf("released %v, want [uploads/same.jpg]", released)
+		}
+	})
+
+	t.Run("FindImageByChecksum", func(t *testing.T) {
+		repo := newRepo(t)
+		ctx := context.Background()
+
+		first, second := testImage("b", dbtest.Time(0)), testImage("a", dbtest.Time(1))
+		first.Checksum, second.Checksum = strings.Repeat("ab", 32), strings.Repeat("ab", 32)
+		first.Variants = []ImageVariant{{Name: "256", S3Key: "variants/ab/256.jpg", ContentType: "image/jpeg", Width: 256, Height: 256, Size: 1}}
+		for _, img := range []ImageMetadata{second, first, testImage("c", dbtest.Time(2))} {
+			if err := repo.SaveImage(ctx, img); err != nil {
+				t.Fatalf("SaveImage %s: %v", img.ID, err)
+			}
+		}
+
+		got, err := repo.FindImageByChecksum(ctx, first.Checksum)
+		if err != nil {
+			t.Fatalf("FindImageByChecksum: %v", err)
+		}
+		assertImage(t, *got, first)
+		if len(got.Variants) != 1 || got.Variants[0].S3Key != "variants/ab/256.jpg" {
+			t.Errorf("variants = %+v", got.Variants)
+		}
+
+		if _, err := repo.FindImageByChecksum(ctx, strings.Repeat("cd", 32)); !errors.Is(err, ErrImageNotFound) {
+			t.Errorf("missing checksum: err = %v, want ErrImageNotFound", err)
+		}
+	})
+
+	t.Run("PerceptualHashes", func(t *testing.T) {
+		repo := newRepo(t)
+		ctx := context.Background()
+
+		hashed, other := testImage("a", dbtest.Time(0)), testImage("b", dbtest.Time(1))
+		hashed.PerceptualHash, other.PerceptualHash = "3c3e1e0f0f070301", "ffffffff00000000"
+		for _, img := range []ImageMetadata{hashed, other, testImage("unhashed", dbtest.Time(2))} {
+			if err := repo.SaveImage(ctx, img); err != nil {
+				t.Fatalf("SaveImage %s: %v", img.ID, err)
+			}
+		}
+
+		got, err := repo.GetImageByID(ctx, "a")
+		if err != nil {
+			t.Fatalf("GetImageByID: %v", err)
+		}
+		assertImage(t, *got, hashed)
+
+		hashes, err := repo.ListPerceptualHashes(ctx)
+		if err != nil {
+			t.Fatalf("ListPerceptualHashes: %v", err)
+		}
+		if want := map[string]string{"a": hashed.PerceptualHash, "b": other.PerceptualHash}; !reflect.DeepEqual(hashes, want) {
+			t.Errorf("hashes = %v, want %v", hashes, want)
+		}
+	})
+
+	t.Run("SaveDuplicateID", func(t *testing.T) {
+		repo := newRepo(t)
+		ctx := context.Background()
+
+		if err := repo.SaveImage(ctx, testImage("a", dbtest.Time(0))); err != nil {
+			t.Fatalf("SaveImage: %v", err)
+		}
+		if err := repo.SaveImage(ctx, testImage("a", dbtest.Time(1))); err == nil {
+			t.Fatal("SaveImage with a duplicate ID succeeded")
+		}
+	})
+
+	t.Run("GetMissing", func(t *testing.T) {
+		repo := newRepo(t)
+
+		_, err := repo.GetImageByID(context.Background(), "missing")
+		if !errors.Is(err, ErrImageNotFound) {
+			t.Fatalf("err = %v, want ErrImageNotFound", err)
+		}
+	})
+
+	t.Run("GetImagesByIDs", func(t *testing.T) {
+		repo := newRepo(t)
+		ctx := context.Background()
+
+		for i, id := range []string{"a", "b", "c"} {
+			img := testImage(id, dbtest.Time(i))
+			img.Tags = []string{"tag-" + id}
+			if err := repo.SaveImage(ctx, img); err != nil {
+				t.Fatalf("SaveImage %s: %v", id, err)
+			}
+		}
+
+		got, err := repo.GetImagesByIDs(ctx, []string{"c", "missing", "a", "c"})
+		if err != nil {
+			t.Fatalf("GetImagesByIDs: %v", err)
+		}
+		if len(got) != 2 || got[0].ID != "c" || got[1].ID != "a" {
+			t.Fatalf("images = %+v, want c then a", got)
+		}
+		if fmt.Sprint(got[0].Tags) != "[tag-c]" {
+			t.Errorf("tags = %v, want [tag-c]", got[0].Tags)
+		}
+
+		if got, err := repo.GetImagesByIDs(ctx, nil); err != nil || len(got) != 0 {
+			t.Errorf("GetImagesByIDs(nil) = %v, %v, want no images", got, err)
+		}
+	})
+
+	t.Run("UpdateImage", func(t *testing.T) {
+		repo := newRepo(t)
+		ctx := context.Background()
+
+		img := testImage("a", dbtest.Time(0))
+		if err := repo.SaveImage(ctx, img); err != nil {
+			t.Fatalf("SaveImage: %v", err)
+		}
+
+		img.Title = "Login page"
+		img.Description = "Error shown after\nthe second attempt"
+		img.AltText = "Login form with a red error banner"
+		img.Private = true
+		if err := repo.UpdateImage(ctx, img); err != nil {
+			t.Fatalf("UpdateImage: %v", err)
+		}
+		// Saving the same values again is not a missing image
+		if err := repo.UpdateImage(ctx, img); err != nil {
+			t.Fatalf("UpdateImage unchanged: %v", err)
+		}
+
+		got, err := repo.GetImageByID(ctx, "a")
+		if err != nil {
+			t.Fatalf("GetImageByID: %v", err)
+		}
+		assertImage(t, *got, img)
+
+		img.ID = "missing"
+		if err := repo.UpdateImage(ctx, img); !errors.Is(err, ErrImageNotFound) {
+			t.Errorf("UpdateImage on missing image: err = %v, want ErrImageNotFound", err)
+		}
+	})
+
+	t.Run("ClaimUnownedImages", func(t *testing.T) {
+		repo := newRepo(t)
+		ctx := context.Background()
+
+		owned := testImage("a", dbtest.Time(0))
+		owned.OwnerID = "u1"
+		for _, img := range []ImageMetadata{owned, testImage("b", dbtest.Time(60)), testImage("c", dbtest.Time(120))} {
+			if err := repo.SaveImage(ctx, img); err != nil {
+				t.Fatalf("SaveImage %s: %v", img.ID, err)
+			}
+		}
+
+		claimed, err := repo.ClaimUnownedImages(ctx, "u2")
+		if err != nil || claimed != 2 {
+			t.Fatalf("ClaimUnownedImages = %d, %v; want 2", claimed, err)
+		}
+		for id, want := range map[string]string{"a": "u1", "b": "u2", "c": "u2"} {
+			got, err := repo.GetImageByID(ctx, id)
+			if err != nil {
+				t.Fatalf("GetImageByID %s: %v", id, err)
+			}
+			if got.OwnerID != want {
+				t.Errorf("owner of %s = %q, want %q", id, got.OwnerID, want)
+			}
+		}
+
+		if claimed, err := repo.ClaimUnownedImages(ctx, "u3"); err != nil || claimed != 0 {
+			t.Errorf("second ClaimUnownedImages = %d, %v; want 0", claimed, err)
+		}
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		repo := newRepo(t)
+		ctx := context.Background()
+
+		img := testImage("a", dbtest.Time(0))
+		img.Variants = []ImageVariant{{Name: "256", S3Key: "variants/a/256.jpg", ContentType: "image/jpeg", Width: 256, Height: 256, Size: 1}}
+		if err := repo.SaveImage(ctx, img); err != nil {
+			t.Fatalf("SaveImage: %v", err)
+		}
+
+		if err := repo.DeleteImage(ctx, "a", nil); err != nil {
+			t.Fatalf("DeleteImage: %v", err)
+		}
+		if _, err := repo.GetImageByID(ctx, "a"); !errors.Is(err, ErrImageNotFound) {
+			t.Fatalf("GetImageByID after delete: err = %v, want ErrImageNotFound", err)
+		}
+		if err := repo.DeleteImage(ctx, "a", nil); !errors.Is(err, ErrImageNotFound) {
+			t.Fatalf("second DeleteImage: err = %v, want ErrImageNotFound", err)
+		}
+
+		// The ID is free again, so no variant rows were left behind
+		if err := repo.SaveImage(ctx, img); err != nil {
+			t.Fatalf("SaveImage after delete: %v", err)
+		}
+	})
+
+	t.Run("Pagination", func(t *testing.T) {
+		repo := newRepo(t)
+		ctx := context.Background()
+
+		// Two images share an upload time so the id tie-break is exercised
+		var want []string
+		for i, id := range []string{"e", "d", "c2", "c1", "b", "a"} {
+			offset := 5 - i
+			if id == "c1" {
+				offset = 3
+			}
+			img := testImage(id, dbtest.Time(offset))
+			img.Variants = []ImageVariant{{Name: "256", S3Key: "variants/" + id + "/256.jpg", ContentType: "image/jpeg", Width: 256, Height: 256, Size: 1}}
+			if err := repo.SaveImage(ctx, img); err != nil {
+				t.Fatalf("SaveImage %s: %v", id, err)
+			}
+			want = append(want, id)
+		}
+
+		var got []string
+		var pages []*ImagePage
+		query := ImageQuery{Limit: 4}
+		for {
+			page, err := repo.GetAllImages(ctx, query)
+			if err != nil {
+				t.Fatalf("GetAllImages: %v", err)
+			}
+			if page.Total != int64(len(want)) {
+				t.Errorf("Total = %d, want %d", page.Total, len(want))
+			}
+			for _, img := range page.Images {
+				if len(img.Variants) != 1 {
+					t.Errorf("image %s has %d variants, want 1", img.ID, len(img.Variants))
+				}
+				got = append(got, img.ID)
+			}
+			pages = append(pages, page)
+			if page.NextCursor == "" {
+				break
+			}
+			query = ImageQuery{Limit: 4, After: page.NextCursor}
+		}
+
+		if fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Fatalf("paged IDs = %v, want %v", got, want)
+		}
+		if len(pages) != 2 || pages[0].PrevCursor != "" || pages[1].PrevCursor == "" {
+			t.Fatalf("unexpected cursors on %d pages", len(pages))
+		}
+
+		back, err := repo.GetAllImages(ctx, ImageQuery{Limit: 4, Before: pages[1].PrevCursor})
+		if err != nil {
+			t.Fatalf("GetAllImages backward: %v", err)
+		}
+		var backIDs []string
+		for _, img := range back.Images {
+			backIDs = append(backIDs, img.ID)
+		}
+		if fmt.Sprint(backIDs) != fmt.Sprint(want[:4]) {
+			t.Errorf("backward page = %v, want %v", backIDs, want[:4])
+		}
+		if back.PrevCursor != "" || back.NextCursor == "" {
+			t.Errorf("backward page cursors: prev=%q next=%q", back.PrevCursor, back.NextCursor)
+		}
+	})
+
+	t.Run("Tags", func(t *testing.T) {
+		repo := newRepo(t)
+		ctx := context.Background()
+
+		a := testImage("a", dbtest.Time(0))
+		a.Tags = []string{"sunset", "beach"}
+		b := testImage("b", dbtest.Time(1))
+		b.Tags = []string{"beach"}
+		c := testImage("c", dbtest.Time(2))
+		for _, img := range []ImageMetadata{a, b, c} {
+			if err := repo.SaveImage(ctx, img); err != nil {
+				t.Fatalf("SaveImage %s: %v", img.ID, err)
+			}
+		}
+
+		got, err := repo.GetImageByID(ctx, "a")
+		if err != nil {
+			t.Fatalf("GetImageByID: %v", err)
+		}
+		if fmt.Sprint(got.Tags) != "[beach sunset]" {
+			t.Errorf("tags = %v, want [beach sunset]", got.Tags)
+		}
+
+		// Adding a tag twice is not an error
+		if err := repo.AddTags(ctx, "c", []string{"beach", "night"}); err != nil {
+			t.Fatalf("AddTags: %v", err)
+		}
+		if err := repo.AddTags(ctx, "c", []string{"night"}); err != nil {
+			t.Fatalf("AddTags again: %v", err)
+		}
+		if err := repo.RemoveTags(ctx, "b", []string{"beach", "unknown"}); err != nil {
+			t.Fatalf("RemoveTags: %v", err)
+		}
+
+		for _, tc := range []struct {
+			tags []string
+			want string
+		}{
+			{nil, "[c b a]"},
+			{[]string{"beach"}, "[c a]"},
+			{[]string{"beach", "night"}, "[c]"},
+			{[]string{"unknown"}, "[]"},
+		} {
+			page, err := repo.GetAllImages(ctx, ImageQuery{Limit: 10, Tags: tc.tags})
+			if err != nil {
+				t.Fatalf("GetAllImages %v: %v", tc.tags, err)
+			}
+			var ids []string
+			for _, img := range page.Images {
+				ids = append(ids, img.ID)
+			}
+			if fmt.Sprint(ids) != tc.want {
+				t.Errorf("tags %v: IDs = %v, want %s", tc.tags, ids, tc.want)
+			}
+			if page.Total != int64(len(ids)) {
+				t.Errorf("tags %v: Total = %d, want %d", tc.tags, page.Total, len(ids))
+			}
+		}
+
+		if err := repo.AddTags(ctx, "missing", []string{"beach"}); !errors.Is(err, ErrImageNotFound) {
+			t.Errorf("AddTags on missing image: err = %v, want ErrImageNotFound", err)
+		}
+		if err := repo.RemoveTags(ctx, "missing", []string{"beach"}); !errors.Is(err, ErrImageNotFound) {
+			t.Errorf("RemoveTags on missing image: err = %v, want ErrImageNotFound", err)
+		}
+
+		// Deleting and re-saving an image does not resurrect its old tags
+		if err := repo.DeleteImage(ctx, "c", nil); err != nil {
+			t.Fatalf("DeleteImage: %v", err)
+		}
+		if err := repo.SaveImage(ctx, testImage("c", dbtest.Time(2))); err != nil {
+			t.Fatalf("SaveImage after delete: %v", err)
+		}
+		got, err = repo.GetImageByID(ctx, "c")
+		if err != nil {
+			t.Fatalf("GetImageByID: %v", err)
+		}
+		if len(got.Tags) != 0 {
+			t.Errorf("tags after re-save = %v, want none", got.Tags)
+		}
+	})
+
+	t.Run("Search", func(t *testing.T) {
+		repo := newRepo(t)
+		ctx := context.Background()
+
+		images := []ImageMetadata{
+			testImage("a", dbtest.Time(0)),
+			testImage("b", dbtest.Time(60)),
+			testImage("c", dbtest.Time(120)),
+			testImage("d", dbtest.Time(180)),
+			testImage("e", dbtest.Time(240)),
+		}
+		images[0].OriginalName = "screenshot-login-error.png"
+		images[0].ContentType = "image/png"
+		images[0].Size = 100
+		images[1].Title = "Dashboard latency"
+		images[1].Description = "Spike during the deployment"
+		images[1].Size = 2000
+		images[2].Tags = []string{"incident", "login"}
+		images[2].ContentType = "image/gif"
+		images[2].Size = 3000
+		images[3].Title = "Café menu"
+		images[3].Size = 5000
+		images[4].OriginalName = "login-before-accounts.png"
+		images[1].OwnerID = "u1"
+		images[3].OwnerID = "u1"
+		images[3].Private = true
+		// Private images without an owner are only shared through links
+		images[4].Private = true
+		for _, img := range images {
+			if err := repo.SaveImage(ctx, img); err != nil {
+				t.Fatalf("SaveImage %s: %v", img.ID, err)
+			}
+		}
+
+		// Queries are given in the normalized form the service passes on
+		for _, tc := range []struct {
+			name  string
+			query ImageQuery
+			want  string
+		}{
+			{"original name", ImageQuery{Search: "login"}, "[c a]"},
+			{"word prefix", ImageQuery{Search: "deploy"}, "[b]"},
+			{"words across fields", ImageQuery{Search: "dashboard spike"}, "[b]"},
+			{"word and tag", ImageQuery{Search: "incident login"}, "[c]"},
+			{"no match", ImageQuery{Search: "nothing"}, "[]"},
+			{"content type", ImageQuery{ContentTypes: []string{"image/png", "image/gif"}}, "[c a]"},
+			{"size range", ImageQuery{MinSize: 1000, MaxSize: 2500}, "[b]"},
+			{"upload range", ImageQuery{UploadedFrom: dbtest.Time(60), UploadedTo: dbtest.Time(180)}, "[c b]"},
+			{"combined", ImageQuery{Search: "login", MaxSize: 1000}, "[a]"},
+			{"owner", ImageQuery{OwnerID: "u1", ViewerID: "u1"}, "[d b]"},
+			{"private of another user", ImageQuery{ViewerID: "u2"}, "[c b a]"},
+			{"own private", ImageQuery{ViewerID: "u1"}, "[d c b a]"},
+			{"signed out", ImageQuery{OwnerID: "u1"}, "[b]"},
+		} {
+			tc.query.Limit = 10
+			page, err := repo.GetAllImages(ctx, tc.query)
+			if err != nil {
+				t.Fatalf("%s: GetAllImages: %v", tc.name, err)
+			}
+			var ids []string
+			for _, img := range page.Images {
+				ids = append(ids, img.ID)
+			}
+			if fmt.Sprint(ids) != tc.want {
+				t.Errorf("%s: IDs = %v, want %s", tc.name, ids, tc.want)
+			}
+			if page.Total != int64(len(ids)) {
+				t.Errorf("%s: Total = %d, want %d", tc.name, page.Total, len(ids))
+			}
+		}
+
+		// Edited details are searchable
+		images[3].Title = "Release checklist"
+		if err := repo.UpdateImage(ctx, images[3]); err != nil {
+			t.Fatalf("UpdateImage: %v", err)
+		}
+		for search, want := range map[string]int64{"checklist": 1, "menu": 0} {
+			page, err := repo.GetAllImages(ctx, ImageQuery{Limit: 10, Search: search, ViewerID: "u1"})
+			if err != nil {
+				t.Fatalf("GetAllImages %q: %v", search, err)
+			}
+			if page.Total != want {
+				t.Errorf("search %q after edit: Total = %d, want %d", search, page.Total, want)
+			}
+		}
+	})
+
+	t.Run("UploadReservations", func(t *testing.T) {
+		repo := newRepo(t)
+		ctx := context.Background()
+
+		reservation := func(id string, expiresAt time.Time) UploadReservation {
+			return UploadReservation{
+				ID:          id,
+				S3Key:       "pending/" + id + ".png",
+				Filename:    "photo-" + id + ".png",
+				ContentType: "image/png",
+				Size:        1234,
+				OwnerID:     "u1",
+				CreatedAt:   dbtest.Time(0),
+				ExpiresAt:   expiresAt,
+			}
+		}
+		live, expired := reservation("live", dbtest.Time(30)), reservation("expired", dbtest.Time(10))
+		for _, r := range []UploadReservation{live, expired} {
+			if err := repo.SaveReservation(ctx, r); err != nil {
+				t.Fatalf("SaveReservation %s: %v", r.ID, err)
+			}
+		}
+		if err := repo.SaveReservation(ctx, live); err == nil {
+			t.Error("saving a duplicate reservation succeeded")
+		}
+
+		got, err := repo.GetReservation(ctx, "live")
+		if err != nil {
+			t.Fatalf("GetReservation: %v", err)
+		}
+		if got.ID != live.ID || got.S3Key != live.S3Key || got.Filename != live.Filename || got.ContentType != live.ContentType ||
+			got.Size != live.Size || got.OwnerID != live.OwnerID || !got.CreatedAt.Equal(live.CreatedAt) || !got.ExpiresAt.Equal(live.ExpiresAt) {
+			t.Errorf("reservation = %+v, want %+v", got, live)
+		}
+
+		swept, err := repo.DeleteExpiredReservations(ctx, dbtest.Time(20))
+		if err != nil {
+			t.Fatalf("DeleteExpiredReservations: %v", err)
+		}
+		if len(swept) != 1 || swept[0].ID != "expired" || swept[0].S3Key != expired.S3Key {
+			t.Errorf("swept = %+v, want only the expired reservation", swept)
+		}
+		if _, err := repo.GetReservation(ctx, "expired"); !errors.Is(err, ErrUploadNotFound) {
+			t.Errorf("expired reservation: err = %v, want ErrUploadNotFound", err)
+		}
+
+		if err := repo.DeleteReservation(ctx, "live"); err != nil {
+			t.Fatalf("DeleteReservation: %v", err)
+		}
+		if err := repo.DeleteReservation(ctx, "live"); !errors.Is(err, ErrUploadNotFound) {
+			t.Errorf("deleting twice: err = %v, want ErrUploadNotFound", err)
+		}
+	})
+
+	t.Run("TusUploads", func(t *testing.T) {
+		repo := newRepo(t)
+		ctx := context.Background()
+
+		upload := func(id string, expiresAt time.Time) TusUpload {
+			return TusUpload{
+				ID:        id,
+				S3Key:     "tus/" + id + "/upload",
+				Length:    12 << 20,
+				Metadata:  "filename cGhvdG8ucG5n",
+				OwnerID:   "u1",
+				CreatedAt: dbtest.Time(0),
+				ExpiresAt: expiresAt,
+			}
+		}
+		live, expired := upload("live", dbtest.Time(30)), upload("expired", dbtest.Time(10))
+		for _, u := range []TusUpload{live, expired} {
+			if err := repo.SaveTusUpload(ctx, u); err != nil {
+				t.Fatalf("SaveTusUpload %s: %v", u.ID, err)
+			}
+		}
+		if err := repo.SaveTusUpload(ctx, live); err == nil {
+			t.Error("saving a duplicate tus upload succeeded")
+		}
+
+		// Two chunks, the second adding a part to the first
+		live.MultipartID = "multipart-1"
+		live.Parts = []storage.CompletedPart{{PartNumber: 1, ETag: `"etag-1"`, Size: 5 << 20}}
+		live.Offset, live.TailKey, live.ExpiresAt = 6<<20, "tus/live/tail-1", dbtest.Time(40)
+		if err := repo.UpdateTusUpload(ctx, live, 0); err != nil {
+			t.Fatalf("UpdateTusUpload: %v", err)
+		}
+		live.Parts = append(live.Parts, storage.CompletedPart{PartNumber: 2, ETag: `"etag-2"`, Size: 5 << 20})
+		live.Offset, live.TailKey = 11<<20, "tus/live/tail-2"
+		if err := repo.UpdateTusUpload(ctx, live, 6<<20); err != nil {
+			t.Fatalf("UpdateTusUpload: %v", err)
+		}
+		if err := repo.UpdateTusUpload(ctx, live, 6<<20); !errors.Is(err, ErrUploadConflict) {
+			t.Errorf("stale offset: err = %v, want ErrUploadConflict", err)
+		}
+		if err := repo.UpdateTusUpload(ctx, upload("missing", dbtest.Time(30)), 0); !errors.Is(err, ErrUploadNotFound) {
+			t.Errorf("missing upload: err = %v, want ErrUploadNotFound", err)
+		}
+
+		completed := dbtest.Time(45)
+		live.CompletedAt = &completed
+		if err := repo.UpdateTusUpload(ctx, live, live.Offset); err != nil {
+			t.Fatalf("UpdateTusUpload completing: %v", err)
+		}
+
+		got, err := repo.GetTusUpload(ctx, "live")
+		if err != nil {
+			t.Fatalf("GetTusUpload: %v", err)
+		}
+		if got.ID != live.ID || got.S3Key != live.S3Key || got.MultipartID != live.MultipartID || got.Length != live.Length ||
+			got.Offset != live.Offset || got.Metadata != live.Metadata || got.TailKey != live.TailKey || got.OwnerID != live.OwnerID ||
+			!got.CreatedAt.Equal(live.CreatedAt) || !got.ExpiresAt.Equal(live.ExpiresAt) ||
+			got.CompletedAt == nil || !got.CompletedAt.Equal(completed) {
+			t.Errorf("tus upload = %+v, want %+v", got, live)
+		}
+		if !reflect.DeepEqual(got.Parts, live.Parts) {
+			t.Errorf("parts = %+v, want %+v", got.Parts, live.Parts)
+		}
+
+		swept, err := repo.DeleteExpiredTusUploads(ctx, dbtest.Time(20))
+		if err != nil {
+			t.Fatalf("DeleteExpiredTusUploads: %v", err)
+		}
+		if len(swept) != 1 || swept[0].ID != "expired" || swept[0].S3Key != expired.S3Key {
+			t.Errorf("swept = %+v, want only the expired upload", swept)
+		}
+		if _, err := repo.GetTusUpload(ctx, "expired"); !errors.Is(err, ErrUploadNotFound) {
+			t.Errorf("expired upload: err = %v, want ErrUploadNotFound", err)
+		}
+
+		if err := repo.DeleteTusUpload(ctx, "live"); err != nil {
+			t.Fatalf("DeleteTusUpload: %v", err)
+		}
+		if err := repo.DeleteTusUpload(ctx, "live"); !errors.Is(err, ErrUploadNotFound) {
+			t.Errorf("deleting twice: err = %v, want ErrUploadNotFound", err)
+		}
+	})
+
+	t.Run("ShareLinks", func(t *testing.T) {
+		repo := newRepo(t)
+		ctx := context.Background()
+
+		for _, id := range []string{"a", "b"} {
+			if err := repo.SaveImage(ctx, testImage(id, dbtest.Time(0))); err != nil {
+				t.Fatalf("SaveImage %s: %v", id, err)
+			}
+		}
+
+		link := func(id, imageID string, maxDownloads int, createdAt time.Time) ShareLink {
+			return ShareLink{
+				ID:           id,
+				ImageID:      imageID,
+				ExpiresAt:    dbtest.Time(60),
+				MaxDownloads: maxDownloads,
+				CreatedAt:    createdAt,
+			}
+		}
+		limited := link("limited", "a", 2, dbtest.Time(2))
+		protected := link("protected", "a", 0, dbtest.Time(1))
+		protected.PasswordHash = "$2a$10$hash"
+		other := link("other", "b", 0, dbtest.Time(1))
+		for _, l := range []ShareLink{limited, protected, other} {
+			if err := repo.SaveShareLink(ctx, l); err != nil {
+				t.Fatalf("SaveShareLink %s: %v", l.ID, err)
+			}
+		}
+
+		got, err := repo.GetShareLink(ctx, "protected")
+		if err != nil {
+			t.Fatalf("GetShareLink: %v", err)
+		}
+		if got.ImageID != "a" || !got.ExpiresAt.Equal(protected.ExpiresAt) || got.PasswordHash != protected.PasswordHash ||
+			!got.Protected || got.Downloads != 0 || !got.CreatedAt.Equal(protected.CreatedAt) {
+			t.Errorf("share link = %+v, want %+v", got, protected)
+		}
+		if _, err := repo.GetShareLink(ctx, "missing"); !errors.Is(err, ErrShareLinkNotFound) {
+			t.Errorf("GetShareLink missing: err = %v, want ErrShareLinkNotFound", err)
+		}
+
+		links, err := repo.ListShareLinks(ctx, "a")
+		if err != nil {
+			t.Fatalf("ListShareLinks: %v", err)
+		}
+		if len(links) != 2 || links[0].ID != "protected" || links[1].ID != "limited" || links[1].Protected {
+			t.Errorf("links = %+v, want protected then limited", links)
+		}
+
+		// Two downloads are allowed, then the link is used up
+		for i := 0; i < 2; i++ {
+			if err := repo.RecordShareDownload(ctx, "limited", dbtest.Time(10)); err != nil {
+				t.Fatalf("RecordShareDownload %d: %v", i, err)
+			}
+		}
+		if err := repo.RecordShareDownload(ctx, "limited", dbtest.Time(10)); !errors.Is(err, ErrShareLinkExhausted) {
+			t.Errorf("third download: err = %v, want ErrShareLinkExhausted", err)
+		}
+		if got, _ := repo.GetShareLink(ctx, "limited"); got == nil || got.Downloads != 2 {
+			t.Errorf("downloads = %+v, want 2", got)
+		}
+		if err := repo.RecordShareDownload(ctx, "protected", dbtest.Time(60)); !errors.Is(err, ErrShareLinkExpired) {
+			t.Errorf("download at expiry: err = %v, want ErrShareLinkExpired", err)
+		}
+		if err := repo.RecordShareDownload(ctx, "missing", dbtest.Time(10)); !errors.Is(err, ErrShareLinkNotFound) {
+			t.Errorf("download of missing link: err = %v, want ErrShareLinkNotFound", err)
+		}
+
+		// Links are revoked through their own image only
+		if err := repo.DeleteShareLink(ctx, "b", "limited"); !errors.Is(err, ErrShareLinkNotFound) {
+			t.Errorf("DeleteShareLink through another image: err = %v, want ErrShareLinkNotFound", err)
+		}
+		if err := repo.DeleteShareLink(ctx, "a", "limited"); err != nil {
+			t.Fatalf("DeleteShareLink: %v", err)
+		}
+		if _, err := repo.GetShareLink(ctx, "limited"); !errors.Is(err, ErrShareLinkNotFound) {
+			t.Errorf("GetShareLink after revoke: err = %v, want ErrShareLinkNotFound", err)
+		}
+
+		// Deleting an image takes its links with it
+		if err := repo.DeleteImage(ctx, "a", nil); err != nil {
+			t.Fatalf("DeleteImage: %v", err)
+		}
+		if _, err := repo.GetShareLink(ctx, "protected"); !errors.Is(err, ErrShareLinkNotFound) {
+			t.Errorf("GetShareLink after image delete: err = %v, want ErrShareLinkNotFound", err)
+		}
+		if _, err := repo.GetShareLink(ctx, "other"); err != nil {
+			t.Errorf("GetShareLink of another image: %v", err)
+		}
+	})
+
+	t.Run("InvalidCursor", func(t *testing.T) {
+		repo := newRepo(t)
+
+		_, err := repo.GetAllImages(context.Background(), ImageQuery{Limit: 10, After: "not a cursor"})
+		if !errors.Is(err, ErrInvalidCursor) {
+			t.Fatalf("err = %v, want ErrInvalidCursor", err)
+		}
+	})
+}
+
+// testImage returns metadata for an image with the given ID
+func testImage(id string, uploadedAt time.Time) ImageMetadata {
+	return ImageMetadata{
+		ID:           id,
+		Filename:     id + ".jpg",
+		OriginalName: "photo-" + id + ".jpg",
+		Title:        "Photo " + id,
+		S3Key:        "uploads/" + id + ".jpg",
+		S3URL:        "https://example.com/uploads/" + id + ".jpg",
+		ContentType:  "image/jpeg",
+		Size:         1234,
+		Checksum:     fmt.Sprintf("%064x", len(id)),
+		UploadedAt:   uploadedAt,
+		Width:        640,
+		Height:       480,
+	}
+}
+
+// assertImage compares the stored image fields, ignoring variants
+func assertImage(t *testing.T, got, want ImageMetadata) {
+	t.Helper()
+
+	if got.ID != want.ID || got.Filename != want.Filename || got.OriginalName != want.OriginalName ||
+		got.Title != want.Title || got.Description != want.Description || got.AltText != want.AltText ||
+		got.S3Key != want.S3Key || got.S3URL != want.S3URL || got.ContentType != want.ContentType ||
+		got.Size != want.Size || got.Checksum != want.Checksum || got.Width != want.Width ||
+		got.Height != want.Height || got.Orientation != want.Orientation ||
+		got.CameraMake != want.CameraMake || got.CameraModel != want.CameraModel ||
+		got.PerceptualHash != want.PerceptualHash || got.Private != want.Private ||
+		got.OwnerID != want.OwnerID {
+		t.Errorf("image = %+v, want %+v", got, want)
+	}
+	if !got.UploadedAt.Equal(want.UploadedAt) {
+		t.Errorf("UploadedAt = %v, want %v", got.UploadedAt, want.UploadedAt)
+	}
+	if (got.TakenAt == nil) != (want.TakenAt == nil) || (got.TakenAt != nil && !got.TakenAt.Equal(*want.TakenAt)) {
+		t.Errorf("TakenAt = %v, want %v", got.TakenAt, want.TakenAt)
+	}
+	if (got.Latitude == nil) != (want.Latitude == nil) || (got.Latitude != nil &&
+		(*got.Latitude != *want.Latitude || *got.Longitude != *want.Longitude)) {
+		t.Errorf("position = %v, %v, want %v, %v", got.Latitude, got.Longitude, want.Latitude, want.Longitude)
+	}
+}
@@ -0,0 +1,580 @@
+package image
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"file-pub/storage"
+)
+
+// memoryImageRepository implements ImageRepository in process memory
+type memoryImageRepository struct {
+	mu           sync.RWMutex
+	images       map[string]ImageMetadata
+	blobs        map[string]int
+	reservations map[string]UploadReservation
+	tusUploads   map[string]TusUpload
+	shareLinks   map[string]ShareLink
+}
+
+// NewMemoryImageRepository creates a new ImageRepository that keeps metadata
+// in memory, for tests and development. Metadata is lost when the process exits.
+func NewMemoryImageRepository() ImageRepository {
+	return &memoryImageRepository{
+		images:       make(map[string]ImageMetadata),
+		blobs:        make(map[string]int),
+		reservations: make(map[string]UploadReservation),
+		tusUploads:   make(map[string]TusUpload),
+		shareLinks:   make(map[string]ShareLink),
+	}
+}
+
+// GetAllImages retrieves one page of images using keyset pagination over (uploaded_at, id)
+func (repo *memoryImageRepository) GetAllImages(ctx context.Context, query ImageQuery) (*ImagePage, error) {
+	var cursor *pageCursor
+	backward := query.Before != ""
+	switch {
+	case backward:
+		parsed, err := decodeCursor(query.Before)
+		if err != nil {
+			return nil, err
+		}
+		cursor = parsed
+	case query.After != "":
+		parsed, err := decodeCursor(query.After)
+		if err != nil {
+			return nil, err
+		}
+		cursor = parsed
+	}
+
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+
+	// Mirror the SQL implementations: newest first, or oldest first when
+	// paging backward, keeping one extra row to detect another page
+	var rows []ImageMetadata
+	var total int64
+	for _, img := range repo.images {
+		if !matchesQuery(img, query) {
+			continue
+		}
+		total++
+
+		if cursor != nil {
+			cmp := compareCursor(img, cursor)
+			if (backward && cmp <= 0) || (!backward && cmp >= 0) {
+				continue
+			}
+		}
+		rows = append(rows, copyImage(img))
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		cmp := compareImages(rows[i], rows[j])
+		if backward {
+			return cmp < 0
+		}
+		return cmp > 0
+	})
+	if len(rows) > query.Limit+1 {
+		rows = rows[:query.Limit+1]
+	}
+
+	page := buildPage(rows, query)
+	page.Total = total
+	return page, nil
+}
+
+// SaveImage saves a copy of the image metadata and its variants
+func (repo *memoryImageRepository) SaveImage(ctx context.Context, metadata ImageMetadata) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	if _, exists := repo.images[metadata.ID]; exists {
+		return fmt.Errorf("memory insert image %s: duplicate id", metadata.ID)
+	}
+	repo.images[metadata.ID] = copyImage(metadata)
+	for _, key := range blobKeys(metadata) {
+		repo.blobs[key]++
+	}
+
+	return nil
+}
+
+// GetImageByID retrieves a copy of an image's metadata
+func (repo *memoryImageRepository) GetImageByID(ctx context.Context, id string) (*ImageMetadata, error) {
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+
+	img, ok := repo.images[id]
+	if !ok {
+		return nil, ErrImageNotFound
+	}
+
+	img = copyImage(img)
+	return &img, nil
+}
+
+// FindImageByChecksum retrieves a copy of the earliest image with the given
+// content checksum, or ErrImageNotFound when there is none
+func (repo *memoryImageRepository) FindImageByChecksum(ctx context.Context, checksum string) (*ImageMetadata, error) {
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+
+	var found *ImageMetadata
+	for _, img := range repo.images {
+		if img.Checksum != checksum {
+			continue
+		}
+		if found == nil || compareImages(img, *found) < 0 {
+			img := img
+			found = &img
+		}
+	}
+	if found == nil {
+		return nil, ErrImageNotFound
+	}
+
+	img := copyImage(*found)
+	return &img, nil
+}
+
+// ListPerceptualHashes returns the perceptual hash of every image that has
+// one, keyed by image ID
+func (repo *memoryImageRepository) ListPerceptualHashes(ctx context.Context) (map[string]string, error) {
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+
+	hashes := make(map[string]string)
+	for id, img := range repo.images {
+		if img.PerceptualHash != "" {
+			hashes[id] = img.PerceptualHash
+		}
+	}
+
+	return hashes, nil
+}
+
+// GetImagesByIDs retrieves copies of the images with the given IDs in the
+// order the IDs are listed; IDs with no image are skipped
+func (repo *memoryImageRepository) GetImagesByIDs(ctx context.Context, ids []string) ([]ImageMetadata, error) {
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+
+	var images []ImageMetadata
+	seen := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		img, ok := repo.images[id]
+		if !ok || seen[id] {
+			continue
+		}
+		seen[id] = true
+		images = append(images, copyImage(img))
+	}
+
+	return images, nil
+}
+
+// UpdateImage saves an image's title, description and alt text
+func (repo *memoryImageRepository) UpdateImage(ctx context.Context, metadata ImageMetadata) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	img, ok := repo.images[metadata.ID]
+	if !ok {
+		return ErrImageNotFound
+	}
+	img.Title = metadata.Title
+	img.Description = metadata.Description
+	img.AltText = metadata.AltText
+	img.Private = metadata.Private
+	repo.images[metadata.ID] = img
+
+	return nil
+}
+
+// ClaimUnownedImages gives every image without an owner to the user with
+// ownerID and returns how many it changed
+func (repo *memoryImageRepository) ClaimUnownedImages(ctx context.Context, ownerID string) (int64, error) {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	var claimed int64
+	for id, img := range repo.images {
+		if img.OwnerID == "" {
+			img.OwnerID = ownerID
+			repo.images[id] = img
+			claimed++
+		}
+	}
+
+	return claimed, nil
+}
+
+// DeleteImage removes an image and its variants
+func (repo *memoryImageRepository) DeleteImage(ctx context.Context, id string, release ReleaseFunc) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	img, ok := repo.images[id]
+	if !ok {
+		return ErrImageNotFound
+	}
+
+	// Release while holding the lock, and only forget the image once every
+	// release succeeded, as the SQL repository's transaction does
+	var released []string
+	for _, key := range blobKeys(img) {
+		if repo.blobs[key] > 1 {
+			continue
+		}
+		if release != nil {
+			if err := release(key); err != nil {
+				return err
+			}
+		}
+		released = append(released, key)
+	}
+
+	for _, key := range blobKeys(img) {
+		repo.blobs[key]--
+	}
+	for _, key := range released {
+		delete(repo.blobs, key)
+	}
+	delete(repo.images, id)
+	for linkID, link := range repo.shareLinks {
+		if link.ImageID == id {
+			delete(repo.shareLinks, linkID)
+		}
+	}
+
+	return nil
+}
+
+// AddTags attaches tags to an image; tags it already has are ignored
+func (repo *memoryImageRepository) AddTags(ctx context.Context, id string, tags []string) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	img, ok := repo.images[id]
+	if !ok {
+		return ErrImageNotFound
+	}
+	img.Tags = mergeTags(img.Tags, tags)
+	repo.images[id] = img
+
+	return nil
+}
+
+// RemoveTags detaches tags from an image; tags it does not have are ignored
+func (repo *memoryImageRepository) RemoveTags(ctx context.Context, id string, tags []string) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	img, ok := repo.images[id]
+	if !ok {
+		return ErrImageNotFound
+	}
+
+	var kept []string
+	for _, tag := range img.Tags {
+		if !containsTag(tags, tag) {
+			kept = append(kept, tag)
+		}
+	}
+	img.Tags = kept
+	repo.images[id] = img
+
+	return nil
+}
+
+// SaveReservation records a direct upload reservation
+func (repo *memoryImageRepository) SaveReservation(ctx context.Context, reservation UploadReservation) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	if _, exists := repo.reservations[reservation.ID]; exists {
+		return fmt.Errorf("memory insert upload reservation %s: duplicate id", reservation.ID)
+	}
+	repo.reservations[reservation.ID] = reservation
+
+	return nil
+}
+
+// GetReservation retrieves a direct upload reservation by image ID
+func (repo *memoryImageRepository) GetReservation(ctx context.Context, id string) (*UploadReservation, error) {
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+
+	reservation, ok := repo.reservations[id]
+	if !ok {
+		return nil, ErrUploadNotFound
+	}
+
+	return &reservation, nil
+}
+
+// DeleteReservation removes a direct upload reservation
+func (repo *memoryImageRepository) DeleteReservation(ctx context.Context, id string) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	if _, ok := repo.reservations[id]; !ok {
+		return ErrUploadNotFound
+	}
+	delete(repo.reservations, id)
+
+	return nil
+}
+
+// DeleteExpiredReservations removes the reservations that expired at or
+// before now and returns them
+func (repo *memoryImageRepository) DeleteExpiredReservations(ctx context.Context, now time.Time) ([]UploadReservation, error) {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	var expired []UploadReservation
+	for id, reservation := range repo.reservations {
+		if !reservation.ExpiresAt.After(now) {
+			expired = append(expired, reservation)
+			delete(repo.reservations, id)
+		}
+	}
+
+	return expired, nil
+}
+
+// SaveTusUpload records a new resumable upload
+func (repo *memoryImageRepository) SaveTusUpload(ctx context.Context, upload TusUpload) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	if _, exists := repo.tusUploads[upload.ID]; exists {
+		return fmt.Errorf("memory insert tus upload %s: duplicate id", upload.ID)
+	}
+	repo.tusUploads[upload.ID] = copyTusUpload(upload)
+
+	return nil
+}
+
+// GetTusUpload retrieves a resumable upload with its parts in order
+func (repo *memoryImageRepository) GetTusUpload(ctx context.Context, id string) (*TusUpload, error) {
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+
+	upload, ok := repo.tusUploads[id]
+	if !ok {
+		return nil, ErrUploadNotFound
+	}
+
+	upload = copyTusUpload(upload)
+	return &upload, nil
+}
+
+// UpdateTusUpload saves the progress of a resumable upload, failing with
+// ErrUploadConflict unless it is still at previousOffset
+func (repo *memoryImageRepository) UpdateTusUpload(ctx context.Context, upload TusUpload, previousOffset int64) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	stored, ok := repo.tusUploads[upload.ID]
+	if !ok {
+		return ErrUploadNotFound
+	}
+	if stored.Offset != previousOffset {
+		return ErrUploadConflict
+	}
+
+	upload.S3Key = stored.S3Key
+	upload.Length = stored.Length
+	upload.Metadata = stored.Metadata
+	upload.CreatedAt = stored.CreatedAt
+	repo.tusUploads[upload.ID] = copyTusUpload(upload)
+
+	return nil
+}
+
+// DeleteTusUpload removes a resumable upload
+func (repo *memoryImageRepository) DeleteTusUpload(ctx context.Context, id string) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	if _, ok := repo.tusUploads[id]; !ok {
+		return ErrUploadNotFound
+	}
+	delete(repo.tusUploads, id)
+
+	return nil
+}
+
+// DeleteExpiredTusUploads removes the resumable uploads that expired at or
+// before now and returns them without their parts
+func (repo *memoryImageRepository) DeleteExpiredTusUploads(ctx context.Context, now time.Time) ([]TusUpload, error) {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	var expired []TusUpload
+	for id, upload := range repo.tusUploads {
+		if !upload.ExpiresAt.After(now) {
+			upload.Parts = nil
+			expired = append(expired, upload)
+			delete(repo.tusUploads, id)
+		}
+	}
+
+	return expired, nil
+}
+
+// SaveShareLink records a new share link
+func (repo *memoryImageRepository) SaveShareLink(ctx context.Context, link ShareLink) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	if _, exists := repo.shareLinks[link.ID]; exists {
+		return fmt.Errorf("memory insert share link %s: duplicate id", link.ID)
+	}
+	if _, ok := repo.images[link.ImageID]; !ok {
+		return fmt.Errorf("memory insert share link %s: no image %s", link.ID, link.ImageID)
+	}
+	link.Protected = link.PasswordHash != ""
+	repo.shareLinks[link.ID] = link
+
+	return nil
+}
+
+// GetShareLink retrieves a share link by ID
+func (repo *memoryImageRepository) GetShareLink(ctx context.Context, id string) (*ShareLink, error) {
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+
+	link, ok := repo.shareLinks[id]
+	if !ok {
+		return nil, ErrShareLinkNotFound
+	}
+
+	return &link, nil
+}
+
+// ListShareLinks returns an image's share links, oldest first
+func (repo *memoryImageRepository) ListShareLinks(ctx context.Context, imageID string) ([]ShareLink, error) {
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+
+	var links []ShareLink
+	for _, link := range repo.shareLinks {
+		if link.ImageID == imageID {
+			links = append(links, link)
+		}
+	}
+	sort.Slice(links, func(i, j int) bool {
+		if !links[i].CreatedAt.Equal(links[j].CreatedAt) {
+			return links[i].CreatedAt.Before(links[j].CreatedAt)
+		}
+		return links[i].ID < links[j].ID
+	})
+
+	return links, nil
+}
+
+// DeleteShareLink revokes one of an image's share links
+func (repo *memoryImageRepository) DeleteShareLink(ctx context.Context, imageID, id string) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	if link, ok := repo.shareLinks[id]; !ok || link.ImageID != imageID {
+		return ErrShareLinkNotFound
+	}
+	delete(repo.shareLinks, id)
+
+	return nil
+}
+
+// RecordShareDownload counts a download through a share link that is still
+// valid at now and has downloads left
+func (repo *memoryImageRepository) RecordShareDownload(ctx context.Context, id string, now time.Time) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	link, ok := repo.shareLinks[id]
+	switch {
+	case !ok:
+		return ErrShareLinkNotFound
+	case !link.ExpiresAt.After(now):
+		return ErrShareLinkExpired
+	case link.MaxDownloads > 0 && link.Downloads >= link.MaxDownloads:
+		return ErrShareLinkExhausted
+	}
+	link.Downloads++
+	repo.shareLinks[id] = link
+
+	return nil
+}
+
+// copyTusUpload returns a copy of upload that shares no memory with it
+func copyTusUpload(upload TusUpload) TusUpload {
+	upload.Parts = append([]storage.CompletedPart(nil), upload.Parts...)
+	if upload.CompletedAt != nil {
+		completed := *upload.CompletedAt
+		upload.CompletedAt = &completed
+	}
+	return upload
+}
+
+// copyImage returns a copy of img that shares no slices with it, with
+// variants tagged with the image ID and ordered by width and tags sorted,
+// like the SQL implementations return them
+func copyImage(img ImageMetadata) ImageMetadata {
+	img.Tags = mergeTags(nil, img.Tags)
+	if len(img.Tags) == 0 {
+		img.Tags = nil
+	}
+
+	variants := make([]ImageVariant, len(img.Variants))
+	copy(variants, img.Variants)
+	for i := range variants {
+		variants[i].ImageID = img.ID
+	}
+	sort.SliceStable(variants, func(i, j int) bool {
+		return variants[i].Width < variants[j].Width
+	})
+
+	img.Variants = variants
+	if len(variants) == 0 {
+		img.Variants = nil
+	}
+
+	if img.TakenAt != nil {
+		takenAt := *img.TakenAt
+		img.TakenAt = &takenAt
+	}
+	if img.Latitude != nil && img.Longitude != nil {
+		latitude, longitude := *img.Latitude, *img.Longitude
+		img.Latitude, img.Longitude = &latitude, &longitude
+	}
+	return img
+}
+
+// compareImages orders images by (uploaded_at, id)
+func compareImages(a, b ImageMetadata) int {
+	return compareCursor(a, &pageCursor{UploadedAt: b.UploadedAt, ID: b.ID})
+}
+
+// compareCursor orders an image relative to a cursor position by (uploaded_at, id)
+func compareCursor(img ImageMetadata, cursor *pageCursor) int {
+	switch {
+	case img.UploadedAt.Before(cursor.UploadedAt):
+		return -1
+	case img.UploadedAt.After(cursor.UploadedAt):
+		return 1
+	case img.ID < cursor.ID:
+		return -1
+	case img.ID > cursor.ID:
+		return 1
+	default:
+		return 0
+	}
+}
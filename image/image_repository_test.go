@@ -0,0 +1,60 @@
+package image
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+
+	"file-pub/internal/database/dbtest"
+)
+
+func TestMemoryImageRepository(t *testing.T) {
+	testRepositoryConformance(t, func(t *testing.T) ImageRepository {
+		return NewMemoryImageRepository()
+	})
+}
+
+func TestMemoryImageRepositoryConcurrentAccess(t *testing.T) {
+	repo := NewMemoryImageRepository()
+	ctx := context.Background()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			id := fmt.Sprintf("img-%02d", i)
+			if err := repo.SaveImage(ctx, testImage(id, dbtest.Time(i))); err != nil {
+				t.Errorf("SaveImage %s: %v", id, err)
+			}
+			if _, err := repo.GetAllImages(ctx, ImageQuery{Limit: 5}); err != nil {
+				t.Errorf("GetAllImages: %v", err)
+			}
+			if _, err := repo.GetImageByID(ctx, id); err != nil {
+				t.Errorf("GetImageByID %s: %v", id, err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	page, err := repo.GetAllImages(ctx, ImageQuery{Limit: 5})
+	if err != nil {
+		t.Fatalf("GetAllImages: %v", err)
+	}
+	if page.Total != 20 {
+		t.Errorf("Total = %d, want 20", page.Total)
+	}
+}
+
+func TestSQLImageRepository(t *testing.T) {
+	for _, driver := range dbtest.Drivers {
+		t.Run(driver, func(t *testing.T) {
+			dbtest.SkipUnavailable(t, driver)
+			testRepositoryConformance(t, func(t *testing.T) ImageRepository {
+				db := dbtest.Open(t, driver, "album_images", "albums", "image_tags", "tags", "image_variants", "share_links", "images", "blobs", "upload_reservations", "tus_upload_parts", "tus_uploads")
+				return NewImageRepository(db, driver)
+			})
+		})
+	}
+}
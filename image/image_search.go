@@ -0,0 +1,140 @@
+package image
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	// maxSearchTerms caps how many words one search may contain
+	maxSearchTerms = 8
+	// maxSearchTermLength is the longest search word, in characters
+	maxSearchTermLength = 64
+)
+
+// searchWords splits text into lower-cased words of letters and digits
+func searchWords(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+}
+
+// searchTerms splits a search into words without duplicates. Punctuation
+// separates words, so the terms are safe to embed in every backend's
+// full-text query syntax.
+func searchTerms(search string) ([]string, error) {
+	var terms []string
+	for _, word := range searchWords(search) {
+		if utf8.RuneCountInString(word) > maxSearchTermLength {
+			return nil, fmt.Errorf("%w: %q is longer than %d characters", ErrInvalidSearch, word, maxSearchTermLength)
+		}
+		if !containsTag(terms, word) {
+			terms = append(terms, word)
+		}
+	}
+	if len(terms) > maxSearchTerms {
+		return nil, fmt.Errorf("%w: at most %d search words", ErrInvalidSearch, maxSearchTerms)
+	}
+
+	return terms, nil
+}
+
+// filterContentType accepts a stored content type such as "image/png" or
+// its short form "png", and returns the stored content type
+func filterContentType(value string) (string, error) {
+	contentType := normalizeContentType(value)
+	if !strings.Contains(contentType, "/") {
+		contentType = normalizeContentType("image/" + contentType)
+	}
+	if _, ok := imageExtensions[contentType]; !ok {
+		return "", fmt.Errorf("%w: unknown content type %q", ErrInvalidSearch, value)
+	}
+	return contentType, nil
+}
+
+// normalizeQuery validates the search and filters of a query and puts them
+// in the form the repositories expect
+func normalizeQuery(query ImageQuery) (ImageQuery, error) {
+	tags, err := normalizeTags(query.Tags)
+	if err != nil {
+		return ImageQuery{}, err
+	}
+	query.Tags = tags
+
+	terms, err := searchTerms(query.Search)
+	if err != nil {
+		return ImageQuery{}, err
+	}
+	query.Search = strings.Join(terms, " ")
+
+	var contentTypes []string
+	for _, value := range query.ContentTypes {
+		contentType, err := filterContentType(value)
+		if err != nil {
+			return ImageQuery{}, err
+		}
+		if !containsTag(contentTypes, contentType) {
+			contentTypes = append(contentTypes, contentType)
+		}
+	}
+	query.ContentTypes = contentTypes
+
+	if query.MinSize < 0 || query.MaxSize < 0 {
+		return ImageQuery{}, fmt.Errorf("%w: sizes cannot be negative", ErrInvalidSearch)
+	}
+	if query.MaxSize > 0 && query.MaxSize < query.MinSize {
+		return ImageQuery{}, fmt.Errorf("%w: max size is below min size", ErrInvalidSearch)
+	}
+	if !query.UploadedFrom.IsZero() && !query.UploadedTo.IsZero() && !query.UploadedTo.After(query.UploadedFrom) {
+		return ImageQuery{}, fmt.Errorf("%w: upload date range is empty", ErrInvalidSearch)
+	}
+
+	return query, nil
+}
+
+// matchesQuery reports whether an image passes a normalized query's search
+// and filters, for repositories that filter in Go
+func matchesQuery(img ImageMetadata, query ImageQuery) bool {
+	if !containsAllTags(img.Tags, query.Tags) {
+		return false
+	}
+	if len(query.ContentTypes) > 0 && !containsTag(query.ContentTypes, img.ContentType) {
+		return false
+	}
+	if img.Size < query.MinSize || (query.MaxSize > 0 && img.Size > query.MaxSize) {
+		return false
+	}
+	if !query.UploadedFrom.IsZero() && img.UploadedAt.Before(query.UploadedFrom) {
+		return false
+	}
+	if !query.UploadedTo.IsZero() && !img.UploadedAt.Before(query.UploadedTo) {
+		return false
+	}
+	if query.OwnerID != "" && img.OwnerID != query.OwnerID {
+		return false
+	}
+	if !visibleTo(img, query.ViewerID) {
+		return false
+	}
+
+	// Every search word must prefix a word of the text fields or a tag
+	words := searchWords(strings.Join([]string{img.OriginalName, img.Title, img.Description}, " "))
+	for _, term := range strings.Fields(query.Search) {
+		if !hasPrefixedWord(words, term) && !hasPrefixedWord(img.Tags, term) {
+			return false
+		}
+	}
+	return true
+}
+
+// hasPrefixedWord reports whether any of words starts with prefix
+func hasPrefixedWord(words []string, prefix string) bool {
+	for _, word := range words {
+		if strings.HasPrefix(word, prefix) {
+			return true
+		}
+	}
+	return false
+}
@@ -1,17 +1,18 @@
 package image
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
+	stdimage "image"
 	"io"
-	"path/filepath"
+	"log"
 	"time"
 
 	"file-pub/internal/common"
+	"file-pub/storage"
 
-	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/service/s3"
-	"github.com/aws/aws-sdk-go/service/s3/s3manager"
 	"github.com/google/uuid"
 )
 
@@ -28,120 +29,868 @@ var (
 
 // ImageService defines the interface for image business logic
 type ImageService interface {
-	GetAllImages(ctx context.Context) ([]ImageMetadata, error)
-	GetImageData(ctx context.Context, id string) ([]byte, string, error)
-	UploadImage(ctx context.Context, file io.Reader, filename, contentType string, size int64) (*ImageMetadata, error)
+	GetAllImages(ctx context.Context, query ImageQuery) (*ImagePage, error)
+	GetImage(ctx context.Context, id string) (*ImageMetadata, error)
+	GetImages(ctx context.Context, ids []string) ([]ImageMetadata, error)
+	UpdateImage(ctx context.Context, id string, update ImageUpdate) (*ImageMetadata, error)
+	GetImageData(ctx context.Context, id string) (*ImageObject, error)
+	GetThumbnail(ctx context.Context, id string, size int) (*ImageObject, error)
+	GetTransformedImage(ctx context.Context, id string, opts TransformOptions) (*ImageObject, error)
+	FindSimilarImages(ctx context.Context, id string, limit int) ([]SimilarImage, error)
+	UploadImage(ctx context.Context, file io.Reader, filename, contentType string, size int64, opts UploadOptions) (*ImageMetadata, error)
+	CreateDirectUpload(ctx context.Context, filename, contentType string, size int64) (*DirectUpload, error)
+	CompleteDirectUpload(ctx context.Context, id string, opts UploadOptions) (*ImageMetadata, error)
+	CreateTusUpload(ctx context.Context, length int64, metadata string) (*TusUpload, error)
+	GetTusUpload(ctx context.Context, id string) (*TusUpload, error)
+	WriteTusUpload(ctx context.Context, id string, offset int64, chunk io.Reader) (*TusUpload, error)
+	TerminateTusUpload(ctx context.Context, id string) error
+	CreateShareLink(ctx context.Context, imageID string, opts ShareLinkOptions) (*ShareLink, error)
+	ListShareLinks(ctx context.Context, imageID string) ([]ShareLink, error)
+	RevokeShareLink(ctx context.Context, imageID, linkID string) error
+	AuthorizeImage(ctx context.Context, id string, access ShareAccess) (*ShareLink, error)
+	RecordShareDownload(ctx context.Context, link *ShareLink) error
+	DeleteImage(ctx context.Context, id string) error
+	AddTags(ctx context.Context, id string, tags []string) (*ImageMetadata, error)
+	RemoveTags(ctx context.Context, id string, tags []string) (*ImageMetadata, error)
 	ValidateImageType(contentType string) error
+	MaxUploadSize() int64
 }
 
 // imageService implements ImageService
 type imageService struct {
-	imageRepo  ImageRepository
-	uploader   *s3manager.Uploader
-	downloader *s3manager.Downloader
-	s3Bucket   string
+	imageRepo ImageRepository
+	blobStore storage.BlobStore
+	config    Config
 }
 
 // NewImageService creates a new ImageService
 func NewImageService(
 	imageRepo ImageRepository,
-	uploader *s3manager.Uploader,
-	downloader *s3manager.Downloader,
-	s3Bucket string,
+	blobStore storage.BlobStore,
+	config Config,
 ) ImageService {
 	common.PanicOnInvalidDependencies("ImageService", map[string]interface{}{
-		"imageRepo":  imageRepo,
-		"uploader":   uploader,
-		"downloader": downloader,
+		"imageRepo": imageRepo,
+		"blobStore": blobStore,
 	})
 
-	if err := common.ValidateNonEmptyString(s3Bucket, "s3Bucket"); err != nil {
-		panic(fmt.Sprintf("ImageService: %v", err))
+	if config.MaxUploadSize <= 0 {
+		panic(fmt.Sprintf("ImageService: invalid max upload size %d", config.MaxUploadSize))
+	}
+
+	if config.DefaultPageSize <= 0 || config.MaxPageSize < config.DefaultPageSize {
+		panic(fmt.Sprintf("ImageService: invalid page sizes default=%d max=%d", config.DefaultPageSize, config.MaxPageSize))
+	}
+
+	if config.SimilarityThreshold < 0 || config.SimilarityThreshold > maxHashDistance {
+		panic(fmt.Sprintf("ImageService: invalid similarity threshold %d", config.SimilarityThreshold))
+	}
+
+	if config.DirectUploadExpiry <= 0 || config.TusUploadExpiry <= 0 {
+		panic(fmt.Sprintf("ImageService: invalid upload expiry direct=%s tus=%s", config.DirectUploadExpiry, config.TusUploadExpiry))
+	}
+
+	if config.MaxShareLinkExpiry <= 0 {
+		panic(fmt.Sprintf("ImageService: invalid max share link expiry %s", config.MaxShareLinkExpiry))
+	}
+
+	if len(config.ShareLinkSecret) == 0 {
+		panic("ImageService: missing share link secret")
 	}
 
 	return &imageService{
-		imageRepo:  imageRepo,
-		uploader:   uploader,
-		downloader: downloader,
-		s3Bucket:   s3Bucket,
+		imageRepo: imageRepo,
+		blobStore: blobStore,
+		config:    config,
 	}
 }
 
-// GetAllImages retrieves all images
-func (service *imageService) GetAllImages(ctx context.Context) ([]ImageMetadata, error) {
-	images, err := service.imageRepo.GetAllImages(ctx)
+// GetAllImages retrieves one page of images, applying the configured page size limits
+func (service *imageService) GetAllImages(ctx context.Context, query ImageQuery) (*ImagePage, error) {
+	if query.Limit <= 0 {
+		query.Limit = service.config.DefaultPageSize
+	}
+	if query.Limit > service.config.MaxPageSize {
+		query.Limit = service.config.MaxPageSize
+	}
+
+	query, err := normalizeQuery(query)
+	if err != nil {
+		return nil, err
+	}
+	query.ViewerID = viewerID(ctx)
+
+	page, err := service.imageRepo.GetAllImages(ctx, query)
 	if err != nil {
 		return nil, fmt.Errorf("getting all images: %w", err)
 	}
 
-	return images, nil
+	return page, nil
 }
 
-// GetImageData retrieves image data from S3 by ID
-func (service *imageService) GetImageData(ctx context.Context, id string) ([]byte, string, error) {
+// GetImage retrieves image metadata by ID. Other users' private images are
+// reported as not found.
+func (service *imageService) GetImage(ctx context.Context, id string) (*ImageMetadata, error) {
+	metadata, err := service.getVisibleImage(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	return metadata, nil
+}
+
+// GetImages retrieves the metadata of several images in the order the IDs are
+// listed, skipping IDs with no image and other users' private images
+func (service *imageService) GetImages(ctx context.Context, ids []string) ([]ImageMetadata, error) {
+	images, err := service.imageRepo.GetImagesByIDs(ctx, ids)
+	if err != nil {
+		return nil, fmt.Errorf("getting images by id: %w", err)
+	}
+
+	return visibleImages(images, viewerID(ctx)), nil
+}
+
+// FindSimilarImages returns up to limit images whose perceptual hashes are
+// within the similarity threshold of the image's, closest first. Images
+// without a hash have no similar images.
+func (service *imageService) FindSimilarImages(ctx context.Context, id string, limit int) ([]SimilarImage, error) {
+	if limit <= 0 {
+		limit = service.config.DefaultPageSize
+	}
+	if limit > service.config.MaxPageSize {
+		limit = service.config.MaxPageSize
+	}
+
+	metadata, err := service.getVisibleImage(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if metadata.PerceptualHash == "" {
+		return []SimilarImage{}, nil
+	}
+
+	hashes, err := service.imageRepo.ListPerceptualHashes(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("listing perceptual hashes: %w", err)
+	}
+	nearest := nearestHashes(hashes, metadata.PerceptualHash, id, service.config.SimilarityThreshold, limit)
+
+	ids := make([]string, len(nearest))
+	for i, match := range nearest {
+		ids[i] = match.ID
+	}
+	images, err := service.imageRepo.GetImagesByIDs(ctx, ids)
+	if err != nil {
+		return nil, fmt.Errorf("getting similar images: %w", err)
+	}
+	images = visibleImages(images, viewerID(ctx))
+
+	// Images deleted since the hashes were listed are skipped
+	distances := make(map[string]int, len(nearest))
+	for _, match := range nearest {
+		distances[match.ID] = match.Distance
+	}
+	similar := make([]SimilarImage, 0, len(images))
+	for _, image := range images {
+		similar = append(similar, SimilarImage{ImageMetadata: image, Distance: distances[image.ID]})
+	}
+
+	return similar, nil
+}
+
+// UpdateImage changes an image's title, description, alt text or privacy and returns
+// the updated metadata
+func (service *imageService) UpdateImage(ctx context.Context, id string, update ImageUpdate) (*ImageMetadata, error) {
+	metadata, err := service.getOwnedImage(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	title, description, altText := metadata.Title, metadata.Description, metadata.AltText
+	if update.Title != nil {
+		title = *update.Title
+	}
+	if update.Description != nil {
+		description = *update.Description
+	}
+	if update.AltText != nil {
+		altText = *update.AltText
+	}
+	if update.Private != nil {
+		metadata.Private = *update.Private
+	}
+	if err := setDetails(metadata, title, description, altText); err != nil {
+		return nil, err
+	}
+
+	if err := service.imageRepo.UpdateImage(ctx, *metadata); err != nil {
+		return nil, fmt.Errorf("updating image metadata: %w", err)
+	}
+
+	return metadata, nil
+}
+
+// GetImageData opens the image object in the blob store by ID.
+// The returned Body fetches bytes lazily so callers can serve byte ranges;
+// the caller must close it.
+func (service *imageService) GetImageData(ctx context.Context, id string) (*ImageObject, error) {
 	// Get image metadata from database
 	metadata, err := service.imageRepo.GetImageByID(ctx, id)
 	if err != nil {
-		return nil, "", fmt.Errorf("getting image metadata: %w", err)
+		return nil, fmt.Errorf("getting image metadata: %w", err)
 	}
 
-	// Download image from S3
-	buffer := aws.NewWriteAtBuffer([]byte{})
-	_, err = service.downloader.DownloadWithContext(ctx, buffer, &s3.GetObjectInput{
-		Bucket: aws.String(service.s3Bucket),
-		Key:    aws.String(metadata.S3Key),
-	})
+	return service.openImage(ctx, metadata)
+}
+
+// openImage opens the original object described by metadata
+func (service *imageService) openImage(ctx context.Context, metadata *ImageMetadata) (*ImageObject, error) {
+	// Confirm the object exists and learn its exact size
+	info, err := service.blobStore.Head(ctx, metadata.S3Key)
 	if err != nil {
-		return nil, "", common.WrapS3Error("download", service.s3Bucket, metadata.S3Key, err)
+		return nil, fmt.Errorf("fetching image object: %w", err)
 	}
 
-	return buffer.Bytes(), metadata.ContentType, nil
+	return &ImageObject{
+		Body:         storage.NewObjectReader(ctx, service.blobStore, metadata.S3Key, info.Size),
+		Metadata:     *metadata,
+		ContentType:  metadata.ContentType,
+		Size:         info.Size,
+		ETag:         checksumETag(metadata.Checksum),
+		LastModified: metadata.UploadedAt,
+	}, nil
 }
 
-// UploadImage uploads an image to S3 and saves metadata to database
-func (service *imageService) UploadImage(ctx context.Context, file io.Reader, filename, contentType string, size int64) (*ImageMetadata, error) {
-	// Validate content type
-	if err := service.ValidateImageType(contentType); err != nil {
+// UploadImage uploads an image and its resized variants to the blob store and
+// saves metadata to database. The stored content type is detected from the
+// file itself; contentType is only the client's claim and must agree with it.
+func (service *imageService) UploadImage(ctx context.Context, file io.Reader, filename, contentType string, size int64, opts UploadOptions) (*ImageMetadata, error) {
+	return service.createImage(ctx, uuid.New().String(), viewerID(ctx), file, "", filename, contentType, size, opts)
+}
+
+// createImage stores an uploaded image under the given image ID, owned by
+// the user with ownerID, or by nobody when it is empty. sourceKey, when not
+// empty, names the object file was read from, so stores that can copy
+// objects copy it rather than receiving the same bytes again.
+func (service *imageService) createImage(ctx context.Context, id, ownerID string, file io.Reader, sourceKey, filename, contentType string, size int64, opts UploadOptions) (*ImageMetadata, error) {
+	tags, details, err := uploadDetails(opts)
+	if err != nil {
 		return nil, err
 	}
 
-	// Generate unique ID and filename
-	id := uuid.New().String()
-	ext := filepath.Ext(filename)
-	uniqueFilename := id + ext
-	s3Key := "uploads/" + uniqueFilename
+	// Reject declared sizes early; the real size is enforced while spooling
+	largestLimit := service.config.largestSizeLimit()
+	if size > largestLimit {
+		return nil, fmt.Errorf("%w: upload of %d bytes exceeds %d bytes", ErrFileTooLarge, size, largestLimit)
+	}
 
-	// Upload to S3
-	uploadResult, err := service.uploader.UploadWithContext(ctx, &s3manager.UploadInput{
-		Bucket:      aws.String(service.s3Bucket),
-		Key:         aws.String(s3Key),
-		Body:        file,
-		ContentType: aws.String(contentType),
-	})
+	// Spool to a temporary file so the upload can be read more than once
+	upload, err := spoolUpload(file, largestLimit)
+	if err != nil {
+		return nil, err
+	}
+	defer upload.Close()
+
+	// Determine the real type from the content rather than trusting the client
+	body, err := upload.Reader()
+	if err != nil {
+		return nil, err
+	}
+	detectedType, err := detectImageType(body)
 	if err != nil {
-		return nil, common.WrapS3Error("upload", service.s3Bucket, s3Key, err)
+		return nil, err
+	}
+	if err := service.ValidateImageType(detectedType); err != nil {
+		return nil, err
+	}
+	if err := checkDeclaredType(contentType, detectedType); err != nil {
+		return nil, err
 	}
+	contentType = detectedType
+
+	if limit := service.config.sizeLimit(contentType); upload.size > limit {
+		return nil, fmt.Errorf("%w: %s upload of %d bytes exceeds %d bytes", ErrFileTooLarge, contentType, upload.size, limit)
+	}
+
+	uniqueFilename := id + imageExtensions[contentType]
 
 	// Create metadata
 	metadata := ImageMetadata{
 		ID:           id,
 		Filename:     uniqueFilename,
 		OriginalName: filename,
-		S3Key:        s3Key,
-		S3URL:        uploadResult.Location,
+		Title:        details.Title,
+		Description:  details.Description,
+		AltText:      details.AltText,
 		ContentType:  contentType,
-		Size:         size,
+		Size:         upload.size,
+		Checksum:     upload.checksum,
 		UploadedAt:   time.Now(),
+		Tags:         tags,
+		OwnerID:      ownerID,
+	}
+
+	// Unreadable EXIF data should not cost the user their upload
+	body, err = upload.Reader()
+	if err != nil {
+		return nil, err
+	}
+	if err := extractMetadata(body, contentType, &metadata); err != nil {
+		log.Printf("Skipping EXIF metadata for image %s: %v", id, err)
+	}
+
+	// Serve a copy without metadata when asked to, keeping the upload aside
+	original := upload
+	strip := service.config.StripMetadata
+	if opts.StripMetadata != nil {
+		strip = *opts.StripMetadata
+	}
+	if strip {
+		stripped, applied, err := stripMetadata(upload, contentType, metadata.Orientation)
+		if err != nil {
+			return nil, err
+		}
+		defer stripped.Close()
+
+		upload = stripped
+		metadata.Size = stripped.size
+		metadata.Checksum = stripped.checksum
+		if applied {
+			if metadata.Orientation >= 5 {
+				metadata.Width, metadata.Height = metadata.Height, metadata.Width
+			}
+			metadata.Orientation = 0
+		}
+		// The position is what stripping protects; do not publish it either
+		metadata.Latitude, metadata.Longitude = nil, nil
+	}
+
+	// Only an unchanged upload can be copied from where it was uploaded
+	blobSource := sourceKey
+	if upload.checksum != original.checksum {
+		blobSource = ""
+	}
+
+	// Identical content shares one blob keyed by its SHA-256, and duplicates
+	// reuse its variants; the repository counts the references to each blob
+	metadata.S3Key = "uploads/" + metadata.Checksum + imageExtensions[contentType]
+	var storedKeys []string
+	existing, err := service.imageRepo.FindImageByChecksum(ctx, metadata.Checksum)
+	switch {
+	case err == nil && existing.S3Key == metadata.S3Key:
+		metadata.S3URL = existing.S3URL
+		metadata.Variants = existing.Variants
+		metadata.PerceptualHash = existing.PerceptualHash
+	case err == nil || errors.Is(err, ErrImageNotFound):
+		if storedKeys, err = service.storeBlob(ctx, upload, blobSource, &metadata); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("looking up duplicate image: %w", err)
+	}
+
+	// The unmodified upload may be shared too, so it is not cleaned up below
+	if strip && service.config.KeepOriginals {
+		originalKey := "originals/" + original.checksum + imageExtensions[contentType]
+		if _, err := service.putUpload(ctx, originalKey, original, sourceKey, contentType); err != nil {
+			service.deleteObjects(ctx, storedKeys)
+			return nil, fmt.Errorf("storing unmodified original: %w", err)
+		}
+		metadata.OriginalKey = originalKey
+	}
+
+	// Look for near-duplicates before this image is saved so it is not
+	// reported as similar to itself
+	var nearDuplicates []NearDuplicate
+	if service.config.WarnNearDuplicates && metadata.PerceptualHash != "" {
+		var err error
+		nearDuplicates, err = service.findNearDuplicates(ctx, id, metadata.PerceptualHash, ownerID)
+		if err != nil {
+			log.Printf("Skipping near-duplicate check for image %s: %v", id, err)
+		}
 	}
 
 	// Save metadata to database
 	if err := service.imageRepo.SaveImage(ctx, metadata); err != nil {
+		service.deleteObjects(ctx, storedKeys)
 		return nil, fmt.Errorf("saving image metadata: %w", err)
 	}
 
+	// A delete of the last other image with this content may have released
+	// the blob since the lookup. Now that this image holds a reference
+	// nothing else can remove it, so store it again if it is gone.
+	if _, err := service.blobStore.Head(ctx, metadata.S3Key); errors.Is(err, storage.ErrObjectNotFound) {
+		log.Printf("Blob %s of image %s was released during upload, storing it again", metadata.S3Key, id)
+		if _, err := service.storeBlob(ctx, upload, blobSource, &metadata); err != nil {
+			if deleteErr := service.DeleteImage(ctx, id); deleteErr != nil {
+				log.Printf("Failed to remove image %s after a failed upload: %v", id, deleteErr)
+			}
+			return nil, err
+		}
+	}
+
+	metadata.NearDuplicates = nearDuplicates
 	return &metadata, nil
 }
 
+// findNearDuplicates returns the existing images whose perceptual hashes are
+// within the similarity threshold of hash, leaving out private images the
+// uploader cannot see so the warning does not reveal them
+func (service *imageService) findNearDuplicates(ctx context.Context, id, hash, ownerID string) ([]NearDuplicate, error) {
+	hashes, err := service.imageRepo.ListPerceptualHashes(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("listing perceptual hashes: %w", err)
+	}
+	nearest := nearestHashes(hashes, hash, id, service.config.SimilarityThreshold, maxNearDuplicateWarnings)
+	if len(nearest) == 0 {
+		return nil, nil
+	}
+
+	ids := make([]string, len(nearest))
+	for i, match := range nearest {
+		ids[i] = match.ID
+	}
+	images, err := service.imageRepo.GetImagesByIDs(ctx, ids)
+	if err != nil {
+		return nil, fmt.Errorf("getting near-duplicate images: %w", err)
+	}
+
+	visible := make(map[string]bool, len(images))
+	for _, image := range visibleImages(images, ownerID) {
+		visible[image.ID] = true
+	}
+	var nearDuplicates []NearDuplicate
+	for _, match := range nearest {
+		if visible[match.ID] {
+			nearDuplicates = append(nearDuplicates, match)
+		}
+	}
+
+	return nearDuplicates, nil
+}
+
+// uploadDetails validates the tags and details chosen for an upload,
+// returning the normalized tags and the details set on an empty metadata
+func uploadDetails(opts UploadOptions) ([]string, ImageMetadata, error) {
+	var details ImageMetadata
+	tags, err := normalizeTags(opts.Tags)
+	if err != nil {
+		return nil, details, err
+	}
+	if len(tags) > maxTagsPerImage {
+		return nil, details, fmt.Errorf("%w: at most %d tags per image", ErrInvalidTag, maxTagsPerImage)
+	}
+	if err := setDetails(&details, opts.Title, opts.Description, opts.AltText); err != nil {
+		return nil, details, err
+	}
+	return tags, details, nil
+}
+
+// storeBlob stores the served image at metadata.S3Key together with its
+// variants, returning the keys it stored. sourceKey is as for putUpload.
+func (service *imageService) storeBlob(ctx context.Context, upload *spooledUpload, sourceKey string, metadata *ImageMetadata) ([]string, error) {
+	object, err := service.putUpload(ctx, metadata.S3Key, upload, sourceKey, metadata.ContentType)
+	if err != nil {
+		return nil, fmt.Errorf("storing image object: %w", err)
+	}
+	metadata.S3URL = object.Location
+	storedKeys := []string{metadata.S3Key}
+
+	// Decode once for the perceptual hash and the resized variants; failures
+	// here are not fatal because the original can always be served in place
+	// of a missing variant
+	body, err := upload.Reader()
+	if err != nil {
+		return storedKeys, err
+	}
+	src, _, err := decodeImage(body)
+	if err != nil {
+		log.Printf("Skipping perceptual hash and variants for image %s: %v", metadata.ID, err)
+		return storedKeys, nil
+	}
+	src = applyOrientation(src, metadata.Orientation)
+	metadata.PerceptualHash = perceptualHash(src)
+
+	variants, err := service.createVariants(ctx, metadata, src)
+	if err != nil {
+		log.Printf("Skipping variants for image %s: %v", metadata.ID, err)
+	}
+	for _, variant := range variants {
+		storedKeys = append(storedKeys, variant.S3Key)
+	}
+	metadata.Variants = variants
+
+	return storedKeys, nil
+}
+
+// putUpload stores a spooled upload under key. When sourceKey names an
+// object holding the same bytes and the store can copy objects, the object is
+// copied within the store instead of being uploaded again.
+func (service *imageService) putUpload(ctx context.Context, key string, upload *spooledUpload, sourceKey, contentType string) (*storage.ObjectInfo, error) {
+	if copier, ok := service.blobStore.(storage.Copier); ok && sourceKey != "" {
+		return copier.Copy(ctx, sourceKey, key, contentType)
+	}
+
+	body, err := upload.Reader()
+	if err != nil {
+		return nil, err
+	}
+	return service.blobStore.Put(ctx, key, body, contentType)
+}
+
+// createVariants stores one resized variant of the decoded and oriented
+// image per configured size. Variants are keyed by content checksum like the
+// blob they are made from.
+func (service *imageService) createVariants(ctx context.Context, metadata *ImageMetadata, src stdimage.Image) ([]ImageVariant, error) {
+	if len(service.config.ThumbnailSizes) == 0 {
+		return nil, nil
+	}
+
+	encoded, err := generateVariants(src, service.config.ThumbnailSizes)
+	if err != nil {
+		return nil, err
+	}
+
+	var variants []ImageVariant
+	for _, variant := range encoded {
+		variant.ImageID = metadata.ID
+		variant.S3Key = "variants/" + metadata.Checksum + "/" + variant.Name + variantExtension(variant.ContentType)
+
+		if _, err := service.blobStore.Put(ctx, variant.S3Key, bytes.NewReader(variant.data), variant.ContentType); err != nil {
+			return variants, fmt.Errorf("storing %s variant: %w", variant.Name, err)
+		}
+		variants = append(variants, variant.ImageVariant)
+	}
+
+	return variants, nil
+}
+
+// GetThumbnail opens the smallest variant that is at least size pixels on
+// its longer side (the smallest variant when size is 0), falling back to
+// the original when no variant is large enough
+func (service *imageService) GetThumbnail(ctx context.Context, id string, size int) (*ImageObject, error) {
+	metadata, err := service.imageRepo.GetImageByID(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("getting image metadata: %w", err)
+	}
+
+	variant := selectVariant(metadata.Variants, size)
+	if variant == nil {
+		return service.openImage(ctx, metadata)
+	}
+
+	info, err := service.blobStore.Head(ctx, variant.S3Key)
+	if err != nil {
+		if errors.Is(err, storage.ErrObjectNotFound) {
+			return service.openImage(ctx, metadata)
+		}
+		return nil, fmt.Errorf("fetching variant object: %w", err)
+	}
+
+	etag := ""
+	if metadata.Checksum != "" {
+		etag = `"` + metadata.Checksum + "-" + variant.Name + `"`
+	}
+
+	return &ImageObject{
+		Body:         storage.NewObjectReader(ctx, service.blobStore, variant.S3Key, info.Size),
+		Metadata:     *metadata,
+		ContentType:  variant.ContentType,
+		Size:         info.Size,
+		ETag:         etag,
+		LastModified: metadata.UploadedAt,
+	}, nil
+}
+
+// GetTransformedImage opens a resized, cropped and re-encoded rendition of an
+// image. Renditions are cached in the blob store under derived/{id}/, keyed by
+// the transform parameters, so each one is only rendered once.
+func (service *imageService) GetTransformedImage(ctx context.Context, id string, opts TransformOptions) (*ImageObject, error) {
+	if err := opts.validate(service.config); err != nil {
+		return nil, err
+	}
+
+	metadata, err := service.imageRepo.GetImageByID(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("getting image metadata: %w", err)
+	}
+
+	// The output format decides whether the quality matters
+	opts = opts.withDefaultFormat(metadata.ContentType)
+	if err := opts.validateQuality(service.config); err != nil {
+		return nil, err
+	}
+	contentType := "image/" + opts.Format
+	cacheKey := derivedPrefix(id) + opts.cacheName()
+	etag := ""
+	if metadata.Checksum != "" {
+		etag = `"` + metadata.Checksum + "-" + opts.cacheName() + `"`
+	}
+
+	// Serve the cached rendition when it exists
+	info, err := service.blobStore.Head(ctx, cacheKey)
+	if err == nil {
+		return &ImageObject{
+			Body:         storage.NewObjectReader(ctx, service.blobStore, cacheKey, info.Size),
+			Metadata:     *metadata,
+			ContentType:  contentType,
+			Size:         info.Size,
+			ETag:         etag,
+			LastModified: metadata.UploadedAt,
+		}, nil
+	}
+	if !errors.Is(err, storage.ErrObjectNotFound) {
+		return nil, fmt.Errorf("checking derived object: %w", err)
+	}
+
+	// Render from the original
+	data, err := service.renderTransform(ctx, metadata, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := service.blobStore.Put(ctx, cacheKey, bytes.NewReader(data), contentType); err != nil {
+		// The rendition can still be served; it will be rendered again next time
+		log.Printf("Failed to cache derived image %s: %v", cacheKey, err)
+	}
+
+	return &ImageObject{
+		Body:         nopSeekCloser{bytes.NewReader(data)},
+		Metadata:     *metadata,
+		ContentType:  contentType,
+		Size:         int64(len(data)),
+		ETag:         etag,
+		LastModified: metadata.UploadedAt,
+	}, nil
+}
+
+// renderTransform downloads the original and applies opts to it
+func (service *imageService) renderTransform(ctx context.Context, metadata *ImageMetadata, opts TransformOptions) ([]byte, error) {
+	body, _, err := service.blobStore.Get(ctx, metadata.S3Key)
+	if err != nil {
+		return nil, fmt.Errorf("fetching image object: %w", err)
+	}
+	defer body.Close()
+
+	// Decoding needs random access, so spool the original to disk first
+	original, err := spoolUpload(body, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer original.Close()
+
+	reader, err := original.Reader()
+	if err != nil {
+		return nil, err
+	}
+	src, _, err := decodeImage(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	data, _, err := encodeImage(transformImage(src, opts), opts.Format, opts.Quality)
+	if err != nil {
+		return nil, fmt.Errorf("encoding transformed image: %w", err)
+	}
+	return data, nil
+}
+
+// derivedPrefix is the blob store prefix of an image's cached renditions
+func derivedPrefix(id string) string {
+	return "derived/" + id + "/"
+}
+
+// selectVariant picks the smallest variant whose longer side is at least size
+func selectVariant(variants []ImageVariant, size int) *ImageVariant {
+	var best *ImageVariant
+	for i := range variants {
+		variant := &variants[i]
+		if max(variant.Width, variant.Height) < size {
+			continue
+		}
+		if best == nil || variant.Width*variant.Height < best.Width*best.Height {
+			best = variant
+		}
+	}
+	return best
+}
+
+// deleteObjects removes objects on a best-effort basis, logging failures
+func (service *imageService) deleteObjects(ctx context.Context, keys []string) {
+	for _, key := range keys {
+		if err := service.blobStore.Delete(ctx, key); err != nil && !errors.Is(err, storage.ErrObjectNotFound) {
+			log.Printf("Failed to delete orphaned object %s: %v", key, err)
+		}
+	}
+}
+
+// DeleteImage removes an image's metadata and drops its references to
+// blobs. A blob, with its variants, is deleted from the blob store only when
+// no other image has the same content, and before the deletion is committed:
+// if that fails nothing has changed and the image is still served. If a
+// blob is gone but the rows cannot be removed, ErrImageDeleteIncomplete is
+// returned; retrying is safe because a missing object is not treated as an
+// error.
+func (service *imageService) DeleteImage(ctx context.Context, id string) error {
+	metadata, err := service.getOwnedImage(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	released := false
+	err = service.imageRepo.DeleteImage(ctx, id, func(key string) error {
+		if err := service.blobStore.Delete(ctx, key); err != nil && !errors.Is(err, storage.ErrObjectNotFound) {
+			if key == metadata.OriginalKey {
+				return fmt.Errorf("deleting unmodified original: %w", err)
+			}
+			return fmt.Errorf("deleting image object: %w", err)
+		}
+		released = true
+
+		// Variants are derived data; a leftover variant object is only wasted space
+		if key == metadata.S3Key {
+			var variantKeys []string
+			for _, variant := range metadata.Variants {
+				variantKeys = append(variantKeys, variant.S3Key)
+			}
+			service.deleteObjects(ctx, variantKeys)
+		}
+		return nil
+	})
+	if err != nil {
+		if errors.Is(err, ErrImageNotFound) {
+			// Deleted concurrently; the end state is what the caller asked for
+			return nil
+		}
+		if released {
+			return fmt.Errorf("%w: deleting image metadata: %v", ErrImageDeleteIncomplete, err)
+		}
+		return err
+	}
+
+	// Transformed renditions are cached per image
+	derived, err := service.blobStore.List(ctx, derivedPrefix(id))
+	if err != nil {
+		log.Printf("Failed to list derived objects of image %s: %v", id, err)
+	}
+	var derivedKeys []string
+	for _, object := range derived {
+		derivedKeys = append(derivedKeys, object.Key)
+	}
+	service.deleteObjects(ctx, derivedKeys)
+
+	return nil
+}
+
+// AddTags attaches tags to an image and returns its updated metadata
+func (service *imageService) AddTags(ctx context.Context, id string, tags []string) (*ImageMetadata, error) {
+	tags, err := normalizeTags(tags)
+	if err != nil {
+		return nil, err
+	}
+
+	metadata, err := service.getOwnedImage(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if len(mergeTags(metadata.Tags, tags)) > maxTagsPerImage {
+		return nil, fmt.Errorf("%w: at most %d tags per image", ErrInvalidTag, maxTagsPerImage)
+	}
+
+	if err := service.imageRepo.AddTags(ctx, id, tags); err != nil {
+		return nil, fmt.Errorf("tagging image: %w", err)
+	}
+
+	return service.GetImage(ctx, id)
+}
+
+// RemoveTags detaches tags from an image and returns its updated metadata
+func (service *imageService) RemoveTags(ctx context.Context, id string, tags []string) (*ImageMetadata, error) {
+	tags, err := normalizeTags(tags)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := service.getOwnedImage(ctx, id); err != nil {
+		return nil, err
+	}
+
+	if err := service.imageRepo.RemoveTags(ctx, id, tags); err != nil {
+		return nil, fmt.Errorf("untagging image: %w", err)
+	}
+
+	return service.GetImage(ctx, id)
+}
+
+// getOwnedImage returns an image's metadata when the request's user may
+// change it. Owned images may only be changed by the user who uploaded them,
+// images without an owner by anyone when Config.ChangeUnowned is set.
+func (service *imageService) getOwnedImage(ctx context.Context, id string) (*ImageMetadata, error) {
+	metadata, err := service.imageRepo.GetImageByID(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("getting image metadata: %w", err)
+	}
+	if metadata.OwnerID == "" {
+		if !service.config.ChangeUnowned {
+			return nil, ErrNotImageOwner
+		}
+		return metadata, nil
+	}
+	if identity, ok := common.IdentityFromContext(ctx); !ok || identity.ID != metadata.OwnerID {
+		return nil, ErrNotImageOwner
+	}
+	return metadata, nil
+}
+
+// checkUploadOwner fails with ErrNotUploadOwner unless the request's user
+// started the upload owned by ownerID. Like images, uploads without an owner
+// may be continued by anyone.
+func checkUploadOwner(ctx context.Context, ownerID string) error {
+	if ownerID != "" && viewerID(ctx) != ownerID {
+		return ErrNotUploadOwner
+	}
+	return nil
+}
+
+// getVisibleImage returns an image's metadata when the request's user may
+// see it, and ErrImageNotFound for other users' private images
+func (service *imageService) getVisibleImage(ctx context.Context, id string) (*ImageMetadata, error) {
+	metadata, err := service.imageRepo.GetImageByID(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("getting image metadata: %w", err)
+	}
+	if !visibleTo(*metadata, viewerID(ctx)) {
+		return nil, ErrImageNotFound
+	}
+	return metadata, nil
+}
+
+// visibleTo reports whether the user with the given ID, or a signed-out
+// visitor when it is empty, may see an image's metadata. Private images are
+// shown to their owner only, like their files; private images without an
+// owner are only reachable through share links.
+func visibleTo(img ImageMetadata, userID string) bool {
+	return !img.Private || (img.OwnerID != "" && img.OwnerID == userID)
+}
+
+// visibleImages keeps the images the user with the given ID may see
+func visibleImages(images []ImageMetadata, userID string) []ImageMetadata {
+	visible := images[:0]
+	for _, img := range images {
+		if visibleTo(img, userID) {
+			visible = append(visible, img)
+		}
+	}
+	return visible
+}
+
+// viewerID returns the ID of the request's user, or "" when signed out
+func viewerID(ctx context.Context) string {
+	if identity, ok := common.IdentityFromContext(ctx); ok {
+		return identity.ID
+	}
+	return ""
+}
+
 // ValidateImageType validates if the content type is an allowed image type
 func (service *imageService) ValidateImageType(contentType string) error {
 	if !validImageTypes[contentType] {
@@ -149,3 +898,27 @@ func (service *imageService) ValidateImageType(contentType string) error {
 	}
 	return nil
 }
+
+// MaxUploadSize returns the largest upload, in bytes, that any content type may have
+func (service *imageService) MaxUploadSize() int64 {
+	return service.config.largestSizeLimit()
+}
+
+// checksumETag formats a stored checksum as a strong HTTP entity tag.
+// Images uploaded before checksums were recorded get no ETag.
+func checksumETag(checksum string) string {
+	if checksum == "" {
+		return ""
+	}
+	return `"` + checksum + `"`
+}
+
+// nopSeekCloser adds a no-op Close to an io.ReadSeeker
+type nopSeekCloser struct {
+	io.ReadSeeker
+}
+
+// Close implements io.Closer
+func (nopSeekCloser) Close() error {
+	return nil
+}
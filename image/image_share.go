@@ -0,0 +1,187 @@
+package image
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+
+	"file-pub/internal/common"
+
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// maxSharePasswordLength is the longest password bcrypt accepts, in bytes
+const maxSharePasswordLength = 72
+
+// CreateShareLink creates a signed link that opens the image until
+// opts.ExpiresAt, at most opts.MaxDownloads times when that is positive and
+// only with opts.Password when one is given
+func (service *imageService) CreateShareLink(ctx context.Context, imageID string, opts ShareLinkOptions) (*ShareLink, error) {
+	if _, err := service.getOwnedImage(ctx, imageID); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	if !opts.ExpiresAt.After(now) || opts.ExpiresAt.After(now.Add(service.config.MaxShareLinkExpiry)) {
+		return nil, fmt.Errorf("%w: expiry must be within %s from now", ErrInvalidShareLink, service.config.MaxShareLinkExpiry)
+	}
+	if opts.MaxDownloads < 0 {
+		return nil, fmt.Errorf("%w: max downloads must not be negative", ErrInvalidShareLink)
+	}
+	if len(opts.Password) > maxSharePasswordLength {
+		return nil, fmt.Errorf("%w: password must be at most %d bytes", ErrInvalidShareLink, maxSharePasswordLength)
+	}
+
+	// The expiry is signed in whole seconds, which every database stores exactly
+	link := ShareLink{
+		ID:           uuid.New().String(),
+		ImageID:      imageID,
+		ExpiresAt:    opts.ExpiresAt.UTC().Truncate(time.Second),
+		MaxDownloads: opts.MaxDownloads,
+		CreatedAt:    now,
+	}
+	if opts.Password != "" {
+		hash, err := bcrypt.GenerateFromPassword([]byte(opts.Password), bcrypt.DefaultCost)
+		if err != nil {
+			return nil, fmt.Errorf("hashing share link password: %w", err)
+		}
+		link.PasswordHash = string(hash)
+		link.Protected = true
+	}
+
+	if err := service.imageRepo.SaveShareLink(ctx, link); err != nil {
+		return nil, fmt.Errorf("saving share link: %w", err)
+	}
+
+	link.URL = service.shareURL(link)
+	return &link, nil
+}
+
+// ListShareLinks returns an image's share links, expired ones included,
+// oldest first
+func (service *imageService) ListShareLinks(ctx context.Context, imageID string) ([]ShareLink, error) {
+	if _, err := service.getOwnedImage(ctx, imageID); err != nil {
+		return nil, err
+	}
+
+	links, err := service.imageRepo.ListShareLinks(ctx, imageID)
+	if err != nil {
+		return nil, fmt.Errorf("listing share links: %w", err)
+	}
+	for i := range links {
+		links[i].URL = service.shareURL(links[i])
+	}
+
+	return links, nil
+}
+
+// RevokeShareLink deletes one of an image's share links
+func (service *imageService) RevokeShareLink(ctx context.Context, imageID, linkID string) error {
+	if _, err := service.getOwnedImage(ctx, imageID); err != nil {
+		return err
+	}
+	return service.imageRepo.DeleteShareLink(ctx, imageID, linkID)
+}
+
+// AuthorizeImage decides whether an image may be served. Public images
+// always may, and so may private images to their owner; the returned link is
+// then nil. Anyone else needs a share
+// link for it that is correctly signed, not revoked or expired, has
+// downloads left and, when protected, comes with its password or unlock
+// token; without any link it is reported as not found. A link opened with
+// its password carries the unlock token for later requests.
+func (service *imageService) AuthorizeImage(ctx context.Context, id string, access ShareAccess) (*ShareLink, error) {
+	metadata, err := service.imageRepo.GetImageByID(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("getting image metadata: %w", err)
+	}
+	if !metadata.Private {
+		return nil, nil
+	}
+	if identity, ok := common.IdentityFromContext(ctx); ok && metadata.OwnerID != "" && identity.ID == metadata.OwnerID {
+		return nil, nil
+	}
+	if access.LinkID == "" {
+		return nil, ErrImageNotFound
+	}
+
+	// Check the signature before looking up the link
+	expires, err := strconv.ParseInt(access.Expires, 10, 64)
+	if err != nil || !hmac.Equal([]byte(access.Signature), []byte(service.shareSignature(id, access.LinkID, expires))) {
+		return nil, ErrShareLinkNotFound
+	}
+	if time.Now().Unix() >= expires {
+		return nil, ErrShareLinkExpired
+	}
+
+	link, err := service.imageRepo.GetShareLink(ctx, access.LinkID)
+	if err != nil {
+		return nil, err
+	}
+	if link.ImageID != id || link.ExpiresAt.Unix() != expires {
+		return nil, ErrShareLinkNotFound
+	}
+	if link.MaxDownloads > 0 && link.Downloads >= link.MaxDownloads {
+		return nil, ErrShareLinkExhausted
+	}
+
+	if link.Protected {
+		token := service.unlockToken(*link)
+		switch {
+		case access.UnlockToken != "" && hmac.Equal([]byte(access.UnlockToken), []byte(token)):
+		case access.Password != "" && bcrypt.CompareHashAndPassword([]byte(link.PasswordHash), []byte(access.Password)) == nil:
+			link.UnlockToken = token
+		default:
+			return nil, ErrSharePasswordRequired
+		}
+	}
+
+	link.URL = service.shareURL(*link)
+	return link, nil
+}
+
+// RecordShareDownload counts a download against a link returned by
+// AuthorizeImage. It fails with ErrShareLinkExhausted or ErrShareLinkExpired
+// when the link ran out since it was authorized.
+func (service *imageService) RecordShareDownload(ctx context.Context, link *ShareLink) error {
+	if err := service.imageRepo.RecordShareDownload(ctx, link.ID, time.Now()); err != nil {
+		return err
+	}
+	link.Downloads++
+	return nil
+}
+
+// shareURL returns the signed path that opens a link's image
+func (service *imageService) shareURL(link ShareLink) string {
+	expires := link.ExpiresAt.Unix()
+	query := url.Values{
+		"share":   {link.ID},
+		"expires": {strconv.FormatInt(expires, 10)},
+		"sig":     {service.shareSignature(link.ImageID, link.ID, expires)},
+	}
+	return "/image/" + url.PathEscape(link.ImageID) + "?" + query.Encode()
+}
+
+// shareSignature signs the image, link and expiry of a share URL
+func (service *imageService) shareSignature(imageID, linkID string, expires int64) string {
+	return service.sign(fmt.Sprintf("share\n%s\n%s\n%d", imageID, linkID, expires))
+}
+
+// unlockToken proves a protected link's password was given; it changes, and
+// old tokens stop working, if the link is recreated with another password
+func (service *imageService) unlockToken(link ShareLink) string {
+	return service.sign("unlock\n" + link.ID + "\n" + link.PasswordHash)
+}
+
+// sign returns the URL-safe HMAC-SHA256 of message under the share link secret
+func (service *imageService) sign(message string) string {
+	mac := hmac.New(sha256.New, service.config.ShareLinkSecret)
+	mac.Write([]byte(message))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,343 @@
+package image
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"file-pub/internal/common"
+)
+
+// shareCookiePrefix starts the name of the cookie holding a protected link's
+// unlock token; the link ID completes it
+const shareCookiePrefix = "share_"
+
+// shareExpiryChoice is one lifetime offered when creating a link from the edit page
+type shareExpiryChoice struct {
+	Value string
+	Label string
+}
+
+// shareExpiryChoices are the lifetimes offered on the edit page, as durations
+var shareExpiryChoices = []shareExpiryChoice{
+	{Value: "1h", Label: "1 hour"},
+	{Value: "24h", Label: "1 day"},
+	{Value: "168h", Label: "7 days"},
+	{Value: "720h", Label: "30 days"},
+}
+
+// shareLinkListResponse is the JSON body returned when listing share links
+type shareLinkListResponse struct {
+	Links []ShareLink `json:"links"`
+	Count int         `json:"count"`
+}
+
+// handleShareLinks handles the edit page's link forms: POST /image/{id}/links
+// creates a link and POST /image/{id}/links/{linkID}/revoke revokes one. Both
+// redirect back to the edit page.
+func (handler *ImageHandler) handleShareLinks(w http.ResponseWriter, r *http.Request, id, rest string) {
+	linkID, action, _ := strings.Cut(rest, "/")
+	if (rest != "" && action != "revoke") || (action == "revoke" && linkID == "") {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if action == "revoke" {
+		if err := handler.imageService.RevokeShareLink(r.Context(), id, linkID); err != nil {
+			if errors.Is(err, ErrShareLinkNotFound) || errors.Is(err, ErrImageNotFound) {
+				http.Error(w, "Share link not found", http.StatusNotFound)
+				return
+			}
+			if errors.Is(err, ErrNotImageOwner) {
+				http.Error(w, ErrNotImageOwner.Error(), http.StatusForbidden)
+				return
+			}
+			log.Printf("Error revoking share link %s of image %s: %v", linkID, id, err)
+			http.Error(w, "Failed to revoke share link", http.StatusInternalServerError)
+			return
+		}
+		http.Redirect(w, r, "/image/"+id+"/edit", http.StatusSeeOther)
+		return
+	}
+
+	metadata, err := handler.imageService.GetImage(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, ErrImageNotFound) {
+			http.Error(w, "Image not found", http.StatusNotFound)
+			return
+		}
+		log.Printf("Error fetching image %s: %v", id, err)
+		http.Error(w, "Failed to fetch image", http.StatusInternalServerError)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxFormBodySize)
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Invalid form", http.StatusBadRequest)
+		return
+	}
+
+	opts, err := shareLinkOptionsFromForm(r)
+	if err == nil {
+		_, err = handler.imageService.CreateShareLink(r.Context(), id, opts)
+	}
+	if err != nil {
+		if errors.Is(err, ErrInvalidShareLink) {
+			handler.renderEditForm(w, r, http.StatusBadRequest, metadata, err.Error())
+			return
+		}
+		if errors.Is(err, ErrNotImageOwner) {
+			http.Error(w, ErrNotImageOwner.Error(), http.StatusForbidden)
+			return
+		}
+		log.Printf("Error creating share link for image %s: %v", id, err)
+		http.Error(w, "Failed to create share link", http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, "/image/"+id+"/edit", http.StatusSeeOther)
+}
+
+// shareLinkOptionsFromForm reads the lifetime, download limit and password
+// of a new link from the edit page's form
+func shareLinkOptionsFromForm(r *http.Request) (ShareLinkOptions, error) {
+	lifetime, err := time.ParseDuration(r.PostFormValue("expires_in"))
+	if err != nil {
+		return ShareLinkOptions{}, fmt.Errorf("%w: choose when the link expires", ErrInvalidShareLink)
+	}
+
+	maxDownloads := 0
+	if value := strings.TrimSpace(r.PostFormValue("max_downloads")); value != "" {
+		maxDownloads, err = strconv.Atoi(value)
+		if err != nil {
+			return ShareLinkOptions{}, fmt.Errorf("%w: max downloads must be a whole number", ErrInvalidShareLink)
+		}
+	}
+
+	return ShareLinkOptions{
+		ExpiresAt:    time.Now().Add(lifetime),
+		MaxDownloads: maxDownloads,
+		Password:     r.PostFormValue("password"),
+	}, nil
+}
+
+// handleUnlockShareLink checks the password posted for a protected link. On
+// success the unlock token is kept in a cookie scoped to the image and the
+// browser is sent back to the link.
+func (handler *ImageHandler) handleUnlockShareLink(w http.ResponseWriter, r *http.Request, id string) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxFormBodySize)
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Invalid form", http.StatusBadRequest)
+		return
+	}
+
+	access := shareAccessFromRequest(r)
+	access.Password = r.PostFormValue("password")
+	link, err := handler.imageService.AuthorizeImage(r.Context(), id, access)
+	if err != nil {
+		if errors.Is(err, ErrSharePasswordRequired) {
+			handler.renderSharePassword(w, http.StatusUnauthorized, "Wrong password")
+			return
+		}
+		writeShareError(w, id, err)
+		return
+	}
+
+	if link != nil && link.UnlockToken != "" {
+		http.SetCookie(w, &http.Cookie{
+			Name:     shareCookiePrefix + link.ID,
+			Value:    link.UnlockToken,
+			Path:     "/image/" + id,
+			Expires:  link.ExpiresAt,
+			Secure:   r.TLS != nil,
+			HttpOnly: true,
+			SameSite: http.SameSiteLaxMode,
+		})
+	}
+	http.Redirect(w, r, r.URL.RequestURI(), http.StatusSeeOther)
+}
+
+// authorizeImage checks that the request may see the image, answering it
+// when it may not. The returned link is nil for public images and for the
+// owner.
+func (handler *ImageHandler) authorizeImage(w http.ResponseWriter, r *http.Request, id string) (*ShareLink, bool) {
+	link, err := handler.imageService.AuthorizeImage(r.Context(), id, shareAccessFromRequest(r))
+	if err != nil {
+		if errors.Is(err, ErrSharePasswordRequired) {
+			handler.renderSharePassword(w, http.StatusUnauthorized, "")
+			return nil, false
+		}
+		writeShareError(w, id, err)
+		return nil, false
+	}
+	return link, true
+}
+
+// shareDownloadWriter counts a download against a share link once the
+// response turns out to send the image from its first byte: a 200, a 206
+// whose range starts at byte 0, or a multipart 206. Errors, 304s, 416s and
+// resumed downloads are not counted. When the link ran out in the meantime
+// the response becomes a 410 instead.
+type shareDownloadWriter struct {
+	http.ResponseWriter
+	handler *ImageHandler
+	r       *http.Request
+	id      string
+	link    *ShareLink
+	wrote   bool
+	err     error
+}
+
+// WriteHeader records the download, if the status starts one, before
+// sending the header
+func (sw *shareDownloadWriter) WriteHeader(status int) {
+	if sw.wrote {
+		return
+	}
+	sw.wrote = true
+
+	if startsDownload(status, sw.Header()) {
+		if err := sw.handler.imageService.RecordShareDownload(sw.r.Context(), sw.link); err != nil {
+			sw.err = err
+			for _, name := range []string{"Content-Length", "Content-Range", "ETag", "Last-Modified"} {
+				sw.Header().Del(name)
+			}
+			writeShareError(sw.ResponseWriter, sw.id, err)
+			return
+		}
+	}
+	sw.ResponseWriter.WriteHeader(status)
+}
+
+// Write sends the body, dropping it when the download was refused
+func (sw *shareDownloadWriter) Write(p []byte) (int, error) {
+	if !sw.wrote {
+		sw.WriteHeader(http.StatusOK)
+	}
+	if sw.err != nil {
+		return 0, sw.err
+	}
+	return sw.ResponseWriter.Write(p)
+}
+
+// startsDownload reports whether a response with the status and headers
+// sends the image from its first byte, so the chunks of one ranged or resumed
+// download are counted once. Multipart responses, which carry no
+// Content-Range header, always count.
+func startsDownload(status int, header http.Header) bool {
+	switch status {
+	case http.StatusOK:
+		return true
+	case http.StatusPartialContent:
+		contentRange := header.Get("Content-Range")
+		return contentRange == "" || strings.HasPrefix(contentRange, "bytes 0-")
+	default:
+		return false
+	}
+}
+
+// shareAccessFromRequest collects the share link parameters of the URL and
+// the unlock token cookie of the link
+func shareAccessFromRequest(r *http.Request) ShareAccess {
+	query := r.URL.Query()
+	access := ShareAccess{
+		LinkID:    query.Get("share"),
+		Expires:   query.Get("expires"),
+		Signature: query.Get("sig"),
+	}
+	if access.LinkID != "" {
+		if cookie, err := r.Cookie(shareCookiePrefix + access.LinkID); err == nil {
+			access.UnlockToken = cookie.Value
+		}
+	}
+	return access
+}
+
+// writeShareError reports why an image may not be served. Bad and revoked
+// links look like a missing image; used up links are gone for good.
+func writeShareError(w http.ResponseWriter, id string, err error) {
+	switch {
+	case errors.Is(err, ErrImageNotFound), errors.Is(err, ErrShareLinkNotFound):
+		http.Error(w, "Image not found", http.StatusNotFound)
+	case errors.Is(err, ErrShareLinkExpired), errors.Is(err, ErrShareLinkExhausted):
+		http.Error(w, err.Error(), http.StatusGone)
+	default:
+		log.Printf("Error authorizing image %s: %v", id, err)
+		http.Error(w, "Failed to fetch image", http.StatusInternalServerError)
+	}
+}
+
+// renderSharePassword renders the form asking for a protected link's password
+func (handler *ImageHandler) renderSharePassword(w http.ResponseWriter, status int, message string) {
+	data := struct {
+		Error string
+	}{
+		Error: message,
+	}
+
+	var page bytes.Buffer
+	if err := handler.templates.ExecuteTemplate(&page, "share_password.html", data); err != nil {
+		log.Printf("Template error: %v", err)
+		http.Error(w, "Failed to render page", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	page.WriteTo(w)
+}
+
+// apiListShareLinks returns an image's share links as JSON
+func (handler *ImageHandler) apiListShareLinks(w http.ResponseWriter, r *http.Request, id string) {
+	links, err := handler.imageService.ListShareLinks(r.Context(), id)
+	if err != nil {
+		writeAPIError(w, "listing share links of image "+id, err)
+		return
+	}
+
+	if links == nil {
+		links = []ShareLink{}
+	}
+	common.WriteJSON(w, http.StatusOK, shareLinkListResponse{
+		Links: links,
+		Count: len(links),
+	})
+}
+
+// apiCreateShareLink creates a share link from a JSON ShareLinkOptions body
+func (handler *ImageHandler) apiCreateShareLink(w http.ResponseWriter, r *http.Request, id string) {
+	var opts ShareLinkOptions
+	if err := common.ReadJSON(w, r, maxJSONBodySize, &opts); err != nil {
+		common.WriteJSONError(w, http.StatusBadRequest, "invalid_request", `Expected a JSON body with "expires_at" and optionally "max_downloads" and "password"`)
+		return
+	}
+
+	link, err := handler.imageService.CreateShareLink(r.Context(), id, opts)
+	if err != nil {
+		writeAPIError(w, "creating share link for image "+id, err)
+		return
+	}
+
+	common.WriteJSON(w, http.StatusCreated, link)
+}
+
+// apiRevokeShareLink revokes a share link and responds with 204 No Content
+func (handler *ImageHandler) apiRevokeShareLink(w http.ResponseWriter, r *http.Request, id, linkID string) {
+	if err := handler.imageService.RevokeShareLink(r.Context(), id, linkID); err != nil {
+		writeAPIError(w, "revoking share link "+linkID, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
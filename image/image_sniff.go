@@ -0,0 +1,83 @@
+package image
+
+import (
+	"fmt"
+	stdimage "image"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// sniffLength is the number of leading bytes http.DetectContentType considers
+const sniffLength = 512
+
+// decoderContentTypes maps image.DecodeConfig format names to content types
+var decoderContentTypes = map[string]string{
+	"jpeg": "image/jpeg",
+	"png":  "image/png",
+	"gif":  "image/gif",
+	"webp": "image/webp",
+}
+
+// imageExtensions maps detected content types to stored file extensions
+var imageExtensions = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/gif":  ".gif",
+	"image/webp": ".webp",
+}
+
+// detectImageType determines the real image type of r from its magic bytes
+// and confirms it by decoding the image header. r is left at an unspecified
+// offset.
+func detectImageType(r io.ReadSeeker) (string, error) {
+	head := make([]byte, sniffLength)
+	n, err := io.ReadFull(r, head)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		if err == io.EOF {
+			return "", fmt.Errorf("%w: empty file", ErrInvalidImageType)
+		}
+		return "", fmt.Errorf("reading image header: %w", err)
+	}
+
+	sniffed := http.DetectContentType(head[:n])
+	if !validImageTypes[sniffed] {
+		return "", fmt.Errorf("%w: content looks like %s", ErrInvalidImageType, sniffed)
+	}
+
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return "", fmt.Errorf("rewinding image: %w", err)
+	}
+
+	// Magic bytes alone are easy to forge; make sure the header actually decodes
+	_, format, err := stdimage.DecodeConfig(r)
+	if err != nil {
+		return "", fmt.Errorf("%w: %s header does not decode: %v", ErrInvalidImageType, sniffed, err)
+	}
+	if decoderContentTypes[format] != sniffed {
+		return "", fmt.Errorf("%w: magic bytes say %s but header decodes as %s", ErrInvalidImageType, sniffed, format)
+	}
+
+	return sniffed, nil
+}
+
+// normalizeContentType lower-cases a client-supplied content type, strips
+// parameters and maps the non-standard image/jpg alias to image/jpeg
+func normalizeContentType(contentType string) string {
+	mediaType, _, _ := strings.Cut(contentType, ";")
+	mediaType = strings.ToLower(strings.TrimSpace(mediaType))
+	if mediaType == "image/jpg" {
+		return "image/jpeg"
+	}
+	return mediaType
+}
+
+// checkDeclaredType rejects uploads whose declared type disagrees with the detected one.
+// Missing or generic declared types are accepted and replaced by the detected type.
+func checkDeclaredType(declared, detected string) error {
+	declared = normalizeContentType(declared)
+	if declared == "" || declared == "application/octet-stream" || declared == detected {
+		return nil
+	}
+	return fmt.Errorf("%w: declared %s but content is %s", ErrContentTypeMismatch, declared, detected)
+}
@@ -0,0 +1,398 @@
+package image
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	stdimage "image"
+	"image/draw"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+)
+
+// strippedJPEGQuality is used when a JPEG has to be re-encoded to apply its orientation
+const strippedJPEGQuality = 92
+
+// keptPNGChunks are the PNG chunks a stripped image keeps: the critical
+// chunks, those that affect rendering and the APNG animation chunks.
+// Text, time and EXIF chunks are dropped.
+var keptPNGChunks = map[string]bool{
+	"IHDR": true, "PLTE": true, "IDAT": true, "IEND": true,
+	"tRNS": true, "gAMA": true, "cHRM": true, "sRGB": true, "iCCP": true,
+	"sBIT": true, "bKGD": true, "pHYs": true,
+	"acTL": true, "fcTL": true, "fdAT": true,
+}
+
+// VP8X feature flags for the WebP metadata chunks
+const (
+	webpFlagEXIF = 0x08
+	webpFlagXMP  = 0x04
+)
+
+// stripMetadata returns a copy of the upload without EXIF, XMP, IPTC or
+// text metadata. JPEG and PNG images with an orientation other than 1 are
+// re-encoded upright; otherwise the metadata is cut out and the image data
+// is copied unchanged. WebP is not re-encoded, because the only available
+// encoder is lossless and would inflate lossy files, so a stripped WebP keeps
+// a minimal EXIF block holding only its orientation. applied reports whether
+// the orientation was applied to the pixels.
+func stripMetadata(upload *spooledUpload, contentType string, orientation int) (stripped *spooledUpload, applied bool, err error) {
+	body, err := upload.Reader()
+	if err != nil {
+		return nil, false, err
+	}
+
+	var buf bytes.Buffer
+	rotate := orientation > 1
+	switch {
+	case contentType == "image/webp":
+		err = stripWebP(&buf, body, orientation)
+		rotate = false
+	case contentType == "image/gif":
+		// GIF has no orientation; re-encoding drops comments and XMP
+		// application extensions while keeping every frame
+		err = stripGIF(&buf, body)
+		rotate = false
+	case rotate:
+		err = encodeOriented(&buf, body, contentType, orientation)
+	case contentType == "image/jpeg":
+		err = stripJPEG(&buf, bufio.NewReader(body))
+	case contentType == "image/png":
+		err = stripPNG(&buf, body)
+	default:
+		return nil, false, fmt.Errorf("%w: cannot strip metadata from %s", ErrInvalidImageType, contentType)
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("%w: stripping metadata: %v", ErrInvalidImageType, err)
+	}
+
+	stripped, err = spoolUpload(&buf, 0)
+	if err != nil {
+		return nil, false, err
+	}
+	return stripped, rotate, nil
+}
+
+// encodeOriented decodes a JPEG or PNG, applies its orientation and encodes
+// it again in the same format, which writes no metadata at all
+func encodeOriented(w io.Writer, r io.ReadSeeker, contentType string, orientation int) error {
+	src, _, err := decodeImage(r)
+	if err != nil {
+		return err
+	}
+	img := applyOrientation(src, orientation)
+
+	if contentType == "image/png" {
+		return png.Encode(w, img)
+	}
+	return jpeg.Encode(w, img, &jpeg.Options{Quality: strippedJPEGQuality})
+}
+
+// applyOrientation transforms img so that it displays upright without its
+// EXIF orientation
+func applyOrientation(img stdimage.Image, orientation int) stdimage.Image {
+	if orientation < 2 || orientation > 8 {
+		return img
+	}
+
+	bounds := img.Bounds()
+	src := stdimage.NewRGBA(stdimage.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(src, src.Bounds(), img, bounds.Min, draw.Src)
+	width, height := bounds.Dx(), bounds.Dy()
+
+	dstWidth, dstHeight := width, height
+	if orientation >= 5 {
+		dstWidth, dstHeight = height, width
+	}
+	dst := stdimage.NewRGBA(stdimage.Rect(0, 0, dstWidth, dstHeight))
+
+	for y := 0; y < dstHeight; y++ {
+		for x := 0; x < dstWidth; x++ {
+			// Find the source pixel that lands on (x, y)
+			var sx, sy int
+			switch orientation {
+			case 2: // mirrored horizontally
+				sx, sy = width-1-x, y
+			case 3: // rotated 180
+				sx, sy = width-1-x, height-1-y
+			case 4: // mirrored vertically
+				sx, sy = x, height-1-y
+			case 5: // transposed
+				sx, sy = y, x
+			case 6: // rotated 90 clockwise to display
+				sx, sy = y, height-1-x
+			case 7: // transversed
+				sx, sy = width-1-y, height-1-x
+			case 8: // rotated 90 counter-clockwise to display
+				sx, sy = width-1-y, x
+			}
+			copy(dst.Pix[dst.PixOffset(x, y):dst.PixOffset(x, y)+4], src.Pix[src.PixOffset(sx, sy):src.PixOffset(sx, sy)+4])
+		}
+	}
+	return dst
+}
+
+// stripJPEG copies a JPEG stream without its metadata segments. JFIF,
+// ICC profile and Adobe segments are kept because they affect how the image
+// renders; everything after the end of image, such as embedded previews,
+// is dropped.
+func stripJPEG(w io.Writer, r *bufio.Reader) error {
+	var soi [2]byte
+	if _, err := io.ReadFull(r, soi[:]); err != nil {
+		return err
+	}
+	if soi != [2]byte{0xff, 0xd8} {
+		return errors.New("missing JPEG start of image")
+	}
+	if _, err := w.Write(soi[:]); err != nil {
+		return err
+	}
+
+	var marker byte
+	var err error
+	for scanned := false; ; {
+		// A scan ends at the marker that follows it
+		if !scanned {
+			if marker, err = readJPEGMarker(r); err != nil {
+				return err
+			}
+		}
+		scanned = false
+
+		if marker == 0xd9 {
+			_, err := w.Write([]byte{0xff, 0xd9})
+			return err
+		}
+		if marker == 0x01 || (marker >= 0xd0 && marker <= 0xd7) {
+			if _, err := w.Write([]byte{0xff, marker}); err != nil {
+				return err
+			}
+			continue
+		}
+
+		var length uint16
+		if err := binary.Read(r, binary.BigEndian, &length); err != nil {
+			return err
+		}
+		if length < 2 {
+			return errors.New("malformed JPEG segment length")
+		}
+		segment := make([]byte, length-2)
+		if _, err := io.ReadFull(r, segment); err != nil {
+			return err
+		}
+
+		if !keepJPEGSegment(marker, segment) {
+			continue
+		}
+		if _, err := w.Write([]byte{0xff, marker, byte(length >> 8), byte(length)}); err != nil {
+			return err
+		}
+		if _, err := w.Write(segment); err != nil {
+			return err
+		}
+
+		// Entropy-coded data follows a start of scan header
+		if marker == 0xda {
+			if marker, err = copyScan(w, r); err != nil {
+				return err
+			}
+			scanned = true
+		}
+	}
+}
+
+// keepJPEGSegment reports whether a segment survives stripping: every
+// non-APPn segment except comments, plus JFIF, ICC profile and Adobe APPn
+// segments
+func keepJPEGSegment(marker byte, segment []byte) bool {
+	switch {
+	case marker == 0xfe:
+		return false
+	case marker == 0xe0:
+		return bytes.HasPrefix(segment, []byte("JFIF\x00")) || bytes.HasPrefix(segment, []byte("JFXX\x00"))
+	case marker == 0xe2:
+		return bytes.HasPrefix(segment, []byte("ICC_PROFILE\x00"))
+	case marker == 0xee:
+		return bytes.HasPrefix(segment, []byte("Adobe"))
+	case marker >= 0xe0 && marker <= 0xef:
+		return false
+	}
+	return true
+}
+
+// readJPEGMarker reads the next marker, skipping fill bytes
+func readJPEGMarker(r *bufio.Reader) (byte, error) {
+	b, err := r.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+	if b != 0xff {
+		return 0, errors.New("malformed JPEG marker")
+	}
+	for b == 0xff {
+		if b, err = r.ReadByte(); err != nil {
+			return 0, err
+		}
+	}
+	return b, nil
+}
+
+// copyScan copies entropy-coded data and returns the first marker after it
+// that is not a restart marker
+func copyScan(w io.Writer, r *bufio.Reader) (byte, error) {
+	bw := bufio.NewWriter(w)
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		if b != 0xff {
+			bw.WriteByte(b)
+			continue
+		}
+
+		next, err := r.ReadByte()
+		for err == nil && next == 0xff {
+			next, err = r.ReadByte()
+		}
+		if err != nil {
+			return 0, err
+		}
+		// Stuffed zero bytes and restart markers belong to the scan
+		if next == 0x00 || (next >= 0xd0 && next <= 0xd7) {
+			bw.WriteByte(b)
+			bw.WriteByte(next)
+			continue
+		}
+		return next, bw.Flush()
+	}
+}
+
+// stripPNG copies a PNG stream keeping only keptPNGChunks
+func stripPNG(w io.Writer, r io.Reader) error {
+	var signature [8]byte
+	if _, err := io.ReadFull(r, signature[:]); err != nil {
+		return err
+	}
+	if _, err := w.Write(signature[:]); err != nil {
+		return err
+	}
+
+	for {
+		var header [8]byte
+		if _, err := io.ReadFull(r, header[:]); err != nil {
+			return err
+		}
+		length := int64(binary.BigEndian.Uint32(header[:4]))
+		chunkType := string(header[4:])
+
+		// Chunk data is followed by a four byte CRC
+		if !keptPNGChunks[chunkType] {
+			if _, err := io.CopyN(io.Discard, r, length+4); err != nil {
+				return err
+			}
+			continue
+		}
+		if _, err := w.Write(header[:]); err != nil {
+			return err
+		}
+		if _, err := io.CopyN(w, r, length+4); err != nil {
+			return err
+		}
+		if chunkType == "IEND" {
+			return nil
+		}
+	}
+}
+
+// stripGIF decodes every frame of a GIF and encodes them again
+func stripGIF(w io.Writer, r io.Reader) error {
+	animation, err := gif.DecodeAll(r)
+	if err != nil {
+		return err
+	}
+	if animation.Config.Width*animation.Config.Height > maxDecodePixels {
+		return fmt.Errorf("image %dx%d exceeds %d pixel processing limit", animation.Config.Width, animation.Config.Height, maxDecodePixels)
+	}
+	return gif.EncodeAll(w, animation)
+}
+
+// stripWebP copies a WebP stream without its EXIF and XMP chunks. When
+// orientation is other than 1 a minimal EXIF chunk recording only the
+// orientation takes their place.
+func stripWebP(w io.Writer, r io.Reader, orientation int) error {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	if len(data) < 12 || string(data[:4]) != "RIFF" || string(data[8:12]) != "WEBP" {
+		return errors.New("missing WebP RIFF header")
+	}
+
+	var chunks bytes.Buffer
+	flagsOffset := -1
+	for pos := 12; pos < len(data); {
+		if pos+8 > len(data) {
+			return errors.New("truncated WebP chunk header")
+		}
+		chunkType := string(data[pos : pos+4])
+		length := int(binary.LittleEndian.Uint32(data[pos+4:]))
+		// Chunks are padded to an even length
+		end := pos + 8 + length + length&1
+		if length > len(data) || end > len(data) {
+			return errors.New("truncated WebP chunk")
+		}
+		chunk := data[pos:end]
+		pos = end
+
+		switch chunkType {
+		case "EXIF", "XMP ":
+			continue
+		case "VP8X":
+			flagsOffset = chunks.Len() + 8
+		}
+		chunks.Write(chunk)
+	}
+
+	// Only the extended format can carry metadata, and it flags what it carries
+	if flagsOffset >= 0 {
+		flags := chunks.Bytes()[flagsOffset] &^ (webpFlagEXIF | webpFlagXMP)
+		if orientation > 1 {
+			exif := orientationExif(orientation)
+			chunks.WriteString("EXIF")
+			binary.Write(&chunks, binary.LittleEndian, uint32(len(exif)))
+			chunks.Write(exif)
+			flags |= webpFlagEXIF
+		}
+		chunks.Bytes()[flagsOffset] = flags
+	}
+
+	header := make([]byte, 12)
+	copy(header, "RIFF")
+	binary.LittleEndian.PutUint32(header[4:], uint32(4+chunks.Len()))
+	copy(header[8:], "WEBP")
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+	_, err = chunks.WriteTo(w)
+	return err
+}
+
+// orientationExif returns a little-endian TIFF structure whose only field is
+// the orientation
+func orientationExif(orientation int) []byte {
+	exif := make([]byte, 26)
+	copy(exif, "II\x2a\x00")
+	binary.LittleEndian.PutUint32(exif[4:], 8)
+	binary.LittleEndian.PutUint16(exif[8:], 1)
+	binary.LittleEndian.PutUint16(exif[10:], tagOrientation)
+	binary.LittleEndian.PutUint16(exif[12:], typeShort)
+	binary.LittleEndian.PutUint32(exif[14:], 1)
+	binary.LittleEndian.PutUint16(exif[18:], uint16(orientation))
+	return exif
+}
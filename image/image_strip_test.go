@@ -0,0 +1,104 @@
+package image
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image/png"
+	"testing"
+)
+
+// pngChunk encodes one PNG chunk with its CRC
+func pngChunk(chunkType string, data []byte) []byte {
+	chunk := binary.BigEndian.AppendUint32(nil, uint32(len(data)))
+	chunk = append(chunk, chunkType...)
+	chunk = append(chunk, data...)
+	return binary.BigEndian.AppendUint32(chunk, crc32.ChecksumIEEE(chunk[4:]))
+}
+
+// webpChunk encodes one RIFF chunk, padded to an even length
+func webpChunk(chunkType string, data []byte) []byte {
+	chunk := append([]byte(chunkType), binary.LittleEndian.AppendUint32(nil, uint32(len(data)))...)
+	chunk = append(chunk, data...)
+	if len(data)%2 == 1 {
+		chunk = append(chunk, 0)
+	}
+	return chunk
+}
+
+func TestStripPNG(t *testing.T) {
+	plain := testPNG(t, 8, 8)
+
+	// Insert text and EXIF chunks after IHDR, which is 8+25 bytes in
+	withMetadata := append([]byte(nil), plain[:33]...)
+	withMetadata = append(withMetadata, pngChunk("tEXt", []byte("Comment\x00secret"))...)
+	withMetadata = append(withMetadata, pngChunk("eXIf", []byte("MM\x00\x2a\x00\x00\x00\x08"))...)
+	withMetadata = append(withMetadata, plain[33:]...)
+
+	var out bytes.Buffer
+	if err := stripPNG(&out, bytes.NewReader(withMetadata)); err != nil {
+		t.Fatalf("stripPNG: %v", err)
+	}
+	if !bytes.Equal(out.Bytes(), plain) {
+		t.Error("stripped PNG differs from the PNG without metadata")
+	}
+	if _, err := png.Decode(&out); err != nil {
+		t.Errorf("stripped PNG does not decode: %v", err)
+	}
+}
+
+func TestStripJPEG(t *testing.T) {
+	data := testExifJPEG(t, 16, 16)
+	withComment := append([]byte{0xff, 0xd8, 0xff, 0xfe, 0x00, 0x08}, "secret"...)
+	withComment = append(withComment, data[2:]...)
+
+	var out bytes.Buffer
+	if err := stripJPEG(&out, bufio.NewReader(bytes.NewReader(withComment))); err != nil {
+		t.Fatalf("stripJPEG: %v", err)
+	}
+	if bytes.Contains(out.Bytes(), []byte("Exif")) || bytes.Contains(out.Bytes(), []byte("secret")) {
+		t.Error("stripped JPEG still carries metadata")
+	}
+
+	// The image data itself is copied unchanged
+	exifSegment := 2 + int(binary.BigEndian.Uint16(data[4:]))
+	if want := append(data[:2:2], data[2+exifSegment:]...); !bytes.Equal(out.Bytes(), want) {
+		t.Error("stripped JPEG differs from the JPEG without its Exif segment")
+	}
+}
+
+func TestStripWebP(t *testing.T) {
+	build := func(flags byte, chunks ...[]byte) []byte {
+		body := []byte("WEBP")
+		body = append(body, webpChunk("VP8X", []byte{flags, 0, 0, 0, 7, 0, 0, 7, 0, 0})...)
+		for _, chunk := range chunks {
+			body = append(body, chunk...)
+		}
+		return append(append([]byte("RIFF"), binary.LittleEndian.AppendUint32(nil, uint32(len(body)))...), body...)
+	}
+	bitstream := webpChunk("VP8L", []byte{1, 2, 3})
+	exif := webpChunk("EXIF", []byte("MM\x00\x2a secret"))
+	xmp := webpChunk("XMP ", []byte("<x:xmpmeta>secret</x:xmpmeta>"))
+
+	var out bytes.Buffer
+	if err := stripWebP(&out, bytes.NewReader(build(webpFlagEXIF|webpFlagXMP, bitstream, exif, xmp)), 0); err != nil {
+		t.Fatalf("stripWebP: %v", err)
+	}
+	if want := build(0, bitstream); !bytes.Equal(out.Bytes(), want) {
+		t.Errorf("stripped = %q, want %q", out.Bytes(), want)
+	}
+
+	// An orientation survives as the only EXIF field
+	out.Reset()
+	if err := stripWebP(&out, bytes.NewReader(build(webpFlagEXIF, bitstream, exif)), 6); err != nil {
+		t.Fatalf("stripWebP: %v", err)
+	}
+	if want := build(webpFlagEXIF, bitstream, webpChunk("EXIF", orientationExif(6))); !bytes.Equal(out.Bytes(), want) {
+		t.Errorf("stripped = %q, want %q", out.Bytes(), want)
+	}
+	var metadata ImageMetadata
+	if err := parseExif(orientationExif(6), &metadata); err != nil || metadata.Orientation != 6 {
+		t.Errorf("orientation EXIF parses as %d, %v", metadata.Orientation, err)
+	}
+}
@@ -0,0 +1,91 @@
+package image
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	// maxTagLength is the longest tag, in characters
+	maxTagLength = 64
+	// maxTagsPerImage caps how many tags one image may carry
+	maxTagsPerImage = 20
+)
+
+// tagPattern allows letters, digits, spaces, hyphens and underscores,
+// starting with a letter or digit
+var tagPattern = regexp.MustCompile(`^[\p{L}\p{N}][\p{L}\p{N} _-]*$`)
+
+// normalizeTag lower-cases a tag and collapses runs of whitespace
+func normalizeTag(tag string) (string, error) {
+	normalized := strings.ToLower(strings.Join(strings.Fields(tag), " "))
+	if normalized == "" {
+		return "", fmt.Errorf("%w: tag is empty", ErrInvalidTag)
+	}
+	if utf8.RuneCountInString(normalized) > maxTagLength {
+		return "", fmt.Errorf("%w: %q is longer than %d characters", ErrInvalidTag, normalized, maxTagLength)
+	}
+	if !tagPattern.MatchString(normalized) {
+		return "", fmt.Errorf("%w: %q may only contain letters, digits, spaces, '-' and '_'", ErrInvalidTag, normalized)
+	}
+	return normalized, nil
+}
+
+// normalizeTags normalizes each tag and returns them sorted without duplicates
+func normalizeTags(tags []string) ([]string, error) {
+	seen := make(map[string]bool, len(tags))
+	normalized := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		tag, err := normalizeTag(tag)
+		if err != nil {
+			return nil, err
+		}
+		if !seen[tag] {
+			seen[tag] = true
+			normalized = append(normalized, tag)
+		}
+	}
+
+	sort.Strings(normalized)
+	return normalized, nil
+}
+
+// parseTagList splits a comma-separated tag list, dropping empty entries
+func parseTagList(value string) []string {
+	var tags []string
+	for _, tag := range strings.Split(value, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// mergeTags returns the sorted union of two normalized tag lists
+func mergeTags(current, added []string) []string {
+	merged, _ := normalizeTags(append(append([]string(nil), current...), added...))
+	return merged
+}
+
+// containsAllTags reports whether tags includes every entry of required
+func containsAllTags(tags, required []string) bool {
+	for _, tag := range required {
+		if !containsTag(tags, tag) {
+			return false
+		}
+	}
+	return true
+}
+
+// containsTag reports whether tags includes tag
+func containsTag(tags []string, tag string) bool {
+	for _, candidate := range tags {
+		if candidate == tag {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,211 @@
+package image
+
+import (
+	"fmt"
+	stdimage "image"
+	"net/url"
+	"strconv"
+
+	"golang.org/x/image/draw"
+)
+
+// Fit modes for on-the-fly transformations
+const (
+	// FitContain scales the image to fit inside the requested box without cropping
+	FitContain = "contain"
+	// FitCover scales the image to cover the requested box and crops the overflow
+	FitCover = "cover"
+	// FitFill stretches the image to exactly the requested box
+	FitFill = "fill"
+)
+
+// defaultTransformQuality is the JPEG quality used when q is not given. Other
+// output formats are lossless and ignore q.
+const defaultTransformQuality = 85
+
+// transformParams are the query parameters that request a transformation
+var transformParams = []string{"w", "h", "fit", "format", "q"}
+
+// TransformOptions describes an on-the-fly resize, crop and re-encode
+type TransformOptions struct {
+	Width   int
+	Height  int
+	Fit     string
+	Format  string
+	Quality int
+}
+
+// hasTransformParams reports whether the query asks for a transformation
+func hasTransformParams(params url.Values) bool {
+	for _, name := range transformParams {
+		if params.Has(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseTransformOptions reads w, h, fit, format and q from the query
+func parseTransformOptions(params url.Values) (TransformOptions, error) {
+	opts := TransformOptions{
+		Fit:     FitContain,
+		Quality: defaultTransformQuality,
+	}
+
+	var err error
+	if opts.Width, err = parseDimension(params, "w"); err != nil {
+		return opts, err
+	}
+	if opts.Height, err = parseDimension(params, "h"); err != nil {
+		return opts, err
+	}
+	if opts.Width == 0 && opts.Height == 0 {
+		return opts, fmt.Errorf("%w: w or h is required", ErrInvalidTransform)
+	}
+
+	if fit := params.Get("fit"); fit != "" {
+		if fit != FitContain && fit != FitCover && fit != FitFill {
+			return opts, fmt.Errorf("%w: fit must be contain, cover or fill", ErrInvalidTransform)
+		}
+		opts.Fit = fit
+	}
+
+	switch format := params.Get("format"); format {
+	case "":
+	case "jpeg", "jpg":
+		opts.Format = "jpeg"
+	case "png", "gif", "webp":
+		opts.Format = format
+	default:
+		return opts, fmt.Errorf("%w: unknown format %q", ErrInvalidTransform, format)
+	}
+
+	if q := params.Get("q"); q != "" {
+		quality, err := strconv.Atoi(q)
+		if err != nil {
+			return opts, fmt.Errorf("%w: q must be an integer", ErrInvalidTransform)
+		}
+		opts.Quality = quality
+	}
+
+	return opts, nil
+}
+
+// parseDimension reads an optional positive integer query parameter
+func parseDimension(params url.Values, name string) (int, error) {
+	value := params.Get(name)
+	if value == "" {
+		return 0, nil
+	}
+
+	parsed, err := strconv.Atoi(value)
+	if err != nil || parsed <= 0 {
+		return 0, fmt.Errorf("%w: %s must be a positive integer", ErrInvalidTransform, name)
+	}
+	return parsed, nil
+}
+
+// validate checks the options against the configured allow-lists so clients
+// cannot make the server render and cache arbitrarily many derivatives
+func (opts TransformOptions) validate(config Config) error {
+	if opts.Width != 0 && !containsInt(config.TransformSizes, opts.Width) {
+		return fmt.Errorf("%w: width %d is not allowed", ErrInvalidTransform, opts.Width)
+	}
+	if opts.Height != 0 && !containsInt(config.TransformSizes, opts.Height) {
+		return fmt.Errorf("%w: height %d is not allowed", ErrInvalidTransform, opts.Height)
+	}
+	return nil
+}
+
+// validateQuality checks the quality against its allow-list. It runs once
+// the output format is known, since lossless formats ignore the quality.
+func (opts TransformOptions) validateQuality(config Config) error {
+	if opts.lossy() && !containsInt(config.TransformQualities, opts.Quality) {
+		return fmt.Errorf("%w: quality %d is not allowed", ErrInvalidTransform, opts.Quality)
+	}
+	return nil
+}
+
+// withDefaultFormat fills in an output format based on the source content
+// type: JPEG stays JPEG, everything else becomes PNG to preserve transparency.
+// The quality is dropped for lossless formats, which do not use it.
+func (opts TransformOptions) withDefaultFormat(sourceContentType string) TransformOptions {
+	if opts.Format == "" {
+		opts.Format = "png"
+		if sourceContentType == "image/jpeg" || sourceContentType == "image/jpg" {
+			opts.Format = "jpeg"
+		}
+	}
+	if !opts.lossy() {
+		opts.Quality = 0
+	}
+	return opts
+}
+
+// lossy reports whether the output format uses the quality setting
+func (opts TransformOptions) lossy() bool {
+	return opts.Format == "jpeg"
+}
+
+// cacheName identifies the derived output in the blob store; the format must
+// be set. Lossless outputs leave out the quality so that q does not create
+// duplicate renditions.
+func (opts TransformOptions) cacheName() string {
+	name := fmt.Sprintf("w%d_h%d_%s", opts.Width, opts.Height, opts.Fit)
+	if opts.lossy() {
+		name += fmt.Sprintf("_q%d", opts.Quality)
+	}
+	return name + variantExtension("image/"+opts.Format)
+}
+
+// transformImage resizes and crops src according to opts
+func transformImage(src stdimage.Image, opts TransformOptions) stdimage.Image {
+	bounds := src.Bounds()
+	srcWidth, srcHeight := float64(bounds.Dx()), float64(bounds.Dy())
+	width, height := float64(opts.Width), float64(opts.Height)
+
+	// With only one dimension every fit mode scales proportionally
+	if width == 0 || height == 0 {
+		scale := width / srcWidth
+		if width == 0 {
+			scale = height / srcHeight
+		}
+		if opts.Fit == FitContain && scale > 1 {
+			scale = 1
+		}
+		return scaleImage(src, bounds, int(srcWidth*scale+0.5), int(srcHeight*scale+0.5))
+	}
+
+	switch opts.Fit {
+	case FitFill:
+		return scaleImage(src, bounds, opts.Width, opts.Height)
+	case FitCover:
+		// Crop the largest centred region with the target aspect ratio
+		scale := max(width/srcWidth, height/srcHeight)
+		cropWidth, cropHeight := int(width/scale+0.5), int(height/scale+0.5)
+		x0 := bounds.Min.X + (bounds.Dx()-cropWidth)/2
+		y0 := bounds.Min.Y + (bounds.Dy()-cropHeight)/2
+		crop := stdimage.Rect(x0, y0, x0+cropWidth, y0+cropHeight)
+		return scaleImage(src, crop, opts.Width, opts.Height)
+	default:
+		scale := min(width/srcWidth, height/srcHeight, 1)
+		return scaleImage(src, bounds, int(srcWidth*scale+0.5), int(srcHeight*scale+0.5))
+	}
+}
+
+// scaleImage scales the srcRect region of src to a width x height image
+func scaleImage(src stdimage.Image, srcRect stdimage.Rectangle, width, height int) stdimage.Image {
+	dst := stdimage.NewRGBA(stdimage.Rect(0, 0, max(1, width), max(1, height)))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), src, srcRect, draw.Src, nil)
+	return dst
+}
+
+// containsInt reports whether values contains v
+func containsInt(values []int, v int) bool {
+	for _, value := range values {
+		if value == v {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,417 @@
+package image
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"file-pub/storage"
+
+	"github.com/google/uuid"
+)
+
+// maxTusMetadataLength caps the Upload-Metadata header stored with an upload
+const maxTusMetadataLength = 8 << 10
+
+// CreateTusUpload starts a resumable upload of length bytes. metadata is the
+// tus Upload-Metadata header; it may name the file (filename), its type
+// (filetype) and carry the upload options (tags, title, description,
+// alt_text, strip_metadata), which are checked now and applied when the
+// upload completes.
+func (service *imageService) CreateTusUpload(ctx context.Context, length int64, metadata string) (*TusUpload, error) {
+	if len(metadata) > maxTusMetadataLength {
+		return nil, fmt.Errorf("%w: Upload-Metadata exceeds %d bytes", ErrInvalidUpload, maxTusMetadataLength)
+	}
+	filename, contentType, opts, err := parseTusMetadata(metadata)
+	if err != nil {
+		return nil, err
+	}
+	if _, _, err := uploadDetails(opts); err != nil {
+		return nil, err
+	}
+	if utf8.RuneCountInString(filename) > maxFilenameLength {
+		return nil, fmt.Errorf("%w: filename must be at most %d characters", ErrInvalidUpload, maxFilenameLength)
+	}
+
+	if length <= 0 {
+		return nil, fmt.Errorf("%w: Upload-Length must be positive", ErrInvalidUpload)
+	}
+	limit := service.config.largestSizeLimit()
+	if contentType != "" {
+		if err := service.ValidateImageType(contentType); err != nil {
+			return nil, err
+		}
+		limit = service.config.sizeLimit(contentType)
+	}
+	if length > limit {
+		return nil, fmt.Errorf("%w: upload of %d bytes exceeds %d bytes", ErrFileTooLarge, length, limit)
+	}
+
+	// Abandoned uploads would otherwise pile up, with their parts
+	service.deleteExpiredTusUploads(ctx)
+
+	id := uuid.New().String()
+	now := time.Now()
+	upload := TusUpload{
+		ID:        id,
+		S3Key:     tusKey(id, "upload"),
+		Length:    length,
+		Metadata:  metadata,
+		OwnerID:   viewerID(ctx),
+		CreatedAt: now,
+		ExpiresAt: now.Add(service.config.TusUploadExpiry),
+	}
+	if err := service.imageRepo.SaveTusUpload(ctx, upload); err != nil {
+		return nil, fmt.Errorf("saving tus upload: %w", err)
+	}
+
+	return &upload, nil
+}
+
+// GetTusUpload retrieves a resumable upload that has not expired. Only the
+// user who started it may continue it.
+func (service *imageService) GetTusUpload(ctx context.Context, id string) (*TusUpload, error) {
+	upload, err := service.imageRepo.GetTusUpload(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkUploadOwner(ctx, upload.OwnerID); err != nil {
+		return nil, err
+	}
+	if time.Now().After(upload.ExpiresAt) {
+		return nil, ErrUploadExpired
+	}
+	return upload, nil
+}
+
+// WriteTusUpload appends a chunk to a resumable upload at offset, which must
+// be the upload's current offset. The bytes received are kept even if the
+// chunk is cut short. Once the last byte arrives the upload is saved as the
+// image with the upload's ID, through the same checks as UploadImage; if that
+// fails for a reason other than the upload itself, an empty chunk at the
+// final offset tries again.
+func (service *imageService) WriteTusUpload(ctx context.Context, id string, offset int64, chunk io.Reader) (*TusUpload, error) {
+	upload, err := service.GetTusUpload(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if offset != upload.Offset {
+		return nil, fmt.Errorf("%w: upload is at offset %d", ErrUploadConflict, upload.Offset)
+	}
+	if upload.CompletedAt != nil {
+		return upload, nil
+	}
+
+	if upload.Offset < upload.Length {
+		if err := service.appendTusChunk(ctx, upload, chunk); err != nil {
+			return nil, err
+		}
+	}
+	if upload.Offset == upload.Length {
+		if err := service.finishTusUpload(ctx, upload); err != nil {
+			return nil, err
+		}
+	}
+
+	return upload, nil
+}
+
+// TerminateTusUpload discards a resumable upload and the bytes received for
+// it. An image it already became is kept.
+func (service *imageService) TerminateTusUpload(ctx context.Context, id string) error {
+	upload, err := service.imageRepo.GetTusUpload(ctx, id)
+	if err != nil {
+		return err
+	}
+	if err := checkUploadOwner(ctx, upload.OwnerID); err != nil {
+		return err
+	}
+	if err := service.imageRepo.DeleteTusUpload(ctx, id); err != nil {
+		return err
+	}
+	service.deleteTusObjects(ctx, *upload)
+	return nil
+}
+
+// appendTusChunk reads a chunk into the upload. Every full part goes to the
+// multipart upload, except the last part of the upload, and the rest is
+// carried in a new tail object. Nothing is recorded if the blob store fails,
+// so the client resends from the previous offset.
+func (service *imageService) appendTusChunk(ctx context.Context, upload *TusUpload, chunk io.Reader) error {
+	previous := *upload
+	uploader := storage.MultipartUploads(service.blobStore)
+	fail := func(err error) error {
+		if previous.MultipartID == "" && upload.MultipartID != "" {
+			if abortErr := uploader.AbortMultipartUpload(ctx, upload.S3Key, upload.MultipartID); abortErr != nil {
+				log.Printf("Failed to abort multipart upload of tus upload %s: %v", upload.ID, abortErr)
+			}
+		}
+		return err
+	}
+
+	// Continue from the bytes the last chunk left short of a full part
+	var pending bytes.Buffer
+	if upload.TailKey != "" {
+		if err := service.readObject(ctx, upload.TailKey, &pending); err != nil {
+			return fmt.Errorf("reading upload tail: %w", err)
+		}
+	}
+
+	body := io.LimitReader(chunk, upload.Length-upload.Offset)
+	var received int64
+	var readErr error
+	for {
+		n, err := io.CopyN(&pending, body, storage.MinPartSize-int64(pending.Len()))
+		received += n
+		if err != nil {
+			if err != io.EOF {
+				readErr = err
+			}
+			break
+		}
+		if upload.Offset+received == upload.Length {
+			break
+		}
+
+		if upload.MultipartID == "" {
+			multipartID, err := uploader.CreateMultipartUpload(ctx, upload.S3Key, "application/octet-stream")
+			if err != nil {
+				return fmt.Errorf("starting multipart upload: %w", err)
+			}
+			upload.MultipartID = multipartID
+		}
+		part, err := uploader.UploadPart(ctx, upload.S3Key, upload.MultipartID, len(upload.Parts)+1, bytes.NewReader(pending.Bytes()))
+		if err != nil {
+			return fail(fmt.Errorf("uploading part: %w", err))
+		}
+		upload.Parts = append(upload.Parts, *part)
+		pending.Reset()
+	}
+	// A chunk running past Upload-Length is refused whole
+	if readErr == nil && upload.Offset+received == upload.Length {
+		if n, _ := io.ReadFull(chunk, make([]byte, 1)); n > 0 {
+			return fail(fmt.Errorf("%w: chunk runs past Upload-Length %d", ErrFileTooLarge, upload.Length))
+		}
+	}
+	if received == 0 {
+		if readErr != nil {
+			return fmt.Errorf("reading upload chunk: %w", readErr)
+		}
+		return nil
+	}
+
+	upload.Offset += received
+	upload.TailKey = ""
+	if pending.Len() > 0 {
+		upload.TailKey = tusKey(upload.ID, "tail-"+uuid.New().String())
+		if _, err := service.blobStore.Put(ctx, upload.TailKey, &pending, "application/octet-stream"); err != nil {
+			return fail(fmt.Errorf("storing upload tail: %w", err))
+		}
+	}
+	upload.ExpiresAt = time.Now().Add(service.config.TusUploadExpiry)
+
+	if err := service.imageRepo.UpdateTusUpload(ctx, *upload, previous.Offset); err != nil {
+		service.deleteObjects(ctx, nonEmpty([]string{upload.TailKey}))
+		if errors.Is(err, ErrUploadConflict) {
+			err = fmt.Errorf("%w: another chunk was written concurrently", err)
+		}
+		return fail(err)
+	}
+	service.deleteObjects(ctx, nonEmpty([]string{previous.TailKey}))
+
+	if readErr != nil {
+		return fmt.Errorf("reading upload chunk: %w", readErr)
+	}
+	return nil
+}
+
+// finishTusUpload saves a fully received upload as an image. Uploads the
+// image cannot be made from are discarded.
+func (service *imageService) finishTusUpload(ctx context.Context, upload *TusUpload) error {
+	// A retry after the image was saved only has to record the completion
+	_, err := service.imageRepo.GetImageByID(ctx, upload.ID)
+	if err == nil {
+		return service.completeTusUpload(ctx, upload)
+	}
+	if !errors.Is(err, ErrImageNotFound) {
+		return fmt.Errorf("checking for completed upload: %w", err)
+	}
+
+	filename, contentType, opts, err := parseTusMetadata(upload.Metadata)
+	if err != nil {
+		return err
+	}
+	if filename == "" {
+		filename = upload.ID
+	}
+
+	key, err := service.assembleTusUpload(ctx, upload)
+	if err != nil {
+		return err
+	}
+	body, _, err := service.blobStore.Get(ctx, key)
+	if err != nil {
+		return fmt.Errorf("reading assembled upload: %w", err)
+	}
+	defer body.Close()
+
+	if _, err := service.createImage(ctx, upload.ID, upload.OwnerID, body, "", filename, contentType, upload.Length, opts); err != nil {
+		if isRejectedUpload(err) {
+			if deleteErr := service.imageRepo.DeleteTusUpload(ctx, upload.ID); deleteErr != nil {
+				log.Printf("Failed to delete rejected tus upload %s: %v", upload.ID, deleteErr)
+			}
+			service.deleteTusObjects(ctx, *upload)
+		}
+		return err
+	}
+
+	return service.completeTusUpload(ctx, upload)
+}
+
+// assembleTusUpload returns the key of the object holding the whole upload.
+// Uploads smaller than a part are the tail object itself; others complete
+// the multipart upload with the tail as the last part, unless an earlier
+// attempt already did.
+func (service *imageService) assembleTusUpload(ctx context.Context, upload *TusUpload) (string, error) {
+	if upload.MultipartID == "" {
+		return upload.TailKey, nil
+	}
+
+	_, err := service.blobStore.Head(ctx, upload.S3Key)
+	if err == nil {
+		return upload.S3Key, nil
+	}
+	if !errors.Is(err, storage.ErrObjectNotFound) {
+		return "", fmt.Errorf("checking assembled upload: %w", err)
+	}
+
+	uploader := storage.MultipartUploads(service.blobStore)
+	parts := upload.Parts
+	if upload.TailKey != "" {
+		var tail bytes.Buffer
+		if err := service.readObject(ctx, upload.TailKey, &tail); err != nil {
+			return "", fmt.Errorf("reading upload tail: %w", err)
+		}
+		part, err := uploader.UploadPart(ctx, upload.S3Key, upload.MultipartID, len(parts)+1, bytes.NewReader(tail.Bytes()))
+		if err != nil {
+			return "", fmt.Errorf("uploading last part: %w", err)
+		}
+		parts = append(parts[:len(parts):len(parts)], *part)
+	}
+
+	if _, err := uploader.CompleteMultipartUpload(ctx, upload.S3Key, upload.MultipartID, parts); err != nil {
+		return "", fmt.Errorf("completing multipart upload: %w", err)
+	}
+	return upload.S3Key, nil
+}
+
+// completeTusUpload records that an upload became its image and removes the
+// objects that held it. The record is kept until it expires so clients can
+// still ask for the final offset.
+func (service *imageService) completeTusUpload(ctx context.Context, upload *TusUpload) error {
+	objects := nonEmpty([]string{upload.TailKey, upload.S3Key})
+
+	now := time.Now()
+	upload.TailKey = ""
+	upload.CompletedAt = &now
+	upload.ExpiresAt = now.Add(service.config.TusUploadExpiry)
+	if err := service.imageRepo.UpdateTusUpload(ctx, *upload, upload.Offset); err != nil {
+		return fmt.Errorf("recording completed upload: %w", err)
+	}
+
+	// The image has its own copy under its content-addressed key
+	service.deleteObjects(ctx, objects)
+	return nil
+}
+
+// deleteTusObjects aborts an upload's multipart upload and removes its
+// objects. Failures are only logged; an object left behind is never served.
+func (service *imageService) deleteTusObjects(ctx context.Context, upload TusUpload) {
+	if upload.MultipartID != "" && upload.CompletedAt == nil {
+		err := storage.MultipartUploads(service.blobStore).AbortMultipartUpload(ctx, upload.S3Key, upload.MultipartID)
+		if err != nil && !errors.Is(err, storage.ErrObjectNotFound) {
+			log.Printf("Failed to abort multipart upload of tus upload %s: %v", upload.ID, err)
+		}
+	}
+	service.deleteObjects(ctx, nonEmpty([]string{upload.TailKey, upload.S3Key}))
+}
+
+// deleteExpiredTusUploads removes expired resumable uploads and the bytes
+// received for them
+func (service *imageService) deleteExpiredTusUploads(ctx context.Context) {
+	expired, err := service.imageRepo.DeleteExpiredTusUploads(ctx, time.Now())
+	if err != nil {
+		log.Printf("Failed to delete expired tus uploads: %v", err)
+		return
+	}
+	for _, upload := range expired {
+		service.deleteTusObjects(ctx, upload)
+	}
+}
+
+// readObject copies a whole object into buf
+func (service *imageService) readObject(ctx context.Context, key string, buf *bytes.Buffer) error {
+	body, _, err := service.blobStore.Get(ctx, key)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	_, err = buf.ReadFrom(body)
+	return err
+}
+
+// parseTusMetadata reads the file name, content type and upload options from
+// a tus Upload-Metadata header: comma-separated pairs of a key and a base64
+// value, where the value may be left out
+func parseTusMetadata(header string) (filename, contentType string, opts UploadOptions, err error) {
+	values := make(map[string]string)
+	for _, pair := range strings.Split(header, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+
+		key, encoded, _ := strings.Cut(pair, " ")
+		if _, duplicate := values[key]; duplicate {
+			return "", "", opts, fmt.Errorf("%w: Upload-Metadata repeats %q", ErrInvalidUpload, key)
+		}
+		value, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+		if err != nil || !utf8.Valid(value) {
+			return "", "", opts, fmt.Errorf("%w: Upload-Metadata value of %q is not base64 encoded text", ErrInvalidUpload, key)
+		}
+		values[key] = string(value)
+	}
+
+	opts = UploadOptions{
+		Tags:        parseTagList(values["tags"]),
+		Title:       values["title"],
+		Description: values["description"],
+		AltText:     values["alt_text"],
+	}
+	if opts.StripMetadata, err = parseStripMetadata(values["strip_metadata"]); err != nil {
+		return "", "", opts, err
+	}
+
+	// tus-js-client sends filename and filetype, Uppy name and type
+	filename, contentType = values["filename"], values["filetype"]
+	if filename == "" {
+		filename = values["name"]
+	}
+	if contentType == "" {
+		contentType = values["type"]
+	}
+	return filename, normalizeContentType(contentType), opts, nil
+}
+
+// tusKey is the key of one of the objects that hold a resumable upload
+func tusKey(id, name string) string {
+	return "tus/" + id + "/" + name
+}
@@ -0,0 +1,167 @@
+package image
+
+import (
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"file-pub/internal/common"
+)
+
+// apiTusPath is the prefix of the resumable upload API
+const apiTusPath = "/api/v1/tus"
+
+const (
+	// tusVersion is the only tus protocol version served
+	tusVersion = "1.0.0"
+	// tusExtensions lists the tus extensions served
+	tusExtensions = "creation,expiration,termination"
+	// tusChunkType is the content type of PATCH requests
+	tusChunkType = "application/offset+octet-stream"
+)
+
+// HandleTusUploads handles /api/v1/tus: OPTIONS describes the tus server and
+// POST creates a resumable upload
+func (handler *ImageHandler) HandleTusUploads(w http.ResponseWriter, r *http.Request) {
+	if !startTusRequest(w, r) {
+		return
+	}
+
+	switch tusMethod(r) {
+	case http.MethodOptions:
+		handler.writeTusOptions(w)
+	case http.MethodPost:
+		handler.createTusUpload(w, r)
+	default:
+		w.Header().Set("Allow", "OPTIONS, POST")
+		common.WriteJSONError(w, http.StatusMethodNotAllowed, "method_not_allowed", "Method not allowed")
+	}
+}
+
+// HandleTusUpload handles /api/v1/tus/{id}: HEAD reports how much of the
+// upload was received, PATCH appends a chunk and DELETE terminates it. The
+// completed upload is the image with the same ID.
+func (handler *ImageHandler) HandleTusUpload(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimPrefix(r.URL.Path, apiTusPath+"/")
+	if id == "" || strings.Contains(id, "/") {
+		common.WriteJSONError(w, http.StatusNotFound, "not_found", "Unknown API endpoint")
+		return
+	}
+	if !startTusRequest(w, r) {
+		return
+	}
+
+	switch tusMethod(r) {
+	case http.MethodOptions:
+		handler.writeTusOptions(w)
+	case http.MethodHead:
+		handler.headTusUpload(w, r, id)
+	case http.MethodPatch:
+		handler.patchTusUpload(w, r, id)
+	case http.MethodDelete:
+		if err := handler.imageService.TerminateTusUpload(r.Context(), id); err != nil {
+			writeAPIError(w, "terminating tus upload "+id, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.Header().Set("Allow", "OPTIONS, HEAD, PATCH, DELETE")
+		common.WriteJSONError(w, http.StatusMethodNotAllowed, "method_not_allowed", "Method not allowed")
+	}
+}
+
+// writeTusOptions describes the protocol versions, extensions and upload
+// size the server supports
+func (handler *ImageHandler) writeTusOptions(w http.ResponseWriter) {
+	w.Header().Set("Tus-Version", tusVersion)
+	w.Header().Set("Tus-Extension", tusExtensions)
+	w.Header().Set("Tus-Max-Size", strconv.FormatInt(handler.imageService.MaxUploadSize(), 10))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// createTusUpload starts an upload of Upload-Length bytes described by
+// Upload-Metadata. Uploads of unknown length are not supported.
+func (handler *ImageHandler) createTusUpload(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Upload-Defer-Length") != "" {
+		common.WriteJSONError(w, http.StatusBadRequest, "invalid_request", "Upload-Defer-Length is not supported, send Upload-Length")
+		return
+	}
+	length, err := strconv.ParseInt(r.Header.Get("Upload-Length"), 10, 64)
+	if err != nil || length < 0 {
+		common.WriteJSONError(w, http.StatusBadRequest, "invalid_request", "Upload-Length must be a non-negative integer")
+		return
+	}
+
+	upload, err := handler.imageService.CreateTusUpload(r.Context(), length, r.Header.Get("Upload-Metadata"))
+	if err != nil {
+		writeAPIError(w, "creating tus upload", err)
+		return
+	}
+
+	w.Header().Set("Location", apiTusPath+"/"+upload.ID)
+	w.Header().Set("Upload-Expires", upload.ExpiresAt.UTC().Format(http.TimeFormat))
+	w.WriteHeader(http.StatusCreated)
+}
+
+// headTusUpload reports the offset to resume an upload from
+func (handler *ImageHandler) headTusUpload(w http.ResponseWriter, r *http.Request, id string) {
+	upload, err := handler.imageService.GetTusUpload(r.Context(), id)
+	if err != nil {
+		writeAPIError(w, "getting tus upload "+id, err)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+	w.Header().Set("Upload-Length", strconv.FormatInt(upload.Length, 10))
+	if upload.Metadata != "" {
+		w.Header().Set("Upload-Metadata", upload.Metadata)
+	}
+	w.Header().Set("Upload-Expires", upload.ExpiresAt.UTC().Format(http.TimeFormat))
+	w.WriteHeader(http.StatusOK)
+}
+
+// patchTusUpload appends the request body to an upload at Upload-Offset
+func (handler *ImageHandler) patchTusUpload(w http.ResponseWriter, r *http.Request, id string) {
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType != tusChunkType {
+		common.WriteJSONError(w, http.StatusUnsupportedMediaType, "invalid_request", "Content-Type must be "+tusChunkType)
+		return
+	}
+	offset, err := strconv.ParseInt(r.Header.Get("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		common.WriteJSONError(w, http.StatusBadRequest, "invalid_request", "Upload-Offset must be a non-negative integer")
+		return
+	}
+
+	upload, err := handler.imageService.WriteTusUpload(r.Context(), id, offset, r.Body)
+	if err != nil {
+		writeAPIError(w, "writing tus upload "+id, err)
+		return
+	}
+
+	w.Header().Set("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+	w.Header().Set("Upload-Expires", upload.ExpiresAt.UTC().Format(http.TimeFormat))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// startTusRequest sets the header every tus response carries and refuses
+// requests made for another protocol version; OPTIONS needs no version
+func startTusRequest(w http.ResponseWriter, r *http.Request) bool {
+	w.Header().Set("Tus-Resumable", tusVersion)
+	if r.Method != http.MethodOptions && r.Header.Get("Tus-Resumable") != tusVersion {
+		w.Header().Set("Tus-Version", tusVersion)
+		common.WriteJSONError(w, http.StatusPreconditionFailed, "unsupported_version", "Tus-Resumable must be "+tusVersion)
+		return false
+	}
+	return true
+}
+
+// tusMethod returns the request method, honouring X-HTTP-Method-Override on
+// POST for clients that cannot send PATCH or DELETE
+func tusMethod(r *http.Request) string {
+	if override := r.Header.Get("X-HTTP-Method-Override"); override != "" && r.Method == http.MethodPost {
+		return strings.ToUpper(override)
+	}
+	return r.Method
+}
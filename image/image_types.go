@@ -1,15 +1,299 @@
 package image
 
-import "time"
+import (
+	"io"
+	"time"
+
+	"file-pub/storage"
+)
 
 // ImageMetadata represents metadata for an uploaded image
 type ImageMetadata struct {
 	ID           string    `json:"id" db:"id"`
 	Filename     string    `json:"filename" db:"filename"`
 	OriginalName string    `json:"original_name" db:"original_name"`
+	Title        string    `json:"title" db:"title"`
+	Description  string    `json:"description" db:"description"`
+	AltText      string    `json:"alt_text" db:"alt_text"`
 	S3Key        string    `json:"s3_key" db:"s3_key"`
 	S3URL        string    `json:"s3_url" db:"s3_url"`
 	ContentType  string    `json:"content_type" db:"content_type"`
 	Size         int64     `json:"size" db:"size"`
+	Checksum     string    `json:"checksum" db:"checksum"`
 	UploadedAt   time.Time `json:"uploaded_at" db:"uploaded_at"`
+
+	// Private images are only served through share links
+	Private bool `json:"private" db:"private"`
+	// OwnerID is the user who uploaded the image; empty for anonymous uploads
+	OwnerID string `json:"owner_id,omitempty" db:"owner_id"`
+
+	// Width and Height are the stored pixel dimensions, before Orientation
+	// is applied; zero for images uploaded before they were recorded
+	Width  int `json:"width" db:"width"`
+	Height int `json:"height" db:"height"`
+	// Orientation is the EXIF orientation, 1 to 8, or 0 when absent
+	Orientation int        `json:"orientation,omitempty" db:"orientation"`
+	CameraMake  string     `json:"camera_make,omitempty" db:"camera_make"`
+	CameraModel string     `json:"camera_model,omitempty" db:"camera_model"`
+	TakenAt     *time.Time `json:"taken_at,omitempty" db:"taken_at"`
+	Latitude    *float64   `json:"latitude,omitempty" db:"gps_latitude"`
+	Longitude   *float64   `json:"longitude,omitempty" db:"gps_longitude"`
+
+	// PerceptualHash is the image's dHash as 16 hex digits; empty for images
+	// uploaded before it was computed or that could not be decoded
+	PerceptualHash string `json:"perceptual_hash,omitempty" db:"perceptual_hash"`
+
+	// OriginalKey locates the unmodified upload kept when metadata was
+	// stripped; it is never served or exposed
+	OriginalKey string `json:"-" db:"original_key"`
+
+	Tags     []string       `json:"tags,omitempty" db:"-"`
+	Variants []ImageVariant `json:"variants,omitempty" db:"-"`
+
+	// NearDuplicates warns, on upload only, about existing images that look
+	// the same; it is not stored
+	NearDuplicates []NearDuplicate `json:"near_duplicates,omitempty" db:"-"`
+}
+
+// NearDuplicate identifies an image whose perceptual hash is within the
+// similarity threshold of another's
+type NearDuplicate struct {
+	ID       string `json:"id"`
+	Distance int    `json:"distance"`
+}
+
+// SimilarImage is an image with the Hamming distance between its perceptual
+// hash and that of the image it was compared with
+type SimilarImage struct {
+	ImageMetadata
+	Distance int `json:"distance"`
+}
+
+// ImageVariant is a resized rendition of an image stored alongside the original
+type ImageVariant struct {
+	ImageID     string `json:"-" db:"image_id"`
+	Name        string `json:"name" db:"name"`
+	S3Key       string `json:"s3_key" db:"s3_key"`
+	ContentType string `json:"content_type" db:"content_type"`
+	Width       int    `json:"width" db:"width"`
+	Height      int    `json:"height" db:"height"`
+	Size        int64  `json:"size" db:"size"`
+}
+
+// ImageObject is an open, seekable image stream together with its metadata
+type ImageObject struct {
+	Body         io.ReadSeekCloser
+	Metadata     ImageMetadata
+	ContentType  string
+	Size         int64
+	ETag         string
+	LastModified time.Time
+}
+
+// UploadReservation is an image ID and object key handed out for a direct
+// upload, waiting for the client to upload the object and complete it.
+// OwnerID is the user who reserved it, who will own the image.
+type UploadReservation struct {
+	ID          string    `json:"id" db:"id"`
+	S3Key       string    `json:"-" db:"s3_key"`
+	Filename    string    `json:"filename" db:"original_name"`
+	ContentType string    `json:"content_type" db:"content_type"`
+	Size        int64     `json:"size" db:"size"`
+	OwnerID     string    `json:"-" db:"owner_id"`
+	CreatedAt   time.Time `json:"created_at" db:"created_at"`
+	ExpiresAt   time.Time `json:"expires_at" db:"expires_at"`
+}
+
+// DirectUpload is a reservation together with the presigned request that
+// uploads its object straight to the blob store
+type DirectUpload struct {
+	UploadReservation
+	Upload *storage.PresignedRequest `json:"upload"`
+}
+
+// TusUpload is the state of a resumable upload made with the tus protocol.
+// Full parts go to a multipart upload at S3Key and the bytes after them wait
+// in the tail object. The upload becomes the image with the same ID once
+// Offset reaches Length, owned by the user with OwnerID.
+type TusUpload struct {
+	ID          string                  `db:"id"`
+	S3Key       string                  `db:"s3_key"`
+	MultipartID string                  `db:"multipart_id"`
+	Length      int64                   `db:"upload_length"`
+	Offset      int64                   `db:"upload_offset"`
+	Metadata    string                  `db:"metadata"`
+	TailKey     string                  `db:"tail_key"`
+	Parts       []storage.CompletedPart `db:"-"`
+	OwnerID     string                  `db:"owner_id"`
+	CreatedAt   time.Time               `db:"created_at"`
+	ExpiresAt   time.Time               `db:"expires_at"`
+	CompletedAt *time.Time              `db:"completed_at"`
+}
+
+// ImageQuery selects a page of images in newest-first order.
+// After and Before are opaque cursors taken from a previous ImagePage;
+// at most one of them should be set. The remaining fields narrow the
+// results; zero values do not filter.
+type ImageQuery struct {
+	Limit  int
+	After  string
+	Before string
+
+	// Tags keeps images carrying every one of the tags
+	Tags []string
+	// Search keeps images where each word starts a word of the original
+	// name, title or description, or starts one of the image's tags
+	Search string
+	// ContentTypes keeps images of any of the types
+	ContentTypes []string
+	// MinSize and MaxSize bound the size in bytes, inclusively
+	MinSize int64
+	MaxSize int64
+	// UploadedFrom is inclusive and UploadedTo exclusive
+	UploadedFrom time.Time
+	UploadedTo   time.Time
+	// OwnerID keeps the images uploaded by one user
+	OwnerID string
+	// ViewerID is the signed-in user, if any. Private images are left out
+	// unless they belong to the viewer or have no owner.
+	ViewerID string
+}
+
+// UploadOptions carries the optional details supplied with an upload
+type UploadOptions struct {
+	Tags        []string
+	Title       string
+	Description string
+	AltText     string
+	// StripMetadata overrides Config.StripMetadata for this upload when set
+	StripMetadata *bool
+}
+
+// ImageUpdate holds the editable image fields to change; nil fields are left as they are
+type ImageUpdate struct {
+	Title       *string `json:"title"`
+	Description *string `json:"description"`
+	AltText     *string `json:"alt_text"`
+	Private     *bool   `json:"private"`
+}
+
+// ShareLink opens a private image until it expires, is revoked or has been
+// downloaded MaxDownloads times
+type ShareLink struct {
+	ID      string `json:"id" db:"id"`
+	ImageID string `json:"image_id" db:"image_id"`
+	// URL is the signed path of the image, to be resolved against the site
+	URL       string    `json:"url" db:"-"`
+	ExpiresAt time.Time `json:"expires_at" db:"expires_at"`
+	// MaxDownloads limits the downloads of the image; 0 is unlimited
+	MaxDownloads int       `json:"max_downloads" db:"max_downloads"`
+	Downloads    int       `json:"downloads" db:"download_count"`
+	PasswordHash string    `json:"-" db:"password_hash"`
+	Protected    bool      `json:"password_protected" db:"-"`
+	CreatedAt    time.Time `json:"created_at" db:"created_at"`
+	// UnlockToken stands in for the password once it has been checked
+	UnlockToken string `json:"-" db:"-"`
+}
+
+// ShareLinkOptions configures a new share link
+type ShareLinkOptions struct {
+	ExpiresAt    time.Time `json:"expires_at"`
+	MaxDownloads int       `json:"max_downloads"`
+	Password     string    `json:"password"`
+}
+
+// ShareAccess is what a request for a private image presents: the signed
+// link parameters and, for protected links, the password or the unlock
+// token issued for it
+type ShareAccess struct {
+	LinkID      string
+	Expires     string
+	Signature   string
+	Password    string
+	UnlockToken string
+}
+
+// ImagePage is one page of images in newest-first order
+type ImagePage struct {
+	Images     []ImageMetadata `json:"images"`
+	Total      int64           `json:"total"`
+	NextCursor string          `json:"next_cursor,omitempty"`
+	PrevCursor string          `json:"prev_cursor,omitempty"`
+}
+
+// Config holds tunable settings for the image service
+type Config struct {
+	// DefaultPageSize is used when a query does not specify a limit
+	DefaultPageSize int
+	// MaxPageSize caps the limit a client may request
+	MaxPageSize int
+	// ThumbnailSizes are the bounding-box sizes, in pixels, of the variants
+	// generated on upload; empty disables variant generation
+	ThumbnailSizes []int
+	// TransformSizes allow-lists the w and h values accepted for on-the-fly
+	// transformations; empty disables transformations
+	TransformSizes []int
+	// TransformQualities allow-lists the q values accepted for transformations
+	TransformQualities []int
+	// MaxUploadSize is the largest accepted upload in bytes
+	MaxUploadSize int64
+	// TypeSizeLimits optionally overrides MaxUploadSize per detected content type
+	TypeSizeLimits map[string]int64
+	// StripMetadata removes EXIF, XMP and IPTC metadata from uploads by
+	// default, applying their orientation, so the served image carries none
+	StripMetadata bool
+	// SimilarityThreshold is the largest Hamming distance, out of 64 bits,
+	// between the perceptual hashes of images considered similar
+	SimilarityThreshold int
+	// WarnNearDuplicates reports similar existing images when uploading
+	WarnNearDuplicates bool
+	// KeepOriginals stores the unmodified upload under originals/ when
+	// metadata is stripped; it is never served
+	KeepOriginals bool
+	// DirectUploadExpiry is how long a presigned direct upload stays valid
+	DirectUploadExpiry time.Duration
+	// TusUploadExpiry is how long a resumable upload is kept after its last
+	// chunk arrived
+	TusUploadExpiry time.Duration
+	// ShareLinkSecret signs share links and must not be empty
+	ShareLinkSecret []byte
+	// MaxShareLinkExpiry is the longest a share link may stay valid
+	MaxShareLinkExpiry time.Duration
+	// ChangeUnowned lets anyone change images without an owner, uploaded
+	// anonymously or before accounts existed. Otherwise nobody may until
+	// they are given an owner.
+	ChangeUnowned bool
+}
+
+// DefaultConfig returns the default image service settings
+func DefaultConfig() Config {
+	return Config{
+		DefaultPageSize:     24,
+		MaxPageSize:         100,
+		ThumbnailSizes:      []int{256, 1024},
+		TransformSizes:      []int{64, 128, 256, 320, 400, 480, 640, 800, 1024, 1280, 1600, 1920},
+		TransformQualities:  []int{50, 60, 70, 75, 80, 85, 90, 95},
+		MaxUploadSize:       32 << 20,
+		SimilarityThreshold: 10,
+		DirectUploadExpiry:  15 * time.Minute,
+		TusUploadExpiry:     24 * time.Hour,
+		MaxShareLinkExpiry:  30 * 24 * time.Hour,
+	}
+}
+
+// sizeLimit returns the upload size limit for a content type
+func (config Config) sizeLimit(contentType string) int64 {
+	if limit, ok := config.TypeSizeLimits[contentType]; ok {
+		return limit
+	}
+	return config.MaxUploadSize
+}
+
+// largestSizeLimit returns the largest upload any content type may have
+func (config Config) largestSizeLimit() int64 {
+	largest := config.MaxUploadSize
+	for _, limit := range config.TypeSizeLimits {
+		largest = max(largest, limit)
+	}
+	return largest
 }
@@ -0,0 +1,70 @@
+package image
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// spooledUpload is an upload copied to a temporary file so it can be read
+// more than once (stored, decoded for variants, inspected) without holding
+// the whole file in memory
+type spooledUpload struct {
+	file     *os.File
+	size     int64
+	checksum string
+}
+
+// spoolUpload copies r to a temporary file, computing its size and SHA-256 as
+// it streams. Reading stops with ErrFileTooLarge as soon as more than limit
+// bytes arrive; a limit of 0 or less means no limit.
+func spoolUpload(r io.Reader, limit int64) (*spooledUpload, error) {
+	file, err := os.CreateTemp("", "file-pub-upload-*")
+	if err != nil {
+		return nil, fmt.Errorf("creating upload spool file: %w", err)
+	}
+
+	if limit > 0 {
+		r = io.LimitReader(r, limit+1)
+	}
+
+	hasher := sha256.New()
+	size, err := io.Copy(io.MultiWriter(file, hasher), r)
+	if err == nil && limit > 0 && size > limit {
+		err = fmt.Errorf("%w: upload exceeds %d bytes", ErrFileTooLarge, limit)
+	}
+	if err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		if errors.Is(err, ErrFileTooLarge) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("spooling upload: %w", err)
+	}
+
+	return &spooledUpload{
+		file:     file,
+		size:     size,
+		checksum: hex.EncodeToString(hasher.Sum(nil)),
+	}, nil
+}
+
+// Reader rewinds the spool file and returns it for reading from the start
+func (upload *spooledUpload) Reader() (io.ReadSeeker, error) {
+	if _, err := upload.file.Seek(0, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("rewinding upload spool file: %w", err)
+	}
+	return upload.file, nil
+}
+
+// Close closes and removes the spool file
+func (upload *spooledUpload) Close() error {
+	closeErr := upload.file.Close()
+	if err := os.Remove(upload.file.Name()); err != nil {
+		return err
+	}
+	return closeErr
+}
@@ -0,0 +1,156 @@
+package image
+
+import (
+	"bytes"
+	"fmt"
+	stdimage "image"
+	"image/gif" // also registers the GIF decoder (first frame)
+	"image/jpeg"
+	"image/png"
+	"io"
+	"sort"
+	"strconv"
+
+	"github.com/HugoSmits86/nativewebp"
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp" // register WebP decoder
+)
+
+// maxDecodePixels bounds the images we are willing to decode for processing,
+// protecting against decompression bombs
+const maxDecodePixels = 64 << 20
+
+// variantJPEGQuality is the JPEG quality used for generated variants
+const variantJPEGQuality = 85
+
+// encodedVariant is a generated variant ready to be stored
+type encodedVariant struct {
+	ImageVariant
+	data []byte
+}
+
+// decodeImage decodes an image after checking its dimensions against maxDecodePixels
+func decodeImage(r io.ReadSeeker) (stdimage.Image, string, error) {
+	config, format, err := stdimage.DecodeConfig(r)
+	if err != nil {
+		return nil, "", fmt.Errorf("decoding image header: %w", err)
+	}
+	if config.Width*config.Height > maxDecodePixels {
+		return nil, "", fmt.Errorf("image %dx%d exceeds %d pixel processing limit", config.Width, config.Height, maxDecodePixels)
+	}
+
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return nil, "", err
+	}
+
+	img, format, err := stdimage.Decode(r)
+	if err != nil {
+		return nil, "", fmt.Errorf("decoding image: %w", err)
+	}
+	return img, format, nil
+}
+
+// generateVariants renders src into each requested bounding-box size.
+// Sizes at least as large as the source are skipped; the original serves them.
+func generateVariants(src stdimage.Image, sizes []int) ([]encodedVariant, error) {
+	// Work from the largest size down so each step resamples the previous result
+	ordered := append([]int(nil), sizes...)
+	sort.Sort(sort.Reverse(sort.IntSlice(ordered)))
+
+	var variants []encodedVariant
+	current := src
+	for _, size := range ordered {
+		bounds := current.Bounds()
+		if size <= 0 || (bounds.Dx() <= size && bounds.Dy() <= size) {
+			continue
+		}
+
+		resized := resizeToFit(current, size)
+		data, contentType, err := encodeVariant(resized)
+		if err != nil {
+			return nil, fmt.Errorf("encoding %dpx variant: %w", size, err)
+		}
+
+		variants = append(variants, encodedVariant{
+			ImageVariant: ImageVariant{
+				Name:        strconv.Itoa(size),
+				ContentType: contentType,
+				Width:       resized.Bounds().Dx(),
+				Height:      resized.Bounds().Dy(),
+				Size:        int64(len(data)),
+			},
+			data: data,
+		})
+		current = resized
+	}
+
+	return variants, nil
+}
+
+// resizeToFit scales src down to fit within a size x size box, keeping its aspect ratio
+func resizeToFit(src stdimage.Image, size int) stdimage.Image {
+	bounds := src.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width >= height {
+		height = max(1, height*size/width)
+		width = size
+	} else {
+		width = max(1, width*size/height)
+		height = size
+	}
+
+	dst := stdimage.NewRGBA(stdimage.Rect(0, 0, width, height))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), src, bounds, draw.Src, nil)
+	return dst
+}
+
+// encodeVariant encodes opaque images as JPEG and images with transparency as PNG
+func encodeVariant(img stdimage.Image) ([]byte, string, error) {
+	return encodeImage(img, "", variantJPEGQuality)
+}
+
+// encodeImage encodes img in the given format ("jpeg", "png", "gif" or
+// lossless "webp").
+// An empty format picks JPEG for opaque images and PNG otherwise.
+func encodeImage(img stdimage.Image, format string, quality int) ([]byte, string, error) {
+	if format == "" {
+		format = "jpeg"
+		if opaque, ok := img.(interface{ Opaque() bool }); ok && !opaque.Opaque() {
+			format = "png"
+		}
+	}
+
+	var buf bytes.Buffer
+	var err error
+	switch format {
+	case "jpeg":
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality})
+	case "png":
+		err = png.Encode(&buf, img)
+	case "gif":
+		err = gif.Encode(&buf, img, nil)
+	case "webp":
+		err = nativewebp.Encode(&buf, img, nil)
+	default:
+		return nil, "", fmt.Errorf("%w: unsupported output format %q", ErrInvalidTransform, format)
+	}
+	if err != nil {
+		return nil, "", err
+	}
+
+	return buf.Bytes(), "image/" + format, nil
+}
+
+// variantExtension returns the file extension for a variant content type
+func variantExtension(contentType string) string {
+	switch contentType {
+	case "image/png":
+		return ".png"
+	case "image/gif":
+		return ".gif"
+	case "image/webp":
+		return ".webp"
+	default:
+		return ".jpg"
+	}
+}
@@ -0,0 +1,23 @@
+package common
+
+import "context"
+
+// Identity is the signed-in user a request is made by
+type Identity struct {
+	ID       string
+	Username string
+}
+
+// identityKey is the context key of the request's Identity
+type identityKey struct{}
+
+// WithIdentity returns a copy of ctx carrying the signed-in user
+func WithIdentity(ctx context.Context, identity Identity) context.Context {
+	return context.WithValue(ctx, identityKey{}, identity)
+}
+
+// IdentityFromContext returns the signed-in user carried by ctx, if any
+func IdentityFromContext(ctx context.Context) (Identity, bool) {
+	identity, ok := ctx.Value(identityKey{}).(Identity)
+	return identity, ok
+}
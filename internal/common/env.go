@@ -1,6 +1,12 @@
 package common
 
-import "os"
+import (
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
 
 // GetEnv gets an environment variable or returns a default value
 func GetEnv(key, defaultValue string) string {
@@ -9,3 +15,115 @@ func GetEnv(key, defaultValue string) string {
 	}
 	return defaultValue
 }
+
+// GetEnvInt gets an integer environment variable or returns a default value.
+// Invalid values are logged and the default is used.
+func GetEnvInt(key string, defaultValue int) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+
+	parsed, err := strconv.Atoi(value)
+	if err != nil {
+		log.Printf("Invalid integer for %s=%q, using default %d", key, value, defaultValue)
+		return defaultValue
+	}
+	return parsed
+}
+
+// GetEnvIntList gets a comma-separated list of integers from an environment
+// variable or returns a default value. An explicitly empty list ("none")
+// returns nil. Invalid values are logged and the default is used.
+func GetEnvIntList(key string, defaultValue []int) []int {
+	value := strings.TrimSpace(os.Getenv(key))
+	if value == "" {
+		return defaultValue
+	}
+	if value == "none" {
+		return nil
+	}
+
+	var parsed []int
+	for _, field := range strings.Split(value, ",") {
+		n, err := strconv.Atoi(strings.TrimSpace(field))
+		if err != nil {
+			log.Printf("Invalid integer list for %s=%q, using default %v", key, value, defaultValue)
+			return defaultValue
+		}
+		parsed = append(parsed, n)
+	}
+	return parsed
+}
+
+// GetEnvInt64 gets a 64-bit integer environment variable or returns a default value.
+// Invalid values are logged and the default is used.
+func GetEnvInt64(key string, defaultValue int64) int64 {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+
+	parsed, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		log.Printf("Invalid integer for %s=%q, using default %d", key, value, defaultValue)
+		return defaultValue
+	}
+	return parsed
+}
+
+// GetEnvInt64Map gets a comma-separated list of name=integer pairs from an
+// environment variable, e.g. "image/gif=10485760,image/png=20971520".
+// Invalid entries are logged and skipped.
+func GetEnvInt64Map(key string) map[string]int64 {
+	value := strings.TrimSpace(os.Getenv(key))
+	if value == "" {
+		return nil
+	}
+
+	parsed := make(map[string]int64)
+	for _, field := range strings.Split(value, ",") {
+		name, number, ok := strings.Cut(strings.TrimSpace(field), "=")
+		n, err := strconv.ParseInt(strings.TrimSpace(number), 10, 64)
+		if !ok || err != nil {
+			log.Printf("Invalid entry %q in %s, skipping", field, key)
+			continue
+		}
+		parsed[strings.TrimSpace(name)] = n
+	}
+	return parsed
+}
+
+// GetEnvBool gets a boolean environment variable (as accepted by
+// strconv.ParseBool) or returns a default value. Invalid values are logged
+// and the default is used.
+func GetEnvBool(key string, defaultValue bool) bool {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+
+	parsed, err := strconv.ParseBool(value)
+	if err != nil {
+		log.Printf("Invalid boolean for %s=%q, using default %t", key, value, defaultValue)
+		return defaultValue
+	}
+	return parsed
+}
+
+// GetEnvDuration gets a duration environment variable (as accepted by
+// time.ParseDuration, e.g. "15m") or returns a default value. Invalid values
+// are logged and the default is used.
+func GetEnvDuration(key string, defaultValue time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+
+	parsed, err := time.ParseDuration(value)
+	if err != nil {
+		log.Printf("Invalid duration for %s=%q, using default %s", key, value, defaultValue)
+		return defaultValue
+	}
+	return parsed
+}
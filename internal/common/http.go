@@ -0,0 +1,47 @@
+package common
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+)
+
+// APIError is the JSON error body returned by API endpoints
+type APIError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// WriteJSON writes v as a JSON response with the given status code
+func WriteJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("Error encoding JSON response: %v", err)
+	}
+}
+
+// WriteJSONError writes a JSON error body of the form {"error": {"code": ..., "message": ...}}
+func WriteJSONError(w http.ResponseWriter, status int, code, message string) {
+	WriteJSON(w, status, map[string]APIError{
+		"error": {Code: code, Message: message},
+	})
+}
+
+// ReadJSON decodes a JSON request body of at most maxBytes into v,
+// rejecting unknown fields and trailing data
+func ReadJSON(w http.ResponseWriter, r *http.Request, maxBytes int64, v interface{}) error {
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBytes))
+	decoder.DisallowUnknownFields()
+
+	if err := decoder.Decode(v); err != nil {
+		return fmt.Errorf("decoding JSON body: %w", err)
+	}
+	if decoder.More() {
+		return errors.New("decoding JSON body: unexpected data after JSON value")
+	}
+	return nil
+}
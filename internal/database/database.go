@@ -0,0 +1,110 @@
+// Package database opens the supported SQL databases and smooths over the
+// differences between their dialects
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	_ "github.com/go-sql-driver/mysql"
+	_ "github.com/lib/pq"
+	_ "modernc.org/sqlite"
+)
+
+// Supported drivers, as selected by DB_DRIVER
+const (
+	DriverMySQL    = "mysql"
+	DriverPostgres = "postgres"
+	DriverSQLite   = "sqlite"
+)
+
+// ValidateDriver returns ErrUnknownDriver for unsupported drivers
+func ValidateDriver(driver string) error {
+	switch driver {
+	case DriverMySQL, DriverPostgres, DriverSQLite:
+		return nil
+	default:
+		return fmt.Errorf("%w: %q", ErrUnknownDriver, driver)
+	}
+}
+
+// Open opens and pings a database with the given driver and DSN
+func Open(driver, dsn string) (*sql.DB, error) {
+	if err := ValidateDriver(driver); err != nil {
+		return nil, err
+	}
+
+	db, err := sql.Open(driver, dsn)
+	if err != nil {
+		return nil, fmt.Errorf("opening %s database: %w", driver, err)
+	}
+
+	if driver == DriverSQLite {
+		// SQLite allows a single writer; one connection avoids SQLITE_BUSY
+		// errors and keeps ":memory:" databases from splitting per connection
+		db.SetMaxOpenConns(1)
+	}
+
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("pinging %s database: %w", driver, err)
+	}
+
+	return db, nil
+}
+
+// MySQLDSN builds a go-sql-driver DSN. Times are parsed into time.Time.
+func MySQLDSN(host, port, user, password, name string) string {
+	return fmt.Sprintf("%s:%s@tcp(%s:%s)/%s?parseTime=true", user, password, host, port, name)
+}
+
+// PostgresDSN builds a lib/pq connection URL
+func PostgresDSN(host, port, user, password, name, sslMode string) string {
+	dsn := url.URL{
+		Scheme:   "postgres",
+		User:     url.UserPassword(user, password),
+		Host:     host + ":" + port,
+		Path:     "/" + name,
+		RawQuery: url.Values{"sslmode": {sslMode}}.Encode(),
+	}
+	return dsn.String()
+}
+
+// SQLiteDSN builds a modernc.org/sqlite DSN for the database file at path.
+// Foreign keys are enforced and times are stored in a sortable text format.
+func SQLiteDSN(path string) string {
+	return "file:" + path + "?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)&_time_format=sqlite"
+}
+
+// Rebind rewrites a query written with "?" placeholders for the driver.
+// Postgres uses numbered placeholders ($1, $2, ...); the others accept "?".
+// Queries must not contain literal question marks.
+func Rebind(driver, query string) string {
+	if driver != DriverPostgres || !strings.Contains(query, "?") {
+		return query
+	}
+
+	var rebound strings.Builder
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			rebound.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		rebound.WriteRune(r)
+	}
+	return rebound.String()
+}
+
+// InsertIgnore rewrites an "INSERT INTO" query so rows that would violate a
+// unique or primary key are skipped instead of failing the statement
+func InsertIgnore(driver, query string) string {
+	if driver == DriverMySQL {
+		return strings.Replace(query, "INSERT INTO", "INSERT IGNORE INTO", 1)
+	}
+	return strings.TrimRight(query, " \t\n") + " ON CONFLICT DO NOTHING"
+}
@@ -0,0 +1,6 @@
+package database
+
+import "errors"
+
+// ErrUnknownDriver indicates an unsupported database driver was configured
+var ErrUnknownDriver = errors.New("unknown database driver")
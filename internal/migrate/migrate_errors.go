@@ -0,0 +1,14 @@
+package migrate
+
+import "errors"
+
+var (
+	// ErrInvalidMigration indicates a migration file is misnamed, duplicated or empty
+	ErrInvalidMigration = errors.New("invalid migration")
+	// ErrIrreversibleMigration indicates a migration has no down script
+	ErrIrreversibleMigration = errors.New("migration cannot be reverted")
+	// ErrUnknownVersion indicates the database has a migration applied that this build does not know
+	ErrUnknownVersion = errors.New("database schema is newer than this build")
+	// ErrLockTimeout indicates another instance held the migration lock for too long
+	ErrLockTimeout = errors.New("timed out waiting for migration lock")
+)
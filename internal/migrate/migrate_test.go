@@ -0,0 +1,32 @@
+package migrate
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestSplitStatements(t *testing.T) {
+	script := `-- Leading comment
+CREATE TABLE a (
+    id INTEGER PRIMARY KEY
+);
+
+INSERT INTO a (id) VALUES (1);
+CREATE TRIGGER a_insert AFTER INSERT ON a
+BEGIN
+    DELETE FROM b WHERE id = new.id;
+    INSERT INTO b (id) VALUES (new.id);
+END;
+DROP TABLE c`
+
+	got := splitStatements(script)
+	want := []string{
+		"CREATE TABLE a (\n    id INTEGER PRIMARY KEY\n)",
+		"INSERT INTO a (id) VALUES (1)",
+		"CREATE TRIGGER a_insert AFTER INSERT ON a\nBEGIN\n    DELETE FROM b WHERE id = new.id;\n    INSERT INTO b (id) VALUES (new.id);\nEND",
+		"DROP TABLE c",
+	}
+	if fmt.Sprintf("%q", got) != fmt.Sprintf("%q", want) {
+		t.Errorf("statements =\n%q\nwant\n%q", got, want)
+	}
+}
@@ -2,53 +2,112 @@ package main
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
 	"html/template"
 	"log"
 	"net/http"
+	"os"
+	"path/filepath"
 
+	"file-pub/album"
 	"file-pub/image"
 	"file-pub/internal/common"
+	"file-pub/internal/database"
+	"file-pub/storage"
+	"file-pub/user"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/s3"
 	"github.com/aws/aws-sdk-go/service/s3/s3manager"
-	_ "github.com/go-sql-driver/mysql"
 )
 
 // Config holds application configuration
 type Config struct {
+	// DBDriver selects the metadata database: "mysql", "postgres" or "sqlite"
+	DBDriver   string
 	DBHost     string
 	DBPort     string
 	DBUser     string
 	DBPassword string
 	DBName     string
+	DBSSLMode  string // postgres only
+	DBPath     string // sqlite only
 	S3Bucket   string
 	S3Region   string
 	Port       string
+
+	// AutoMigrate applies pending schema migrations on startup
+	AutoMigrate bool
+
+	// StorageBackend selects the blob store: "s3", "local" or "memory"
+	StorageBackend   string
+	LocalStoragePath string
+
+	Image image.Config
+	Album album.Config
+	User  user.Config
 }
 
 func main() {
 	config := loadConfig()
 
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := runMigrate(config, os.Args[2:]); err != nil {
+			log.Fatalf("Migration failed: %v", err)
+		}
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "user" {
+		if err := runUser(config, os.Args[2:]); err != nil {
+			log.Fatalf("User command failed: %v", err)
+		}
+		return
+	}
+
 	app, err := initApp(config)
 	if err != nil {
 		log.Fatalf("Failed to initialize app: %v", err)
 	}
 	defer app.DB.Close()
 
-	// Setup routes
-	http.HandleFunc("/", app.ImageHandler.HandleHome)
-	http.HandleFunc("/upload", app.ImageHandler.HandleUpload)
-	http.HandleFunc("/image/", app.ImageHandler.HandleImageProxy)
+	// Setup routes. Unless anonymous access is enabled, everything but
+	// albums, image files and share links requires signing in.
+	requireUser := app.UserHandler.RequireUser
+	http.HandleFunc("/", requireUser(app.ImageHandler.HandleHome))
+	http.HandleFunc("/upload", requireUser(app.ImageHandler.HandleUpload))
+	http.HandleFunc("/image/", app.handleImage)
+	http.HandleFunc("/api/v1/images", requireUser(app.ImageHandler.HandleAPIImages))
+	http.HandleFunc("/api/v1/images/", requireUser(app.ImageHandler.HandleAPIImage))
+	http.HandleFunc("/api/v1/uploads", requireUser(app.ImageHandler.HandleAPIUploads))
+	http.HandleFunc("/api/v1/uploads/", requireUser(app.ImageHandler.HandleAPIUpload))
+	http.HandleFunc("/api/v1/tus", requireUser(app.ImageHandler.HandleTusUploads))
+	http.HandleFunc("/api/v1/tus/", requireUser(app.ImageHandler.HandleTusUpload))
+	http.HandleFunc("/album/", app.AlbumHandler.HandleAlbumPage)
+	http.HandleFunc("/api/v1/albums", requireUser(app.AlbumHandler.HandleAPIAlbums))
+	http.HandleFunc("/api/v1/albums/", requireUser(app.AlbumHandler.HandleAPIAlbum))
+	http.HandleFunc("/login", app.UserHandler.HandleLogin)
+	http.HandleFunc("/logout", app.UserHandler.HandleLogout)
+	http.HandleFunc("/signup", app.UserHandler.HandleSignup)
 	http.HandleFunc("/health", app.handleHealth)
 
 	log.Printf("Server starting on port %s", config.Port)
-	log.Printf("Database: %s@%s:%s/%s", config.DBUser, config.DBHost, config.DBPort, config.DBName)
-	log.Printf("S3 Bucket: %s (Region: %s)", config.S3Bucket, config.S3Region)
+	if config.DBDriver == database.DriverSQLite {
+		log.Printf("Database: sqlite %s", config.DBPath)
+	} else {
+		log.Printf("Database: %s %s@%s:%s/%s", config.DBDriver, config.DBUser, config.DBHost, config.DBPort, config.DBName)
+	}
+	if config.StorageBackend == "s3" {
+		log.Printf("S3 Bucket: %s (Region: %s)", config.S3Bucket, config.S3Region)
+	} else {
+		log.Printf("Storage: %s", config.StorageBackend)
+	}
+	if config.User.AnonymousAccess {
+		log.Printf("Anonymous access is enabled; anyone can upload and browse images")
+	}
 
-	if err := http.ListenAndServe(":"+config.Port, nil); err != nil {
+	if err := http.ListenAndServe(":"+config.Port, app.UserHandler.Authenticate(http.DefaultServeMux)); err != nil {
 		log.Fatalf("Server failed to start: %v", err)
 	}
 }
@@ -56,62 +115,95 @@ func main() {
 // App holds application dependencies
 type App struct {
 	DB           *sql.DB
-	S3Client     *s3.S3
+	S3Client     *s3.S3 // nil unless the s3 storage backend is selected
+	BlobStore    storage.BlobStore
 	ImageHandler *image.ImageHandler
+	AlbumHandler *album.AlbumHandler
+	UserHandler  *user.UserHandler
 	Config       Config
 }
 
 func loadConfig() Config {
 	config := Config{
+		DBDriver:   common.GetEnv("DB_DRIVER", database.DriverMySQL),
 		DBHost:     common.GetEnv("DB_HOST", "localhost"),
-		DBPort:     common.GetEnv("DB_PORT", "3306"),
 		DBUser:     common.GetEnv("DB_USER", "root"),
 		DBPassword: common.GetEnv("DB_PASSWORD", "password"),
 		DBName:     common.GetEnv("DB_NAME", "filepub"),
+		DBSSLMode:  common.GetEnv("DB_SSLMODE", "require"),
+		DBPath:     common.GetEnv("DB_PATH", "data/filepub.db"),
 		S3Bucket:   common.GetEnv("S3_BUCKET", ""),
 		S3Region:   common.GetEnv("S3_REGION", "us-east-1"),
 		Port:       common.GetEnv("PORT", "8080"),
+
+		AutoMigrate: common.GetEnvBool("AUTO_MIGRATE", true),
+
+		StorageBackend:   common.GetEnv("STORAGE_BACKEND", "s3"),
+		LocalStoragePath: common.GetEnv("LOCAL_STORAGE_PATH", "data/blobs"),
 	}
 
-	if config.S3Bucket == "" {
-		log.Fatal("S3_BUCKET environment variable is required")
+	defaultPort := "3306"
+	if config.DBDriver == database.DriverPostgres {
+		defaultPort = "5432"
 	}
+	config.DBPort = common.GetEnv("DB_PORT", defaultPort)
+
+	config.Image = image.DefaultConfig()
+	config.Image.DefaultPageSize = common.GetEnvInt("PAGE_SIZE", config.Image.DefaultPageSize)
+	config.Image.MaxPageSize = common.GetEnvInt("MAX_PAGE_SIZE", config.Image.MaxPageSize)
+	config.Image.ThumbnailSizes = common.GetEnvIntList("THUMBNAIL_SIZES", config.Image.ThumbnailSizes)
+	config.Image.TransformSizes = common.GetEnvIntList("TRANSFORM_SIZES", config.Image.TransformSizes)
+	config.Image.TransformQualities = common.GetEnvIntList("TRANSFORM_QUALITIES", config.Image.TransformQualities)
+	config.Image.MaxUploadSize = common.GetEnvInt64("MAX_UPLOAD_SIZE", config.Image.MaxUploadSize)
+	config.Image.TypeSizeLimits = common.GetEnvInt64Map("UPLOAD_TYPE_LIMITS")
+	config.Image.StripMetadata = common.GetEnvBool("STRIP_METADATA", config.Image.StripMetadata)
+	config.Image.KeepOriginals = common.GetEnvBool("KEEP_ORIGINALS", config.Image.KeepOriginals)
+	config.Image.SimilarityThreshold = common.GetEnvInt("SIMILARITY_THRESHOLD", config.Image.SimilarityThreshold)
+	config.Image.WarnNearDuplicates = common.GetEnvBool("WARN_NEAR_DUPLICATES", config.Image.WarnNearDuplicates)
+	config.Image.DirectUploadExpiry = common.GetEnvDuration("DIRECT_UPLOAD_EXPIRY", config.Image.DirectUploadExpiry)
+	config.Image.TusUploadExpiry = common.GetEnvDuration("TUS_UPLOAD_EXPIRY", config.Image.TusUploadExpiry)
+	config.Image.ShareLinkSecret = []byte(common.GetEnv("SHARE_LINK_SECRET", ""))
+	config.Image.MaxShareLinkExpiry = common.GetEnvDuration("SHARE_LINK_MAX_EXPIRY", config.Image.MaxShareLinkExpiry)
+
+	config.User = user.DefaultConfig()
+	config.User.SessionDuration = common.GetEnvDuration("SESSION_DURATION", config.User.SessionDuration)
+	config.User.AnonymousAccess = common.GetEnvBool("ANONYMOUS_ACCESS", config.User.AnonymousAccess)
+	config.User.AllowSignup = common.GetEnvBool("ALLOW_SIGNUP", config.User.AllowSignup)
+	config.User.SecureCookies = common.GetEnvBool("SECURE_COOKIES", config.User.SecureCookies)
+
+	// Images and albums without an owner stay editable only while anyone may use the site
+	config.Album = album.DefaultConfig()
+	config.Image.ChangeUnowned = config.User.AnonymousAccess
+	config.Album.ChangeUnowned = config.User.AnonymousAccess
 
 	return config
 }
 
 func initApp(config Config) (*App, error) {
-	// Initialize database connection
-	dsn := fmt.Sprintf("%s:%s@tcp(%s:%s)/%s?parseTime=true",
-		config.DBUser, config.DBPassword, config.DBHost, config.DBPort, config.DBName)
-
-	db, err := sql.Open("mysql", dsn)
-	if err != nil {
-		return nil, fmt.Errorf("failed to open database: %w", err)
+	// Share links must keep working across restarts and instances
+	if len(config.Image.ShareLinkSecret) == 0 {
+		return nil, errors.New("SHARE_LINK_SECRET must be set")
 	}
 
-	// Test database connection
-	if err := db.Ping(); err != nil {
-		return nil, fmt.Errorf("failed to ping database: %w", err)
+	// Initialize database connection
+	db, err := openDatabase(config)
+	if err != nil {
+		return nil, err
 	}
 
-	// Create table if not exists
-	if err := createTables(db); err != nil {
-		return nil, fmt.Errorf("failed to create tables: %w", err)
+	// Bring the schema up to date
+	if config.AutoMigrate {
+		if err := migrateUp(db, config.DBDriver); err != nil {
+			return nil, fmt.Errorf("failed to migrate database: %w", err)
+		}
 	}
 
-	// Initialize AWS session
-	sess, err := session.NewSession(&aws.Config{
-		Region: aws.String(config.S3Region),
-	})
+	// Initialize blob storage
+	blobStore, s3Client, err := newBlobStore(config)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create AWS session: %w", err)
+		return nil, fmt.Errorf("failed to initialize storage: %w", err)
 	}
 
-	s3Client := s3.New(sess)
-	uploader := s3manager.NewUploader(sess)
-	downloader := s3manager.NewDownloader(sess)
-
 	// Parse templates
 	templates, err := template.ParseGlob("templates/*.html")
 	if err != nil {
@@ -119,34 +211,91 @@ func initApp(config Config) (*App, error) {
 	}
 
 	// Initialize domain services
-	imageRepo := image.NewImageRepository(db)
-	imageService := image.NewImageService(imageRepo, uploader, downloader, config.S3Bucket)
+	imageRepo := image.NewImageRepository(db, config.DBDriver)
+	imageService := image.NewImageService(imageRepo, blobStore, config.Image)
 	imageHandler := image.NewImageHandler(imageService, templates)
 
+	albumRepo := album.NewAlbumRepository(db, config.DBDriver)
+	albumService := album.NewAlbumService(albumRepo, imageService, config.Album)
+	albumHandler := album.NewAlbumHandler(albumService, templates)
+
+	userRepo := user.NewUserRepository(db, config.DBDriver)
+	userService := user.NewUserService(userRepo, config.User)
+	userHandler := user.NewUserHandler(userService, templates, config.User)
+
 	return &App{
 		DB:           db,
 		S3Client:     s3Client,
+		BlobStore:    blobStore,
 		ImageHandler: imageHandler,
+		AlbumHandler: albumHandler,
+		UserHandler:  userHandler,
 		Config:       config,
 	}, nil
 }
 
-func createTables(db *sql.DB) error {
-	query := `
-	CREATE TABLE IF NOT EXISTS images (
-		id VARCHAR(36) PRIMARY KEY,
-		filename VARCHAR(255) NOT NULL,
-		original_name VARCHAR(255) NOT NULL,
-		s3_key VARCHAR(512) NOT NULL,
-		s3_url VARCHAR(1024) NOT NULL,
-		content_type VARCHAR(100) NOT NULL,
-		size BIGINT NOT NULL,
-		uploaded_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-		INDEX idx_uploaded_at (uploaded_at DESC)
-	) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
-	`
-	_, err := db.Exec(query)
-	return err
+// openDatabase opens and pings the database selected by config.DBDriver
+func openDatabase(config Config) (*sql.DB, error) {
+	var dsn string
+	switch config.DBDriver {
+	case database.DriverMySQL:
+		dsn = database.MySQLDSN(config.DBHost, config.DBPort, config.DBUser, config.DBPassword, config.DBName)
+	case database.DriverPostgres:
+		dsn = database.PostgresDSN(config.DBHost, config.DBPort, config.DBUser, config.DBPassword, config.DBName, config.DBSSLMode)
+	case database.DriverSQLite:
+		if err := os.MkdirAll(filepath.Dir(config.DBPath), 0o755); err != nil {
+			return nil, fmt.Errorf("failed to create database directory: %w", err)
+		}
+		dsn = database.SQLiteDSN(config.DBPath)
+	}
+
+	db, err := database.Open(config.DBDriver, dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+	return db, nil
+}
+
+// newBlobStore creates the blob store selected by config.StorageBackend.
+// The S3 client is returned as well so the health check can probe the bucket.
+func newBlobStore(config Config) (storage.BlobStore, *s3.S3, error) {
+	switch config.StorageBackend {
+	case "s3":
+		if config.S3Bucket == "" {
+			return nil, nil, fmt.Errorf("S3_BUCKET environment variable is required")
+		}
+
+		sess, err := session.NewSession(&aws.Config{
+			Region: aws.String(config.S3Region),
+		})
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to create AWS session: %w", err)
+		}
+
+		s3Client := s3.New(sess)
+		uploader := s3manager.NewUploader(sess)
+		return storage.NewS3BlobStore(s3Client, uploader, config.S3Bucket), s3Client, nil
+	case "local":
+		store, err := storage.NewLocalBlobStore(config.LocalStoragePath)
+		if err != nil {
+			return nil, nil, err
+		}
+		return store, nil, nil
+	case "memory":
+		return storage.NewMemoryBlobStore(), nil, nil
+	default:
+		return nil, nil, fmt.Errorf("%w: %q", storage.ErrUnknownBackend, config.StorageBackend)
+	}
+}
+
+// handleImage serves /image/ routes. Image files and share links are public
+// so albums can embed them; editing and managing links requires signing in.
+func (app *App) handleImage(w http.ResponseWriter, r *http.Request) {
+	if image.IsImageView(r) {
+		app.ImageHandler.HandleImageProxy(w, r)
+		return
+	}
+	app.UserHandler.RequireUser(app.ImageHandler.HandleImageProxy)(w, r)
 }
 
 func (app *App) handleHealth(w http.ResponseWriter, r *http.Request) {
@@ -158,17 +307,23 @@ func (app *App) handleHealth(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Check S3 access
-	_, err := app.S3Client.HeadBucket(&s3.HeadBucketInput{
-		Bucket: aws.String(app.Config.S3Bucket),
-	})
-	if err != nil {
-		w.WriteHeader(http.StatusServiceUnavailable)
-		fmt.Fprintf(w, "S3 bucket unhealthy: %v\n", err)
-		return
+	if app.S3Client != nil {
+		_, err := app.S3Client.HeadBucket(&s3.HeadBucketInput{
+			Bucket: aws.String(app.Config.S3Bucket),
+		})
+		if err != nil {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			fmt.Fprintf(w, "S3 bucket unhealthy: %v\n", err)
+			return
+		}
 	}
 
 	w.WriteHeader(http.StatusOK)
 	fmt.Fprintln(w, "OK")
 	fmt.Fprintf(w, "Database: Connected\n")
-	fmt.Fprintf(w, "S3 Bucket: Accessible\n")
+	if app.S3Client != nil {
+		fmt.Fprintf(w, "S3 Bucket: Accessible\n")
+	} else {
+		fmt.Fprintf(w, "Storage: %s\n", app.Config.StorageBackend)
+	}
 }
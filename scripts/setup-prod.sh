@@ -32,6 +32,11 @@ if [ -z "$DB_HOST" ]; then
     exit 1
 fi
 
+if [ -z "$SHARE_LINK_SECRET" ]; then
+    echo "Error: SHARE_LINK_SECRET not set in .env.prod"
+    exit 1
+fi
+
 echo ""
 echo "==================================="
 echo "Production Configuration"
@@ -0,0 +1,47 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"time"
+)
+
+// BlobStore defines the interface for object storage backends
+type BlobStore interface {
+	Put(ctx context.Context, key string, body io.Reader, contentType string) (*ObjectInfo, error)
+	Get(ctx context.Context, key string) (io.ReadCloser, *ObjectInfo, error)
+	GetRange(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error)
+	Delete(ctx context.Context, key string) error
+	Head(ctx context.Context, key string) (*ObjectInfo, error)
+	List(ctx context.Context, prefix string) ([]ObjectInfo, error)
+}
+
+// Presigner is implemented by blob stores that let clients upload an object
+// themselves with a presigned request, without going through the application
+type Presigner interface {
+	PresignPut(ctx context.Context, key, contentType string, expires time.Duration) (*PresignedRequest, error)
+}
+
+// Copier is implemented by blob stores that can copy an object to another key
+// within the store, without its bytes passing through the application
+type Copier interface {
+	Copy(ctx context.Context, srcKey, dstKey, contentType string) (*ObjectInfo, error)
+}
+
+// PresignedRequest is an HTTP request a client sends to the store directly.
+// Every header listed must be sent with the values given.
+type PresignedRequest struct {
+	Method    string            `json:"method"`
+	URL       string            `json:"url"`
+	Headers   map[string]string `json:"headers"`
+	ExpiresAt time.Time         `json:"expires_at"`
+}
+
+// ObjectInfo describes a stored object
+type ObjectInfo struct {
+	Key          string    `json:"key"`
+	Location     string    `json:"location"`
+	ContentType  string    `json:"content_type"`
+	Size         int64     `json:"size"`
+	LastModified time.Time `json:"last_modified"`
+}
@@ -0,0 +1,253 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"file-pub/internal/common"
+)
+
+// localBlobStore implements BlobStore on the local filesystem
+type localBlobStore struct {
+	root string
+}
+
+// NewLocalBlobStore creates a new BlobStore rooted at the given directory,
+// creating the directory if it does not exist
+func NewLocalBlobStore(root string) (BlobStore, error) {
+	cleanedRoot, err := common.CleanAndValidatePath(root)
+	if err != nil {
+		return nil, fmt.Errorf("local blob store root: %w", err)
+	}
+
+	absRoot, err := filepath.Abs(cleanedRoot)
+	if err != nil {
+		return nil, common.WrapFileError("resolve", cleanedRoot, err)
+	}
+
+	if err := os.MkdirAll(absRoot, 0o755); err != nil {
+		return nil, common.WrapFileError("create", absRoot, err)
+	}
+
+	return &localBlobStore{
+		root: absRoot,
+	}, nil
+}
+
+// Put writes an object to disk atomically via a temporary file
+func (store *localBlobStore) Put(ctx context.Context, key string, body io.Reader, contentType string) (*ObjectInfo, error) {
+	objectPath, err := store.resolve(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(objectPath), 0o755); err != nil {
+		return nil, common.WrapFileError("create directory for", objectPath, err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(objectPath), ".upload-*")
+	if err != nil {
+		return nil, common.WrapFileError("create temp", objectPath, err)
+	}
+	defer os.Remove(tmp.Name())
+
+	size, err := io.Copy(tmp, &contextReader{ctx: ctx, reader: body})
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, common.WrapFileError("write", objectPath, err)
+	}
+
+	if err := os.Rename(tmp.Name(), objectPath); err != nil {
+		return nil, common.WrapFileError("rename", objectPath, err)
+	}
+
+	return &ObjectInfo{
+		Key:         key,
+		Location:    "file://" + filepath.ToSlash(objectPath),
+		ContentType: contentType,
+		Size:        size,
+	}, nil
+}
+
+// Copy writes the object under srcKey again under dstKey
+func (store *localBlobStore) Copy(ctx context.Context, srcKey, dstKey, contentType string) (*ObjectInfo, error) {
+	body, _, err := store.Get(ctx, srcKey)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	return store.Put(ctx, dstKey, body, contentType)
+}
+
+// Get opens an object for reading; the caller must close the returned reader
+func (store *localBlobStore) Get(ctx context.Context, key string) (io.ReadCloser, *ObjectInfo, error) {
+	objectPath, err := store.resolve(key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	file, err := os.Open(objectPath)
+	if err != nil {
+		return nil, nil, store.wrapError("open", objectPath, err)
+	}
+
+	stat, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, nil, common.WrapFileError("stat", objectPath, err)
+	}
+
+	return file, store.objectInfo(key, stat), nil
+}
+
+// GetRange opens length bytes of an object starting at offset
+func (store *localBlobStore) GetRange(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error) {
+	if offset < 0 || length <= 0 {
+		return nil, fmt.Errorf("local range offset=%d length=%d: %w", offset, length, ErrInvalidRange)
+	}
+
+	objectPath, err := store.resolve(key)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.Open(objectPath)
+	if err != nil {
+		return nil, store.wrapError("open", objectPath, err)
+	}
+
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		file.Close()
+		return nil, common.WrapFileError("seek", objectPath, err)
+	}
+
+	return &limitedReadCloser{
+		Reader: io.LimitReader(file, length),
+		Closer: file,
+	}, nil
+}
+
+// Delete removes an object from disk
+func (store *localBlobStore) Delete(ctx context.Context, key string) error {
+	objectPath, err := store.resolve(key)
+	if err != nil {
+		return err
+	}
+
+	if err := os.Remove(objectPath); err != nil {
+		return store.wrapError("delete", objectPath, err)
+	}
+
+	return nil
+}
+
+// Head retrieves object information without opening the file
+func (store *localBlobStore) Head(ctx context.Context, key string) (*ObjectInfo, error) {
+	objectPath, err := store.resolve(key)
+	if err != nil {
+		return nil, err
+	}
+
+	stat, err := os.Stat(objectPath)
+	if err != nil {
+		return nil, store.wrapError("stat", objectPath, err)
+	}
+	if stat.IsDir() {
+		return nil, common.WrapFileError("stat", objectPath, ErrObjectNotFound)
+	}
+
+	return store.objectInfo(key, stat), nil
+}
+
+// List returns all objects whose keys start with prefix
+func (store *localBlobStore) List(ctx context.Context, prefix string) ([]ObjectInfo, error) {
+	var objects []ObjectInfo
+	err := filepath.WalkDir(store.root, func(walkPath string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), ".upload-") {
+			return nil
+		}
+
+		relPath, err := filepath.Rel(store.root, walkPath)
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(relPath)
+		if !strings.HasPrefix(key, prefix) {
+			return nil
+		}
+
+		stat, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		objects = append(objects, *store.objectInfo(key, stat))
+		return nil
+	})
+	if err != nil {
+		return nil, common.WrapFileError("list", store.root, err)
+	}
+
+	return objects, nil
+}
+
+// resolve maps an object key to a path inside the store root
+func (store *localBlobStore) resolve(key string) (string, error) {
+	cleanedKey := path.Clean("/" + key)
+	if strings.TrimSpace(key) == "" || cleanedKey == "/" || cleanedKey[1:] != key {
+		return "", fmt.Errorf("%w: %q", ErrInvalidKey, key)
+	}
+
+	return filepath.Join(store.root, filepath.FromSlash(key)), nil
+}
+
+// objectInfo builds ObjectInfo from file information
+func (store *localBlobStore) objectInfo(key string, stat fs.FileInfo) *ObjectInfo {
+	return &ObjectInfo{
+		Key:          key,
+		Location:     "file://" + filepath.ToSlash(filepath.Join(store.root, filepath.FromSlash(key))),
+		ContentType:  mime.TypeByExtension(path.Ext(key)),
+		Size:         stat.Size(),
+		LastModified: stat.ModTime(),
+	}
+}
+
+// wrapError wraps filesystem errors, translating missing files into ErrObjectNotFound
+func (store *localBlobStore) wrapError(operation, objectPath string, err error) error {
+	if os.IsNotExist(err) {
+		return common.WrapFileError(operation, objectPath, ErrObjectNotFound)
+	}
+	return common.WrapFileError(operation, objectPath, err)
+}
+
+// limitedReadCloser pairs a limited reader with the closer of its source
+type limitedReadCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// contextReader stops reading once its context is cancelled
+type contextReader struct {
+	ctx    context.Context
+	reader io.Reader
+}
+
+// Read implements io.Reader
+func (reader *contextReader) Read(p []byte) (int, error) {
+	if err := reader.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return reader.reader.Read(p)
+}
@@ -0,0 +1,176 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// memoryObject is an object held by memoryBlobStore
+type memoryObject struct {
+	data         []byte
+	contentType  string
+	lastModified time.Time
+}
+
+// memoryBlobStore implements BlobStore in process memory
+type memoryBlobStore struct {
+	mu      sync.RWMutex
+	objects map[string]memoryObject
+}
+
+// NewMemoryBlobStore creates a new BlobStore that keeps objects in memory.
+// Objects are lost when the process exits.
+func NewMemoryBlobStore() BlobStore {
+	return &memoryBlobStore{
+		objects: make(map[string]memoryObject),
+	}
+}
+
+// Put stores a copy of body under key
+func (store *memoryBlobStore) Put(ctx context.Context, key string, body io.Reader, contentType string) (*ObjectInfo, error) {
+	if strings.TrimSpace(key) == "" {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidKey, key)
+	}
+
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return nil, fmt.Errorf("memory put key=%s: %w", key, err)
+	}
+
+	object := memoryObject{
+		data:         data,
+		contentType:  contentType,
+		lastModified: time.Now(),
+	}
+
+	store.mu.Lock()
+	store.objects[key] = object
+	store.mu.Unlock()
+
+	return store.objectInfo(key, object), nil
+}
+
+// Copy stores the object under srcKey again under dstKey. Stored data is
+// never modified, so both keys share it.
+func (store *memoryBlobStore) Copy(ctx context.Context, srcKey, dstKey, contentType string) (*ObjectInfo, error) {
+	if strings.TrimSpace(dstKey) == "" {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidKey, dstKey)
+	}
+
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	source, ok := store.objects[srcKey]
+	if !ok {
+		return nil, fmt.Errorf("memory copy key=%s: %w", srcKey, ErrObjectNotFound)
+	}
+	object := memoryObject{
+		data:         source.data,
+		contentType:  contentType,
+		lastModified: time.Now(),
+	}
+	store.objects[dstKey] = object
+
+	return store.objectInfo(dstKey, object), nil
+}
+
+// Get returns a reader over the stored object
+func (store *memoryBlobStore) Get(ctx context.Context, key string) (io.ReadCloser, *ObjectInfo, error) {
+	store.mu.RLock()
+	object, ok := store.objects[key]
+	store.mu.RUnlock()
+
+	if !ok {
+		return nil, nil, fmt.Errorf("memory get key=%s: %w", key, ErrObjectNotFound)
+	}
+
+	return io.NopCloser(bytes.NewReader(object.data)), store.objectInfo(key, object), nil
+}
+
+// GetRange returns a reader over length bytes of the object starting at offset
+func (store *memoryBlobStore) GetRange(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error) {
+	if offset < 0 || length <= 0 {
+		return nil, fmt.Errorf("memory range offset=%d length=%d: %w", offset, length, ErrInvalidRange)
+	}
+
+	store.mu.RLock()
+	object, ok := store.objects[key]
+	store.mu.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("memory get key=%s: %w", key, ErrObjectNotFound)
+	}
+
+	size := int64(len(object.data))
+	if offset >= size {
+		return nil, fmt.Errorf("memory range offset=%d size=%d: %w", offset, size, ErrInvalidRange)
+	}
+	end := offset + length
+	if end > size {
+		end = size
+	}
+
+	return io.NopCloser(bytes.NewReader(object.data[offset:end])), nil
+}
+
+// Delete removes an object
+func (store *memoryBlobStore) Delete(ctx context.Context, key string) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	if _, ok := store.objects[key]; !ok {
+		return fmt.Errorf("memory delete key=%s: %w", key, ErrObjectNotFound)
+	}
+	delete(store.objects, key)
+
+	return nil
+}
+
+// Head retrieves object information
+func (store *memoryBlobStore) Head(ctx context.Context, key string) (*ObjectInfo, error) {
+	store.mu.RLock()
+	object, ok := store.objects[key]
+	store.mu.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("memory head key=%s: %w", key, ErrObjectNotFound)
+	}
+
+	return store.objectInfo(key, object), nil
+}
+
+// List returns all objects whose keys start with prefix, sorted by key
+func (store *memoryBlobStore) List(ctx context.Context, prefix string) ([]ObjectInfo, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+
+	var objects []ObjectInfo
+	for key, object := range store.objects {
+		if strings.HasPrefix(key, prefix) {
+			objects = append(objects, *store.objectInfo(key, object))
+		}
+	}
+
+	sort.Slice(objects, func(i, j int) bool {
+		return objects[i].Key < objects[j].Key
+	})
+
+	return objects, nil
+}
+
+// objectInfo builds ObjectInfo for a stored object
+func (store *memoryBlobStore) objectInfo(key string, object memoryObject) *ObjectInfo {
+	return &ObjectInfo{
+		Key:          key,
+		Location:     "memory://" + key,
+		ContentType:  object.contentType,
+		Size:         int64(len(object.data)),
+		LastModified: object.lastModified,
+	}
+}
@@ -0,0 +1,160 @@
+package storage
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// MinPartSize is the smallest part, other than the last, a multipart upload
+// accepts; it is the S3 limit
+const MinPartSize = 5 << 20
+
+// MultipartUploader assembles an object from parts uploaded one at a time,
+// possibly by different processes
+type MultipartUploader interface {
+	CreateMultipartUpload(ctx context.Context, key, contentType string) (uploadID string, err error)
+	UploadPart(ctx context.Context, key, uploadID string, partNumber int, body io.ReadSeeker) (*CompletedPart, error)
+	CompleteMultipartUpload(ctx context.Context, key, uploadID string, parts []CompletedPart) (*ObjectInfo, error)
+	AbortMultipartUpload(ctx context.Context, key, uploadID string) error
+}
+
+// CompletedPart identifies an uploaded part of a multipart upload
+type CompletedPart struct {
+	PartNumber int    `json:"part_number"`
+	ETag       string `json:"etag"`
+	Size       int64  `json:"size"`
+}
+
+// MultipartUploads returns the store's own multipart uploads, or for stores
+// without them an emulation that keeps each part as an object under
+// multipart/{uploadID}/ until the upload is completed or aborted
+func MultipartUploads(store BlobStore) MultipartUploader {
+	if uploader, ok := store.(MultipartUploader); ok {
+		return uploader
+	}
+	return &objectMultipartUploader{store: store}
+}
+
+// objectMultipartUploader emulates multipart uploads with plain objects
+type objectMultipartUploader struct {
+	store BlobStore
+}
+
+// CreateMultipartUpload starts an upload, recording its content type
+func (uploader *objectMultipartUploader) CreateMultipartUpload(ctx context.Context, key, contentType string) (string, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", fmt.Errorf("generating multipart upload id: %w", err)
+	}
+	uploadID := hex.EncodeToString(id)
+
+	if _, err := uploader.store.Put(ctx, multipartPrefix(uploadID)+"content-type", strings.NewReader(contentType), "text/plain"); err != nil {
+		return "", fmt.Errorf("create multipart upload key=%s: %w", key, err)
+	}
+
+	return uploadID, nil
+}
+
+// UploadPart stores one part, replacing an earlier upload of the same number
+func (uploader *objectMultipartUploader) UploadPart(ctx context.Context, key, uploadID string, partNumber int, body io.ReadSeeker) (*CompletedPart, error) {
+	hash := md5.New()
+	info, err := uploader.store.Put(ctx, partKey(uploadID, partNumber), io.TeeReader(body, hash), "application/octet-stream")
+	if err != nil {
+		return nil, fmt.Errorf("upload part %d key=%s: %w", partNumber, key, err)
+	}
+
+	return &CompletedPart{
+		PartNumber: partNumber,
+		ETag:       `"` + hex.EncodeToString(hash.Sum(nil)) + `"`,
+		Size:       info.Size,
+	}, nil
+}
+
+// CompleteMultipartUpload concatenates the parts into the object at key and
+// removes them
+func (uploader *objectMultipartUploader) CompleteMultipartUpload(ctx context.Context, key, uploadID string, parts []CompletedPart) (*ObjectInfo, error) {
+	contentType, err := uploader.readContentType(ctx, uploadID)
+	if err != nil {
+		return nil, fmt.Errorf("complete multipart upload key=%s: %w", key, err)
+	}
+
+	// Stream the parts in order, opening one at a time
+	reader, writer := io.Pipe()
+	go func() {
+		for _, part := range parts {
+			body, _, err := uploader.store.Get(ctx, partKey(uploadID, part.PartNumber))
+			if err != nil {
+				writer.CloseWithError(err)
+				return
+			}
+			_, err = io.Copy(writer, body)
+			body.Close()
+			if err != nil {
+				writer.CloseWithError(err)
+				return
+			}
+		}
+		writer.Close()
+	}()
+
+	info, err := uploader.store.Put(ctx, key, reader, contentType)
+	reader.CloseWithError(io.ErrClosedPipe)
+	if err != nil {
+		return nil, fmt.Errorf("complete multipart upload key=%s: %w", key, err)
+	}
+
+	if err := uploader.AbortMultipartUpload(ctx, key, uploadID); err != nil {
+		return nil, err
+	}
+
+	return info, nil
+}
+
+// AbortMultipartUpload removes the upload's parts
+func (uploader *objectMultipartUploader) AbortMultipartUpload(ctx context.Context, key, uploadID string) error {
+	objects, err := uploader.store.List(ctx, multipartPrefix(uploadID))
+	if err != nil {
+		return fmt.Errorf("abort multipart upload key=%s: %w", key, err)
+	}
+	if len(objects) == 0 {
+		return fmt.Errorf("abort multipart upload key=%s: %w", key, ErrObjectNotFound)
+	}
+
+	for _, object := range objects {
+		if err := uploader.store.Delete(ctx, object.Key); err != nil {
+			return fmt.Errorf("abort multipart upload key=%s: %w", key, err)
+		}
+	}
+
+	return nil
+}
+
+// readContentType returns the content type recorded when the upload started
+func (uploader *objectMultipartUploader) readContentType(ctx context.Context, uploadID string) (string, error) {
+	body, _, err := uploader.store.Get(ctx, multipartPrefix(uploadID)+"content-type")
+	if err != nil {
+		return "", err
+	}
+	defer body.Close()
+
+	contentType, err := io.ReadAll(body)
+	if err != nil {
+		return "", err
+	}
+	return string(contentType), nil
+}
+
+// multipartPrefix is the key prefix of an emulated upload's objects
+func multipartPrefix(uploadID string) string {
+	return "multipart/" + uploadID + "/"
+}
+
+// partKey is the key of one part of an emulated upload
+func partKey(uploadID string, partNumber int) string {
+	return fmt.Sprintf("%spart-%05d", multipartPrefix(uploadID), partNumber)
+}
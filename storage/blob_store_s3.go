@@ -0,0 +1,322 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"file-pub/internal/common"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+)
+
+// s3BlobStore implements BlobStore on top of an S3 bucket
+type s3BlobStore struct {
+	client   *s3.S3
+	uploader *s3manager.Uploader
+	bucket   string
+}
+
+// NewS3BlobStore creates a new BlobStore backed by S3
+func NewS3BlobStore(client *s3.S3, uploader *s3manager.Uploader, bucket string) BlobStore {
+	common.PanicOnInvalidDependencies("S3BlobStore", map[string]interface{}{
+		"client":   client,
+		"uploader": uploader,
+	})
+
+	if err := common.ValidateNonEmptyString(bucket, "bucket"); err != nil {
+		panic(fmt.Sprintf("S3BlobStore: %v", err))
+	}
+
+	return &s3BlobStore{
+		client:   client,
+		uploader: uploader,
+		bucket:   bucket,
+	}
+}
+
+// Put uploads an object to S3
+func (store *s3BlobStore) Put(ctx context.Context, key string, body io.Reader, contentType string) (*ObjectInfo, error) {
+	result, err := store.uploader.UploadWithContext(ctx, &s3manager.UploadInput{
+		Bucket:      aws.String(store.bucket),
+		Key:         aws.String(key),
+		Body:        body,
+		ContentType: aws.String(contentType),
+	})
+	if err != nil {
+		return nil, common.WrapS3Error("upload", store.bucket, key, err)
+	}
+
+	return &ObjectInfo{
+		Key:         key,
+		Location:    result.Location,
+		ContentType: contentType,
+	}, nil
+}
+
+// PresignPut returns a PUT request that uploads an object of contentType to
+// key, valid for expires. S3 does not sign the length, so callers must check
+// the size of what was uploaded.
+func (store *s3BlobStore) PresignPut(ctx context.Context, key, contentType string, expires time.Duration) (*PresignedRequest, error) {
+	req, _ := store.client.PutObjectRequest(&s3.PutObjectInput{
+		Bucket:      aws.String(store.bucket),
+		Key:         aws.String(key),
+		ContentType: aws.String(contentType),
+	})
+	req.SetContext(ctx)
+
+	url, signedHeaders, err := req.PresignRequest(expires)
+	if err != nil {
+		return nil, common.WrapS3Error("presign upload", store.bucket, key, err)
+	}
+
+	headers := make(map[string]string, len(signedHeaders))
+	for name := range signedHeaders {
+		headers[name] = signedHeaders.Get(name)
+	}
+
+	return &PresignedRequest{
+		Method:    http.MethodPut,
+		URL:       url,
+		Headers:   headers,
+		ExpiresAt: time.Now().Add(expires),
+	}, nil
+}
+
+// Copy copies an object within the bucket with a server-side CopyObject,
+// replacing its content type
+func (store *s3BlobStore) Copy(ctx context.Context, srcKey, dstKey, contentType string) (*ObjectInfo, error) {
+	output, err := store.client.CopyObjectWithContext(ctx, &s3.CopyObjectInput{
+		Bucket:            aws.String(store.bucket),
+		Key:               aws.String(dstKey),
+		CopySource:        aws.String(url.PathEscape(store.bucket + "/" + srcKey)),
+		ContentType:       aws.String(contentType),
+		MetadataDirective: aws.String(s3.MetadataDirectiveReplace),
+	})
+	if err != nil {
+		return nil, store.wrapError("copy "+srcKey+" to", dstKey, err)
+	}
+
+	info := &ObjectInfo{
+		Key:         dstKey,
+		Location:    store.location(dstKey),
+		ContentType: contentType,
+	}
+	if output.CopyObjectResult != nil {
+		info.LastModified = aws.TimeValue(output.CopyObjectResult.LastModified)
+	}
+	return info, nil
+}
+
+// location returns the URL of the object at key, as reported by uploads
+func (store *s3BlobStore) location(key string) string {
+	req, _ := store.client.GetObjectRequest(&s3.GetObjectInput{
+		Bucket: aws.String(store.bucket),
+		Key:    aws.String(key),
+	})
+	if err := req.Build(); err != nil {
+		return ""
+	}
+	location := *req.HTTPRequest.URL
+	location.RawQuery = ""
+	return location.String()
+}
+
+// Get opens an object for reading; the caller must close the returned reader
+func (store *s3BlobStore) Get(ctx context.Context, key string) (io.ReadCloser, *ObjectInfo, error) {
+	output, err := store.client.GetObjectWithContext(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(store.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return nil, nil, store.wrapError("download", key, err)
+	}
+
+	info := &ObjectInfo{
+		Key:          key,
+		ContentType:  aws.StringValue(output.ContentType),
+		Size:         aws.Int64Value(output.ContentLength),
+		LastModified: aws.TimeValue(output.LastModified),
+	}
+
+	return output.Body, info, nil
+}
+
+// GetRange opens length bytes of an object starting at offset
+func (store *s3BlobStore) GetRange(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error) {
+	if offset < 0 || length <= 0 {
+		return nil, fmt.Errorf("s3 range offset=%d length=%d: %w", offset, length, ErrInvalidRange)
+	}
+
+	output, err := store.client.GetObjectWithContext(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(store.bucket),
+		Key:    aws.String(key),
+		Range:  aws.String(fmt.Sprintf("bytes=%d-%d", offset, offset+length-1)),
+	})
+	if err != nil {
+		return nil, store.wrapError("download range", key, err)
+	}
+
+	return output.Body, nil
+}
+
+// Delete removes an object from S3
+func (store *s3BlobStore) Delete(ctx context.Context, key string) error {
+	_, err := store.client.DeleteObjectWithContext(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(store.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return store.wrapError("delete", key, err)
+	}
+
+	return nil
+}
+
+// Head retrieves object information without downloading the body
+func (store *s3BlobStore) Head(ctx context.Context, key string) (*ObjectInfo, error) {
+	output, err := store.client.HeadObjectWithContext(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(store.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return nil, store.wrapError("head", key, err)
+	}
+
+	return &ObjectInfo{
+		Key:          key,
+		ContentType:  aws.StringValue(output.ContentType),
+		Size:         aws.Int64Value(output.ContentLength),
+		LastModified: aws.TimeValue(output.LastModified),
+	}, nil
+}
+
+// List returns all objects whose keys start with prefix
+func (store *s3BlobStore) List(ctx context.Context, prefix string) ([]ObjectInfo, error) {
+	var objects []ObjectInfo
+	err := store.client.ListObjectsV2PagesWithContext(ctx, &s3.ListObjectsV2Input{
+		Bucket: aws.String(store.bucket),
+		Prefix: aws.String(prefix),
+	}, func(page *s3.ListObjectsV2Output, lastPage bool) bool {
+		for _, object := range page.Contents {
+			objects = append(objects, ObjectInfo{
+				Key:          aws.StringValue(object.Key),
+				Size:         aws.Int64Value(object.Size),
+				LastModified: aws.TimeValue(object.LastModified),
+			})
+		}
+		return true
+	})
+	if err != nil {
+		return nil, store.wrapError("list", prefix, err)
+	}
+
+	return objects, nil
+}
+
+// CreateMultipartUpload starts an S3 multipart upload to key
+func (store *s3BlobStore) CreateMultipartUpload(ctx context.Context, key, contentType string) (string, error) {
+	output, err := store.client.CreateMultipartUploadWithContext(ctx, &s3.CreateMultipartUploadInput{
+		Bucket:      aws.String(store.bucket),
+		Key:         aws.String(key),
+		ContentType: aws.String(contentType),
+	})
+	if err != nil {
+		return "", store.wrapError("create multipart upload", key, err)
+	}
+
+	return aws.StringValue(output.UploadId), nil
+}
+
+// UploadPart uploads one part of a multipart upload
+func (store *s3BlobStore) UploadPart(ctx context.Context, key, uploadID string, partNumber int, body io.ReadSeeker) (*CompletedPart, error) {
+	size, err := body.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, fmt.Errorf("s3 upload part %d key=%s: %w", partNumber, key, err)
+	}
+	if _, err := body.Seek(0, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("s3 upload part %d key=%s: %w", partNumber, key, err)
+	}
+
+	output, err := store.client.UploadPartWithContext(ctx, &s3.UploadPartInput{
+		Bucket:     aws.String(store.bucket),
+		Key:        aws.String(key),
+		UploadId:   aws.String(uploadID),
+		PartNumber: aws.Int64(int64(partNumber)),
+		Body:       body,
+	})
+	if err != nil {
+		return nil, store.wrapError(fmt.Sprintf("upload part %d", partNumber), key, err)
+	}
+
+	return &CompletedPart{
+		PartNumber: partNumber,
+		ETag:       aws.StringValue(output.ETag),
+		Size:       size,
+	}, nil
+}
+
+// CompleteMultipartUpload assembles the parts into the object at key
+func (store *s3BlobStore) CompleteMultipartUpload(ctx context.Context, key, uploadID string, parts []CompletedPart) (*ObjectInfo, error) {
+	completed := make([]*s3.CompletedPart, len(parts))
+	for i, part := range parts {
+		completed[i] = &s3.CompletedPart{
+			PartNumber: aws.Int64(int64(part.PartNumber)),
+			ETag:       aws.String(part.ETag),
+		}
+	}
+
+	output, err := store.client.CompleteMultipartUploadWithContext(ctx, &s3.CompleteMultipartUploadInput{
+		Bucket:          aws.String(store.bucket),
+		Key:             aws.String(key),
+		UploadId:        aws.String(uploadID),
+		MultipartUpload: &s3.CompletedMultipartUpload{Parts: completed},
+	})
+	if err != nil {
+		return nil, store.wrapError("complete multipart upload", key, err)
+	}
+
+	return &ObjectInfo{
+		Key:      key,
+		Location: aws.StringValue(output.Location),
+	}, nil
+}
+
+// AbortMultipartUpload discards a multipart upload and its parts
+func (store *s3BlobStore) AbortMultipartUpload(ctx context.Context, key, uploadID string) error {
+	_, err := store.client.AbortMultipartUploadWithContext(ctx, &s3.AbortMultipartUploadInput{
+		Bucket:   aws.String(store.bucket),
+		Key:      aws.String(key),
+		UploadId: aws.String(uploadID),
+	})
+	if err != nil {
+		return store.wrapError("abort multipart upload", key, err)
+	}
+
+	return nil
+}
+
+// wrapError wraps S3 errors, translating missing objects into ErrObjectNotFound
+func (store *s3BlobStore) wrapError(operation, key string, err error) error {
+	if isS3NotFound(err) {
+		return common.WrapS3Error(operation, store.bucket, key, ErrObjectNotFound)
+	}
+	return common.WrapS3Error(operation, store.bucket, key, err)
+}
+
+// isS3NotFound reports whether err signals a missing S3 object
+func isS3NotFound(err error) bool {
+	if reqErr, ok := err.(awserr.RequestFailure); ok && reqErr.StatusCode() == http.StatusNotFound {
+		return true
+	}
+	if awsErr, ok := err.(awserr.Error); ok {
+		return awsErr.Code() == s3.ErrCodeNoSuchKey || awsErr.Code() == s3.ErrCodeNoSuchUpload || awsErr.Code() == "NotFound"
+	}
+	return false
+}
@@ -0,0 +1,95 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// objectReader is a seekable reader over a stored object. It opens a ranged
+// read lazily on the first Read after each Seek, so only the bytes actually
+// requested are fetched from the backend.
+type objectReader struct {
+	ctx    context.Context
+	store  BlobStore
+	key    string
+	size   int64
+	offset int64
+	body   io.ReadCloser
+}
+
+// NewObjectReader returns an io.ReadSeekCloser over the object stored under key.
+// size must be the object's length in bytes.
+func NewObjectReader(ctx context.Context, store BlobStore, key string, size int64) io.ReadSeekCloser {
+	return &objectReader{
+		ctx:   ctx,
+		store: store,
+		key:   key,
+		size:  size,
+	}
+}
+
+// Read implements io.Reader
+func (reader *objectReader) Read(p []byte) (int, error) {
+	if reader.offset >= reader.size {
+		return 0, io.EOF
+	}
+
+	if reader.body == nil {
+		body, err := reader.store.GetRange(reader.ctx, reader.key, reader.offset, reader.size-reader.offset)
+		if err != nil {
+			return 0, err
+		}
+		reader.body = body
+	}
+
+	n, err := reader.body.Read(p)
+	reader.offset += int64(n)
+	if err == io.EOF && reader.offset < reader.size {
+		err = io.ErrUnexpectedEOF
+	}
+	return n, err
+}
+
+// Seek implements io.Seeker
+func (reader *objectReader) Seek(offset int64, whence int) (int64, error) {
+	var target int64
+	switch whence {
+	case io.SeekStart:
+		target = offset
+	case io.SeekCurrent:
+		target = reader.offset + offset
+	case io.SeekEnd:
+		target = reader.size + offset
+	default:
+		return 0, fmt.Errorf("seek whence=%d: %w", whence, ErrInvalidRange)
+	}
+	if target < 0 {
+		return 0, errors.New("seek before start of object")
+	}
+
+	if target != reader.offset {
+		if err := reader.closeBody(); err != nil {
+			return 0, err
+		}
+		reader.offset = target
+	}
+
+	return target, nil
+}
+
+// Close implements io.Closer
+func (reader *objectReader) Close() error {
+	return reader.closeBody()
+}
+
+// closeBody closes the currently open ranged read, if any
+func (reader *objectReader) closeBody() error {
+	if reader.body == nil {
+		return nil
+	}
+	err := reader.body.Close()
+	reader.body = nil
+	return err
+}
@@ -0,0 +1,14 @@
+package storage
+
+import "errors"
+
+var (
+	// ErrObjectNotFound indicates the requested object does not exist in the store
+	ErrObjectNotFound = errors.New("object not found")
+	// ErrInvalidKey indicates the object key is empty or escapes the store root
+	ErrInvalidKey = errors.New("invalid object key")
+	// ErrInvalidRange indicates a byte range outside the object was requested
+	ErrInvalidRange = errors.New("invalid byte range")
+	// ErrUnknownBackend indicates an unsupported storage backend was configured
+	ErrUnknownBackend = errors.New("unknown storage backend")
+)
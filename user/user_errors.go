@@ -0,0 +1,16 @@
+package user
+
+import "errors"
+
+var (
+	// ErrUserNotFound indicates the requested user was not found
+	ErrUserNotFound = errors.New("user not found")
+	// ErrUsernameTaken indicates a new account with a username already in use
+	ErrUsernameTaken = errors.New("username is already taken")
+	// ErrInvalidUser indicates a malformed username or a password of the wrong length
+	ErrInvalidUser = errors.New("invalid user")
+	// ErrInvalidCredentials indicates a login with an unknown username or a wrong password
+	ErrInvalidCredentials = errors.New("wrong username or password")
+	// ErrSessionNotFound indicates a session token that is unknown, logged out or expired
+	ErrSessionNotFound = errors.New("session not found")
+)
@@ -0,0 +1,242 @@
+package user
+
+import (
+	"bytes"
+	"errors"
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"file-pub/internal/common"
+)
+
+const (
+	// sessionCookieName is the cookie holding the session token
+	sessionCookieName = "session"
+	// maxFormBodySize caps the login and signup form bodies
+	maxFormBodySize = 64 << 10
+)
+
+// UserHandler handles login, logout and signup, and provides the middleware
+// that signs requests in
+type UserHandler struct {
+	userService UserService
+	templates   *template.Template
+	config      Config
+}
+
+// NewUserHandler creates a new UserHandler
+func NewUserHandler(
+	userService UserService,
+	templates *template.Template,
+	config Config,
+) *UserHandler {
+	common.PanicOnInvalidDependencies("UserHandler", map[string]interface{}{
+		"userService": userService,
+		"templates":   templates,
+	})
+
+	return &UserHandler{
+		userService: userService,
+		templates:   templates,
+		config:      config,
+	}
+}
+
+// HandleLogin shows the login form on GET and signs in on POST, then
+// redirects to the page given in next
+func (handler *UserHandler) HandleLogin(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		handler.renderAccountForm(w, http.StatusOK, false, "", r.URL.Query().Get("next"), "")
+	case http.MethodPost:
+		r.Body = http.MaxBytesReader(w, r.Body, maxFormBodySize)
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, "Invalid form", http.StatusBadRequest)
+			return
+		}
+
+		username, next := r.PostFormValue("username"), r.PostFormValue("next")
+		session, err := handler.userService.Login(r.Context(), username, r.PostFormValue("password"))
+		if err != nil {
+			if errors.Is(err, ErrInvalidCredentials) {
+				handler.renderAccountForm(w, http.StatusUnauthorized, false, username, next, err.Error())
+				return
+			}
+			log.Printf("Error logging in %q: %v", username, err)
+			http.Error(w, "Failed to log in", http.StatusInternalServerError)
+			return
+		}
+
+		handler.setSessionCookie(w, r, session)
+		http.Redirect(w, r, localRedirect(next), http.StatusSeeOther)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// HandleSignup shows the signup form on GET and creates an account and
+// signs it in on POST. It is only served when Config.AllowSignup is set.
+func (handler *UserHandler) HandleSignup(w http.ResponseWriter, r *http.Request) {
+	if !handler.config.AllowSignup {
+		http.NotFound(w, r)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		handler.renderAccountForm(w, http.StatusOK, true, "", r.URL.Query().Get("next"), "")
+	case http.MethodPost:
+		r.Body = http.MaxBytesReader(w, r.Body, maxFormBodySize)
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, "Invalid form", http.StatusBadRequest)
+			return
+		}
+
+		username, password, next := r.PostFormValue("username"), r.PostFormValue("password"), r.PostFormValue("next")
+		if _, err := handler.userService.CreateUser(r.Context(), username, password); err != nil {
+			switch {
+			case errors.Is(err, ErrInvalidUser):
+				handler.renderAccountForm(w, http.StatusBadRequest, true, username, next, err.Error())
+			case errors.Is(err, ErrUsernameTaken):
+				handler.renderAccountForm(w, http.StatusConflict, true, username, next, err.Error())
+			default:
+				log.Printf("Error creating user %q: %v", username, err)
+				http.Error(w, "Failed to create account", http.StatusInternalServerError)
+			}
+			return
+		}
+
+		session, err := handler.userService.Login(r.Context(), username, password)
+		if err != nil {
+			log.Printf("Error logging in new user %q: %v", username, err)
+			http.Error(w, "Failed to log in", http.StatusInternalServerError)
+			return
+		}
+
+		handler.setSessionCookie(w, r, session)
+		http.Redirect(w, r, localRedirect(next), http.StatusSeeOther)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// HandleLogout ends the session on POST and redirects to the home page
+func (handler *UserHandler) HandleLogout(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if cookie, err := r.Cookie(sessionCookieName); err == nil {
+		if err := handler.userService.Logout(r.Context(), cookie.Value); err != nil {
+			log.Printf("Error logging out: %v", err)
+			http.Error(w, "Failed to log out", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookieName,
+		Path:     "/",
+		MaxAge:   -1,
+		Secure:   handler.config.SecureCookies || r.TLS != nil,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+// Authenticate attaches the user signed in by the session cookie to each
+// request's context, where common.IdentityFromContext finds it. Requests
+// without a valid session continue anonymously.
+func (handler *UserHandler) Authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if cookie, err := r.Cookie(sessionCookieName); err == nil {
+			user, err := handler.userService.Authenticate(r.Context(), cookie.Value)
+			switch {
+			case err == nil:
+				r = r.WithContext(common.WithIdentity(r.Context(), common.Identity{ID: user.ID, Username: user.Username}))
+			case !errors.Is(err, ErrSessionNotFound):
+				log.Printf("Error authenticating session: %v", err)
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// RequireUser serves next only to signed-in requests, or to everyone when
+// Config.AnonymousAccess is set. Other page views are redirected to the
+// login form; API and form requests get 401.
+func (handler *UserHandler) RequireUser(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := common.IdentityFromContext(r.Context()); ok || handler.config.AnonymousAccess {
+			next(w, r)
+			return
+		}
+
+		switch {
+		case strings.HasPrefix(r.URL.Path, "/api/"):
+			common.WriteJSONError(w, http.StatusUnauthorized, "unauthorized", "Sign in to use the API")
+		case r.Method == http.MethodGet || r.Method == http.MethodHead:
+			http.Redirect(w, r, "/login?next="+url.QueryEscape(r.URL.RequestURI()), http.StatusSeeOther)
+		default:
+			http.Error(w, "Sign in required", http.StatusUnauthorized)
+		}
+	}
+}
+
+// setSessionCookie stores a new session's token in the browser until the
+// session expires
+func (handler *UserHandler) setSessionCookie(w http.ResponseWriter, r *http.Request, session *Session) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookieName,
+		Value:    session.Token,
+		Path:     "/",
+		Expires:  session.ExpiresAt,
+		Secure:   handler.config.SecureCookies || r.TLS != nil,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// renderAccountForm renders the login or signup form with an optional error message
+func (handler *UserHandler) renderAccountForm(w http.ResponseWriter, status int, signup bool, username, next, message string) {
+	data := struct {
+		Signup      bool
+		AllowSignup bool
+		Username    string
+		Next        string
+		Error       string
+	}{
+		Signup:      signup,
+		AllowSignup: handler.config.AllowSignup,
+		Username:    username,
+		Next:        localRedirect(next),
+		Error:       message,
+	}
+
+	var page bytes.Buffer
+	if err := handler.templates.ExecuteTemplate(&page, "login.html", data); err != nil {
+		log.Printf("Template error: %v", err)
+		http.Error(w, "Failed to render page", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	page.WriteTo(w)
+}
+
+// localRedirect returns next when it is a path on this site, and the home
+// page otherwise, so login links cannot send users elsewhere
+func localRedirect(next string) string {
+	if !strings.HasPrefix(next, "/") || strings.HasPrefix(next, "//") || strings.HasPrefix(next, "/\\") {
+		return "/"
+	}
+	return next
+}
@@ -0,0 +1,198 @@
+package user
+
+import (
+	"context"
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"file-pub/internal/common"
+)
+
+// newTestHandler builds a UserHandler over an in-memory repository using
+// the real page templates
+func newTestHandler(t *testing.T, config Config) (*UserHandler, UserService) {
+	t.Helper()
+
+	templates, err := template.ParseGlob("../templates/*.html")
+	if err != nil {
+		t.Fatalf("parsing templates: %v", err)
+	}
+
+	userService := NewUserService(NewMemoryUserRepository(), config)
+	return NewUserHandler(userService, templates, config), userService
+}
+
+// postForm sends a form POST to handle
+func postForm(handle http.HandlerFunc, target string, form url.Values) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodPost, target, strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	handle(w, r)
+	return w
+}
+
+// whoAmI runs a request with cookie through the Authenticate middleware and
+// returns the username it signed in, or "" for anonymous requests
+func whoAmI(handler *UserHandler, cookie *http.Cookie) string {
+	var username string
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if identity, ok := common.IdentityFromContext(r.Context()); ok {
+			username = identity.Username
+		}
+	})
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	if cookie != nil {
+		r.AddCookie(cookie)
+	}
+	handler.Authenticate(next).ServeHTTP(httptest.NewRecorder(), r)
+	return username
+}
+
+// sessionCookie returns the session cookie set by a response
+func sessionCookie(t *testing.T, w *httptest.ResponseRecorder) *http.Cookie {
+	t.Helper()
+
+	for _, cookie := range w.Result().Cookies() {
+		if cookie.Name == sessionCookieName {
+			return cookie
+		}
+	}
+	t.Fatalf("no %s cookie in response", sessionCookieName)
+	return nil
+}
+
+func TestLoginAndLogout(t *testing.T) {
+	handler, userService := newTestHandler(t, DefaultConfig())
+	if _, err := userService.CreateUser(context.Background(), "Alice", "correct horse"); err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+
+	w := httptest.NewRecorder()
+	handler.HandleLogin(w, httptest.NewRequest(http.MethodGet, "/login?next=%2Fimage%2Fabc%2Fedit", nil))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `value="/image/abc/edit"`) {
+		t.Fatalf("login form: status = %d, body missing next", w.Code)
+	}
+
+	w = postForm(handler.HandleLogin, "/login", url.Values{"username": {"alice"}, "password": {"wrong password"}})
+	if w.Code != http.StatusUnauthorized || !strings.Contains(w.Body.String(), "wrong username or password") {
+		t.Fatalf("wrong password: status = %d, want 401 with message", w.Code)
+	}
+	w = postForm(handler.HandleLogin, "/login", url.Values{"username": {"nobody"}, "password": {"correct horse"}})
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("unknown user: status = %d, want 401", w.Code)
+	}
+
+	// Usernames are case-insensitive, and next may not leave the site
+	w = postForm(handler.HandleLogin, "/login", url.Values{"username": {"ALICE"}, "password": {"correct horse"}, "next": {"//evil.example/"}})
+	if w.Code != http.StatusSeeOther || w.Header().Get("Location") != "/" {
+		t.Fatalf("login: status = %d, location = %q, want 303 to /", w.Code, w.Header().Get("Location"))
+	}
+	cookie := sessionCookie(t, w)
+	if !cookie.HttpOnly || cookie.SameSite != http.SameSiteLaxMode || cookie.Path != "/" {
+		t.Errorf("cookie = %+v, want HttpOnly, SameSite=Lax and Path=/", cookie)
+	}
+	if got := whoAmI(handler, cookie); got != "alice" {
+		t.Fatalf("signed in as %q, want alice", got)
+	}
+
+	r := httptest.NewRequest(http.MethodPost, "/logout", nil)
+	r.AddCookie(cookie)
+	w = httptest.NewRecorder()
+	handler.HandleLogout(w, r)
+	if w.Code != http.StatusSeeOther || sessionCookie(t, w).MaxAge >= 0 {
+		t.Fatalf("logout: status = %d, want 303 clearing the cookie", w.Code)
+	}
+	if got := whoAmI(handler, cookie); got != "" {
+		t.Errorf("after logout signed in as %q, want anonymous", got)
+	}
+	if got := whoAmI(handler, &http.Cookie{Name: sessionCookieName, Value: "forged"}); got != "" {
+		t.Errorf("forged cookie signed in as %q, want anonymous", got)
+	}
+}
+
+func TestSignup(t *testing.T) {
+	handler, _ := newTestHandler(t, DefaultConfig())
+	w := postForm(handler.HandleSignup, "/signup", url.Values{"username": {"bob"}, "password": {"hunter2hunter2"}})
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("signup disabled: status = %d, want 404", w.Code)
+	}
+
+	config := DefaultConfig()
+	config.AllowSignup = true
+	handler, _ = newTestHandler(t, config)
+
+	tests := []struct {
+		name     string
+		username string
+		password string
+		want     int
+	}{
+		{"Created", "bob", "hunter2hunter2", http.StatusSeeOther},
+		{"Taken", "BOB", "hunter2hunter2", http.StatusConflict},
+		{"ShortPassword", "carol", "short", http.StatusBadRequest},
+		{"BadUsername", "carol smith", "hunter2hunter2", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := postForm(handler.HandleSignup, "/signup", url.Values{"username": {tt.username}, "password": {tt.password}, "next": {"/?mine=true"}})
+			if w.Code != tt.want {
+				t.Fatalf("status = %d, want %d", w.Code, tt.want)
+			}
+			if tt.want == http.StatusSeeOther {
+				if location := w.Header().Get("Location"); location != "/?mine=true" {
+					t.Errorf("location = %q, want /?mine=true", location)
+				}
+				if got := whoAmI(handler, sessionCookie(t, w)); got != tt.username {
+					t.Errorf("signed in as %q, want %s", got, tt.username)
+				}
+			}
+		})
+	}
+}
+
+func TestRequireUser(t *testing.T) {
+	ok := func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusNoContent) }
+
+	tests := []struct {
+		name      string
+		anonymous bool
+		signedIn  bool
+		method    string
+		target    string
+		want      int
+	}{
+		{"SignedIn", false, true, http.MethodPost, "/upload", http.StatusNoContent},
+		{"AnonymousAccess", true, false, http.MethodPost, "/upload", http.StatusNoContent},
+		{"Page", false, false, http.MethodGet, "/?tag=cats", http.StatusSeeOther},
+		{"Form", false, false, http.MethodPost, "/upload", http.StatusUnauthorized},
+		{"API", false, false, http.MethodGet, "/api/v1/images", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := DefaultConfig()
+			config.AnonymousAccess = tt.anonymous
+			handler, _ := newTestHandler(t, config)
+
+			r := httptest.NewRequest(tt.method, tt.target, nil)
+			if tt.signedIn {
+				r = r.WithContext(common.WithIdentity(r.Context(), common.Identity{ID: "u1", Username: "alice"}))
+			}
+			w := httptest.NewRecorder()
+			handler.RequireUser(ok)(w, r)
+
+			if w.Code != tt.want {
+				t.Fatalf("status = %d, want %d", w.Code, tt.want)
+			}
+			if tt.want == http.StatusSeeOther {
+				if location := w.Header().Get("Location"); location != "/login?next=%2F%3Ftag%3Dcats" {
+					t.Errorf("location = %q, want the login form returning to %s", location, tt.target)
+				}
+			}
+		})
+	}
+}
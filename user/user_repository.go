@@ -0,0 +1,167 @@
+package user
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"file-pub/internal/common"
+	"file-pub/internal/database"
+)
+
+// UserRepository defines the interface for user and session data access
+type UserRepository interface {
+	SaveUser(ctx context.Context, user User) error
+	GetUserByID(ctx context.Context, id string) (*User, error)
+	GetUserByUsername(ctx context.Context, username string) (*User, error)
+	SaveSession(ctx context.Context, session Session) error
+	GetSessionUser(ctx context.Context, sessionID string, now time.Time) (*User, error)
+	DeleteSession(ctx context.Context, sessionID string) error
+	DeleteExpiredSessions(ctx context.Context, now time.Time) error
+}
+
+// userColumns lists the users columns in the order scanUser expects
+const userColumns = "id, username, password_hash, created_at"
+
+// rowScanner is implemented by *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// userRepository implements UserRepository on MySQL, PostgreSQL or SQLite.
+// Queries are written with "?" placeholders and rebound for the driver.
+type userRepository struct {
+	db     *sql.DB
+	driver string
+}
+
+// NewUserRepository creates a new UserRepository for a database opened with
+// one of the database.Driver* drivers and migrated to the current schema
+func NewUserRepository(db *sql.DB, driver string) UserRepository {
+	common.RequireNonNil(db, "db")
+	if err := database.ValidateDriver(driver); err != nil {
+		panic(err.Error())
+	}
+
+	return &userRepository{
+		db:     db,
+		driver: driver,
+	}
+}
+
+// rebind adapts a query's placeholders to the repository's driver
+func (repo *userRepository) rebind(query string) string {
+	return database.Rebind(repo.driver, query)
+}
+
+// SaveUser saves a new user, returning ErrUsernameTaken when the username is in use
+func (repo *userRepository) SaveUser(ctx context.Context, user User) error {
+	query := `
+		INSERT INTO users (` + userColumns + `)
+		VALUES (?, ?, ?, ?)
+	`
+
+	_, err := repo.db.ExecContext(ctx, repo.rebind(query), user.ID, user.Username, user.PasswordHash, user.CreatedAt.UTC())
+	if err != nil {
+		// Unique violations differ per driver, so look for the clashing user
+		if _, lookupErr := repo.GetUserByUsername(ctx, user.Username); lookupErr == nil {
+			return ErrUsernameTaken
+		}
+		return common.WrapDatabaseError("insert user", err)
+	}
+
+	return nil
+}
+
+// GetUserByID retrieves a user by ID
+func (repo *userRepository) GetUserByID(ctx context.Context, id string) (*User, error) {
+	return repo.getUser(ctx, "id", id)
+}
+
+// GetUserByUsername retrieves a user by username
+func (repo *userRepository) GetUserByUsername(ctx context.Context, username string) (*User, error) {
+	return repo.getUser(ctx, "username", username)
+}
+
+// getUser retrieves the user whose column equals value
+func (repo *userRepository) getUser(ctx context.Context, column, value string) (*User, error) {
+	query := `
+		SELECT ` + userColumns + `
+		FROM users
+		WHERE ` + column + ` = ?
+	`
+
+	user, err := scanUser(repo.db.QueryRowContext(ctx, repo.rebind(query), value))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrUserNotFound
+		}
+		return nil, common.WrapDatabaseError(fmt.Sprintf("query user %s", value), err)
+	}
+
+	return user, nil
+}
+
+// SaveSession records a new session
+func (repo *userRepository) SaveSession(ctx context.Context, session Session) error {
+	query := `
+		INSERT INTO sessions (id, user_id, created_at, expires_at)
+		VALUES (?, ?, ?, ?)
+	`
+
+	_, err := repo.db.ExecContext(ctx, repo.rebind(query), session.ID, session.UserID, session.CreatedAt.UTC(), session.ExpiresAt.UTC())
+	if err != nil {
+		return common.WrapDatabaseError("insert session", err)
+	}
+
+	return nil
+}
+
+// GetSessionUser retrieves the user signed in by a session that has not
+// expired at now
+func (repo *userRepository) GetSessionUser(ctx context.Context, sessionID string, now time.Time) (*User, error) {
+	query := `
+		SELECT u.id, u.username, u.password_hash, u.created_at
+		FROM sessions s
+		JOIN users u ON u.id = s.user_id
+		WHERE s.id = ? AND s.expires_at > ?
+	`
+
+	user, err := scanUser(repo.db.QueryRowContext(ctx, repo.rebind(query), sessionID, now.UTC()))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrSessionNotFound
+		}
+		return nil, common.WrapDatabaseError("query session user", err)
+	}
+
+	return user, nil
+}
+
+// DeleteSession removes a session; removing one that does not exist is not an error
+func (repo *userRepository) DeleteSession(ctx context.Context, sessionID string) error {
+	if _, err := repo.db.ExecContext(ctx, repo.rebind("DELETE FROM sessions WHERE id = ?"), sessionID); err != nil {
+		return common.WrapDatabaseError("delete session", err)
+	}
+	return nil
+}
+
+// DeleteExpiredSessions removes every session that has expired at now
+func (repo *userRepository) DeleteExpiredSessions(ctx context.Context, now time.Time) error {
+	if _, err := repo.db.ExecContext(ctx, repo.rebind("DELETE FROM sessions WHERE expires_at <= ?"), now.UTC()); err != nil {
+		return common.WrapDatabaseError("delete expired sessions", err)
+	}
+	return nil
+}
+
+// scanUser scans a row selected with userColumns into a User
+func scanUser(row rowScanner) (*User, error) {
+	var user User
+	if err := row.Scan(&user.ID, &user.Username, &user.PasswordHash, &user.CreatedAt); err != nil {
+		return nil, err
+	}
+	user.CreatedAt = user.CreatedAt.UTC()
+	return &user, nil
+}
@@ -0,0 +1,119 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"file-pub/internal/database/dbtest"
+)
+
+// testRepositoryConformance runs the behaviour every UserRepository
+// implementation must share. newRepo must return an empty repository.
+func testRepositoryConformance(t *testing.T, newRepo func(t *testing.T) UserRepository) {
+	t.Run("SaveAndGetUser", func(t *testing.T) {
+		repo := newRepo(t)
+		ctx := context.Background()
+
+		want := testUser("u1", "alice")
+		if err := repo.SaveUser(ctx, want); err != nil {
+			t.Fatalf("SaveUser: %v", err)
+		}
+
+		byID, err := repo.GetUserByID(ctx, "u1")
+		if err != nil {
+			t.Fatalf("GetUserByID: %v", err)
+		}
+		assertUser(t, *byID, want)
+
+		byName, err := repo.GetUserByUsername(ctx, "alice")
+		if err != nil {
+			t.Fatalf("GetUserByUsername: %v", err)
+		}
+		assertUser(t, *byName, want)
+
+		if _, err := repo.GetUserByUsername(ctx, "bob"); !errors.Is(err, ErrUserNotFound) {
+			t.Errorf("GetUserByUsername(bob) err = %v, want ErrUserNotFound", err)
+		}
+	})
+
+	t.Run("UsernameTaken", func(t *testing.T) {
+		repo := newRepo(t)
+		ctx := context.Background()
+
+		if err := repo.SaveUser(ctx, testUser("u1", "alice")); err != nil {
+			t.Fatalf("SaveUser: %v", err)
+		}
+		if err := repo.SaveUser(ctx, testUser("u2", "alice")); !errors.Is(err, ErrUsernameTaken) {
+			t.Fatalf("SaveUser duplicate err = %v, want ErrUsernameTaken", err)
+		}
+	})
+
+	t.Run("Sessions", func(t *testing.T) {
+		repo := newRepo(t)
+		ctx := context.Background()
+		now := dbtest.Time(0)
+
+		user := testUser("u1", "alice")
+		if err := repo.SaveUser(ctx, user); err != nil {
+			t.Fatalf("SaveUser: %v", err)
+		}
+		for id, expiresAt := range map[string]time.Time{"live": now.Add(time.Hour), "stale": now.Add(-time.Hour)} {
+			session := Session{ID: id, UserID: "u1", CreatedAt: now.Add(-2 * time.Hour), ExpiresAt: expiresAt}
+			if err := repo.SaveSession(ctx, session); err != nil {
+				t.Fatalf("SaveSession %s: %v", id, err)
+			}
+		}
+
+		got, err := repo.GetSessionUser(ctx, "live", now)
+		if err != nil {
+			t.Fatalf("GetSessionUser: %v", err)
+		}
+		assertUser(t, *got, user)
+
+		if _, err := repo.GetSessionUser(ctx, "stale", now); !errors.Is(err, ErrSessionNotFound) {
+			t.Errorf("expired session err = %v, want ErrSessionNotFound", err)
+		}
+		if _, err := repo.GetSessionUser(ctx, "missing", now); !errors.Is(err, ErrSessionNotFound) {
+			t.Errorf("missing session err = %v, want ErrSessionNotFound", err)
+		}
+
+		// The live session outlasts the clean-up until it expires too
+		if err := repo.DeleteExpiredSessions(ctx, now); err != nil {
+			t.Fatalf("DeleteExpiredSessions: %v", err)
+		}
+		if _, err := repo.GetSessionUser(ctx, "live", now); err != nil {
+			t.Errorf("live session after clean-up: %v", err)
+		}
+
+		if err := repo.DeleteSession(ctx, "live"); err != nil {
+			t.Fatalf("DeleteSession: %v", err)
+		}
+		if _, err := repo.GetSessionUser(ctx, "live", now); !errors.Is(err, ErrSessionNotFound) {
+			t.Errorf("deleted session err = %v, want ErrSessionNotFound", err)
+		}
+		if err := repo.DeleteSession(ctx, "live"); err != nil {
+			t.Errorf("DeleteSession twice: %v", err)
+		}
+	})
+}
+
+// testUser returns a user with a placeholder password hash
+func testUser(id, username string) User {
+	return User{
+		ID:           id,
+		Username:     username,
+		PasswordHash: "$2a$10$placeholder",
+		CreatedAt:    dbtest.Time(0),
+	}
+}
+
+// assertUser compares users field by field
+func assertUser(t *testing.T, got, want User) {
+	t.Helper()
+
+	if got.ID != want.ID || got.Username != want.Username || got.PasswordHash != want.PasswordHash || !got.CreatedAt.Equal(want.CreatedAt) {
+		t.Errorf("user = %+v, want %+v", got, want)
+	}
+}
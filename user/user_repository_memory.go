@@ -0,0 +1,121 @@
+package user
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// memoryUserRepository implements UserRepository in process memory
+type memoryUserRepository struct {
+	mu       sync.RWMutex
+	users    map[string]User
+	sessions map[string]Session
+}
+
+// NewMemoryUserRepository creates a new UserRepository that keeps users and
+// sessions in memory, for tests and development. They are lost when the
+// process exits.
+func NewMemoryUserRepository() UserRepository {
+	return &memoryUserRepository{
+		users:    make(map[string]User),
+		sessions: make(map[string]Session),
+	}
+}
+
+// SaveUser saves a new user, returning ErrUsernameTaken when the username is in use
+func (repo *memoryUserRepository) SaveUser(ctx context.Context, user User) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	if _, exists := repo.users[user.ID]; exists {
+		return fmt.Errorf("memory insert user %s: duplicate id", user.ID)
+	}
+	for _, existing := range repo.users {
+		if existing.Username == user.Username {
+			return ErrUsernameTaken
+		}
+	}
+	repo.users[user.ID] = user
+
+	return nil
+}
+
+// GetUserByID retrieves a copy of a user by ID
+func (repo *memoryUserRepository) GetUserByID(ctx context.Context, id string) (*User, error) {
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+
+	user, ok := repo.users[id]
+	if !ok {
+		return nil, ErrUserNotFound
+	}
+	return &user, nil
+}
+
+// GetUserByUsername retrieves a copy of a user by username
+func (repo *memoryUserRepository) GetUserByUsername(ctx context.Context, username string) (*User, error) {
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+
+	for _, user := range repo.users {
+		if user.Username == username {
+			return &user, nil
+		}
+	}
+	return nil, ErrUserNotFound
+}
+
+// SaveSession records a new session
+func (repo *memoryUserRepository) SaveSession(ctx context.Context, session Session) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	if _, exists := repo.users[session.UserID]; !exists {
+		return fmt.Errorf("memory insert session: %w", ErrUserNotFound)
+	}
+	session.Token = ""
+	repo.sessions[session.ID] = session
+
+	return nil
+}
+
+// GetSessionUser retrieves the user signed in by a session that has not
+// expired at now
+func (repo *memoryUserRepository) GetSessionUser(ctx context.Context, sessionID string, now time.Time) (*User, error) {
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+
+	session, ok := repo.sessions[sessionID]
+	if !ok || !session.ExpiresAt.After(now) {
+		return nil, ErrSessionNotFound
+	}
+	user, ok := repo.users[session.UserID]
+	if !ok {
+		return nil, ErrSessionNotFound
+	}
+	return &user, nil
+}
+
+// DeleteSession removes a session; removing one that does not exist is not an error
+func (repo *memoryUserRepository) DeleteSession(ctx context.Context, sessionID string) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	delete(repo.sessions, sessionID)
+	return nil
+}
+
+// DeleteExpiredSessions removes every session that has expired at now
+func (repo *memoryUserRepository) DeleteExpiredSessions(ctx context.Context, now time.Time) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	for id, session := range repo.sessions {
+		if !session.ExpiresAt.After(now) {
+			delete(repo.sessions, id)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,24 @@
+package user
+
+import (
+	"testing"
+
+	"file-pub/internal/database/dbtest"
+)
+
+func TestMemoryUserRepository(t *testing.T) {
+	testRepositoryConformance(t, func(t *testing.T) UserRepository {
+		return NewMemoryUserRepository()
+	})
+}
+
+func TestSQLUserRepository(t *testing.T) {
+	for _, driver := range dbtest.Drivers {
+		t.Run(driver, func(t *testing.T) {
+			dbtest.SkipUnavailable(t, driver)
+			testRepositoryConformance(t, func(t *testing.T) UserRepository {
+				return NewUserRepository(dbtest.Open(t, driver, "sessions", "users"), driver)
+			})
+		})
+	}
+}
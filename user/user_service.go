@@ -0,0 +1,171 @@
+package user
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"file-pub/internal/common"
+
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// UserService defines the interface for accounts and login sessions
+type UserService interface {
+	CreateUser(ctx context.Context, username, password string) (*User, error)
+	Login(ctx context.Context, username, password string) (*Session, error)
+	Logout(ctx context.Context, token string) error
+	Authenticate(ctx context.Context, token string) (*User, error)
+}
+
+// userService implements UserService
+type userService struct {
+	userRepo UserRepository
+	config   Config
+	// unknownUserHash is compared against on logins with an unknown
+	// username, so they take as long as logins with a wrong password
+	unknownUserHash []byte
+}
+
+// NewUserService creates a new UserService
+func NewUserService(
+	userRepo UserRepository,
+	config Config,
+) UserService {
+	common.PanicOnInvalidDependencies("UserService", map[string]interface{}{
+		"userRepo": userRepo,
+	})
+
+	if config.SessionDuration <= 0 {
+		panic("UserService: SessionDuration must be positive")
+	}
+
+	unknownUserHash, err := bcrypt.GenerateFromPassword([]byte("unknown user"), bcrypt.DefaultCost)
+	if err != nil {
+		panic(fmt.Sprintf("UserService: hashing placeholder password: %v", err))
+	}
+
+	return &userService{
+		userRepo:        userRepo,
+		config:          config,
+		unknownUserHash: unknownUserHash,
+	}
+}
+
+// CreateUser creates an account. Usernames are case-insensitive and stored
+// in lower case.
+func (service *userService) CreateUser(ctx context.Context, username, password string) (*User, error) {
+	username, err := normalizeUsername(username)
+	if err != nil {
+		return nil, err
+	}
+	if len(password) < minPasswordLength || len(password) > maxPasswordLength {
+		return nil, fmt.Errorf("%w: password must be %d to %d bytes", ErrInvalidUser, minPasswordLength, maxPasswordLength)
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, fmt.Errorf("hashing password: %w", err)
+	}
+
+	user := User{
+		ID:           uuid.New().String(),
+		Username:     username,
+		PasswordHash: string(hash),
+		CreatedAt:    time.Now().UTC().Truncate(time.Second),
+	}
+	if err := service.userRepo.SaveUser(ctx, user); err != nil {
+		if errors.Is(err, ErrUsernameTaken) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("saving user: %w", err)
+	}
+
+	return &user, nil
+}
+
+// Login checks a username and password and starts a session. The returned
+// session carries the token for the session cookie.
+func (service *userService) Login(ctx context.Context, username, password string) (*Session, error) {
+	user, err := service.userRepo.GetUserByUsername(ctx, strings.ToLower(strings.TrimSpace(username)))
+	if err != nil && !errors.Is(err, ErrUserNotFound) {
+		return nil, fmt.Errorf("getting user: %w", err)
+	}
+	if user == nil {
+		bcrypt.CompareHashAndPassword(service.unknownUserHash, []byte(password))
+		return nil, ErrInvalidCredentials
+	}
+	if bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)) != nil {
+		return nil, ErrInvalidCredentials
+	}
+
+	// Sessions nobody logged out of would otherwise pile up
+	now := time.Now()
+	if err := service.userRepo.DeleteExpiredSessions(ctx, now); err != nil {
+		log.Printf("Failed to delete expired sessions: %v", err)
+	}
+
+	token := make([]byte, sessionTokenBytes)
+	if _, err := rand.Read(token); err != nil {
+		return nil, fmt.Errorf("generating session token: %w", err)
+	}
+	session := Session{
+		Token:     base64.RawURLEncoding.EncodeToString(token),
+		UserID:    user.ID,
+		CreatedAt: now,
+		ExpiresAt: now.Add(service.config.SessionDuration),
+	}
+	session.ID = sessionID(session.Token)
+
+	if err := service.userRepo.SaveSession(ctx, session); err != nil {
+		return nil, fmt.Errorf("saving session: %w", err)
+	}
+
+	return &session, nil
+}
+
+// Logout ends the session with the given token
+func (service *userService) Logout(ctx context.Context, token string) error {
+	if err := service.userRepo.DeleteSession(ctx, sessionID(token)); err != nil {
+		return fmt.Errorf("deleting session: %w", err)
+	}
+	return nil
+}
+
+// Authenticate returns the user signed in by a session token
+func (service *userService) Authenticate(ctx context.Context, token string) (*User, error) {
+	if token == "" {
+		return nil, ErrSessionNotFound
+	}
+	return service.userRepo.GetSessionUser(ctx, sessionID(token), time.Now())
+}
+
+// normalizeUsername lower-cases a username and checks it is 3 to 32
+// letters, digits, dots, dashes or underscores
+func normalizeUsername(username string) (string, error) {
+	username = strings.ToLower(strings.TrimSpace(username))
+	if length := utf8.RuneCountInString(username); length < minUsernameLength || length > maxUsernameLength {
+		return "", fmt.Errorf("%w: username must be %d to %d characters", ErrInvalidUser, minUsernameLength, maxUsernameLength)
+	}
+	for _, r := range username {
+		if !(r >= 'a' && r <= 'z') && !(r >= '0' && r <= '9') && r != '.' && r != '-' && r != '_' {
+			return "", fmt.Errorf("%w: username may only contain letters, digits, dots, dashes and underscores", ErrInvalidUser)
+		}
+	}
+	return username, nil
+}
+
+// sessionID is the stored ID of the session with a token
+func sessionID(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
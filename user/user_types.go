@@ -0,0 +1,55 @@
+package user
+
+import "time"
+
+const (
+	// minUsernameLength and maxUsernameLength bound usernames, in characters
+	minUsernameLength = 3
+	maxUsernameLength = 32
+	// minPasswordLength is the shortest password accepted, in bytes
+	minPasswordLength = 8
+	// maxPasswordLength is the longest password bcrypt accepts, in bytes
+	maxPasswordLength = 72
+	// sessionTokenBytes is the length of the random session token
+	sessionTokenBytes = 32
+)
+
+// User is an account that signs in with a username and password
+type User struct {
+	ID           string    `json:"id" db:"id"`
+	Username     string    `json:"username" db:"username"`
+	PasswordHash string    `json:"-" db:"password_hash"`
+	CreatedAt    time.Time `json:"created_at" db:"created_at"`
+}
+
+// Session is a signed-in browser. Only the SHA-256 of its token is stored,
+// as the ID, so the sessions table cannot be used to sign in.
+type Session struct {
+	ID        string    `json:"-" db:"id"`
+	UserID    string    `json:"user_id" db:"user_id"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+	ExpiresAt time.Time `json:"expires_at" db:"expires_at"`
+	// Token is kept in the session cookie; it is only known when the session is created
+	Token string `json:"-" db:"-"`
+}
+
+// Config holds the account and session settings
+type Config struct {
+	// SessionDuration is how long a login lasts
+	SessionDuration time.Duration
+	// AnonymousAccess lets visitors who are not signed in browse and upload
+	// as they could before accounts existed
+	AnonymousAccess bool
+	// AllowSignup lets visitors create their own accounts at /signup
+	AllowSignup bool
+	// SecureCookies marks the session cookie Secure even when the request
+	// reached the application over plain HTTP, as behind a TLS proxy
+	SecureCookies bool
+}
+
+// DefaultConfig returns the default account settings
+func DefaultConfig() Config {
+	return Config{
+		SessionDuration: 7 * 24 * time.Hour,
+	}
+}
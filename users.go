@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"file-pub/album"
+	"file-pub/image"
+	"file-pub/user"
+)
+
+const userUsage = "usage: file-pub user add <username> (reads the password from stdin)\n" +
+	"       file-pub user claim <username> (gives the user every image and album without an owner)"
+
+// runUser implements the "user" subcommand, which creates accounts when
+// signup through the web form is disabled and hands images and albums from
+// before accounts existed to an account
+func runUser(config Config, args []string) error {
+	if len(args) != 2 || (args[0] != "add" && args[0] != "claim") {
+		return errors.New(userUsage)
+	}
+
+	var password string
+	if args[0] == "add" {
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && line == "" {
+			return fmt.Errorf("reading password: %w", err)
+		}
+		password = strings.TrimRight(line, "\r\n")
+	}
+
+	db, err := openDatabase(config)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	if config.AutoMigrate {
+		if err := migrateUp(db, config.DBDriver); err != nil {
+			return fmt.Errorf("failed to migrate database: %w", err)
+		}
+	}
+
+	if args[0] == "claim" {
+		return claimUnowned(db, config, args[1])
+	}
+
+	userService := user.NewUserService(user.NewUserRepository(db, config.DBDriver), config.User)
+	created, err := userService.CreateUser(context.Background(), args[1], password)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Created user %s (%s)", created.Username, created.ID)
+	return nil
+}
+
+// claimUnowned gives the user every image and album without an owner, so
+// they can be changed again without anonymous access
+func claimUnowned(db *sql.DB, config Config, username string) error {
+	ctx := context.Background()
+	owner, err := user.NewUserRepository(db, config.DBDriver).GetUserByUsername(ctx, strings.ToLower(strings.TrimSpace(username)))
+	if err != nil {
+		return err
+	}
+
+	images, err := image.NewImageRepository(db, config.DBDriver).ClaimUnownedImages(ctx, owner.ID)
+	if err != nil {
+		return err
+	}
+	albums, err := album.NewAlbumRepository(db, config.DBDriver).ClaimUnownedAlbums(ctx, owner.ID)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Gave %d images and %d albums without an owner to %s", images, albums, owner.Username)
+	return nil
+}